@@ -1,17 +1,19 @@
 package aof
 
 import (
+	"fmt"
 	"go-redis/config"
 	databaseface "go-redis/interface/database"
 	"go-redis/lib/logger"
 	"go-redis/lib/utils"
 	"go-redis/resp/connection"
-	"go-redis/resp/parser"
 	"go-redis/resp/reply"
-	"io"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 // CmdLine is alias for [][]byte, represents a command line
@@ -21,81 +23,272 @@ const (
 	aofQueueSize = 1 << 16
 )
 
+const (
+	// FsyncAlways do fsync for every command
+	FsyncAlways = "always"
+	// FsyncEverySec do fsync every second
+	FsyncEverySec = "everysec"
+	// FsyncNo lets operating system decides when to do fsync
+	FsyncNo = "no"
+)
+
 type payload struct {
 	cmdLine CmdLine
+	// tx is not nil when the payload is a transaction, its lines are wrapped in MULTI/EXEC
+	tx      []CmdLine
 	dbIndex int
+	// wg is not nil when appendfsync is always, the caller waits until the payload is written and synced
+	wg *sync.WaitGroup
 }
 
 // AofHandler receive msgs from channel and write to AOF file
 type AofHandler struct {
-	db          databaseface.Database
-	aofChan     chan *payload
-	aofFile     *os.File
+	db      databaseface.DBEngine
+	aofChan chan *payload
+	// aofFile is the incr file commands are appended to
+	aofFile *os.File
+	// aofDir holds the files of aof and the manifest, aofFilename is the prefix of their names
+	aofDir      string
 	aofFilename string
+	// manifest is modified only when the rewriting lock or pausingAof is held
+	manifest *manifest
+	aofFsync string
 	// aof goroutine will send msg to main goroutine through this channel when aof tasks finished and ready to shutdown
 	aofFinished chan struct{}
 	// pause aof for start/finish aof rewrite progress
 	pausingAof sync.RWMutex
 	currentDB  int
+	// lastTimestamp is the time written by the last timestamp annotation
+	lastTimestamp int64
+	// loadedFlushes counts FLUSHDB loaded by loadFile, rewrite records it for point-in-time recovery
+	loadedFlushes int
+	// tmpDBMaker creates an empty database for aof rewrite to load the aof file
+	tmpDBMaker func() databaseface.DBEngine
+	// held while rewriting, make sure only one rewrite is running
+	rewriting sync.Mutex
+	// stop the goroutine doing fsync every second
+	stopFsync chan struct{}
+
+	// statusMu protects the fields below, which are reported by INFO persistence
+	statusMu          sync.Mutex
+	rewriteInProgress bool
+	// aofSize is the total size of aof files, aofBaseSize is the size after last rewrite or startup
+	aofSize        int64
+	aofBaseSize    int64
+	lastFsyncTime  time.Time
+	lastFsyncError error
+	fsyncErrors    int64
+}
+
+// Status is the state of aof persistence reported by INFO persistence
+type Status struct {
+	RewriteInProgress bool
+	CurrentSize       int64
+	BaseSize          int64
+	Fsync             string
+	// LastFsyncTime is zero if fsync has never been done
+	LastFsyncTime time.Time
+	// LastFsyncError is nil if the last fsync succeeded
+	LastFsyncError error
+	FsyncErrors    int64
 }
 
 // NewAOFHandler creates a new aof.AofHandler
-func NewAOFHandler(db databaseface.Database) (*AofHandler, error) {
+func NewAOFHandler(db databaseface.DBEngine, tmpDBMaker func() databaseface.DBEngine) (*AofHandler, error) {
 	handler := &AofHandler{}
-	handler.aofFilename = config.Properties.AppendFilename
+	handler.aofDir = config.Properties.AppendDirName
+	handler.aofFilename = filepath.Base(config.Properties.AppendFilename)
+	handler.aofFsync = strings.ToLower(config.Properties.AppendFsync)
+	if handler.aofFsync != FsyncAlways && handler.aofFsync != FsyncNo && handler.aofFsync != FsyncEverySec {
+		logger.Warn("unknown appendfsync " + handler.aofFsync + ", use everysec")
+		handler.aofFsync = FsyncEverySec
+	}
 	handler.db = db
-	handler.LoadAof(0)
-	aofFile, err := os.OpenFile(handler.aofFilename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
-	if err != nil {
+	handler.tmpDBMaker = tmpDBMaker
+	if err := handler.loadManifest(); err != nil {
 		return nil, err
 	}
-	handler.aofFile = aofFile
+	if err := handler.loadAofOnStartup(); err != nil {
+		return nil, err
+	}
+	if err := handler.openIncrFileOnStartup(); err != nil {
+		return nil, err
+	}
+	handler.aofSize = handler.totalSize()
+	handler.aofBaseSize = handler.aofSize
 	handler.aofChan = make(chan *payload, aofQueueSize)
 	handler.aofFinished = make(chan struct{})
+	handler.stopFsync = make(chan struct{})
 	go func() {
 		handler.handleAof()
 	}()
+	if handler.aofFsync == FsyncEverySec {
+		handler.fsyncEverySecond()
+	}
 	return handler, nil
 }
 
 // AddAof send command to aof goroutine through channel
 func (handler *AofHandler) AddAof(dbIndex int, cmdLine CmdLine) {
-	if config.Properties.AppendOnly && handler.aofChan != nil {
-		handler.aofChan <- &payload{
-			cmdLine: cmdLine,
-			dbIndex: dbIndex,
-		}
+	handler.addPayload(&payload{
+		cmdLine: cmdLine,
+		dbIndex: dbIndex,
+	})
+}
+
+// AddAofTx send commands of a transaction to aof goroutine, they will be written within MULTI/EXEC
+func (handler *AofHandler) AddAofTx(dbIndex int, cmdLines []CmdLine) {
+	handler.addPayload(&payload{
+		tx:      cmdLines,
+		dbIndex: dbIndex,
+	})
+}
+
+// addPayload sends payload to aof goroutine, waits until it is synced if appendfsync is always
+func (handler *AofHandler) addPayload(p *payload) {
+	if !config.Properties.AppendOnly || handler.aofChan == nil {
+		return
+	}
+	if handler.aofFsync == FsyncAlways {
+		p.wg = &sync.WaitGroup{}
+		p.wg.Add(1)
+		handler.aofChan <- p
+		p.wg.Wait()
+		return
 	}
+	handler.aofChan <- p
 }
 
 // handleAof listen aof channel and write into file
 func (handler *AofHandler) handleAof() {
-	// serialized execution
-	handler.currentDB = 0
+	// serialized execution, currentDB has been set by LoadAof
 	for p := range handler.aofChan {
 		handler.pausingAof.RLock() // prevent other goroutines from pausing aof
-		if p.dbIndex != handler.currentDB {
-			// select db
-			data := reply.MakeMultiBulkReply(utils.ToCmdLine("SELECT", strconv.Itoa(p.dbIndex))).ToBytes()
-			_, err := handler.aofFile.Write(data)
+		handler.writeAof(p)
+		if handler.aofFsync == FsyncAlways {
+			handler.fsync()
+		}
+		needRewrite := handler.needRewrite()
+		handler.pausingAof.RUnlock()
+		if p.wg != nil {
+			p.wg.Done()
+		}
+		if needRewrite {
+			// ignore ErrRewriteInProgress
+			_ = handler.BGRewrite()
+		}
+	}
+	handler.aofFinished <- struct{}{}
+}
+
+// writeAof writes the payload into aof file, the caller holds pausingAof
+func (handler *AofHandler) writeAof(p *payload) {
+	if config.Properties.AofTimestampEnabled {
+		// annotate the time before the payload once per second, it is used for point-in-time recovery
+		now := time.Now().Unix()
+		if now != handler.lastTimestamp {
+			n, err := handler.aofFile.Write(makeTimestampAnnotation(now))
+			handler.addSize(n)
 			if err != nil {
 				logger.Warn(err)
-				continue // skip this command
+				return // skip this command
 			}
-			handler.currentDB = p.dbIndex
+			handler.lastTimestamp = now
 		}
-		data := reply.MakeMultiBulkReply(p.cmdLine).ToBytes()
-		_, err := handler.aofFile.Write(data)
+	}
+	if p.dbIndex != handler.currentDB {
+		// select db
+		data := reply.MakeMultiBulkReply(utils.ToCmdLine("SELECT", strconv.Itoa(p.dbIndex))).ToBytes()
+		n, err := handler.aofFile.Write(data)
+		handler.addSize(n)
 		if err != nil {
 			logger.Warn(err)
+			return // skip this command
 		}
-		handler.pausingAof.RUnlock()
+		handler.currentDB = p.dbIndex
 	}
-	handler.aofFinished <- struct{}{}
+	var data []byte
+	if p.tx != nil {
+		// write the whole transaction at once, a partial transaction will not be executed when loading
+		var buf []byte
+		buf = append(buf, reply.MakeMultiBulkReply(utils.ToCmdLine("MULTI")).ToBytes()...)
+		for _, line := range p.tx {
+			buf = append(buf, reply.MakeMultiBulkReply(line).ToBytes()...)
+		}
+		buf = append(buf, reply.MakeMultiBulkReply(utils.ToCmdLine("EXEC")).ToBytes()...)
+		data = buf
+	} else {
+		data = reply.MakeMultiBulkReply(p.cmdLine).ToBytes()
+	}
+	n, err := handler.aofFile.Write(data)
+	handler.addSize(n)
+	if err != nil {
+		logger.Warn(err)
+	}
+}
+
+// fsyncEverySecond starts a goroutine syncing aof file every second
+func (handler *AofHandler) fsyncEverySecond() {
+	ticker := time.NewTicker(time.Second)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				handler.pausingAof.RLock()
+				handler.fsync()
+				handler.pausingAof.RUnlock()
+			case <-handler.stopFsync:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// fsync flushes aof file to disk and records the result, the caller holds pausingAof
+func (handler *AofHandler) fsync() {
+	err := handler.aofFile.Sync()
+	if err != nil {
+		logger.Error("fsync failed: " + err.Error())
+	}
+	handler.statusMu.Lock()
+	defer handler.statusMu.Unlock()
+	handler.lastFsyncTime = time.Now()
+	handler.lastFsyncError = err
+	if err != nil {
+		handler.fsyncErrors++
+	}
+}
+
+func (handler *AofHandler) addSize(n int) {
+	handler.statusMu.Lock()
+	handler.aofSize += int64(n)
+	handler.statusMu.Unlock()
+}
+
+// Status returns the state of aof persistence
+func (handler *AofHandler) Status() Status {
+	handler.statusMu.Lock()
+	defer handler.statusMu.Unlock()
+	return Status{
+		RewriteInProgress: handler.rewriteInProgress,
+		CurrentSize:       handler.aofSize,
+		BaseSize:          handler.aofBaseSize,
+		Fsync:             handler.aofFsync,
+		LastFsyncTime:     handler.lastFsyncTime,
+		LastFsyncError:    handler.lastFsyncError,
+		FsyncErrors:       handler.fsyncErrors,
+	}
+}
+
+// LoadAof reads aof files recorded in manifest and executes the commands in them.
+// It returns a *LoadError if a file is corrupted, the commands before the bad one have been executed
+func (handler *AofHandler) LoadAof() error {
+	return handler.loadFiles(handler.manifest.fileNames())
 }
 
-// LoadAof read aof file
-func (handler *AofHandler) LoadAof(maxBytes int) {
+// loadFiles loads the given files in aofDir in order
+func (handler *AofHandler) loadFiles(names []string) error {
 	// delete aofChan to prevent write again
 	aofChan := handler.aofChan
 	handler.aofChan = nil
@@ -103,53 +296,188 @@ func (handler *AofHandler) LoadAof(maxBytes int) {
 		handler.aofChan = aofChan
 	}(aofChan)
 
-	file, err := os.Open(handler.aofFilename)
-	if err != nil {
-		if _, ok := err.(*os.PathError); ok {
-			return
+	for _, name := range names {
+		if err := handler.loadFile(name); err != nil {
+			return err
 		}
-		logger.Warn(err)
-		return
 	}
-	defer file.Close()
+	return nil
+}
 
-	var reader io.Reader
-	if maxBytes > 0 {
-		reader = io.LimitReader(file, int64(maxBytes))
-	} else {
-		reader = file
+func (handler *AofHandler) loadFile(name string) error {
+	file, err := os.Open(filepath.Join(handler.aofDir, name))
+	if err != nil {
+		return err
 	}
-	ch := parser.ParseStream(reader)
+	defer file.Close()
+
+	// every file is written from db 0
 	fakeConn := &connection.FakeConn{} // only used for save dbIndex
-	for p := range ch {
-		if p.Err != nil {
-			if p.Err == io.EOF {
-				break
-			}
-			logger.Error("parse error: " + p.Err.Error())
-			continue
+	// base file written by rewrite may be in rdb format, it is loaded before the commands after it
+	_, loadErr := readAof(file, handler.db.LoadRDB, func(cmdLine CmdLine) {
+		if strings.ToLower(string(cmdLine[0])) == "flushdb" {
+			handler.loadedFlushes++
 		}
-		if p.Data == nil {
-			logger.Error("empty payload")
-			continue
+		ret := handler.db.Exec(fakeConn, cmdLine)
+		if reply.IsErrorReply(ret) {
+			logger.Error("exec err: " + ret.(reply.ErrorReply).Error())
 		}
-		r, ok := p.Data.(*reply.MultiBulkReply)
-		if !ok {
-			logger.Error("require multi bulk reply")
-			continue
+	}, nil)
+	// commands appended later are written after the db selected by the last file
+	handler.currentDB = fakeConn.GetDBIndex()
+	if loadErr != nil {
+		loadErr.File = name
+		return loadErr
+	}
+	return nil
+}
+
+// loadAofOnStartup loads aof files. The last file ending in the middle of a command is truncated if aof-load-truncated is on,
+// and the last file corrupted in the middle is truncated at the last valid command if aof-load-corrupted is on
+func (handler *AofHandler) loadAofOnStartup() error {
+	err := handler.LoadAof()
+	if err == nil {
+		return nil
+	}
+	loadErr, ok := err.(*LoadError)
+	if !ok {
+		return err
+	}
+	names := handler.manifest.fileNames()
+	if loadErr.File != names[len(names)-1] {
+		// the files before the last one are never appended to, truncating them loses the commands after them
+		return fmt.Errorf("%s, make a backup of aof files, then use check-aof --fix <manifest>", loadErr.Error())
+	}
+	path := filepath.Join(handler.aofDir, loadErr.File)
+	if loadErr.Truncated {
+		if !config.Properties.AofLoadTruncated {
+			return fmt.Errorf("%s, set aof-load-truncated to yes or use check-aof --fix <manifest>", loadErr.Error())
 		}
-		ret := handler.db.Exec(fakeConn, r.Args)
-		if reply.IsErrorReply(ret) {
-			logger.Error("exec err", err)
+		logger.Warn(fmt.Sprintf("aof file %s is truncated at offset %d, drop the incomplete command and truncate the file to %d bytes",
+			loadErr.File, loadErr.Offset, loadErr.ValidSize))
+		return os.Truncate(path, loadErr.ValidSize)
+	}
+	if !config.Properties.AofLoadCorrupted {
+		return fmt.Errorf("%s, set aof-load-corrupted to yes to drop the commands after it, or make a backup of aof files, then use check-aof --fix <manifest>",
+			loadErr.Error())
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	logger.Warn(fmt.Sprintf("aof file %s is corrupted at offset %d, drop %d bytes after it and truncate the file to %d bytes",
+		loadErr.File, loadErr.Offset, info.Size()-loadErr.ValidSize, loadErr.ValidSize))
+	return os.Truncate(path, loadErr.ValidSize)
+}
+
+func (handler *AofHandler) manifestPath() string {
+	return filepath.Join(handler.aofDir, handler.aofFilename+manifestSuffix)
+}
+
+// loadManifest reads the manifest in aofDir, the aof file of single file format is migrated as the base file
+// 如果没有清单文件，将旧的单文件 AOF 移入目录作为 base 文件
+func (handler *AofHandler) loadManifest() error {
+	m, err := readManifestFile(handler.manifestPath())
+	if err == nil {
+		handler.manifest = m
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.MkdirAll(handler.aofDir, 0755); err != nil {
+		return err
+	}
+	m = &manifest{}
+	oldPath := config.Properties.AppendFilename
+	basePath := filepath.Join(handler.aofDir, handler.aofFilename)
+	if filepath.Clean(oldPath) != filepath.Clean(basePath) && fileExists(oldPath) {
+		logger.Info("migrating aof file " + oldPath + " into " + handler.aofDir)
+		if err := os.Rename(oldPath, basePath); err != nil {
+			return err
 		}
 	}
+	// the migrated file may have been moved before the manifest was written
+	if fileExists(basePath) {
+		m.base = &aofFileInfo{name: handler.aofFilename, seq: 1, fileType: fileTypeBase}
+		m.baseSeq = 1
+	}
+	// the manifest is written after the incr file is created
+	handler.manifest = m
+	return nil
+}
+
+// openIncrFileOnStartup opens the last incr file to append commands, or creates one if there is none
+func (handler *AofHandler) openIncrFileOnStartup() error {
+	m := handler.manifest
+	if len(m.incrs) == 0 {
+		return handler.openNewIncrFile()
+	}
+	name := m.incrs[len(m.incrs)-1].name
+	aofFile, err := os.OpenFile(filepath.Join(handler.aofDir, name), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	handler.aofFile = aofFile
+	return nil
+}
+
+// openNewIncrFile creates a new incr file, records it in manifest and appends commands to it.
+// the caller holds pausingAof or aof goroutine is not started, the previous incr file should be synced and closed by caller
+func (handler *AofHandler) openNewIncrFile() error {
+	m := handler.manifest.clone()
+	m.incrSeq++
+	info := &aofFileInfo{
+		name:     fmt.Sprintf("%s.%d%s", handler.aofFilename, m.incrSeq, incrAofSuffix),
+		seq:      m.incrSeq,
+		fileType: fileTypeIncr,
+	}
+	m.incrs = append(m.incrs, info)
+	aofFile, err := os.OpenFile(filepath.Join(handler.aofDir, info.name), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	if err := writeManifestFile(handler.manifestPath(), m); err != nil {
+		_ = aofFile.Close()
+		_ = os.Remove(aofFile.Name())
+		return err
+	}
+	handler.manifest = m
+	handler.aofFile = aofFile
+	// the new file is loaded from db 0
+	handler.currentDB = 0
+	handler.lastTimestamp = 0
+	return nil
+}
+
+// totalSize returns the size of all aof files recorded in manifest
+func (handler *AofHandler) totalSize() int64 {
+	var size int64
+	for _, name := range handler.manifest.fileNames() {
+		if info, err := os.Stat(filepath.Join(handler.aofDir, name)); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
 }
 
 // Close gracefully stops aof persistence procedure
 func (handler *AofHandler) Close() {
+	// wait for the running rewrite
+	handler.rewriting.Lock()
+	defer handler.rewriting.Unlock()
 	if handler.aofFile != nil {
 		close(handler.aofChan)
 		<-handler.aofFinished // wait for aof finished
+		close(handler.stopFsync)
+		if handler.aofFsync != FsyncNo {
+			handler.fsync()
+		}
 		err := handler.aofFile.Close()
 		if err != nil {
 			logger.Warn(err)
@@ -0,0 +1,280 @@
+package aof
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"go-redis/rdb"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// errUnexpectedEOF means the aof file ends in the middle of a command or a transaction
+var errUnexpectedEOF = errors.New("unexpected end of file")
+
+// LoadError describes the first bad command in aof file
+type LoadError struct {
+	// File is the name of the file containing the bad command, it is empty if the reader is not a file
+	File string
+	// Offset is the position of the bad command
+	Offset int64
+	// ValidSize is the size of the valid part of the file, it is smaller than Offset if the bad command
+	// is inside a transaction, because the unfinished transaction is dropped as a whole
+	ValidSize int64
+	// Truncated is true if the file ends in the middle of a command or a transaction, it usually happens when
+	// the server crashed while writing aof, and the file can be fixed by truncating it to ValidSize
+	Truncated bool
+	Err       error
+}
+
+func (e *LoadError) Error() string {
+	if e.File != "" {
+		return fmt.Sprintf("bad aof file %s at offset %d: %s", e.File, e.Offset, e.Err.Error())
+	}
+	return fmt.Sprintf("bad aof at offset %d: %s", e.Offset, e.Err.Error())
+}
+
+// cmdReader reads command lines from aof strictly, and records how many bytes have been consumed
+type cmdReader struct {
+	reader *bufio.Reader
+	offset int64
+}
+
+// readLine reads a line ending with CRLF and returns it without CRLF
+func (r *cmdReader) readLine() ([]byte, error) {
+	line, err := r.reader.ReadBytes('\n')
+	r.offset += int64(len(line))
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, errors.New("line is not terminated by CRLF")
+	}
+	return line[:len(line)-2], nil
+}
+
+func (r *cmdReader) readCount(prefix byte, line []byte) (int, error) {
+	if len(line) == 0 || line[0] != prefix {
+		return 0, fmt.Errorf("expect '%c', got %q", prefix, line)
+	}
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("illegal length %q", line)
+	}
+	return n, nil
+}
+
+// readCmd reads a command line or an annotation line starting with '#', the annotation is returned without '#'.
+// It returns io.EOF if there is no more command, errUnexpectedEOF if the file ends in the middle of a command
+func (r *cmdReader) readCmd() (CmdLine, string, error) {
+	start := r.offset
+	cmdLine, annotation, err := r.readCmd0()
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		if r.offset == start {
+			return nil, "", io.EOF
+		}
+		return nil, "", errUnexpectedEOF
+	}
+	return cmdLine, annotation, err
+}
+
+func (r *cmdReader) readCmd0() (CmdLine, string, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, "", err
+	}
+	if len(line) > 0 && line[0] == '#' {
+		return nil, string(line[1:]), nil
+	}
+	argc, err := r.readCount('*', line)
+	if err != nil {
+		return nil, "", err
+	}
+	if argc == 0 {
+		return nil, "", errors.New("empty command")
+	}
+	cmdLine := make(CmdLine, argc)
+	for i := range cmdLine {
+		line, err = r.readLine()
+		if err != nil {
+			return nil, "", err
+		}
+		size, err := r.readCount('$', line)
+		if err != nil {
+			return nil, "", err
+		}
+		arg := make([]byte, size+2)
+		n, err := io.ReadFull(r.reader, arg)
+		r.offset += int64(n)
+		if err != nil {
+			return nil, "", err
+		}
+		if !bytes.HasSuffix(arg, []byte("\r\n")) {
+			return nil, "", errors.New("argument is not terminated by CRLF")
+		}
+		cmdLine[i] = arg[:size]
+	}
+	return cmdLine, "", nil
+}
+
+// Limit makes reading aof stop at a point in time, it is used for point-in-time recovery
+type Limit struct {
+	// Timestamp stops reading at the first timestamp annotation later than it, 0 means no limit
+	Timestamp int64
+	// Flushes stops reading before the Flushes-th FLUSHDB, 0 means no limit
+	Flushes int
+	// flushes counts FLUSHDB read, the count goes across files
+	flushes int
+}
+
+// Prepare checks the limit against the base file recorded in manifest before reading the files in it.
+// The base file written by rewrite holds the data at the time the rewrite started, a point in time before it
+// cannot be recovered, and the FLUSHDB compacted into it are counted for the Flushes limit
+func (limit *Limit) Prepare(manifestPath string) error {
+	m, err := readManifestFile(manifestPath)
+	if err != nil {
+		return err
+	}
+	base := m.base
+	if base == nil || base.startTime == 0 {
+		// no base file or it is migrated from single file aof, the whole history is kept
+		return nil
+	}
+	if limit.Timestamp > 0 && limit.Timestamp < base.startTime {
+		return fmt.Errorf("the point in time %d is earlier than the base file %s rewritten at %d",
+			limit.Timestamp, base.name, base.startTime)
+	}
+	if limit.Flushes > 0 && limit.Flushes <= base.flushes {
+		return fmt.Errorf("FLUSHDB #%d is compacted into the base file %s, which holds the data after %d FLUSHDB",
+			limit.Flushes, base.name, base.flushes)
+	}
+	limit.flushes = base.flushes
+	return nil
+}
+
+// reachedBy tells whether reading should stop before the command or annotation
+func (limit *Limit) reachedBy(cmdLine CmdLine, annotation string) bool {
+	if limit == nil {
+		return false
+	}
+	if cmdLine == nil {
+		ts, ok := parseTimestampAnnotation(annotation)
+		return ok && limit.Timestamp > 0 && ts > limit.Timestamp
+	}
+	if limit.Flushes > 0 && strings.ToLower(string(cmdLine[0])) == "flushdb" {
+		limit.flushes++
+		return limit.flushes == limit.Flushes
+	}
+	return false
+}
+
+const timestampAnnotationPrefix = "TS:"
+
+func makeTimestampAnnotation(ts int64) []byte {
+	return []byte("#" + timestampAnnotationPrefix + strconv.FormatInt(ts, 10) + "\r\n")
+}
+
+func parseTimestampAnnotation(annotation string) (int64, bool) {
+	if !strings.HasPrefix(annotation, timestampAnnotationPrefix) {
+		return 0, false
+	}
+	ts, err := strconv.ParseInt(annotation[len(timestampAnnotationPrefix):], 10, 64)
+	return ts, err == nil
+}
+
+// readAof reads aof from reader, loads the rdb preamble by loadRDB if it exists and calls cb for each command.
+// Annotation lines starting with '#' are skipped. If limit is reached, it stops and returns the offset to stop at,
+// otherwise it returns -1. It returns a LoadError describing the first bad command if the file is corrupted.
+// 读取 AOF：先读取可能存在的 RDB 前导部分，再逐条读取命令，记录最后一条完整命令（或完整事务）的结束位置
+func readAof(reader io.Reader, loadRDB func(decoder *rdb.Decoder) error, cb func(cmdLine CmdLine), limit *Limit) (int64, *LoadError) {
+	bufReader := bufio.NewReader(reader)
+	var offset int64
+	if header, err := bufReader.Peek(len(rdb.Magic)); err == nil && string(header) == rdb.Magic {
+		decoder := rdb.NewDecoder(bufReader)
+		if err := loadRDB(decoder); err != nil {
+			return -1, &LoadError{Err: errors.New("bad rdb preamble: " + err.Error())}
+		}
+		offset = decoder.Offset()
+	}
+
+	r := &cmdReader{reader: bufReader, offset: offset}
+	validSize := offset
+	inMulti := false
+	for {
+		cmdOffset := r.offset
+		cmdLine, annotation, err := r.readCmd()
+		if err == io.EOF {
+			if inMulti {
+				return -1, &LoadError{Offset: cmdOffset, ValidSize: validSize, Truncated: true, Err: errUnexpectedEOF}
+			}
+			return -1, nil
+		}
+		if err != nil {
+			return -1, &LoadError{Offset: cmdOffset, ValidSize: validSize, Truncated: err == errUnexpectedEOF, Err: err}
+		}
+		if limit.reachedBy(cmdLine, annotation) {
+			// validSize is the offset before the transaction if the command is inside one
+			return validSize, nil
+		}
+		if cmdLine == nil {
+			if !inMulti {
+				validSize = r.offset
+			}
+			continue
+		}
+		switch strings.ToLower(string(cmdLine[0])) {
+		case "multi":
+			inMulti = true
+		case "exec":
+			inMulti = false
+		}
+		if !inMulti {
+			validSize = r.offset
+		}
+		cb(cmdLine)
+	}
+}
+
+// Check validates the aof read from reader, returns nil if it is valid.
+// If limit is not nil, it stops at the limit and returns the offset to truncate the file at, otherwise returns -1
+func Check(reader io.Reader, limit *Limit) (int64, *LoadError) {
+	loadRDB := func(decoder *rdb.Decoder) error {
+		return decoder.Parse(func(o rdb.Object) bool {
+			return true
+		})
+	}
+	return readAof(reader, loadRDB, func(cmdLine CmdLine) {}, limit)
+}
+
+// Truncate truncates the aof recorded in manifest at the offset of the index-th file, and drops the files after it
+func Truncate(manifestPath string, index int, offset int64) error {
+	m, err := readManifestFile(manifestPath)
+	if err != nil {
+		return err
+	}
+	files := m.files()
+	if index < 0 || index >= len(files) {
+		return errors.New("file index out of range")
+	}
+	dir := filepath.Dir(manifestPath)
+	if err := os.Truncate(filepath.Join(dir, files[index].name), offset); err != nil {
+		return err
+	}
+	if index == len(files)-1 {
+		return nil
+	}
+	dropped := files[index+1:]
+	// base file is always the first one, so the dropped files are incr files
+	m.incrs = m.incrs[:len(m.incrs)-len(dropped)]
+	if err := writeManifestFile(manifestPath, m); err != nil {
+		return err
+	}
+	for _, info := range dropped {
+		_ = os.Remove(filepath.Join(dir, info.name))
+	}
+	return nil
+}
@@ -0,0 +1,708 @@
+package aof
+
+import (
+	"bytes"
+	"go-redis/config"
+	"go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/rdb"
+	"go-redis/resp/reply"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cmd encodes a command as it is written in aof
+func cmd(args ...string) string {
+	cmdLine := make([][]byte, len(args))
+	for i, arg := range args {
+		cmdLine[i] = []byte(arg)
+	}
+	return string(reply.MakeMultiBulkReply(cmdLine).ToBytes())
+}
+
+// readAll reads aof and returns the commands with arguments joined by space
+func readAll(data string, limit *Limit) ([]string, int64, *LoadError) {
+	var cmds []string
+	loadRDB := func(decoder *rdb.Decoder) error {
+		return decoder.Parse(func(o rdb.Object) bool {
+			cmds = append(cmds, "rdb "+o.GetKey())
+			return true
+		})
+	}
+	stop, err := readAof(strings.NewReader(data), loadRDB, func(cmdLine CmdLine) {
+		cmds = append(cmds, string(bytes.Join(cmdLine, []byte(" "))))
+	}, limit)
+	return cmds, stop, err
+}
+
+var (
+	setA  = cmd("SET", "a", "1")
+	setC  = cmd("SET", "c", "3")
+	multi = cmd("MULTI")
+	setB  = cmd("SET", "b", "2")
+	exec  = cmd("EXEC")
+	tx    = multi + setB + exec
+)
+
+func TestReadAof(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+		// wantErr is nil if the aof is valid
+		wantErr *LoadError
+	}{
+		{
+			name:  "valid",
+			input: setA + "#TS:100\r\n" + tx + setC,
+			want:  []string{"SET a 1", "MULTI", "SET b 2", "EXEC", "SET c 3"},
+		},
+		{
+			name:  "empty",
+			input: "",
+		},
+		{
+			name:  "annotation at the end",
+			input: setA + "#TS:100\r\n",
+			want:  []string{"SET a 1"},
+		},
+		{
+			name:    "truncated command",
+			input:   setA + setC[:10],
+			want:    []string{"SET a 1"},
+			wantErr: &LoadError{Offset: int64(len(setA)), ValidSize: int64(len(setA)), Truncated: true},
+		},
+		{
+			name:    "truncated argument",
+			input:   setA + setC[:len(setC)-1],
+			want:    []string{"SET a 1"},
+			wantErr: &LoadError{Offset: int64(len(setA)), ValidSize: int64(len(setA)), Truncated: true},
+		},
+		{
+			name:    "truncated annotation",
+			input:   setA + "#TS:1",
+			want:    []string{"SET a 1"},
+			wantErr: &LoadError{Offset: int64(len(setA)), ValidSize: int64(len(setA)), Truncated: true},
+		},
+		{
+			// the commands of the unfinished transaction are read, but the valid part ends before MULTI
+			name:    "transaction without EXEC",
+			input:   setA + multi + setB,
+			want:    []string{"SET a 1", "MULTI", "SET b 2"},
+			wantErr: &LoadError{Offset: int64(len(setA + multi + setB)), ValidSize: int64(len(setA)), Truncated: true},
+		},
+		{
+			name:    "truncated command in transaction",
+			input:   setA + multi + setB[:5],
+			want:    []string{"SET a 1", "MULTI"},
+			wantErr: &LoadError{Offset: int64(len(setA + multi)), ValidSize: int64(len(setA)), Truncated: true},
+		},
+		{
+			name:    "bad command in the middle",
+			input:   setA + "*2\r\n$3\r\nGET\r\nxx\r\n" + setC,
+			want:    []string{"SET a 1"},
+			wantErr: &LoadError{Offset: int64(len(setA)), ValidSize: int64(len(setA))},
+		},
+		{
+			name:    "line without CR",
+			input:   setA + "*1\n$4\r\nPING\r\n",
+			want:    []string{"SET a 1"},
+			wantErr: &LoadError{Offset: int64(len(setA)), ValidSize: int64(len(setA))},
+		},
+		{
+			name:    "argument without CRLF",
+			input:   setA + "*1\r\n$4\r\nPINGxx" + setC,
+			want:    []string{"SET a 1"},
+			wantErr: &LoadError{Offset: int64(len(setA)), ValidSize: int64(len(setA))},
+		},
+		{
+			name:    "empty command",
+			input:   setA + "*0\r\n" + setC,
+			want:    []string{"SET a 1"},
+			wantErr: &LoadError{Offset: int64(len(setA)), ValidSize: int64(len(setA))},
+		},
+		{
+			name:    "bad command in transaction",
+			input:   setA + multi + "garbage\r\n" + exec,
+			want:    []string{"SET a 1", "MULTI"},
+			wantErr: &LoadError{Offset: int64(len(setA + multi)), ValidSize: int64(len(setA))},
+		},
+	}
+	for _, tt := range tests {
+		cmds, stop, err := readAll(tt.input, nil)
+		if strings.Join(cmds, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: expect commands %q, got %q", tt.name, tt.want, cmds)
+		}
+		if stop != -1 {
+			t.Errorf("%s: expect -1 without limit, got %d", tt.name, stop)
+		}
+		if tt.wantErr == nil {
+			if err != nil {
+				t.Errorf("%s: expect valid, got %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: expect error", tt.name)
+			continue
+		}
+		if err.Offset != tt.wantErr.Offset || err.ValidSize != tt.wantErr.ValidSize || err.Truncated != tt.wantErr.Truncated {
+			t.Errorf("%s: expect offset %d valid size %d truncated %v, got %d %d %v (%v)", tt.name,
+				tt.wantErr.Offset, tt.wantErr.ValidSize, tt.wantErr.Truncated, err.Offset, err.ValidSize, err.Truncated, err)
+		}
+	}
+}
+
+// TestReadAofTruncatedEverywhere cuts a valid aof at every byte, like a crash while writing it
+func TestReadAofTruncatedEverywhere(t *testing.T) {
+	units := []string{setA, "#TS:100\r\n", tx, setC}
+	data := strings.Join(units, "")
+	// the valid part always ends at the end of a unit, a transaction is a single unit
+	ends := []int{0}
+	for _, unit := range units {
+		ends = append(ends, ends[len(ends)-1]+len(unit))
+	}
+	for i := 0; i <= len(data); i++ {
+		validSize := 0
+		for _, end := range ends {
+			if end <= i {
+				validSize = end
+			}
+		}
+		_, _, err := readAll(data[:i], nil)
+		if validSize == i {
+			if err != nil {
+				t.Fatalf("truncated at %d: expect valid, got %v", i, err)
+			}
+			continue
+		}
+		if err == nil || !err.Truncated || err.ValidSize != int64(validSize) {
+			t.Fatalf("truncated at %d: expect truncated with valid size %d, got %+v", i, validSize, err)
+		}
+	}
+}
+
+// makeRDBPreamble returns an rdb holding a string key as the preamble of aof
+func makeRDBPreamble(t *testing.T, key string) string {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	enc := rdb.NewEncoder(buf)
+	err := enc.WriteHeader()
+	if err == nil {
+		err = enc.WriteDBHeader(0, 1, 0)
+	}
+	if err == nil {
+		err = enc.WriteStringObject(key, []byte("v"), nil)
+	}
+	if err == nil {
+		err = enc.WriteEnd()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestReadAofRDBPreamble(t *testing.T) {
+	preamble := makeRDBPreamble(t, "k")
+	cmds, _, err := readAll(preamble+setA, nil)
+	if err != nil || strings.Join(cmds, ",") != "rdb k,SET a 1" {
+		t.Fatalf("expect rdb k,SET a 1, got %q %v", cmds, err)
+	}
+
+	// offsets count from the start of the file
+	_, _, err = readAll(preamble+setA+setC[:5], nil)
+	if err == nil || !err.Truncated || err.ValidSize != int64(len(preamble+setA)) || err.Offset != int64(len(preamble+setA)) {
+		t.Fatalf("expect truncated at %d, got %+v", len(preamble+setA), err)
+	}
+
+	// a broken preamble cannot be fixed by truncating
+	_, _, err = readAll(preamble[:len(preamble)-3], nil)
+	if err == nil || err.Truncated || err.Offset != 0 || err.ValidSize != 0 || !strings.Contains(err.Error(), "bad rdb preamble") {
+		t.Fatalf("expect bad rdb preamble, got %+v", err)
+	}
+}
+
+// fakeDB records the commands executed while loading aof
+type fakeDB struct {
+	cmds []string
+}
+
+func (db *fakeDB) Exec(client resp.Connection, args [][]byte) resp.Reply {
+	db.cmds = append(db.cmds, string(bytes.Join(args, []byte(" "))))
+	return reply.MakeOkReply()
+}
+
+func (db *fakeDB) AfterClientClose(c resp.Connection) {}
+
+func (db *fakeDB) Close() {}
+
+func (db *fakeDB) ForEach(dbIndex int, cb func(key string, data *database.DataEntity, expiration *time.Time) bool) {
+}
+
+func (db *fakeDB) LoadRDB(decoder *rdb.Decoder) error {
+	return decoder.Parse(func(o rdb.Object) bool {
+		db.cmds = append(db.cmds, "rdb "+o.GetKey())
+		return true
+	})
+}
+
+// setupAofDir writes the files into a temp dir and sets up config, files are written in the order of names
+func setupAofDir(t *testing.T, files map[string]string, names ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	aofDir := filepath.Join(dir, "appendonlydir")
+	if err := os.Mkdir(aofDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(aofDir, name), []byte(files[name]), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config.Properties = &config.ServerProperties{
+		AppendFilename:   filepath.Join(dir, "appendonly.aof"),
+		AppendDirName:    aofDir,
+		AofLoadTruncated: true,
+	}
+	return aofDir
+}
+
+// makeTestHandler creates a handler loading aof files without starting the aof goroutine
+func makeTestHandler(t *testing.T, db *fakeDB) *AofHandler {
+	t.Helper()
+	handler := &AofHandler{
+		db:          db,
+		aofDir:      config.Properties.AppendDirName,
+		aofFilename: filepath.Base(config.Properties.AppendFilename),
+	}
+	if err := handler.loadManifest(); err != nil {
+		t.Fatal(err)
+	}
+	return handler
+}
+
+func fileSize(t *testing.T, path string) int {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int(info.Size())
+}
+
+func TestLoadAofOnStartup(t *testing.T) {
+	const manifestContent = "file appendonly.aof.1.base.aof seq 1 type b\n" +
+		"file appendonly.aof.1.incr.aof seq 1 type i\n" +
+		"file appendonly.aof.2.incr.aof seq 2 type i\n"
+	tests := []struct {
+		name          string
+		base          string
+		incr1         string
+		incr2         string
+		loadTruncated bool
+		loadCorrupted bool
+		wantErr       string
+		want          []string
+		// truncatedTo is the size of the last file after loading, -1 means unchanged
+		truncatedTo int
+	}{
+		{
+			name:        "valid",
+			base:        setA,
+			incr1:       tx,
+			incr2:       setC,
+			want:        []string{"SET a 1", "MULTI", "SET b 2", "EXEC", "SET c 3"},
+			truncatedTo: -1,
+		},
+		{
+			name:          "last file truncated",
+			base:          setA,
+			incr1:         setB,
+			incr2:         setC + multi + setB[:3],
+			loadTruncated: true,
+			want:          []string{"SET a 1", "SET b 2", "SET c 3", "MULTI"},
+			truncatedTo:   len(setC),
+		},
+		{
+			name:        "last file truncated without aof-load-truncated",
+			base:        setA,
+			incr1:       setB,
+			incr2:       setC + setB[:3],
+			wantErr:     "set aof-load-truncated to yes",
+			truncatedTo: -1,
+		},
+		{
+			name:          "truncated file before the last one",
+			base:          setA,
+			incr1:         setB[:3],
+			incr2:         setC,
+			loadTruncated: true,
+			wantErr:       "bad aof file appendonly.aof.1.incr.aof at offset 0",
+			truncatedTo:   -1,
+		},
+		{
+			name:          "bad command in the middle of the last file",
+			base:          setA,
+			incr1:         setB,
+			incr2:         "*x\r\n" + setC,
+			loadTruncated: true,
+			wantErr:       "set aof-load-corrupted to yes",
+			truncatedTo:   -1,
+		},
+		{
+			name:          "bad command in the middle of the last file with aof-load-corrupted",
+			base:          setA,
+			incr1:         setB,
+			incr2:         setC + "*x\r\n" + setA,
+			loadCorrupted: true,
+			want:          []string{"SET a 1", "SET b 2", "SET c 3"},
+			truncatedTo:   len(setC),
+		},
+		{
+			// the commands in the transaction before the bad one are dropped with it
+			name:          "bad command inside MULTI of the last file with aof-load-corrupted",
+			base:          setA,
+			incr1:         setB,
+			incr2:         setC + multi + "$3\r\n" + setA + exec,
+			loadCorrupted: true,
+			want:          []string{"SET a 1", "SET b 2", "SET c 3", "MULTI"},
+			truncatedTo:   len(setC),
+		},
+		{
+			name:          "bad command in the middle of the file before the last one with aof-load-corrupted",
+			base:          setA,
+			incr1:         "*x\r\n" + setB,
+			incr2:         setC,
+			loadTruncated: true,
+			loadCorrupted: true,
+			wantErr:       "use check-aof --fix",
+			truncatedTo:   -1,
+		},
+		{
+			// aof-load-corrupted doesn't cover the truncated file
+			name:          "last file truncated with aof-load-corrupted only",
+			base:          setA,
+			incr1:         setB,
+			incr2:         setC + setB[:3],
+			loadCorrupted: true,
+			wantErr:       "set aof-load-truncated to yes",
+			truncatedTo:   -1,
+		},
+	}
+	for _, tt := range tests {
+		aofDir := setupAofDir(t, map[string]string{
+			"appendonly.aof.manifest":   manifestContent,
+			"appendonly.aof.1.base.aof": tt.base,
+			"appendonly.aof.1.incr.aof": tt.incr1,
+			"appendonly.aof.2.incr.aof": tt.incr2,
+		}, "appendonly.aof.manifest", "appendonly.aof.1.base.aof", "appendonly.aof.1.incr.aof", "appendonly.aof.2.incr.aof")
+		config.Properties.AofLoadTruncated = tt.loadTruncated
+		config.Properties.AofLoadCorrupted = tt.loadCorrupted
+		db := &fakeDB{}
+		err := makeTestHandler(t, db).loadAofOnStartup()
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: expect error containing %q, got %v", tt.name, tt.wantErr, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else if strings.Join(db.cmds, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: expect commands %q, got %q", tt.name, tt.want, db.cmds)
+		}
+		size := fileSize(t, filepath.Join(aofDir, "appendonly.aof.2.incr.aof"))
+		want := tt.truncatedTo
+		if want < 0 {
+			want = len(tt.incr2)
+		}
+		if size != want {
+			t.Errorf("%s: expect the last file of %d bytes, got %d", tt.name, want, size)
+		}
+	}
+}
+
+func TestReadAofLimit(t *testing.T) {
+	ts100 := "#TS:100\r\n"
+	ts101 := "#TS:101\r\n"
+	flushdb := cmd("FLUSHDB")
+	tests := []struct {
+		name  string
+		input string
+		limit *Limit
+		want  []string
+		// stop is the offset to truncate at, -1 means the limit is not reached
+		stop int
+	}{
+		{
+			name:  "timestamp",
+			input: ts100 + setA + ts101 + setC,
+			limit: &Limit{Timestamp: 100},
+			want:  []string{"SET a 1"},
+			stop:  len(ts100 + setA),
+		},
+		{
+			name:  "timestamp equal to the limit",
+			input: ts100 + setA + ts101 + setC,
+			limit: &Limit{Timestamp: 101},
+			want:  []string{"SET a 1", "SET c 3"},
+			stop:  -1,
+		},
+		{
+			name:  "timestamp before the first command",
+			input: ts101 + setA,
+			limit: &Limit{Timestamp: 100},
+			stop:  0,
+		},
+		{
+			name:  "timestamp right before MULTI",
+			input: ts100 + setA + ts101 + tx,
+			limit: &Limit{Timestamp: 100},
+			want:  []string{"SET a 1"},
+			stop:  len(ts100 + setA),
+		},
+		{
+			// the transaction is dropped as a whole
+			name:  "timestamp inside MULTI",
+			input: ts100 + setA + multi + ts101 + setB + exec,
+			limit: &Limit{Timestamp: 100},
+			want:  []string{"SET a 1", "MULTI"},
+			stop:  len(ts100 + setA),
+		},
+		{
+			name:  "timestamp right after EXEC",
+			input: ts100 + setA + tx + ts101 + setC,
+			limit: &Limit{Timestamp: 100},
+			want:  []string{"SET a 1", "MULTI", "SET b 2", "EXEC"},
+			stop:  len(ts100 + setA + tx),
+		},
+		{
+			name:  "other annotations",
+			input: "#TS:x\r\n#comment 200\r\n" + setA,
+			limit: &Limit{Timestamp: 100},
+			want:  []string{"SET a 1"},
+			stop:  -1,
+		},
+		{
+			name:  "first FLUSHDB",
+			input: setA + flushdb + setB + flushdb,
+			limit: &Limit{Flushes: 1},
+			want:  []string{"SET a 1"},
+			stop:  len(setA),
+		},
+		{
+			name:  "second FLUSHDB",
+			input: setA + flushdb + setB + cmd("flushdb") + setC,
+			limit: &Limit{Flushes: 2},
+			want:  []string{"SET a 1", "FLUSHDB", "SET b 2"},
+			stop:  len(setA + flushdb + setB),
+		},
+		{
+			name:  "FLUSHDB inside MULTI",
+			input: setA + multi + setB + flushdb + exec,
+			limit: &Limit{Flushes: 1},
+			want:  []string{"SET a 1", "MULTI", "SET b 2"},
+			stop:  len(setA),
+		},
+		{
+			name:  "FLUSHDB not reached",
+			input: setA + flushdb,
+			limit: &Limit{Flushes: 2},
+			want:  []string{"SET a 1", "FLUSHDB"},
+			stop:  -1,
+		},
+		{
+			name:  "FLUSHDB before timestamp",
+			input: ts100 + setA + flushdb + ts101 + setC,
+			limit: &Limit{Timestamp: 100, Flushes: 1},
+			want:  []string{"SET a 1"},
+			stop:  len(ts100 + setA),
+		},
+		{
+			// the corrupted part after the point in time does not matter
+			name:  "bad command after timestamp",
+			input: ts100 + setA + ts101 + "*x\r\n",
+			limit: &Limit{Timestamp: 100},
+			want:  []string{"SET a 1"},
+			stop:  len(ts100 + setA),
+		},
+	}
+	for _, tt := range tests {
+		cmds, stop, err := readAll(tt.input, tt.limit)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if strings.Join(cmds, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: expect commands %q, got %q", tt.name, tt.want, cmds)
+		}
+		if stop != int64(tt.stop) {
+			t.Errorf("%s: expect stop at %d, got %d", tt.name, tt.stop, stop)
+		}
+	}
+}
+
+// TestReadAofLimitAcrossFiles counts FLUSHDB across the files of manifest
+func TestReadAofLimitAcrossFiles(t *testing.T) {
+	flushdb := cmd("FLUSHDB")
+	limit := &Limit{Flushes: 2}
+	if _, stop, err := readAll(setA+flushdb, limit); err != nil || stop != -1 {
+		t.Fatalf("expect the first file read through, got %d %v", stop, err)
+	}
+	if _, stop, err := readAll(setB+flushdb+setC, limit); err != nil || stop != int64(len(setB)) {
+		t.Fatalf("expect stop at %d in the second file, got %d %v", len(setB), stop, err)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	files := map[string]string{
+		"appendonly.aof.manifest": "file appendonly.aof.1.base.aof seq 1 type b\n" +
+			"file appendonly.aof.1.incr.aof seq 1 type i\n" +
+			"file appendonly.aof.2.incr.aof seq 2 type i\n",
+		"appendonly.aof.1.base.aof": setA,
+		"appendonly.aof.1.incr.aof": setB + setC,
+		"appendonly.aof.2.incr.aof": setC,
+	}
+	aofDir := setupAofDir(t, files, "appendonly.aof.manifest", "appendonly.aof.1.base.aof",
+		"appendonly.aof.1.incr.aof", "appendonly.aof.2.incr.aof")
+	manifestPath := filepath.Join(aofDir, "appendonly.aof.manifest")
+	if err := Truncate(manifestPath, 3, 0); err == nil {
+		t.Fatal("expect error for index out of range")
+	}
+	// truncates the first incr file and drops the files after it
+	if err := Truncate(manifestPath, 1, int64(len(setB))); err != nil {
+		t.Fatal(err)
+	}
+	paths, err := ManifestFiles(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(aofDir, "appendonly.aof.1.base.aof"), filepath.Join(aofDir, "appendonly.aof.1.incr.aof")}
+	if strings.Join(paths, ",") != strings.Join(want, ",") {
+		t.Fatalf("expect files %q, got %q", want, paths)
+	}
+	if size := fileSize(t, want[1]); size != len(setB) {
+		t.Fatalf("expect the incr file of %d bytes, got %d", len(setB), size)
+	}
+	if _, err := os.Stat(filepath.Join(aofDir, "appendonly.aof.2.incr.aof")); !os.IsNotExist(err) {
+		t.Fatalf("expect the dropped file removed, got %v", err)
+	}
+}
+
+func TestLimitPrepare(t *testing.T) {
+	flushdb := cmd("FLUSHDB")
+	tests := []struct {
+		name     string
+		manifest string
+		limit    *Limit
+		wantErr  string
+		// stop is the offset to stop at in the incr file
+		stop int64
+	}{
+		{
+			name:     "timestamp before base",
+			manifest: "file b.aof seq 2 type b starttime 100 flushes 1\nfile i.aof seq 1 type i\n",
+			limit:    &Limit{Timestamp: 99},
+			wantErr:  "earlier than the base file b.aof",
+		},
+		{
+			name:     "timestamp at base",
+			manifest: "file b.aof seq 2 type b starttime 100 flushes 1\nfile i.aof seq 1 type i\n",
+			limit:    &Limit{Timestamp: 100},
+			stop:     int64(len(setA)),
+		},
+		{
+			name:     "flushdb compacted into base",
+			manifest: "file b.aof seq 2 type b starttime 100 flushes 1\nfile i.aof seq 1 type i\n",
+			limit:    &Limit{Flushes: 1},
+			wantErr:  "FLUSHDB #1 is compacted",
+		},
+		{
+			// the FLUSHDB in base counts, so the second one is the first in incr file
+			name:     "flushdb after base",
+			manifest: "file b.aof seq 2 type b starttime 100 flushes 1\nfile i.aof seq 1 type i\n",
+			limit:    &Limit{Flushes: 2},
+			stop:     int64(len(setA + "#TS:101\r\n" + setB)),
+		},
+		{
+			// the base file migrated from single file aof keeps the whole history
+			name:     "migrated base",
+			manifest: "file b.aof seq 1 type b\nfile i.aof seq 1 type i\n",
+			limit:    &Limit{Timestamp: 1, Flushes: 1},
+			stop:     int64(len(setA)),
+		},
+	}
+	for _, tt := range tests {
+		aofDir := setupAofDir(t, map[string]string{"appendonly.aof.manifest": tt.manifest}, "appendonly.aof.manifest")
+		err := tt.limit.Prepare(filepath.Join(aofDir, "appendonly.aof.manifest"))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: expect error %q, got %v", tt.name, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		_, stop, loadErr := readAll(setA+"#TS:101\r\n"+setB+flushdb+setC, tt.limit)
+		if loadErr != nil || stop != tt.stop {
+			t.Errorf("%s: expect stop at %d, got %d %v", tt.name, tt.stop, stop, loadErr)
+		}
+	}
+}
+
+// TestRewriteRecordsBase checks the base file written by rewrite is recorded with its start time and the FLUSHDB in it
+func TestRewriteRecordsBase(t *testing.T) {
+	flushdb := cmd("FLUSHDB")
+	files := map[string]string{
+		"appendonly.aof.manifest": "file appendonly.aof seq 1 type b\n" +
+			"file appendonly.aof.1.incr.aof seq 1 type i\n",
+		"appendonly.aof":            setA + flushdb,
+		"appendonly.aof.1.incr.aof": setB + flushdb + setC,
+	}
+	aofDir := setupAofDir(t, files, "appendonly.aof.manifest", "appendonly.aof", "appendonly.aof.1.incr.aof")
+	handler := makeTestHandler(t, &fakeDB{})
+	handler.tmpDBMaker = func() database.DBEngine {
+		return &fakeDB{}
+	}
+	if err := handler.openIncrFileOnStartup(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = handler.aofFile.Close()
+	}()
+
+	before := time.Now().Unix()
+	if err := handler.rewrite(); err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now().Unix()
+	m, err := readManifestFile(handler.manifestPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.base.name != "appendonly.aof.2.base.aof" || m.base.startTime < before || m.base.startTime > after || m.base.flushes != 2 {
+		t.Fatalf("expect base file started in [%d, %d] with 2 flushes, got %+v", before, after, m.base)
+	}
+	if len(m.incrs) != 1 || m.incrs[0].name != "appendonly.aof.2.incr.aof" {
+		t.Fatalf("expect the new incr file left, got %q", m.fileNames())
+	}
+
+	// the next rewrite counts the FLUSHDB compacted into the old base file
+	if _, err := handler.aofFile.Write([]byte(flushdb)); err != nil {
+		t.Fatal(err)
+	}
+	if err := handler.rewrite(); err != nil {
+		t.Fatal(err)
+	}
+	m, err = readManifestFile(filepath.Join(aofDir, "appendonly.aof.manifest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.base.name != "appendonly.aof.3.base.aof" || m.base.flushes != 3 {
+		t.Fatalf("expect base file with 3 flushes, got %+v", m.base)
+	}
+}
@@ -0,0 +1,200 @@
+package aof
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// types of files recorded in manifest
+const (
+	fileTypeBase = "b"
+	fileTypeIncr = "i"
+)
+
+const (
+	baseAofSuffix  = ".base.aof"
+	baseRdbSuffix  = ".base.rdb"
+	incrAofSuffix  = ".incr.aof"
+	manifestSuffix = ".manifest"
+)
+
+// aofFileInfo is a file recorded in manifest
+type aofFileInfo struct {
+	name     string
+	seq      int64
+	fileType string
+	// startTime and flushes are recorded for the base file written by rewrite, which holds the data at the unix time
+	// startTime when the rewrite started, and compacts the commands before it including flushes FLUSHDB.
+	// startTime is 0 if the file is migrated from single file aof, which keeps the whole history
+	startTime int64
+	flushes   int
+}
+
+// manifest records the files of multi-part aof, the base file is generated by rewrite,
+// and the incr files store commands executed after that, they are loaded in order
+// 多文件 AOF 的清单：一个重写生成的 base 文件，以及之后依次追加命令的若干 incr 文件
+type manifest struct {
+	// base is nil if aof has never been rewritten
+	base  *aofFileInfo
+	incrs []*aofFileInfo
+	// baseSeq and incrSeq are the largest seq of base and incr files ever used
+	baseSeq int64
+	incrSeq int64
+}
+
+// parseManifest reads lines like `file appendonly.aof.1.incr.aof seq 1 type i`,
+// the line of base file written by rewrite ends with `starttime <unix time> flushes <n>`
+func parseManifest(reader io.Reader) (*manifest, error) {
+	m := &manifest{}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields)%2 != 0 {
+			return nil, errors.New("invalid manifest line: " + line)
+		}
+		info := &aofFileInfo{}
+		for i := 0; i < len(fields); i += 2 {
+			switch fields[i] {
+			case "file":
+				info.name = fields[i+1]
+			case "seq":
+				seq, err := strconv.ParseInt(fields[i+1], 10, 64)
+				if err != nil {
+					return nil, errors.New("invalid manifest line: " + line)
+				}
+				info.seq = seq
+			case "type":
+				info.fileType = fields[i+1]
+			case "starttime":
+				ts, err := strconv.ParseInt(fields[i+1], 10, 64)
+				if err != nil {
+					return nil, errors.New("invalid manifest line: " + line)
+				}
+				info.startTime = ts
+			case "flushes":
+				flushes, err := strconv.Atoi(fields[i+1])
+				if err != nil {
+					return nil, errors.New("invalid manifest line: " + line)
+				}
+				info.flushes = flushes
+			}
+		}
+		if info.name == "" || strings.ContainsAny(info.name, "/\\") {
+			return nil, errors.New("invalid file name in manifest line: " + line)
+		}
+		switch info.fileType {
+		case fileTypeBase:
+			if m.base != nil {
+				return nil, errors.New("found duplicate base file in manifest")
+			}
+			m.base = info
+			if info.seq > m.baseSeq {
+				m.baseSeq = info.seq
+			}
+		case fileTypeIncr:
+			if len(m.incrs) > 0 && info.seq <= m.incrs[len(m.incrs)-1].seq {
+				return nil, errors.New("incr files in manifest are not in order")
+			}
+			m.incrs = append(m.incrs, info)
+			m.incrSeq = info.seq
+		default:
+			return nil, errors.New("unknown file type in manifest line: " + line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *manifest) encode() []byte {
+	var buf bytes.Buffer
+	for _, info := range m.files() {
+		buf.WriteString(fmt.Sprintf("file %s seq %d type %s", info.name, info.seq, info.fileType))
+		if info.startTime > 0 {
+			buf.WriteString(fmt.Sprintf(" starttime %d flushes %d", info.startTime, info.flushes))
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// files returns the files in the order of loading
+func (m *manifest) files() []*aofFileInfo {
+	files := make([]*aofFileInfo, 0, len(m.incrs)+1)
+	if m.base != nil {
+		files = append(files, m.base)
+	}
+	return append(files, m.incrs...)
+}
+
+func (m *manifest) fileNames() []string {
+	files := m.files()
+	names := make([]string, len(files))
+	for i, info := range files {
+		names[i] = info.name
+	}
+	return names
+}
+
+func (m *manifest) clone() *manifest {
+	cloned := *m
+	cloned.incrs = make([]*aofFileInfo, len(m.incrs))
+	copy(cloned.incrs, m.incrs)
+	return &cloned
+}
+
+// readManifestFile reads the manifest file
+func readManifestFile(path string) (*manifest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseManifest(file)
+}
+
+// writeManifestFile writes the manifest into a temp file and renames it, so the manifest is replaced atomically
+func writeManifestFile(path string, m *manifest) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "temp-*"+manifestSuffix)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name()) // no-op if it has been renamed
+	}()
+	if _, err = file.Write(m.encode()); err != nil {
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// ManifestFiles returns the paths of aof files recorded in the manifest in the order of loading
+func ManifestFiles(manifestPath string) ([]string, error) {
+	m, err := readManifestFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(manifestPath)
+	names := m.fileNames()
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = filepath.Join(dir, name)
+	}
+	return paths, nil
+}
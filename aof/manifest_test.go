@@ -0,0 +1,199 @@
+package aof
+
+import (
+	"go-redis/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseManifest(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "base and incrs",
+			input: "file appendonly.aof.2.base.rdb seq 2 type b\n" +
+				"file appendonly.aof.3.incr.aof seq 3 type i\n" +
+				"file appendonly.aof.4.incr.aof seq 4 type i\n",
+			want: []string{"appendonly.aof.2.base.rdb", "appendonly.aof.3.incr.aof", "appendonly.aof.4.incr.aof"},
+		},
+		{
+			// the base file is loaded first wherever it is written
+			name: "base after incrs",
+			input: "file appendonly.aof.1.incr.aof seq 1 type i\n" +
+				"file appendonly.aof.1.base.aof seq 1 type b\n",
+			want: []string{"appendonly.aof.1.base.aof", "appendonly.aof.1.incr.aof"},
+		},
+		{
+			name:  "comments, blank lines and unknown keys",
+			input: "# comment\n\n  file a.aof seq 1 type i startoffset 0  \r\n",
+			want:  []string{"a.aof"},
+		},
+		{
+			name:  "no base",
+			input: "file appendonly.aof.1.incr.aof seq 1 type i\n",
+			want:  []string{"appendonly.aof.1.incr.aof"},
+		},
+		{
+			name:  "empty",
+			input: "",
+		},
+		{
+			name:    "odd number of fields",
+			input:   "file a.aof seq 1 type\n",
+			wantErr: "invalid manifest line",
+		},
+		{
+			name:    "invalid seq",
+			input:   "file a.aof seq x type i\n",
+			wantErr: "invalid manifest line",
+		},
+		{
+			name:    "missing file name",
+			input:   "seq 1 type i\n",
+			wantErr: "invalid file name",
+		},
+		{
+			name:    "path in file name",
+			input:   "file ../a.aof seq 1 type i\n",
+			wantErr: "invalid file name",
+		},
+		{
+			name:    "unknown type",
+			input:   "file a.aof seq 1 type h\n",
+			wantErr: "unknown file type",
+		},
+		{
+			name:    "duplicate base",
+			input:   "file a.aof seq 1 type b\nfile b.aof seq 2 type b\n",
+			wantErr: "duplicate base file",
+		},
+		{
+			name:    "incrs out of order",
+			input:   "file a.aof seq 2 type i\nfile b.aof seq 2 type i\n",
+			wantErr: "not in order",
+		},
+	}
+	for _, tt := range tests {
+		m, err := parseManifest(strings.NewReader(tt.input))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: expect error %q, got %v", tt.name, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := m.fileNames(); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: expect files %q, got %q", tt.name, tt.want, got)
+		}
+		// encoding and parsing again keeps the files
+		decoded, err := parseManifest(strings.NewReader(string(m.encode())))
+		if err != nil || strings.Join(decoded.fileNames(), ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: expect files %q after encoding, got %v %v", tt.name, tt.want, decoded, err)
+		}
+	}
+
+	m, _ := parseManifest(strings.NewReader("file b seq 5 type b\nfile i3 seq 3 type i\nfile i7 seq 7 type i\n"))
+	if m.baseSeq != 5 || m.incrSeq != 7 {
+		t.Errorf("expect base seq 5 and incr seq 7, got %d %d", m.baseSeq, m.incrSeq)
+	}
+
+	// the start time of the base file written by rewrite is kept by encoding
+	const rewritten = "file b seq 2 type b starttime 100 flushes 3\nfile i seq 1 type i\n"
+	m, err := parseManifest(strings.NewReader(rewritten))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.base.startTime != 100 || m.base.flushes != 3 {
+		t.Errorf("expect start time 100 and 3 flushes, got %+v", m.base)
+	}
+	if got := string(m.encode()); got != rewritten {
+		t.Errorf("expect %q, got %q", rewritten, got)
+	}
+	for _, input := range []string{"file b seq 2 type b starttime x\n", "file b seq 2 type b flushes x\n"} {
+		if _, err := parseManifest(strings.NewReader(input)); err == nil {
+			t.Errorf("%q: expect error", input)
+		}
+	}
+}
+
+// TestMigrateSingleFile starts with the aof of single file format, it is moved into the aof dir as the base file
+func TestMigrateSingleFile(t *testing.T) {
+	aofDir := setupAofDir(t, nil)
+	// the aof dir is created by migration
+	if err := os.Remove(aofDir); err != nil {
+		t.Fatal(err)
+	}
+	oldPath := config.Properties.AppendFilename
+	if err := os.WriteFile(oldPath, []byte(setA+tx), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db := &fakeDB{}
+	handler := makeTestHandler(t, db)
+	if err := handler.loadAofOnStartup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := handler.openIncrFileOnStartup(); err != nil {
+		t.Fatal(err)
+	}
+	_ = handler.aofFile.Close()
+	if got := strings.Join(db.cmds, ","); got != "SET a 1,MULTI,SET b 2,EXEC" {
+		t.Fatalf("expect the old aof loaded, got %q", got)
+	}
+	if _, err := os.Stat(oldPath); !os.IsNotExist(err) {
+		t.Fatalf("expect the old aof moved, got %v", err)
+	}
+	content, err := os.ReadFile(handler.manifestPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantManifest := "file appendonly.aof seq 1 type b\nfile appendonly.aof.1.incr.aof seq 1 type i\n"
+	if string(content) != wantManifest {
+		t.Fatalf("expect manifest %q, got %q", wantManifest, content)
+	}
+
+	// restarting reads the manifest and appends to the existing incr file
+	if err := os.WriteFile(filepath.Join(aofDir, "appendonly.aof.1.incr.aof"), []byte(setC), 0644); err != nil {
+		t.Fatal(err)
+	}
+	db = &fakeDB{}
+	handler = makeTestHandler(t, db)
+	if err := handler.loadAofOnStartup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := handler.openIncrFileOnStartup(); err != nil {
+		t.Fatal(err)
+	}
+	_ = handler.aofFile.Close()
+	if got := strings.Join(db.cmds, ","); got != "SET a 1,MULTI,SET b 2,EXEC,SET c 3" {
+		t.Fatalf("expect base and incr files loaded, got %q", got)
+	}
+	if got := handler.manifest.fileNames(); len(got) != 2 {
+		t.Fatalf("expect no new incr file, got %q", got)
+	}
+}
+
+// TestMigrateInterrupted covers a crash after the old aof was moved but before the manifest was written
+func TestMigrateInterrupted(t *testing.T) {
+	setupAofDir(t, map[string]string{"appendonly.aof": setA}, "appendonly.aof")
+	db := &fakeDB{}
+	handler := makeTestHandler(t, db)
+	if err := handler.loadAofOnStartup(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(db.cmds, ","); got != "SET a 1" {
+		t.Fatalf("expect the moved aof loaded, got %q", got)
+	}
+	if handler.manifest.base == nil || handler.manifest.base.name != "appendonly.aof" {
+		t.Fatalf("expect the moved aof as base file, got %+v", handler.manifest.base)
+	}
+}
@@ -0,0 +1,153 @@
+package aof
+
+import (
+	"go-redis/datastruct/hash"
+	"go-redis/datastruct/list"
+	"go-redis/datastruct/set"
+	"go-redis/datastruct/sortedset"
+	"go-redis/interface/database"
+	"go-redis/rdb"
+	"strconv"
+	"time"
+)
+
+var pExpireAtBytes = []byte("PEXPIREAT")
+
+// MakeExpireCmd generates command line to set expiration for the given key
+// 过期时间统一以绝对时间 PEXPIREAT 的形式写入 AOF，保证重放时结果一致
+func MakeExpireCmd(key string, expireAt time.Time) CmdLine {
+	args := make([][]byte, 3)
+	args[0] = pExpireAtBytes
+	args[1] = []byte(key)
+	args[2] = []byte(strconv.FormatInt(expireAt.UnixNano()/1e6, 10))
+	return args
+}
+
+// EntityToCmd serializes data entity to redis command, returns nil if the type of data is unknown
+// 将数据序列化为能够重建它的最少命令，用于 AOF 重写
+func EntityToCmd(key string, entity *database.DataEntity) CmdLine {
+	if entity == nil {
+		return nil
+	}
+	switch val := entity.Data.(type) {
+	case []byte:
+		return stringToCmd(key, val)
+	case list.List:
+		return listToCmd(key, val)
+	case *hash.Hash:
+		return hashToCmd(key, val)
+	case *set.Set:
+		return setToCmd(key, val)
+	case *sortedset.SortedSet:
+		return zSetToCmd(key, val)
+	}
+	return nil
+}
+
+var setCmd = []byte("SET")
+
+func stringToCmd(key string, bytes []byte) CmdLine {
+	args := make([][]byte, 3)
+	args[0] = setCmd
+	args[1] = []byte(key)
+	args[2] = bytes
+	return args
+}
+
+var rPushAllCmd = []byte("RPUSH")
+
+func listToCmd(key string, list list.List) CmdLine {
+	args := make([][]byte, 2, 2+list.Len())
+	args[0] = rPushAllCmd
+	args[1] = []byte(key)
+	list.ForEach(func(i int, val interface{}) bool {
+		bytes, _ := val.([]byte)
+		args = append(args, bytes)
+		return true
+	})
+	return args
+}
+
+var sAddCmd = []byte("SADD")
+
+func setToCmd(key string, set *set.Set) CmdLine {
+	args := make([][]byte, 2, 2+set.Len())
+	args[0] = sAddCmd
+	args[1] = []byte(key)
+	set.ForEach(func(val string) bool {
+		args = append(args, []byte(val))
+		return true
+	})
+	return args
+}
+
+var hSetCmd = []byte("HSET")
+
+func hashToCmd(key string, hash *hash.Hash) CmdLine {
+	args := make([][]byte, 2, 2+hash.Len()*2)
+	args[0] = hSetCmd
+	args[1] = []byte(key)
+	hash.ForEach(func(field string, val []byte) bool {
+		args = append(args, []byte(field), val)
+		return true
+	})
+	return args
+}
+
+var zAddCmd = []byte("ZADD")
+
+func zSetToCmd(key string, zset *sortedset.SortedSet) CmdLine {
+	args := make([][]byte, 2, 2+zset.Len()*2)
+	args[0] = zAddCmd
+	args[1] = []byte(key)
+	zset.ForEachByRank(0, zset.Len(), false, func(element *sortedset.Element) bool {
+		score := strconv.FormatFloat(element.Score, 'f', -1, 64)
+		args = append(args, []byte(score), []byte(element.Member))
+		return true
+	})
+	return args
+}
+
+// EntityToRDB writes data entity into rdb, ignores the data of unknown type
+// 将数据以 RDB 格式写入，用于 RDB 持久化和 AOF 的 RDB 前导部分
+func EntityToRDB(encoder *rdb.Encoder, key string, entity *database.DataEntity, expiration *time.Time) error {
+	if entity == nil {
+		return nil
+	}
+	switch val := entity.Data.(type) {
+	case []byte:
+		return encoder.WriteStringObject(key, val, expiration)
+	case list.List:
+		values := make([][]byte, 0, val.Len())
+		val.ForEach(func(i int, v interface{}) bool {
+			bytes, _ := v.([]byte)
+			values = append(values, bytes)
+			return true
+		})
+		return encoder.WriteListObject(key, values, expiration)
+	case *hash.Hash:
+		fields := make([]string, 0, val.Len())
+		values := make([][]byte, 0, val.Len())
+		val.ForEach(func(field string, value []byte) bool {
+			fields = append(fields, field)
+			values = append(values, value)
+			return true
+		})
+		return encoder.WriteHashObject(key, fields, values, expiration)
+	case *set.Set:
+		members := make([][]byte, 0, val.Len())
+		val.ForEach(func(member string) bool {
+			members = append(members, []byte(member))
+			return true
+		})
+		return encoder.WriteSetObject(key, members, expiration)
+	case *sortedset.SortedSet:
+		entries := make([]*rdb.ZSetEntry, 0, val.Len())
+		val.ForEachByRank(0, val.Len(), false, func(element *sortedset.Element) bool {
+			entries = append(entries, &rdb.ZSetEntry{Member: element.Member, Score: element.Score})
+			return true
+		})
+		return encoder.WriteZSetObject(key, entries, expiration)
+	}
+	return nil
+}
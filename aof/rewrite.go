@@ -0,0 +1,290 @@
+package aof
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"go-redis/config"
+	"go-redis/interface/database"
+	"go-redis/lib/logger"
+	"go-redis/lib/utils"
+	"go-redis/rdb"
+	"go-redis/resp/reply"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// ErrRewriteInProgress is returned when a rewrite is requested while another one is running
+var ErrRewriteInProgress = errors.New("ERR Background append only file rewriting already in progress")
+
+// RewriteCtx holds the state of a running aof rewrite
+type RewriteCtx struct {
+	tmpFile *os.File // tmpFile is the file handler of the new base file
+	files   []string // files is the aof files to rewrite, they are recorded in manifest before rewrite started
+	incrSeq int64    // incrSeq is the seq of the first incr file opened after rewrite started
+	// startTime is the unix time when the commands began to be appended to the new incr file,
+	// the new base file holds the data at that time
+	startTime int64
+	// flushes counts the FLUSHDB compacted by the rewrite, including those compacted into the old base file
+	flushes int
+}
+
+// BGRewrite starts rewriting aof in background, returns ErrRewriteInProgress if a rewrite is running
+func (handler *AofHandler) BGRewrite() error {
+	if !handler.rewriting.TryLock() {
+		return ErrRewriteInProgress
+	}
+	handler.setRewriteInProgress(true)
+	go func() {
+		defer handler.rewriting.Unlock()
+		defer handler.setRewriteInProgress(false)
+		if err := handler.rewrite(); err != nil {
+			logger.Error("aof rewrite failed: " + err.Error())
+		}
+	}()
+	return nil
+}
+
+// rewrite compacts the aof files
+// AOF 重写：先切换到新的 incr 文件继续追加命令，再将之前的文件重放到临时数据库，生成新的 base 文件，最后更新清单并删除旧文件
+func (handler *AofHandler) rewrite() error {
+	ctx, err := handler.startRewrite()
+	if err != nil {
+		return err
+	}
+	err = handler.doRewrite(ctx)
+	if err != nil {
+		_ = ctx.tmpFile.Close()
+		_ = os.Remove(ctx.tmpFile.Name())
+		return err
+	}
+	return handler.finishRewrite(ctx)
+}
+
+// startRewrite pauses aof writing, switches to a new incr file and creates the temp base file
+func (handler *AofHandler) startRewrite() (*RewriteCtx, error) {
+	handler.pausingAof.Lock() // pausing aof
+	defer handler.pausingAof.Unlock()
+
+	err := handler.aofFile.Sync()
+	if err != nil {
+		return nil, err
+	}
+	// create tmp file in the same directory, so that it can be renamed to the base file
+	file, err := os.CreateTemp(handler.aofDir, "temp-rewriteaof-*.aof")
+	if err != nil {
+		return nil, err
+	}
+	files := handler.manifest.fileNames()
+	flushes := 0
+	if handler.manifest.base != nil {
+		flushes = handler.manifest.base.flushes
+	}
+	oldFile := handler.aofFile
+	if err := handler.openNewIncrFile(); err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return nil, err
+	}
+	_ = oldFile.Close()
+	return &RewriteCtx{
+		tmpFile:   file,
+		files:     files,
+		incrSeq:   handler.manifest.incrSeq,
+		startTime: time.Now().Unix(),
+		flushes:   flushes,
+	}, nil
+}
+
+// doRewrite loads the aof files before rewrite started into a temporary db and dumps it into the temp file
+func (handler *AofHandler) doRewrite(ctx *RewriteCtx) error {
+	tmpFile := ctx.tmpFile
+
+	// load aof tmpFile
+	tmpDB := handler.tmpDBMaker()
+	tmpAof := &AofHandler{
+		db:     tmpDB,
+		aofDir: handler.aofDir,
+	}
+	defer tmpDB.Close()
+	if err := tmpAof.loadFiles(ctx.files); err != nil {
+		return err
+	}
+	ctx.flushes += tmpAof.loadedFlushes
+
+	if config.Properties.AofUseRdbPreamble {
+		return writeRDBPreamble(tmpFile, tmpDB)
+	}
+
+	// rewrite aof tmpFile
+	now := time.Now()
+	for i := 0; i < config.Properties.Databases; i++ {
+		selected := false
+		var err error
+		tmpDB.ForEach(i, func(key string, entity *database.DataEntity, expiration *time.Time) bool {
+			if expiration != nil && !expiration.After(now) {
+				return true // skip expired key
+			}
+			cmd := EntityToCmd(key, entity)
+			if cmd == nil {
+				return true
+			}
+			if !selected {
+				// select db only if it has data
+				data := reply.MakeMultiBulkReply(utils.ToCmdLine("SELECT", strconv.Itoa(i))).ToBytes()
+				if _, err = tmpFile.Write(data); err != nil {
+					return false
+				}
+				selected = true
+			}
+			if _, err = tmpFile.Write(reply.MakeMultiBulkReply(cmd).ToBytes()); err != nil {
+				return false
+			}
+			if expiration != nil {
+				cmd := MakeExpireCmd(key, *expiration)
+				if _, err = tmpFile.Write(reply.MakeMultiBulkReply(cmd).ToBytes()); err != nil {
+					return false
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeRDBPreamble dumps tmpDB into the temp file in rdb format
+func writeRDBPreamble(tmpFile *os.File, tmpDB database.DBEngine) error {
+	writer := bufio.NewWriter(tmpFile)
+	encoder := rdb.NewEncoder(writer)
+	if err := encoder.WriteHeader(); err != nil {
+		return err
+	}
+	if err := encoder.WriteAux("aof-preamble", "1"); err != nil {
+		return err
+	}
+	now := time.Now()
+	for i := 0; i < config.Properties.Databases; i++ {
+		var keyCount, ttlCount uint64
+		tmpDB.ForEach(i, func(key string, entity *database.DataEntity, expiration *time.Time) bool {
+			if expiration == nil || expiration.After(now) {
+				keyCount++
+				if expiration != nil {
+					ttlCount++
+				}
+			}
+			return true
+		})
+		if keyCount == 0 {
+			continue
+		}
+		if err := encoder.WriteDBHeader(uint(i), keyCount, ttlCount); err != nil {
+			return err
+		}
+		var err error
+		tmpDB.ForEach(i, func(key string, entity *database.DataEntity, expiration *time.Time) bool {
+			if expiration != nil && !expiration.After(now) {
+				return true // skip expired key
+			}
+			err = EntityToRDB(encoder, key, entity, expiration)
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := encoder.WriteEnd(); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// finishRewrite renames the temp file to a new base file, and replaces the files rewritten by it in manifest
+func (handler *AofHandler) finishRewrite(ctx *RewriteCtx) error {
+	tmpFile := ctx.tmpFile
+	err := tmpFile.Sync()
+	_ = tmpFile.Close()
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return err
+	}
+
+	handler.pausingAof.Lock() // pausing aof
+	defer handler.pausingAof.Unlock()
+
+	m := handler.manifest.clone()
+	m.baseSeq++
+	suffix := baseAofSuffix
+	if config.Properties.AofUseRdbPreamble {
+		suffix = baseRdbSuffix
+	}
+	m.base = &aofFileInfo{
+		name:      fmt.Sprintf("%s.%d%s", handler.aofFilename, m.baseSeq, suffix),
+		seq:       m.baseSeq,
+		fileType:  fileTypeBase,
+		startTime: ctx.startTime,
+		flushes:   ctx.flushes,
+	}
+	m.incrs = m.incrs[:0]
+	for _, info := range handler.manifest.incrs {
+		if info.seq >= ctx.incrSeq {
+			m.incrs = append(m.incrs, info)
+		}
+	}
+	basePath := filepath.Join(handler.aofDir, m.base.name)
+	if err := os.Rename(tmpFile.Name(), basePath); err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return err
+	}
+	if err := writeManifestFile(handler.manifestPath(), m); err != nil {
+		_ = os.Remove(basePath)
+		return err
+	}
+	handler.manifest = m
+
+	// the rewritten files are useless now
+	for _, name := range ctx.files {
+		if err := os.Remove(filepath.Join(handler.aofDir, name)); err != nil {
+			logger.Warn("remove aof file failed: " + err.Error())
+		}
+	}
+
+	handler.statusMu.Lock()
+	handler.aofSize = handler.totalSize()
+	handler.aofBaseSize = handler.aofSize
+	handler.statusMu.Unlock()
+	logger.Info("aof rewrite finished")
+	return nil
+}
+
+func (handler *AofHandler) setRewriteInProgress(inProgress bool) {
+	handler.statusMu.Lock()
+	handler.rewriteInProgress = inProgress
+	handler.statusMu.Unlock()
+}
+
+// needRewrite tells whether the aof file grows enough to trigger an automatic rewrite
+func (handler *AofHandler) needRewrite() bool {
+	percentage := config.Properties.AutoAofRewritePercentage
+	if percentage <= 0 {
+		return false
+	}
+	handler.statusMu.Lock()
+	defer handler.statusMu.Unlock()
+	if handler.rewriteInProgress {
+		return false
+	}
+	if handler.aofSize < int64(config.Properties.AutoAofRewriteMinSize) {
+		return false
+	}
+	base := handler.aofBaseSize
+	if base <= 0 {
+		base = 1
+	}
+	growth := (handler.aofSize - base) * 100 / base
+	return growth >= int64(percentage)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"github.com/jolestar/go-commons-pool/v2"
+	"go-redis/config"
 	"go-redis/resp/client"
 )
 
@@ -17,6 +18,13 @@ func (f *connectionFactory) MakeObject(ctx context.Context) (*pool.PooledObject,
 		return nil, err
 	}
 	c.Start()
+	// nodes of cluster share the same requirepass
+	if config.Properties.RequirePass != "" {
+		if err := c.Auth(config.Properties.RequirePass); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
 	return pool.NewPooledObject(c), nil
 }
 
@@ -72,6 +72,16 @@ func (cluster *ClusterDatabase) Exec(c resp.Connection, cmdLine [][]byte) (resul
 		}
 	}()
 	cmdName := strings.ToLower(string(cmdLine[0]))
+	if cmdName == "auth" {
+		return database.Auth(c, cmdLine[1:])
+	}
+	if !database.IsAuthenticated(c) {
+		return reply.MakeErrReply("NOAUTH Authentication required.")
+	}
+	// peers trust each other, so permission is checked on the node receiving the command
+	if errReply := database.CheckPermission(c, cmdLine); errReply != nil {
+		return errReply
+	}
 	cmdFunc, ok := router[cmdName]
 	if !ok {
 		return reply.MakeErrReply("ERR unknown command '" + cmdName + "', or not supported in cluster mode")
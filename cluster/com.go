@@ -8,6 +8,7 @@ import (
 	"go-redis/resp/client"
 	"go-redis/resp/reply"
 	"strconv"
+	"strings"
 )
 
 func (cluster *ClusterDatabase) getPeerClient(peer string) (*client.Client, error) {
@@ -62,3 +63,16 @@ func (cluster *ClusterDatabase) broadcast(c resp.Connection, args [][]byte) map[
 	}
 	return result
 }
+
+// relayByKeys relays a command touching several keys to the node holding them,
+// all the keys must within the same node
+func (cluster *ClusterDatabase) relayByKeys(c resp.Connection, args [][]byte, keys []string) resp.Reply {
+	cmdName := strings.ToLower(string(args[0]))
+	peer := cluster.peerPicker.PickNode(keys[0])
+	for _, key := range keys[1:] {
+		if cluster.peerPicker.PickNode(key) != peer {
+			return reply.MakeErrReply("ERR " + cmdName + " must within one slot in cluster mode")
+		}
+	}
+	return cluster.relay(peer, c, args)
+}
@@ -1,6 +1,9 @@
 package cluster
 
-import "go-redis/interface/resp"
+import (
+	"go-redis/database"
+	"go-redis/interface/resp"
+)
 
 // CmdLine is alias for [][]byte, represents a command line
 type CmdLine = [][]byte
@@ -8,27 +11,120 @@ type CmdLine = [][]byte
 func makeRouter() map[string]CmdFunc {
 	routerMap := make(map[string]CmdFunc)
 	routerMap["ping"] = ping
+	routerMap["command"] = execLocal
+	routerMap["bgrewriteaof"] = execLocal
+	routerMap["info"] = execLocal
+	routerMap["save"] = execLocal
+	routerMap["bgsave"] = execLocal
+	routerMap["lastsave"] = execLocal
+	// users are not synchronized between nodes
+	routerMap["acl"] = execLocal
 
 	routerMap["del"] = Del
 
 	routerMap["exists"] = defaultFunc
 	routerMap["type"] = defaultFunc
-	routerMap["rename"] = Rename
-	routerMap["renamenx"] = Rename
+	routerMap["object"] = defaultFunc
+	routerMap["rename"] = defaultFunc
+	routerMap["renamenx"] = defaultFunc
+	routerMap["expire"] = defaultFunc
+	routerMap["expireat"] = defaultFunc
+	routerMap["pexpire"] = defaultFunc
+	routerMap["pexpireat"] = defaultFunc
+	routerMap["ttl"] = defaultFunc
+	routerMap["pttl"] = defaultFunc
+	routerMap["persist"] = defaultFunc
 
 	routerMap["set"] = defaultFunc
 	routerMap["setnx"] = defaultFunc
 	routerMap["get"] = defaultFunc
 	routerMap["getset"] = defaultFunc
+	routerMap["setex"] = defaultFunc
+	routerMap["psetex"] = defaultFunc
+	routerMap["getex"] = defaultFunc
+	routerMap["getdel"] = defaultFunc
+
+	routerMap["lpush"] = defaultFunc
+	routerMap["rpush"] = defaultFunc
+	routerMap["lpop"] = defaultFunc
+	routerMap["rpop"] = defaultFunc
+	routerMap["lrange"] = defaultFunc
+	routerMap["llen"] = defaultFunc
+	routerMap["lindex"] = defaultFunc
+	routerMap["lset"] = defaultFunc
+	routerMap["lrem"] = defaultFunc
+	routerMap["ltrim"] = defaultFunc
+	routerMap["linsert"] = defaultFunc
+	routerMap["lpos"] = defaultFunc
+	routerMap["lmove"] = defaultFunc
+
+	routerMap["hset"] = defaultFunc
+	routerMap["hsetnx"] = defaultFunc
+	routerMap["hget"] = defaultFunc
+	routerMap["hmget"] = defaultFunc
+	routerMap["hexists"] = defaultFunc
+	routerMap["hdel"] = defaultFunc
+	routerMap["hlen"] = defaultFunc
+	routerMap["hstrlen"] = defaultFunc
+	routerMap["hgetall"] = defaultFunc
+	routerMap["hkeys"] = defaultFunc
+	routerMap["hvals"] = defaultFunc
+	routerMap["hincrby"] = defaultFunc
+	routerMap["hincrbyfloat"] = defaultFunc
+	routerMap["hrandfield"] = defaultFunc
+	routerMap["hscan"] = defaultFunc
+	routerMap["sadd"] = defaultFunc
+	routerMap["sismember"] = defaultFunc
+	routerMap["smismember"] = defaultFunc
+	routerMap["srem"] = defaultFunc
+	routerMap["spop"] = defaultFunc
+	routerMap["scard"] = defaultFunc
+	routerMap["smembers"] = defaultFunc
+	routerMap["srandmember"] = defaultFunc
+	routerMap["smove"] = defaultFunc
+	routerMap["sinter"] = defaultFunc
+	routerMap["sinterstore"] = defaultFunc
+	routerMap["sunion"] = defaultFunc
+	routerMap["sunionstore"] = defaultFunc
+	routerMap["sdiff"] = defaultFunc
+	routerMap["sdiffstore"] = defaultFunc
+	routerMap["zadd"] = defaultFunc
+	routerMap["zscore"] = defaultFunc
+	routerMap["zincrby"] = defaultFunc
+	routerMap["zcard"] = defaultFunc
+	routerMap["zrank"] = defaultFunc
+	routerMap["zrevrank"] = defaultFunc
+	routerMap["zrange"] = defaultFunc
+	routerMap["zrem"] = defaultFunc
+	routerMap["zremrangebyscore"] = defaultFunc
+	routerMap["zremrangebyrank"] = defaultFunc
+	routerMap["zremrangebylex"] = defaultFunc
+	routerMap["zcount"] = defaultFunc
+	routerMap["zlexcount"] = defaultFunc
+	routerMap["zpopmin"] = defaultFunc
+	routerMap["zpopmax"] = defaultFunc
+	routerMap["zrangestore"] = defaultFunc
+	routerMap["zunionstore"] = defaultFunc
+	routerMap["zinterstore"] = defaultFunc
 
 	routerMap["flushdb"] = FlushDB
 
 	return routerMap
 }
 
-// relay command to responsible peer, and return its reply to client
+// relay command to the peer holding its keys, and return its reply to client
+// the keys are found by the metadata of command, all of them must within the same node
 func defaultFunc(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
-	key := string(args[1])
-	peer := cluster.peerPicker.PickNode(key)
-	return cluster.relay(peer, c, args)
+	writeKeys, readKeys := database.GetRelatedKeys(args)
+	keys := append(writeKeys, readKeys...)
+	if len(keys) == 0 {
+		// unknown command or wrong number of arguments, let local db reply the error
+		return execLocal(cluster, c, args)
+	}
+	return cluster.relayByKeys(c, args, keys)
+}
+
+// execLocal executes command on current node, for commands without keys
+func execLocal(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	return cluster.db.Exec(c, args)
 }
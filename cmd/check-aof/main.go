@@ -0,0 +1,147 @@
+// check-aof checks aof files and reports the first bad command, the file can be fixed by truncating it.
+// It also truncates aof to a point in time, eg. the moment before a FLUSHDB executed by mistake,
+// the server loading the truncated aof recovers the data at that time.
+//
+// usage: check-aof [--fix | --truncate-to-timestamp <unix time> | --truncate-before-flushdb <n>] <file.manifest|file.aof>
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"go-redis/aof"
+	"os"
+	"strings"
+)
+
+func usage() {
+	fmt.Println("Usage: check-aof [--fix | --truncate-to-timestamp <unix time> | --truncate-before-flushdb <n>] <file.manifest|file.aof>")
+	flag.PrintDefaults()
+	os.Exit(1)
+}
+
+func main() {
+	fix := flag.Bool("fix", false, "truncate the last file at the first bad command")
+	timestamp := flag.Int64("truncate-to-timestamp", 0, "truncate aof at the first timestamp annotation later than the unix time")
+	flushes := flag.Int("truncate-before-flushdb", 0, "truncate aof before the n-th FLUSHDB")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 1 || *timestamp < 0 || *flushes < 0 {
+		usage()
+	}
+	filename := flag.Arg(0)
+
+	files := []string{filename}
+	isManifest := strings.HasSuffix(filename, ".manifest")
+	if isManifest {
+		var err error
+		files, err = aof.ManifestFiles(filename)
+		if err != nil {
+			fmt.Println("Cannot read manifest: " + err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("Checking %d aof files recorded in %s\n", len(files), filename)
+	}
+
+	if *timestamp > 0 || *flushes > 0 {
+		limit := &aof.Limit{Timestamp: *timestamp, Flushes: *flushes}
+		if !truncateToLimit(filename, files, isManifest, limit) {
+			os.Exit(1)
+		}
+		return
+	}
+	for i, file := range files {
+		// only the last file is appended to, the files before it cannot be fixed by truncating
+		if !checkFile(file, *fix, i == len(files)-1) {
+			os.Exit(1)
+		}
+	}
+}
+
+// checkFile returns true if the file is valid or has been fixed
+func checkFile(filename string, fix bool, fixable bool) bool {
+	file, err := os.Open(filename)
+	if err != nil {
+		fmt.Println("Cannot open file: " + err.Error())
+		return false
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		fmt.Println("Cannot stat file: " + err.Error())
+		return false
+	}
+	size := info.Size()
+	_, loadErr := aof.Check(bufio.NewReader(file), nil)
+	_ = file.Close()
+
+	validSize := size
+	if loadErr != nil {
+		validSize = loadErr.ValidSize
+	}
+	fmt.Printf("AOF %s analyzed: size=%d, ok_up_to=%d, diff=%d\n", filename, size, validSize, size-validSize)
+	if loadErr == nil {
+		fmt.Println("AOF is valid")
+		return true
+	}
+	fmt.Printf("0x%08x: %s\n", loadErr.Offset, loadErr.Err.Error())
+	if !fixable || (loadErr.Offset == 0 && loadErr.ValidSize == 0 && !loadErr.Truncated) {
+		// truncating a file in the middle or a file with broken rdb preamble loses the data after it
+		fmt.Println("AOF is not valid and cannot be fixed by truncating")
+		return false
+	}
+	if !fix {
+		fmt.Println("AOF is not valid. Use the --fix option to try fixing it.")
+		return false
+	}
+	if err := os.Truncate(filename, validSize); err != nil {
+		fmt.Println("Failed to truncate AOF: " + err.Error())
+		return false
+	}
+	fmt.Println("Successfully truncated AOF")
+	return true
+}
+
+// truncateToLimit finds the point where limit is reached and truncates aof there, the files after it are dropped
+func truncateToLimit(filename string, files []string, isManifest bool, limit *aof.Limit) bool {
+	if isManifest {
+		if err := limit.Prepare(filename); err != nil {
+			fmt.Println("Cannot truncate AOF to the point in time: " + err.Error())
+			return false
+		}
+	}
+	for i, path := range files {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Println("Cannot open file: " + err.Error())
+			return false
+		}
+		stop, loadErr := aof.Check(bufio.NewReader(file), limit)
+		_ = file.Close()
+		if loadErr != nil {
+			fmt.Printf("AOF %s is not valid: %s\n", path, loadErr.Error())
+			fmt.Println("Fix it with the --fix option before truncating it to a point in time")
+			return false
+		}
+		if stop < 0 {
+			continue
+		}
+		if isManifest {
+			err = aof.Truncate(filename, i, stop)
+		} else {
+			err = os.Truncate(path, stop)
+		}
+		if err != nil {
+			fmt.Println("Failed to truncate AOF: " + err.Error())
+			return false
+		}
+		fmt.Printf("Successfully truncated AOF %s to %d bytes", path, stop)
+		if dropped := len(files) - i - 1; dropped > 0 {
+			fmt.Printf(", %d files after it are dropped", dropped)
+		}
+		fmt.Println()
+		return true
+	}
+	fmt.Println("The point in time is not found, nothing is truncated")
+	return true
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"go-redis/aof"
+	"go-redis/resp/reply"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// cmd encodes a command as it is written in aof
+func cmd(args ...string) string {
+	cmdLine := make([][]byte, len(args))
+	for i, arg := range args {
+		cmdLine[i] = []byte(arg)
+	}
+	return string(reply.MakeMultiBulkReply(cmdLine).ToBytes())
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestCheckFile(t *testing.T) {
+	valid := cmd("SET", "a", "1") + cmd("MULTI") + cmd("SET", "b", "2") + cmd("EXEC")
+	tests := []struct {
+		name    string
+		content string
+		fix     bool
+		fixable bool
+		wantOK  bool
+		// want is the content after checking
+		want string
+	}{
+		{"valid", valid, false, true, true, valid},
+		{"truncated", valid + cmd("SET", "c", "3")[:7], false, true, false, valid + cmd("SET", "c", "3")[:7]},
+		{"truncated and fixed", valid + cmd("SET", "c", "3")[:7], true, true, true, valid},
+		{"unfinished transaction fixed", valid + cmd("MULTI") + cmd("SET", "c", "3"), true, true, true, valid},
+		// only the last file of manifest is fixable
+		{"truncated but not last file", valid + cmd("SET", "c", "3")[:7], true, false, false, valid + cmd("SET", "c", "3")[:7]},
+		{"bad command in the middle fixed", valid + "*x\r\n" + valid, true, true, true, valid},
+		{"bad first command", "*x\r\n" + valid, true, true, false, "*x\r\n" + valid},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "appendonly.aof")
+		writeFile(t, path, tt.content)
+		if ok := checkFile(path, tt.fix, tt.fixable); ok != tt.wantOK {
+			t.Errorf("%s: expect %v, got %v", tt.name, tt.wantOK, ok)
+		}
+		if got := readFile(t, path); got != tt.want {
+			t.Errorf("%s: expect content %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestTruncateToLimit(t *testing.T) {
+	setA := cmd("SET", "a", "1")
+	setB := cmd("SET", "b", "2")
+	tx := cmd("MULTI") + setB + cmd("EXEC")
+	flushdb := cmd("FLUSHDB")
+	files := []string{"appendonly.aof.1.base.aof", "appendonly.aof.1.incr.aof", "appendonly.aof.2.incr.aof"}
+	manifest := "file appendonly.aof.1.base.aof seq 1 type b\n" +
+		"file appendonly.aof.1.incr.aof seq 1 type i\n" +
+		"file appendonly.aof.2.incr.aof seq 2 type i\n"
+	tests := []struct {
+		name     string
+		contents []string
+		limit    *aof.Limit
+		wantOK   bool
+		// want is the contents of the files left, nil means the file is dropped
+		want []string
+	}{
+		{
+			name:     "timestamp inside MULTI in the second file",
+			contents: []string{setA, "#TS:100\r\n" + setA + cmd("MULTI") + "#TS:101\r\n" + setB + cmd("EXEC"), setA},
+			limit:    &aof.Limit{Timestamp: 100},
+			wantOK:   true,
+			want:     []string{setA, "#TS:100\r\n" + setA},
+		},
+		{
+			name:     "timestamp right before MULTI in the last file",
+			contents: []string{setA, setA, "#TS:100\r\n" + setA + "#TS:101\r\n" + tx},
+			limit:    &aof.Limit{Timestamp: 100},
+			wantOK:   true,
+			want:     []string{setA, setA, "#TS:100\r\n" + setA},
+		},
+		{
+			name:     "second FLUSHDB",
+			contents: []string{setA + flushdb, setA, setB + flushdb + setA},
+			limit:    &aof.Limit{Flushes: 2},
+			wantOK:   true,
+			want:     []string{setA + flushdb, setA, setB},
+		},
+		{
+			name:     "point in time not found",
+			contents: []string{setA, "#TS:100\r\n" + setA, setA},
+			limit:    &aof.Limit{Timestamp: 100},
+			wantOK:   true,
+			want:     []string{setA, "#TS:100\r\n" + setA, setA},
+		},
+		{
+			name:     "bad file before the point in time",
+			contents: []string{setA, setA[:5], "#TS:101\r\n" + setA},
+			limit:    &aof.Limit{Timestamp: 100},
+			wantOK:   false,
+			want:     []string{setA, setA[:5], "#TS:101\r\n" + setA},
+		},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		manifestPath := filepath.Join(dir, "appendonly.aof.manifest")
+		writeFile(t, manifestPath, manifest)
+		paths := make([]string, len(files))
+		for i, name := range files {
+			paths[i] = filepath.Join(dir, name)
+			writeFile(t, paths[i], tt.contents[i])
+		}
+		if ok := truncateToLimit(manifestPath, paths, true, tt.limit); ok != tt.wantOK {
+			t.Errorf("%s: expect %v, got %v", tt.name, tt.wantOK, ok)
+		}
+		left, err := aof.ManifestFiles(manifestPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(left) != len(tt.want) {
+			t.Errorf("%s: expect %d files left, got %q", tt.name, len(tt.want), left)
+			continue
+		}
+		for i, path := range paths {
+			if i >= len(tt.want) {
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Errorf("%s: expect %s dropped, got %v", tt.name, path, err)
+				}
+				continue
+			}
+			if got := readFile(t, path); got != tt.want[i] {
+				t.Errorf("%s: expect %s to be %q, got %q", tt.name, files[i], tt.want[i], got)
+			}
+		}
+	}
+
+	// a single aof file without manifest
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	writeFile(t, path, setA+flushdb+setB)
+	if !truncateToLimit(path, []string{path}, false, &aof.Limit{Flushes: 1}) {
+		t.Fatal("expect truncated")
+	}
+	if got := readFile(t, path); got != setA {
+		t.Fatalf("expect %q, got %q", setA, got)
+	}
+}
+
+// TestTruncateBeforeBase refuses the point in time compacted into the base file written by rewrite
+func TestTruncateBeforeBase(t *testing.T) {
+	setA := cmd("SET", "a", "1")
+	setB := cmd("SET", "b", "2")
+	flushdb := cmd("FLUSHDB")
+	manifest := "file appendonly.aof.2.base.aof seq 2 type b starttime 100 flushes 1\n" +
+		"file appendonly.aof.1.incr.aof seq 1 type i\n"
+	incr := "#TS:100\r\n" + setA + "#TS:101\r\n" + setB + flushdb + setA
+	tests := []struct {
+		name   string
+		limit  *aof.Limit
+		wantOK bool
+		want   string
+	}{
+		{
+			name:   "timestamp before base",
+			limit:  &aof.Limit{Timestamp: 99},
+			wantOK: false,
+			want:   incr,
+		},
+		{
+			name:   "timestamp after base",
+			limit:  &aof.Limit{Timestamp: 100},
+			wantOK: true,
+			want:   "#TS:100\r\n" + setA,
+		},
+		{
+			name:   "flushdb compacted into base",
+			limit:  &aof.Limit{Flushes: 1},
+			wantOK: false,
+			want:   incr,
+		},
+		{
+			name:   "flushdb after base",
+			limit:  &aof.Limit{Flushes: 2},
+			wantOK: true,
+			want:   "#TS:100\r\n" + setA + "#TS:101\r\n" + setB,
+		},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		manifestPath := filepath.Join(dir, "appendonly.aof.manifest")
+		writeFile(t, manifestPath, manifest)
+		paths := []string{filepath.Join(dir, "appendonly.aof.2.base.aof"), filepath.Join(dir, "appendonly.aof.1.incr.aof")}
+		writeFile(t, paths[0], setB)
+		writeFile(t, paths[1], incr)
+		if ok := truncateToLimit(manifestPath, paths, true, tt.limit); ok != tt.wantOK {
+			t.Errorf("%s: expect %v, got %v", tt.name, tt.wantOK, ok)
+		}
+		if got := readFile(t, paths[1]); got != tt.want {
+			t.Errorf("%s: expect %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
@@ -16,10 +16,50 @@ type ServerProperties struct {
     Port           int    `cfg:"port"`
     AppendOnly     bool   `cfg:"appendOnly"`
     AppendFilename string `cfg:"appendFilename"`
+    // directory of aof files and their manifest
+    AppendDirName  string `cfg:"appenddirname"`
+    // fsync policy of aof: always, everysec or no
+    AppendFsync string `cfg:"appendfsync"`
+    // rewrite aof automatically when it grows by the percentage since last rewrite and is larger than min size (in bytes)
+    // percentage 0 disables automatic rewrite
+    AutoAofRewritePercentage int `cfg:"auto-aof-rewrite-percentage"`
+    AutoAofRewriteMinSize    int `cfg:"auto-aof-rewrite-min-size"`
+    // aof rewrite writes the data in rdb format followed by the commands as incremental tail
+    AofUseRdbPreamble bool `cfg:"aof-use-rdb-preamble"`
+    // load the aof file ending in the middle of a command by truncating it, otherwise refuse to start
+    AofLoadTruncated bool `cfg:"aof-load-truncated"`
+    // load the last aof file corrupted in the middle by truncating it at the last valid command and dropping the rest,
+    // otherwise refuse to start
+    AofLoadCorrupted bool `cfg:"aof-load-corrupted"`
+    // write `#TS:<unix time>` annotations into aof, so that check-aof can truncate aof to a point in time
+    AofTimestampEnabled bool `cfg:"aof-timestamp-enabled"`
+    RDBFilename    string `cfg:"dbfilename"`
+    // save rdb if both the given number of seconds and changes are reached, eg. "900 1 300 10"
+    // empty means no automatic saving
+    Save           string `cfg:"save"`
+    // connections beyond maxclients are rejected, 0 means no limit
     MaxClients     int    `cfg:"maxclients"`
+    // close the connection after a client is idle for timeout seconds, 0 means never
+    Timeout        int    `cfg:"timeout"`
+    // limits of the commands sent by clients, the connection is closed if they are exceeded. 0 means no limit
+    // max length of a bulk string
+    ProtoMaxBulkLen int `cfg:"proto-max-bulk-len"`
+    // max number of arguments of a command
+    ProtoMaxMultiBulkLen int `cfg:"proto-max-multibulk-len"`
+    // max total length of the arguments of a command
+    ClientQueryBufferLimit int `cfg:"client-query-buffer-limit"`
     RequirePass    string `cfg:"requirepass"`
+    // users saved by ACL SAVE and loaded on startup, empty means ACL users are not persisted.
+    // requirepass overrides the password of the default user in it
+    ACLFile        string `cfg:"aclfile"`
     Databases      int    `cfg:"databases"`
 
+    // small hashes use a compact encoding until they exceed these limits
+    HashMaxListpackEntries int `cfg:"hash-max-listpack-entries"`
+    HashMaxListpackValue   int `cfg:"hash-max-listpack-value"`
+    // sets holding only integers use the intset encoding until they exceed this limit
+    SetMaxIntsetEntries int `cfg:"set-max-intset-entries"`
+
     Peers []string `cfg:"peers"`
     Self  string   `cfg:"self"`
 }
@@ -28,16 +68,30 @@ type ServerProperties struct {
 var Properties *ServerProperties
 
 func init() {
-    // default config
-    Properties = &ServerProperties{
-        Bind:       "127.0.0.1",
-        Port:       6379,
-        AppendOnly: false,
+    Properties = DefaultProperties()
+}
+
+// DefaultProperties returns the config used without config file, the config file overrides the properties it sets
+func DefaultProperties() *ServerProperties {
+    return &ServerProperties{
+        Bind:                     "0.0.0.0",
+        Port:                     6379,
+        AppendFilename:           "appendonly.aof",
+        AppendDirName:            "appendonlydir",
+        AutoAofRewritePercentage: 100,
+        AutoAofRewriteMinSize:    64 * 1024 * 1024,
+        AofUseRdbPreamble:        true,
+        AofLoadTruncated:         true,
+        MaxClients:               10000,
+        // the same limits as redis
+        ProtoMaxBulkLen:        512 * 1024 * 1024,
+        ProtoMaxMultiBulkLen:   1024 * 1024,
+        ClientQueryBufferLimit: 1024 * 1024 * 1024,
     }
 }
 
 func parse(src io.Reader) *ServerProperties {
-    config := &ServerProperties{}
+    config := DefaultProperties()
 
     // read config file
     rawMap := make(map[string]string)
@@ -76,7 +130,7 @@ func parse(src io.Reader) *ServerProperties {
             case reflect.String:
                 fieldVal.SetString(value)
             case reflect.Int:
-                intValue, err := strconv.ParseInt(value, 10, 64)
+                intValue, err := parseMemory(value)
                 if err == nil {
                     fieldVal.SetInt(intValue)
                 }
@@ -94,6 +148,30 @@ func parse(src io.Reader) *ServerProperties {
     return config
 }
 
+// memoryUnits are the units of sizes like "512mb", k is 1000 and kb is 1024 as redis
+var memoryUnits = []struct {
+    suffix string
+    size   int64
+}{
+    {"kb", 1024}, {"mb", 1024 * 1024}, {"gb", 1024 * 1024 * 1024},
+    {"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+}
+
+// parseMemory parses an integer which may be a size with unit, eg. "64mb"
+func parseMemory(value string) (int64, error) {
+    lower := strings.ToLower(value)
+    for _, unit := range memoryUnits {
+        if strings.HasSuffix(lower, unit.suffix) {
+            n, err := strconv.ParseInt(lower[:len(lower)-len(unit.suffix)], 10, 64)
+            if err != nil {
+                return 0, err
+            }
+            return n * unit.size, nil
+        }
+    }
+    return strconv.ParseInt(value, 10, 64)
+}
+
 // SetupConfig read config file and store properties into Properties
 func SetupConfig(configFilename string) {
     file, err := os.Open(configFilename)
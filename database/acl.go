@@ -0,0 +1,858 @@
+package database
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go-redis/config"
+	"go-redis/interface/resp"
+	"go-redis/lib/wildcard"
+	"go-redis/resp/reply"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// aclCategories maps category names to the command flags they contain, @all contains every command
+// 命令的分类由命令的 flags 决定
+var aclCategories = map[string]int{
+	"read":      flagReadOnly,
+	"write":     flagWrite,
+	"admin":     flagAdmin,
+	"dangerous": flagAdmin,
+	"pubsub":    flagPubSub,
+}
+
+// serverCmdFlags are flags of the commands executed by StandaloneDatabase rather than DB,
+// they are not registered in cmdTable but are limited by ACL as well
+var serverCmdFlags = map[string]int{
+	"multi":        0,
+	"exec":         0,
+	"discard":      0,
+	"watch":        0,
+	"unwatch":      0,
+	"select":       0,
+	"command":      0,
+	"info":         0,
+	"acl":          flagAdmin,
+	"client":       flagAdmin,
+	"bgrewriteaof": flagAdmin,
+	"save":         flagAdmin,
+	"bgsave":       flagAdmin,
+	"lastsave":     flagAdmin,
+}
+
+// selfSubCommands only access the client itself or show public information, every user can run them
+var selfSubCommands = map[string]map[string]bool{
+	"acl":    {"whoami": true, "cat": true},
+	"client": {"id": true, "setname": true, "getname": true, "info": true},
+}
+
+// lookupCommandFlags returns flags of the command, ok is false if the command does not exist
+func lookupCommandFlags(name string) (flags int, ok bool) {
+	if cmd, exists := cmdTable[name]; exists {
+		return cmd.flags, true
+	}
+	flags, ok = serverCmdFlags[name]
+	return
+}
+
+func hashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// aclUser is immutable once it is stored in aclStore, modifying a user means replacing it with a modified clone
+type aclUser struct {
+	name    string
+	enabled bool
+	// nopass user accepts any password
+	nopass bool
+	// sha256 of passwords in hex, plain passwords are never stored
+	passwords []string
+	// command rules in the order of setting, eg. +@all -flushdb, the later one overrides the former.
+	// empty rules means no command is allowed
+	cmdRules        []string
+	keyPatterns     []string
+	keyMatchers     []*wildcard.Pattern
+	channelPatterns []string
+	channelMatchers []*wildcard.Pattern
+}
+
+func makeACLUser(name string) *aclUser {
+	return &aclUser{name: name}
+}
+
+// makeDefaultUser creates the default user which can run every command, it uses requirepass as password
+func makeDefaultUser(requirePass string) *aclUser {
+	u := makeACLUser(defaultUser)
+	for _, rule := range []string{"on", "allkeys", "allchannels", "allcommands"} {
+		_ = u.applyRule(rule)
+	}
+	if requirePass == "" {
+		u.nopass = true
+	} else {
+		u.passwords = []string{hashPassword(requirePass)}
+	}
+	return u
+}
+
+func (u *aclUser) clone() *aclUser {
+	cloned := *u
+	cloned.passwords = append([]string(nil), u.passwords...)
+	cloned.cmdRules = append([]string(nil), u.cmdRules...)
+	cloned.keyPatterns = append([]string(nil), u.keyPatterns...)
+	cloned.keyMatchers = append([]*wildcard.Pattern(nil), u.keyMatchers...)
+	cloned.channelPatterns = append([]string(nil), u.channelPatterns...)
+	cloned.channelMatchers = append([]*wildcard.Pattern(nil), u.channelMatchers...)
+	return &cloned
+}
+
+func isPasswordHash(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+func (u *aclUser) addPassword(hash string) {
+	u.nopass = false
+	if indexOf(u.passwords, hash) < 0 {
+		u.passwords = append(u.passwords, hash)
+	}
+}
+
+func (u *aclUser) removePassword(hash string) error {
+	i := indexOf(u.passwords, hash)
+	if i < 0 {
+		return errors.New("The password you are trying to remove from the user does not exist")
+	}
+	u.passwords = append(u.passwords[:i], u.passwords[i+1:]...)
+	return nil
+}
+
+func (u *aclUser) addCmdRule(rule string) error {
+	target := strings.ToLower(rule[1:])
+	if strings.HasPrefix(target, "@") {
+		category := target[1:]
+		if _, ok := aclCategories[category]; !ok && category != "all" {
+			return errors.New("Unknown command or category name in ACL")
+		}
+		if category == "all" {
+			// +@all and -@all override all the rules before them
+			u.cmdRules = nil
+		}
+	} else if _, ok := lookupCommandFlags(target); !ok {
+		return errors.New("Unknown command or category name in ACL")
+	}
+	// the rule with the same target is overridden by the new one
+	rules := u.cmdRules[:0]
+	for _, r := range u.cmdRules {
+		if r[1:] != target {
+			rules = append(rules, r)
+		}
+	}
+	u.cmdRules = append(rules, rule[:1]+target)
+	return nil
+}
+
+// applyRule modifies user by a rule of ACL SETUSER, eg. on, >password, ~key*, +@read
+func (u *aclUser) applyRule(rule string) error {
+	switch strings.ToLower(rule) {
+	case "on":
+		u.enabled = true
+		return nil
+	case "off":
+		u.enabled = false
+		return nil
+	case "nopass":
+		u.nopass = true
+		u.passwords = nil
+		return nil
+	case "resetpass":
+		u.nopass = false
+		u.passwords = nil
+		return nil
+	case "allkeys":
+		u.keyPatterns = nil
+		u.keyMatchers = nil
+		return u.applyRule("~*")
+	case "resetkeys":
+		u.keyPatterns = nil
+		u.keyMatchers = nil
+		return nil
+	case "allchannels":
+		u.channelPatterns = nil
+		u.channelMatchers = nil
+		return u.applyRule("&*")
+	case "resetchannels":
+		u.channelPatterns = nil
+		u.channelMatchers = nil
+		return nil
+	case "allcommands":
+		return u.addCmdRule("+@all")
+	case "nocommands":
+		return u.addCmdRule("-@all")
+	case "reset":
+		*u = *makeACLUser(u.name)
+		return nil
+	}
+	if rule == "" {
+		return errors.New("Syntax error")
+	}
+	arg := rule[1:]
+	switch rule[0] {
+	case '>':
+		u.addPassword(hashPassword(arg))
+	case '<':
+		return u.removePassword(hashPassword(arg))
+	case '#', '!':
+		if !isPasswordHash(arg) {
+			return errors.New("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+		}
+		if rule[0] == '#' {
+			u.addPassword(arg)
+		} else {
+			return u.removePassword(arg)
+		}
+	case '~':
+		if indexOf(u.keyPatterns, arg) < 0 {
+			u.keyPatterns = append(u.keyPatterns, arg)
+			u.keyMatchers = append(u.keyMatchers, wildcard.CompilePattern(arg))
+		}
+	case '&':
+		if indexOf(u.channelPatterns, arg) < 0 {
+			u.channelPatterns = append(u.channelPatterns, arg)
+			u.channelMatchers = append(u.channelMatchers, wildcard.CompilePattern(arg))
+		}
+	case '+', '-':
+		if arg == "" {
+			return errors.New("Syntax error")
+		}
+		return u.addCmdRule(rule)
+	default:
+		return errors.New("Syntax error")
+	}
+	return nil
+}
+
+func (u *aclUser) checkPassword(password string) bool {
+	return u.nopass || indexOf(u.passwords, hashPassword(password)) >= 0
+}
+
+// canRun tells whether the user is allowed to run the command, the last matched rule decides
+func (u *aclUser) canRun(name string, flags int) bool {
+	allowed := false
+	for _, rule := range u.cmdRules {
+		target := rule[1:]
+		var matched bool
+		if strings.HasPrefix(target, "@") {
+			category := target[1:]
+			matched = category == "all" || flags&aclCategories[category] > 0
+		} else {
+			matched = target == name
+		}
+		if matched {
+			allowed = rule[0] == '+'
+		}
+	}
+	return allowed
+}
+
+func matchAny(matchers []*wildcard.Pattern, s string) bool {
+	for _, m := range matchers {
+		if m.IsMatch(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *aclUser) canAccessKey(key string) bool {
+	return matchAny(u.keyMatchers, key)
+}
+
+func (u *aclUser) canAccessChannel(channel string) bool {
+	return matchAny(u.channelMatchers, channel)
+}
+
+func (u *aclUser) describeCommands() string {
+	if len(u.cmdRules) == 0 {
+		return "-@all"
+	}
+	return strings.Join(u.cmdRules, " ")
+}
+
+func prefixAll(prefix string, list []string) []string {
+	result := make([]string, len(list))
+	for i, s := range list {
+		result[i] = prefix + s
+	}
+	return result
+}
+
+// describe returns the rules which recreate the user, it is used by ACL LIST and the aclfile
+func (u *aclUser) describe() string {
+	parts := []string{"user", u.name}
+	if u.enabled {
+		parts = append(parts, "on")
+	} else {
+		parts = append(parts, "off")
+	}
+	if u.nopass {
+		parts = append(parts, "nopass")
+	}
+	parts = append(parts, prefixAll("#", u.passwords)...)
+	parts = append(parts, prefixAll("~", u.keyPatterns)...)
+	if len(u.channelPatterns) == 0 {
+		parts = append(parts, "resetchannels")
+	} else {
+		parts = append(parts, prefixAll("&", u.channelPatterns)...)
+	}
+	parts = append(parts, u.describeCommands())
+	return strings.Join(parts, " ")
+}
+
+/* ---- acl log ---- */
+
+const aclLogMaxLen = 128
+
+// similar denials within this time are grouped into one log entry
+const aclLogGroupTime = 60 * time.Second
+
+type aclLogEntry struct {
+	count int64
+	// reason is one of command, key, channel and auth
+	reason string
+	// context is toplevel or multi
+	context  string
+	object   string
+	username string
+	created  time.Time
+	updated  time.Time
+}
+
+/* ---- acl store ---- */
+
+// aclStore holds all users and the log of denied commands and authentications
+type aclStore struct {
+	mu    sync.RWMutex
+	users map[string]*aclUser
+	// newest entry first
+	log []*aclLogEntry
+}
+
+// users is used by Auth and CheckPermission, it only has the default user until initACL is called
+var users = &aclStore{
+	users: map[string]*aclUser{defaultUser: makeDefaultUser("")},
+}
+
+// initACL creates the default user by requirepass and loads the aclfile if it exists
+func initACL() error {
+	loaded := make(map[string]*aclUser)
+	if config.Properties.ACLFile != "" {
+		var err error
+		loaded, err = readACLFile(config.Properties.ACLFile)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	users.mu.Lock()
+	users.users = withDefaultUser(loaded)
+	users.mu.Unlock()
+	return nil
+}
+
+// withDefaultUser adds the default user if the loaded users don't have it. requirepass overrides the passwords
+// of the default user in aclfile, because the nodes of cluster authenticate each other by requirepass
+func withDefaultUser(loaded map[string]*aclUser) map[string]*aclUser {
+	if loaded == nil {
+		loaded = make(map[string]*aclUser)
+	}
+	u, ok := loaded[defaultUser]
+	if !ok {
+		loaded[defaultUser] = makeDefaultUser(config.Properties.RequirePass)
+	} else if config.Properties.RequirePass != "" {
+		u.nopass = false
+		u.passwords = []string{hashPassword(config.Properties.RequirePass)}
+	}
+	return loaded
+}
+
+func (s *aclStore) getUser(name string) *aclUser {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.users[name]
+}
+
+func (s *aclStore) setUser(u *aclUser) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[u.name] = u
+}
+
+// sortedUsers returns all users sorted by name
+func (s *aclStore) sortedUsers() []*aclUser {
+	s.mu.RLock()
+	list := make([]*aclUser, 0, len(s.users))
+	for _, u := range s.users {
+		list = append(list, u)
+	}
+	s.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].name < list[j].name
+	})
+	return list
+}
+
+func (s *aclStore) addLog(reason, context, object, username string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for i, entry := range s.log {
+		if entry.reason == reason && entry.context == context && entry.object == object &&
+			entry.username == username && now.Sub(entry.updated) < aclLogGroupTime {
+			entry.count++
+			entry.updated = now
+			// move the updated entry to the head
+			copy(s.log[1:i+1], s.log[:i])
+			s.log[0] = entry
+			return
+		}
+	}
+	entry := &aclLogEntry{
+		count:    1,
+		reason:   reason,
+		context:  context,
+		object:   object,
+		username: username,
+		created:  now,
+		updated:  now,
+	}
+	s.log = append([]*aclLogEntry{entry}, s.log...)
+	if len(s.log) > aclLogMaxLen {
+		s.log = s.log[:aclLogMaxLen]
+	}
+}
+
+/* ---- aclfile ---- */
+
+// readACLFile reads users from lines like `user alice on #<sha256> ~cache:* resetchannels -@all +get`
+func readACLFile(path string) (map[string]*aclUser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	result := make(map[string]*aclUser)
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] != "user" || len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: line should start with user keyword followed by the user name", path, lineNum)
+		}
+		name := fields[1]
+		if _, ok := result[name]; ok {
+			return nil, fmt.Errorf("%s:%d: duplicate user '%s'", path, lineNum, name)
+		}
+		u := makeACLUser(name)
+		for _, rule := range fields[2:] {
+			if err := u.applyRule(rule); err != nil {
+				return nil, fmt.Errorf("%s:%d: error in user declaration '%s': %s", path, lineNum, rule, err.Error())
+			}
+		}
+		result[name] = u
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// writeACLFile writes users into a temp file and renames it, so the aclfile is replaced atomically
+func writeACLFile(path string, list []*aclUser) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "temp-*.acl")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name()) // no-op if it has been renamed
+	}()
+	writer := bufio.NewWriter(file)
+	for _, u := range list {
+		if _, err = writer.WriteString(u.describe() + "\n"); err != nil {
+			return err
+		}
+	}
+	if err = writer.Flush(); err != nil {
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+/* ---- permission check ---- */
+
+// pubsubChannels returns the channels accessed by a pub/sub command, args don't include the command name
+func pubsubChannels(name string, args [][]byte) []string {
+	if len(args) == 0 {
+		return nil
+	}
+	switch name {
+	case "publish", "spublish":
+		return []string{string(args[0])}
+	case "subscribe", "ssubscribe", "psubscribe":
+		channels := make([]string, len(args))
+		for i, arg := range args {
+			channels[i] = string(arg)
+		}
+		return channels
+	}
+	return nil
+}
+
+// CheckPermission checks whether the user of the client can run the command and access its keys and channels.
+// It returns nil if the command is allowed, otherwise a NOPERM error, and the denial is recorded in ACL LOG
+// 检查客户端的用户能否执行命令、访问命令的 key 和频道
+func CheckPermission(c resp.Connection, cmdLine [][]byte) resp.Reply {
+	username := c.GetUser()
+	if username == "" {
+		// connections inside server, eg. loading aof
+		return nil
+	}
+	u := users.getUser(username)
+	if u == nil || !u.enabled {
+		// the user has been deleted or disabled after authentication
+		c.SetAuthenticated(false)
+		c.SetUser(defaultUser)
+		return reply.MakeErrReply("NOAUTH Authentication required.")
+	}
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	flags, ok := lookupCommandFlags(cmdName)
+	if !ok {
+		// unknown command is reported by the executor
+		return nil
+	}
+	context := "toplevel"
+	if c.InMultiState() {
+		context = "multi"
+	}
+	deny := func(reason, object, msg string) resp.Reply {
+		users.addLog(reason, context, object, username)
+		errReply := reply.MakeErrReply("NOPERM " + msg)
+		if c.InMultiState() {
+			c.AddTxError(errors.New(errReply.Error()))
+		}
+		return errReply
+	}
+	selfCmd := len(cmdLine) > 1 && selfSubCommands[cmdName][strings.ToLower(string(cmdLine[1]))]
+	if !selfCmd && !u.canRun(cmdName, flags) {
+		return deny("command", cmdName, fmt.Sprintf("User %s has no permissions to run the '%s' command", username, cmdName))
+	}
+
+	var keys []string
+	if cmdName == "watch" {
+		for _, arg := range cmdLine[1:] {
+			keys = append(keys, string(arg))
+		}
+	} else {
+		writeKeys, readKeys := GetRelatedKeys(cmdLine)
+		keys = append(writeKeys, readKeys...)
+	}
+	for _, key := range keys {
+		if !u.canAccessKey(key) {
+			return deny("key", key, "No permissions to access a key")
+		}
+	}
+	if flags&flagPubSub > 0 {
+		for _, channel := range pubsubChannels(cmdName, cmdLine[1:]) {
+			if !u.canAccessChannel(channel) {
+				return deny("channel", channel, "No permissions to access a channel")
+			}
+		}
+	}
+	return nil
+}
+
+/* ---- acl command ---- */
+
+// execACL implements ACL SETUSER/GETUSER/DELUSER/USERS/LIST/WHOAMI/CAT/LOG/SAVE/LOAD
+func execACL(c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("acl")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	args = args[1:]
+	argNumErr := reply.MakeArgNumErrReply("acl|" + subCmd)
+	switch subCmd {
+	case "setuser":
+		if len(args) == 0 {
+			return argNumErr
+		}
+		return execACLSetUser(args)
+	case "getuser":
+		if len(args) != 1 {
+			return argNumErr
+		}
+		return execACLGetUser(string(args[0]))
+	case "deluser":
+		if len(args) == 0 {
+			return argNumErr
+		}
+		return execACLDelUser(args)
+	case "users":
+		if len(args) != 0 {
+			return argNumErr
+		}
+		list := users.sortedUsers()
+		result := make([][]byte, len(list))
+		for i, u := range list {
+			result[i] = []byte(u.name)
+		}
+		return reply.MakeMultiBulkReply(result)
+	case "list":
+		if len(args) != 0 {
+			return argNumErr
+		}
+		list := users.sortedUsers()
+		result := make([][]byte, len(list))
+		for i, u := range list {
+			result[i] = []byte(u.describe())
+		}
+		return reply.MakeMultiBulkReply(result)
+	case "whoami":
+		if len(args) != 0 {
+			return argNumErr
+		}
+		return reply.MakeBulkReply([]byte(c.GetUser()))
+	case "cat":
+		if len(args) > 1 {
+			return argNumErr
+		}
+		return execACLCat(args)
+	case "log":
+		if len(args) > 1 {
+			return argNumErr
+		}
+		return execACLLog(args)
+	case "save":
+		if len(args) != 0 {
+			return argNumErr
+		}
+		return execACLSave()
+	case "load":
+		if len(args) != 0 {
+			return argNumErr
+		}
+		return execACLLoad()
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try ACL HELP.")
+}
+
+// execACLSetUser creates or modifies the user, the rules are applied to a clone so that nothing changes if any rule is bad
+func execACLSetUser(args [][]byte) resp.Reply {
+	name := string(args[0])
+	if strings.ContainsAny(name, " \t\r\n") || name == "" {
+		return reply.MakeErrReply("ERR Usernames can't contain spaces or null characters")
+	}
+	var u *aclUser
+	if existed := users.getUser(name); existed != nil {
+		u = existed.clone()
+	} else {
+		u = makeACLUser(name)
+	}
+	for _, arg := range args[1:] {
+		rule := string(arg)
+		if err := u.applyRule(rule); err != nil {
+			return reply.MakeErrReply("ERR Error in ACL SETUSER modifier '" + rule + "': " + err.Error())
+		}
+	}
+	users.setUser(u)
+	return reply.MakeOkReply()
+}
+
+func execACLGetUser(name string) resp.Reply {
+	u := users.getUser(name)
+	if u == nil {
+		return reply.MakeNullBulkReply()
+	}
+	flags := [][]byte{[]byte("off")}
+	if u.enabled {
+		flags[0] = []byte("on")
+	}
+	if u.nopass {
+		flags = append(flags, []byte("nopass"))
+	}
+	passwords := make([][]byte, len(u.passwords))
+	for i, p := range u.passwords {
+		passwords[i] = []byte(p)
+	}
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte("flags")),
+		reply.MakeMultiBulkReply(flags),
+		reply.MakeBulkReply([]byte("passwords")),
+		reply.MakeMultiBulkReply(passwords),
+		reply.MakeBulkReply([]byte("commands")),
+		reply.MakeBulkReply([]byte(u.describeCommands())),
+		reply.MakeBulkReply([]byte("keys")),
+		reply.MakeBulkReply([]byte(strings.Join(prefixAll("~", u.keyPatterns), " "))),
+		reply.MakeBulkReply([]byte("channels")),
+		reply.MakeBulkReply([]byte(strings.Join(prefixAll("&", u.channelPatterns), " "))),
+	})
+}
+
+func execACLDelUser(args [][]byte) resp.Reply {
+	for _, arg := range args {
+		if string(arg) == defaultUser {
+			return reply.MakeErrReply("ERR The 'default' user cannot be removed")
+		}
+	}
+	users.mu.Lock()
+	defer users.mu.Unlock()
+	deleted := 0
+	for _, arg := range args {
+		name := string(arg)
+		if _, ok := users.users[name]; ok {
+			delete(users.users, name)
+			deleted++
+		}
+	}
+	return reply.MakeIntReply(int64(deleted))
+}
+
+// execACLCat lists categories, or the commands in the given category
+func execACLCat(args [][]byte) resp.Reply {
+	var result []string
+	if len(args) == 0 {
+		for category := range aclCategories {
+			result = append(result, category)
+		}
+	} else {
+		category := strings.ToLower(string(args[0]))
+		mask, ok := aclCategories[category]
+		if !ok && category != "all" {
+			return reply.MakeErrReply("ERR Unknown category '" + category + "'")
+		}
+		contains := func(flags int) bool {
+			return category == "all" || flags&mask > 0
+		}
+		for name, cmd := range cmdTable {
+			if contains(cmd.flags) {
+				result = append(result, name)
+			}
+		}
+		for name, flags := range serverCmdFlags {
+			if contains(flags) {
+				result = append(result, name)
+			}
+		}
+	}
+	sort.Strings(result)
+	lines := make([][]byte, len(result))
+	for i, s := range result {
+		lines[i] = []byte(s)
+	}
+	return reply.MakeMultiBulkReply(lines)
+}
+
+// execACLLog implements ACL LOG [count | RESET]
+func execACLLog(args [][]byte) resp.Reply {
+	count := aclLogMaxLen
+	if len(args) == 1 {
+		if strings.EqualFold(string(args[0]), "reset") {
+			users.mu.Lock()
+			users.log = nil
+			users.mu.Unlock()
+			return reply.MakeOkReply()
+		}
+		n, err := strconv.Atoi(string(args[0]))
+		if err != nil || n < 0 {
+			return reply.MakeErrReply("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+	now := time.Now()
+	users.mu.RLock()
+	defer users.mu.RUnlock()
+	if count > len(users.log) {
+		count = len(users.log)
+	}
+	result := make([]resp.Reply, count)
+	for i, entry := range users.log[:count] {
+		age := strconv.FormatFloat(now.Sub(entry.updated).Seconds(), 'f', 3, 64)
+		result[i] = reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeBulkReply([]byte("count")),
+			reply.MakeIntReply(entry.count),
+			reply.MakeBulkReply([]byte("reason")),
+			reply.MakeBulkReply([]byte(entry.reason)),
+			reply.MakeBulkReply([]byte("context")),
+			reply.MakeBulkReply([]byte(entry.context)),
+			reply.MakeBulkReply([]byte("object")),
+			reply.MakeBulkReply([]byte(entry.object)),
+			reply.MakeBulkReply([]byte("username")),
+			reply.MakeBulkReply([]byte(entry.username)),
+			reply.MakeBulkReply([]byte("age-seconds")),
+			reply.MakeBulkReply([]byte(age)),
+			reply.MakeBulkReply([]byte("timestamp-created")),
+			reply.MakeIntReply(entry.created.UnixMilli()),
+			reply.MakeBulkReply([]byte("timestamp-last-updated")),
+			reply.MakeIntReply(entry.updated.UnixMilli()),
+		})
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+var errNoACLFile = reply.MakeErrReply("ERR This Redis instance is not configured to use an ACL file. You may want to specify users via the ACL SETUSER command and then set aclfile in the config file.")
+
+func execACLSave() resp.Reply {
+	if config.Properties.ACLFile == "" {
+		return errNoACLFile
+	}
+	if err := writeACLFile(config.Properties.ACLFile, users.sortedUsers()); err != nil {
+		return reply.MakeErrReply("ERR There was an error trying to save the ACLs: " + err.Error())
+	}
+	return reply.MakeOkReply()
+}
+
+// execACLLoad replaces all users with the ones in aclfile, nothing changes if the file is invalid
+func execACLLoad() resp.Reply {
+	if config.Properties.ACLFile == "" {
+		return errNoACLFile
+	}
+	loaded, err := readACLFile(config.Properties.ACLFile)
+	if err != nil {
+		return reply.MakeErrReply("ERR Error loading ACLs: " + err.Error())
+	}
+	users.mu.Lock()
+	users.users = withDefaultUser(loaded)
+	users.mu.Unlock()
+	return reply.MakeOkReply()
+}
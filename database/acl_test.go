@@ -0,0 +1,234 @@
+package database
+
+import (
+	"go-redis/config"
+	"go-redis/resp/reply"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// resetACL creates the default user without password and clears the log
+func resetACL(t *testing.T) {
+	t.Helper()
+	config.Properties.RequirePass = ""
+	config.Properties.ACLFile = ""
+	if err := initACL(); err != nil {
+		t.Fatal(err)
+	}
+	users.mu.Lock()
+	users.log = nil
+	users.mu.Unlock()
+}
+
+func TestACLRules(t *testing.T) {
+	tests := []struct {
+		rules   string
+		allowed []string
+		denied  []string
+		keys    []string
+		noKeys  []string
+	}{
+		{
+			rules:   "+@read -get ~foo:*",
+			allowed: []string{"mget", "strlen", "hget"},
+			denied:  []string{"get", "set", "del", "flushdb", "acl"},
+			keys:    []string{"foo:1", "foo:"},
+			noKeys:  []string{"foo", "bar:1"},
+		},
+		{
+			// the later rule overrides the former one of the same command
+			rules:   "+@read -get +get allkeys resetkeys ~bar",
+			allowed: []string{"get", "mget"},
+			denied:  []string{"set"},
+			keys:    []string{"bar"},
+			noKeys:  []string{"foo:1", "bar:1"},
+		},
+		{
+			rules:   "allcommands -@write +set",
+			allowed: []string{"get", "set", "acl", "select"},
+			denied:  []string{"del", "flushdb", "mset"},
+		},
+		{
+			// +@all overrides all the rules before it
+			rules:   "-get +@all",
+			allowed: []string{"get", "set"},
+		},
+		{
+			rules:  "+get nocommands allkeys",
+			denied: []string{"get", "set"},
+			keys:   []string{"any"},
+		},
+		{
+			rules:  "",
+			denied: []string{"get", "select"},
+			noKeys: []string{"any"},
+		},
+	}
+	for _, tt := range tests {
+		u := makeACLUser("alice")
+		for _, rule := range strings.Fields(tt.rules) {
+			if err := u.applyRule(rule); err != nil {
+				t.Fatalf("%s: %v", tt.rules, err)
+			}
+		}
+		for _, name := range tt.allowed {
+			flags, _ := lookupCommandFlags(name)
+			if !u.canRun(name, flags) {
+				t.Errorf("%q: expect %s allowed", tt.rules, name)
+			}
+		}
+		for _, name := range tt.denied {
+			flags, _ := lookupCommandFlags(name)
+			if u.canRun(name, flags) {
+				t.Errorf("%q: expect %s denied", tt.rules, name)
+			}
+		}
+		for _, key := range tt.keys {
+			if !u.canAccessKey(key) {
+				t.Errorf("%q: expect key %s allowed", tt.rules, key)
+			}
+		}
+		for _, key := range tt.noKeys {
+			if u.canAccessKey(key) {
+				t.Errorf("%q: expect key %s denied", tt.rules, key)
+			}
+		}
+	}
+}
+
+func TestACLRuleErrors(t *testing.T) {
+	tests := []struct {
+		rule    string
+		wantErr string
+	}{
+		{"+nosuchcommand", "Unknown command"},
+		{"-@nosuchcategory", "Unknown command"},
+		{"+", "Syntax error"},
+		{"x", "Syntax error"},
+		{"#abc", "password hash"},
+		{"<missing", "does not exist"},
+	}
+	for _, tt := range tests {
+		u := makeACLUser("alice")
+		err := u.applyRule(tt.rule)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%q: expect error %q, got %v", tt.rule, tt.wantErr, err)
+		}
+	}
+}
+
+func TestACLPasswords(t *testing.T) {
+	u := makeACLUser("alice")
+	for _, rule := range []string{"on", ">p1", ">p2", "#" + hashPassword("p3"), "<p2"} {
+		if err := u.applyRule(rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for password, want := range map[string]bool{"p1": true, "p2": false, "p3": true, "": false} {
+		if got := u.checkPassword(password); got != want {
+			t.Errorf("password %q: expect %v, got %v", password, want, got)
+		}
+	}
+	_ = u.applyRule("nopass")
+	if !u.checkPassword("anything") {
+		t.Error("expect any password accepted by nopass user")
+	}
+	_ = u.applyRule("resetpass")
+	if u.checkPassword("anything") || u.checkPassword("p1") {
+		t.Error("expect no password accepted after resetpass")
+	}
+}
+
+// TestACLDescribe checks the user read back from the aclfile has the same rules
+func TestACLDescribe(t *testing.T) {
+	resetACL(t)
+	defer resetACL(t)
+	config.Properties.ACLFile = filepath.Join(t.TempDir(), "users.acl")
+	mdb, _ := makeTestDatabase()
+	c := makeTestClient(t)
+	assertLines(t, mdb, c, [][2]string{
+		{"ACL SETUSER alice on >secret ~foo:* &news +@read -get", "+OK\r\n"},
+		{"ACL SAVE", "+OK\r\n"},
+		{"ACL DELUSER alice", ":1\r\n"},
+		{"ACL LOAD", "+OK\r\n"},
+	})
+	u := users.getUser("alice")
+	if u == nil {
+		t.Fatal("expect alice loaded")
+	}
+	want := "user alice on #" + hashPassword("secret") + " ~foo:* &news +@read -get"
+	if got := u.describe(); got != want {
+		t.Fatalf("expect %q, got %q", want, got)
+	}
+}
+
+func TestCheckPermission(t *testing.T) {
+	resetACL(t)
+	defer resetACL(t)
+	mdb, _ := makeTestDatabase()
+	admin := makeTestClient(t)
+	assertLines(t, mdb, admin, [][2]string{
+		{"ACL SETUSER alice on >secret +@read -get +multi +exec ~foo:*", "+OK\r\n"},
+		{"SET foo:1 v", "+OK\r\n"},
+	})
+
+	c := makeTestClient(t)
+	assertLines(t, mdb, c, [][2]string{
+		{"AUTH alice wrong", "-WRONGPASS invalid username-password pair or user is disabled.\r\n"},
+		{"AUTH alice secret", "+OK\r\n"},
+		{"ACL WHOAMI", "$5\r\nalice\r\n"},
+		{"STRLEN foo:1", ":1\r\n"},
+		{"GET foo:1", "-NOPERM User alice has no permissions to run the 'get' command\r\n"},
+		{"SET foo:1 v", "-NOPERM User alice has no permissions to run the 'set' command\r\n"},
+		{"STRLEN bar", "-NOPERM No permissions to access a key\r\n"},
+		{"MGET foo:1 bar", "-NOPERM No permissions to access a key\r\n"},
+		// the denied command aborts the transaction
+		{"MULTI", "+OK\r\n"},
+		{"STRLEN bar", "-NOPERM No permissions to access a key\r\n"},
+		{"EXEC", "-EXECABORT Transaction discarded because of previous errors.\r\n"},
+	})
+
+	// the denials are logged, newest first
+	result, ok := execLine(mdb, admin, "ACL LOG").(*reply.MultiRawReply)
+	if !ok {
+		t.Fatal("expect log entries")
+	}
+	type entry struct{ reason, context, object, username string }
+	var got []entry
+	for _, r := range result.Replies {
+		fields := r.(*reply.MultiRawReply).Replies
+		str := func(i int) string {
+			return string(fields[i].(*reply.BulkReply).Arg)
+		}
+		got = append(got, entry{str(3), str(5), str(7), str(9)})
+	}
+	want := []entry{
+		{"key", "multi", "bar", "alice"},
+		{"key", "toplevel", "bar", "alice"},
+		{"command", "toplevel", "set", "alice"},
+		{"command", "toplevel", "get", "alice"},
+		{"auth", "toplevel", "AUTH", "alice"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expect %d entries, got %v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d: expect %v, got %v", i, want[i], got[i])
+		}
+	}
+	// the same denial is grouped into the existing entry
+	execLine(mdb, c, "GET foo:1")
+	assertReply(t, execLine(mdb, admin, "ACL LOG 1").(*reply.MultiRawReply).Replies[0].(*reply.MultiRawReply).Replies[1], ":2\r\n")
+	assertReply(t, execLine(mdb, admin, "ACL LOG RESET"), "+OK\r\n")
+	assertReply(t, execLine(mdb, admin, "ACL LOG"), "*0\r\n")
+
+	// the client is logged out once its user is disabled, then it runs as the default user
+	assertLines(t, mdb, admin, [][2]string{{"ACL SETUSER alice off", "+OK\r\n"}})
+	assertLines(t, mdb, c, [][2]string{
+		{"STRLEN foo:1", "-NOAUTH Authentication required.\r\n"},
+		{"ACL WHOAMI", "$7\r\ndefault\r\n"},
+		{"GET foo:1", "$1\r\nv\r\n"},
+	})
+}
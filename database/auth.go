@@ -0,0 +1,47 @@
+package database
+
+import (
+	"go-redis/interface/resp"
+	"go-redis/resp/reply"
+)
+
+// defaultUser is used by clients without AUTH, and by AUTH with only password. it uses requirepass as password
+const defaultUser = "default"
+
+// Auth implements AUTH [username] password
+func Auth(c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("auth")
+	}
+	if len(args) > 2 {
+		return reply.MakeSyntaxErrReply()
+	}
+	username := defaultUser
+	if len(args) == 2 {
+		username = string(args[0])
+	}
+	password := string(args[len(args)-1])
+	if len(args) == 1 {
+		if u := users.getUser(defaultUser); u != nil && u.enabled && u.nopass {
+			return reply.MakeErrReply("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+		}
+	}
+	u := users.getUser(username)
+	if u == nil || !u.enabled || !u.checkPassword(password) {
+		users.addLog("auth", "toplevel", "AUTH", username)
+		return reply.MakeErrReply("WRONGPASS invalid username-password pair or user is disabled.")
+	}
+	c.SetUser(username)
+	c.SetAuthenticated(true)
+	return reply.MakeOkReply()
+}
+
+// IsAuthenticated tells whether the client can execute commands,
+// clients without AUTH run as the default user if it requires no password
+func IsAuthenticated(c resp.Connection) bool {
+	if c.IsAuthenticated() {
+		return true
+	}
+	u := users.getUser(defaultUser)
+	return u != nil && u.enabled && u.nopass
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"go-redis/config"
+	"testing"
+)
+
+func TestAuth(t *testing.T) {
+	const (
+		noAuth    = "-NOAUTH Authentication required.\r\n"
+		wrongPass = "-WRONGPASS invalid username-password pair or user is disabled.\r\n"
+	)
+	resetACL(t)
+	mdb, _ := makeTestDatabase()
+
+	// clients run as the default user without AUTH if requirepass is not set
+	assertLines(t, mdb, makeTestClient(t), [][2]string{
+		{"SET a 1", "+OK\r\n"},
+		{"AUTH secret", "-ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?\r\n"},
+		{"AUTH default secret", "+OK\r\n"},
+	})
+
+	config.Properties.RequirePass = "secret"
+	if err := initACL(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resetACL(t) })
+	assertLines(t, mdb, makeTestClient(t), [][2]string{
+		{"GET a", noAuth},
+		{"MULTI", noAuth},
+		{"AUTH", "-ERR wrong number of arguments for 'auth' command\r\n"},
+		{"AUTH a b c", "-Err syntax error\r\n"},
+		{"AUTH wrong", wrongPass},
+		{"AUTH default wrong", wrongPass},
+		{"AUTH nobody secret", wrongPass},
+		{"GET a", noAuth},
+		{"AUTH secret", "+OK\r\n"},
+		{"GET a", "$1\r\n1\r\n"},
+		// a failed AUTH doesn't log the client out
+		{"AUTH wrong", wrongPass},
+		{"GET a", "$1\r\n1\r\n"},
+	})
+	assertLines(t, mdb, makeTestClient(t), [][2]string{
+		{"AUTH default secret", "+OK\r\n"},
+		{"GET a", "$1\r\n1\r\n"},
+	})
+}
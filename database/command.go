@@ -1,24 +1,237 @@
 package database
 
-import "strings"
+import (
+	"go-redis/interface/resp"
+	"go-redis/resp/reply"
+	"sort"
+	"strconv"
+	"strings"
+)
 
 var cmdTable = make(map[string]*command)
 
+// flags of command, shown in the reply of COMMAND INFO
+const (
+	flagWrite = 1 << iota
+	flagReadOnly
+	flagAdmin
+	flagPubSub
+	flagNoScript
+)
+
+var flagNames = []struct {
+	flag int
+	name string
+}{
+	{flagWrite, "write"},
+	{flagReadOnly, "readonly"},
+	{flagAdmin, "admin"},
+	{flagPubSub, "pubsub"},
+	{flagNoScript, "noscript"},
+}
+
 type command struct {
+	name string
 	// 执行命令的函数
 	executor ExecFunc
+	// prepare returns related keys of the command, nil means the keys are found by key positions
+	// 返回命令要读写的 key，为 nil 时根据 firstKey/lastKey/keyStep 计算
+	prepare PreFunc
 	// allow number of args, arity < 0 means len(args) >= -arity
 	// 表示参数的个数，如果是正数，表示参数的个数必须等于这个数，如果是负数，表示参数的个数必须大于等于这个数的绝对值
 	arity int
+	flags int
+	// positions of keys in the command line, the command name is at position 0
+	// lastKey < 0 counts from the end of command line, firstKey == 0 means the command has no key
+	firstKey int
+	lastKey  int
+	keyStep  int
+}
+
+// touchesAllKeys tells whether the command writes without key positions, eg. flushdb, it locks the whole db
+func (cmd *command) touchesAllKeys() bool {
+	return cmd.flags&flagWrite != 0 && cmd.firstKey == 0 && cmd.prepare == nil
 }
 
 // RegisterCommand registers a new command. 用于注册一个新的命令
 // arity means allowed number of cmdArgs, arity < 0 means len(args) >= -arity.
 // for example: the arity of `get` is 2, `mget` is -2
-func RegisterCommand(name string, executor ExecFunc, arity int) {
+// firstKey, lastKey and keyStep describe where the keys are, the same as redis COMMAND INFO,
+// for example: `get` is 1, 1, 1 and `mset` is 1, -1, 2
+func RegisterCommand(name string, executor ExecFunc, prepare PreFunc, arity int, flags int, firstKey, lastKey, keyStep int) {
 	name = strings.ToLower(name)
 	cmdTable[name] = &command{
+		name:     name,
 		executor: executor,
+		prepare:  prepare,
 		arity:    arity,
+		flags:    flags,
+		firstKey: firstKey,
+		lastKey:  lastKey,
+		keyStep:  keyStep,
+	}
+}
+
+// getKeys returns keys at the key positions, args don't include the command name
+func (cmd *command) getKeys(args [][]byte) []string {
+	if cmd.firstKey == 0 {
+		return nil
+	}
+	last := cmd.lastKey
+	if last < 0 {
+		last = len(args) + 1 + last
+	}
+	keys := make([]string, 0)
+	for i := cmd.firstKey; i <= last && i <= len(args); i += cmd.keyStep {
+		keys = append(keys, string(args[i-1]))
+	}
+	return keys
+}
+
+// getRelatedKeys returns keys the command writes and reads, args don't include the command name
+func (cmd *command) getRelatedKeys(args [][]byte) ([]string, []string) {
+	if cmd.prepare != nil {
+		return cmd.prepare(args)
+	}
+	keys := cmd.getKeys(args)
+	if cmd.flags&flagWrite > 0 {
+		return keys, nil
+	}
+	return nil, keys
+}
+
+// GetRelatedKeys returns keys the command line writes and reads,
+// returns nothing if the command is unknown or the number of arguments is wrong
+func GetRelatedKeys(cmdLine [][]byte) ([]string, []string) {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := cmdTable[cmdName]
+	if !ok || !validateArity(cmd.arity, cmdLine) {
+		return nil, nil
+	}
+	return cmd.getRelatedKeys(cmdLine[1:])
+}
+
+// IsWriteCommand tells whether the command may modify data
+func IsWriteCommand(name string) bool {
+	cmd, ok := cmdTable[strings.ToLower(name)]
+	return ok && cmd.flags&flagWrite > 0
+}
+
+/* ---- prepare functions ---- */
+
+// prepareSetStore: SINTERSTORE destination key [key ...]
+func prepareSetStore(args [][]byte) ([]string, []string) {
+	dest := string(args[0])
+	keys := make([]string, len(args)-1)
+	for i, arg := range args[1:] {
+		keys[i] = string(arg)
+	}
+	return []string{dest}, keys
+}
+
+// prepareZRangeStore: ZRANGESTORE dst src min max ...
+func prepareZRangeStore(args [][]byte) ([]string, []string) {
+	return []string{string(args[0])}, []string{string(args[1])}
+}
+
+// prepareZStore: ZUNIONSTORE destination numkeys key [key ...] ...
+func prepareZStore(args [][]byte) ([]string, []string) {
+	dest := string(args[0])
+	numKeys, err := strconv.Atoi(string(args[1]))
+	if err != nil || numKeys < 0 || len(args) < 2+numKeys {
+		return []string{dest}, nil
+	}
+	keys := make([]string, numKeys)
+	for i := 0; i < numKeys; i++ {
+		keys[i] = string(args[2+i])
+	}
+	return []string{dest}, keys
+}
+
+/* ---- COMMAND ---- */
+
+// execCommand implements COMMAND, COMMAND COUNT, COMMAND INFO and COMMAND GETKEYS
+func execCommand(args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		names := make([]string, 0, len(cmdTable))
+		for name := range cmdTable {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return commandInfo(names)
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "count":
+		if len(args) != 1 {
+			return reply.MakeErrReply("ERR wrong number of arguments for 'command|count' command")
+		}
+		return reply.MakeIntReply(int64(len(cmdTable)))
+	case "info":
+		names := make([]string, len(args)-1)
+		for i, arg := range args[1:] {
+			names[i] = strings.ToLower(string(arg))
+		}
+		return commandInfo(names)
+	case "getkeys":
+		if len(args) < 2 {
+			return reply.MakeErrReply("ERR wrong number of arguments for 'command|getkeys' command")
+		}
+		return commandGetKeys(args[1:])
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try COMMAND HELP.")
+}
+
+func commandInfo(names []string) resp.Reply {
+	result := make([]resp.Reply, len(names))
+	for i, name := range names {
+		cmd, ok := cmdTable[name]
+		if !ok {
+			result[i] = reply.MakeNullMultiBulkReply()
+			continue
+		}
+		result[i] = cmd.toDescReply()
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+// toDescReply returns: name, arity, flags, first key, last key, key step
+func (cmd *command) toDescReply() resp.Reply {
+	flags := make([]resp.Reply, 0)
+	for _, f := range flagNames {
+		if cmd.flags&f.flag > 0 {
+			flags = append(flags, reply.MakeStatusReply(f.name))
+		}
+	}
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte(cmd.name)),
+		reply.MakeIntReply(int64(cmd.arity)),
+		reply.MakeMultiRawReply(flags),
+		reply.MakeIntReply(int64(cmd.firstKey)),
+		reply.MakeIntReply(int64(cmd.lastKey)),
+		reply.MakeIntReply(int64(cmd.keyStep)),
+	})
+}
+
+func commandGetKeys(cmdLine [][]byte) resp.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := cmdTable[cmdName]
+	if !ok {
+		return reply.MakeErrReply("ERR Invalid command specified")
+	}
+	if !validateArity(cmd.arity, cmdLine) {
+		return reply.MakeErrReply("ERR Invalid number of arguments specified for command")
+	}
+	writeKeys, readKeys := cmd.getRelatedKeys(cmdLine[1:])
+	if len(writeKeys)+len(readKeys) == 0 {
+		return reply.MakeErrReply("ERR The command has no key arguments")
+	}
+	keys := make([][]byte, 0, len(writeKeys)+len(readKeys))
+	for _, key := range writeKeys {
+		keys = append(keys, []byte(key))
+	}
+	for _, key := range readKeys {
+		keys = append(keys, []byte(key))
 	}
+	return reply.MakeMultiBulkReply(keys)
 }
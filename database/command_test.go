@@ -0,0 +1,90 @@
+package database
+
+import (
+	"go-redis/lib/utils"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCommandInfo(t *testing.T) {
+	mdb, c := makeTestDatabase()
+	count := strconv.Itoa(len(cmdTable))
+	assertLines(t, mdb, c, [][2]string{
+		{"COMMAND INFO set", "*1\r\n*6\r\n$3\r\nset\r\n:-3\r\n*1\r\n+write\r\n:1\r\n:1\r\n:1\r\n"},
+		{"COMMAND INFO GET nosuchcmd MSET", "*3\r\n" +
+			"*6\r\n$3\r\nget\r\n:2\r\n*1\r\n+readonly\r\n:1\r\n:1\r\n:1\r\n" +
+			"*-1\r\n" +
+			"*6\r\n$4\r\nmset\r\n:-3\r\n*1\r\n+write\r\n:1\r\n:-1\r\n:2\r\n"},
+		{"COMMAND INFO flushdb", "*1\r\n*6\r\n$7\r\nflushdb\r\n:-1\r\n*1\r\n+write\r\n:0\r\n:0\r\n:0\r\n"},
+		{"COMMAND COUNT", ":" + count + "\r\n"},
+		{"COMMAND COUNT x", "-ERR wrong number of arguments for 'command|count' command\r\n"},
+		{"COMMAND FOO", "-ERR unknown subcommand 'FOO'. Try COMMAND HELP.\r\n"},
+	})
+
+	// COMMAND describes every command sorted by name
+	all := string(execLine(mdb, c, "COMMAND").ToBytes())
+	if !strings.HasPrefix(all, "*"+count+"\r\n") {
+		t.Fatalf("expect %s commands, got %q", count, all[:20])
+	}
+	last := ""
+	for _, entry := range strings.Split(all, "*6\r\n")[1:] {
+		name := strings.Split(entry, "\r\n")[1]
+		if name <= last {
+			t.Fatalf("expect commands sorted by name, got %q after %q", name, last)
+		}
+		last = name
+	}
+}
+
+func TestCommandGetKeys(t *testing.T) {
+	mdb, c := makeTestDatabase()
+	assertLines(t, mdb, c, [][2]string{
+		{"COMMAND GETKEYS MSET a 1 b 2", "*2\r\n$1\r\na\r\n$1\r\nb\r\n"},
+		{"COMMAND GETKEYS ZUNIONSTORE d 2 a b WEIGHTS 1 2", "*3\r\n$1\r\nd\r\n$1\r\na\r\n$1\r\nb\r\n"},
+		{"COMMAND GETKEYS FLUSHDB", "-ERR The command has no key arguments\r\n"},
+		{"COMMAND GETKEYS NOSUCHCMD a", "-ERR Invalid command specified\r\n"},
+		{"COMMAND GETKEYS GET", "-ERR Invalid number of arguments specified for command\r\n"},
+		{"COMMAND GETKEYS", "-ERR wrong number of arguments for 'command|getkeys' command\r\n"},
+	})
+}
+
+// TestGetRelatedKeys checks the keys found by the metadata of commands, which route the commands in cluster
+func TestGetRelatedKeys(t *testing.T) {
+	tests := []struct {
+		cmdLine string
+		write   string
+		read    string
+	}{
+		{"GET a", "", "a"},
+		{"set a v EX 10 GET", "a", ""},
+		{"MSET a 1 b 2 c 3", "a,b,c", ""},
+		{"MGET a b c", "", "a,b,c"},
+		{"DEL a b", "a,b", ""},
+		{"EXISTS a b", "", "a,b"},
+		{"RENAME a b", "a,b", ""},
+		{"LMOVE a b LEFT RIGHT", "a,b", ""},
+		{"HSET h f v f2 v2", "h", ""},
+		{"SINTERSTORE d a b", "d", "a,b"},
+		{"ZRANGESTORE d src 0 -1", "d", "src"},
+		{"ZUNIONSTORE d 2 a b WEIGHTS 1 2", "d", "a,b"},
+		// numkeys out of range only locks the destination
+		{"ZINTERSTORE d 3 a b", "d", ""},
+		{"FLUSHDB", "", ""},
+		{"KEYS *", "", ""},
+		{"PING", "", ""},
+		// unknown command or wrong number of arguments has no keys
+		{"NOSUCHCMD a", "", ""},
+		{"GET a b", "", ""},
+		{"MSET a", "", ""},
+	}
+	for _, tt := range tests {
+		write, read := GetRelatedKeys(utils.ToCmdLine(strings.Fields(tt.cmdLine)...))
+		if got := strings.Join(write, ","); got != tt.write {
+			t.Errorf("%s: expect write keys %q, got %q", tt.cmdLine, tt.write, got)
+		}
+		if got := strings.Join(read, ","); got != tt.read {
+			t.Errorf("%s: expect read keys %q, got %q", tt.cmdLine, tt.read, got)
+		}
+	}
+}
@@ -5,30 +5,70 @@ import (
 	"go-redis/datastruct/dict"
 	"go-redis/interface/database"
 	"go-redis/interface/resp"
+	"go-redis/lib/lock"
+	"go-redis/lib/timewheel"
+	"go-redis/lib/utils"
 	"go-redis/resp/reply"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dataDictSize = 1 << 10
+	ttlDictSize  = 1 << 8
+	lockerSize   = 1024
 )
 
 // DB stores data and execute user's commands
 type DB struct {
 	index int
 	// key -> DataEntity
-	data   dict.Dict
+	data dict.Dict
+	// key -> expireTime (time.Time)
+	ttlMap dict.Dict
+	// key -> version(uint32), increased by every write command, used by WATCH
+	versionMap dict.Dict
+	// dict.Dict will ensure concurrent-safety of its method
+	// use this mutex for complicated command only, eg. rpush, incr, msetnx ...
+	locker *lock.Locks
+	// every command holds dbLock for reading before locking its keys,
+	// the write commands without keys like flushdb hold it for writing since they touch all keys
+	dbLock *sync.RWMutex
+
 	addAof func(CmdLine)
+	// addAofTx writes the command lines of a transaction wrapped in MULTI/EXEC
+	addAofTx func([]CmdLine)
+	// auxiliary db only holds data, it does not register expire tasks into the time wheel
+	// which is shared with the real db
+	auxiliary bool
+	// onWrite is called with the number of written keys, used to count changes for rdb save rules
+	onWrite func(n int)
 }
 
 // ExecFunc is interface for command executor
 // args don't include cmd line
 type ExecFunc func(db *DB, args [][]byte) resp.Reply
 
+// PreFunc analyses command line when queued command to `multi`
+// returns related write keys and read keys
+type PreFunc func(args [][]byte) ([]string, []string)
+
 // CmdLine is alias for [][]byte, represents a command line
 type CmdLine = [][]byte
 
 // makeDB create DB instance
 func makeDB() *DB {
 	db := &DB{
-		data:   dict.MakeSyncDict(),
-		addAof: func(line CmdLine) {},
+		data:       dict.MakeConcurrent(dataDictSize),
+		ttlMap:     dict.MakeConcurrent(ttlDictSize),
+		versionMap: dict.MakeConcurrent(dataDictSize),
+		locker:     lock.Make(lockerSize),
+		dbLock:     &sync.RWMutex{},
+		addAof:     func(line CmdLine) {},
+		addAofTx:   func(lines []CmdLine) {},
+		onWrite:    func(n int) {},
 	}
 	return db
 }
@@ -44,8 +84,28 @@ func (db *DB) Exec(c resp.Connection, cmdLine [][]byte) resp.Reply {
 	if !validateArity(cmd.arity, cmdLine) {
 		return reply.MakeArgNumErrReply(cmdName)
 	}
-	fun := cmd.executor
-	return fun(db, cmdLine[1:])
+	if cmd.flags&flagWrite != 0 {
+		// the arguments read from client share memory blocks, the value stored would keep the whole block
+		cmdLine = utils.CopyCmdLine(cmdLine)
+	}
+	args := cmdLine[1:]
+	if cmd.touchesAllKeys() {
+		db.dbLock.Lock()
+		defer db.dbLock.Unlock()
+	} else {
+		db.dbLock.RLock()
+		defer db.dbLock.RUnlock()
+	}
+	writeKeys, readKeys := cmd.getRelatedKeys(args)
+	// lock the keys the command touches, so that check-and-set commands like msetnx are atomic
+	db.RWLocks(writeKeys, readKeys)
+	defer db.RWUnLocks(writeKeys, readKeys)
+	result := cmd.executor(db, args)
+	db.addVersion(writeKeys...)
+	if len(writeKeys) > 0 && !reply.IsErrorReply(result) {
+		db.onWrite(len(writeKeys))
+	}
+	return result
 }
 
 func validateArity(arity int, cmdArgs [][]byte) bool {
@@ -65,6 +125,9 @@ func (db *DB) GetEntity(key string) (*database.DataEntity, bool) {
 	if !ok {
 		return nil, false
 	}
+	if db.IsExpired(key) {
+		return nil, false
+	}
 	entity, _ := raw.(*database.DataEntity)
 	return entity, true
 }
@@ -87,13 +150,14 @@ func (db *DB) PutIfAbsent(key string, entity *database.DataEntity) int {
 // Remove the given key from db
 func (db *DB) Remove(key string) {
 	db.data.Remove(key)
+	db.Persist(key)
 }
 
 // Removes the given keys from db
 func (db *DB) Removes(keys ...string) (deleted int) {
 	deleted = 0
 	for _, key := range keys {
-		_, exists := db.data.Get(key)
+		_, exists := db.GetEntity(key)
 		if exists {
 			db.Remove(key)
 			deleted++
@@ -104,5 +168,128 @@ func (db *DB) Removes(keys ...string) (deleted int) {
 
 // Flush clean database
 func (db *DB) Flush() {
+	// every key is modified by flush, let the transactions watching them abort
+	db.data.ForEach(func(key string, val interface{}) bool {
+		db.addVersion(key)
+		return true
+	})
+	db.onWrite(db.data.Len())
 	db.data.Clear()
+	db.ttlMap.Clear()
+}
+
+// ForEach traverses all the keys in the db with their expiration
+func (db *DB) ForEach(cb func(key string, data *database.DataEntity, expiration *time.Time) bool) {
+	db.data.ForEach(func(key string, raw interface{}) bool {
+		entity, _ := raw.(*database.DataEntity)
+		var expiration *time.Time
+		if expireTime, ok := db.GetExpireTime(key); ok {
+			expiration = &expireTime
+		}
+		return cb(key, entity, expiration)
+	})
+}
+
+/* ---- Lock Function ----- */
+
+// RWLocks lock keys for writing and reading
+func (db *DB) RWLocks(writeKeys []string, readKeys []string) {
+	db.locker.RWLocks(writeKeys, readKeys)
+}
+
+// RWUnLocks unlock keys for writing and reading
+func (db *DB) RWUnLocks(writeKeys []string, readKeys []string) {
+	db.locker.RWUnLocks(writeKeys, readKeys)
+}
+
+/* ---- Version Functions ---- */
+
+func (db *DB) addVersion(keys ...string) {
+	for _, key := range keys {
+		versionCode := db.GetVersion(key)
+		db.versionMap.Put(key, versionCode+1)
+	}
+}
+
+// GetVersion returns version code for given key
+func (db *DB) GetVersion(key string) uint32 {
+	entity, ok := db.versionMap.Get(key)
+	if !ok {
+		return 0
+	}
+	return entity.(uint32)
+}
+
+/* ---- TTL Functions ---- */
+
+func genExpireTask(index int, key string) string {
+	return "expire:" + strconv.Itoa(index) + ":" + key
+}
+
+// Expire sets the expire time of key
+// 记录过期时间，并在时间轮中注册一个到期删除 key 的任务
+func (db *DB) Expire(key string, expireTime time.Time) {
+	db.ttlMap.Put(key, expireTime)
+	if db.auxiliary {
+		return
+	}
+	db.addExpireTask(key, expireTime)
+}
+
+// addExpireTask registers a task removing key at expireTime
+func (db *DB) addExpireTask(key string, expireTime time.Time) {
+	taskKey := genExpireTask(db.index, key)
+	timewheel.At(expireTime, taskKey, func() {
+		keys := []string{key}
+		db.RWLocks(keys, nil)
+		defer db.RWUnLocks(keys, nil)
+		rawExpireTime, ok := db.ttlMap.Get(key)
+		if !ok {
+			return
+		}
+		expireTime, _ := rawExpireTime.(time.Time)
+		// the key may have been given a new ttl while this task was waiting, check it again at that time
+		if !time.Now().After(expireTime) {
+			db.addExpireTask(key, expireTime)
+			return
+		}
+		db.Remove(key)
+		db.addVersion(key)
+	})
+}
+
+// Persist cancels the expire time of key
+func (db *DB) Persist(key string) {
+	if db.ttlMap.Remove(key) == 0 || db.auxiliary {
+		return // no pending expire task
+	}
+	taskKey := genExpireTask(db.index, key)
+	timewheel.Cancel(taskKey)
+}
+
+// IsExpired check whether a key is expired, expired key will be removed
+// 惰性删除：访问 key 时检查是否过期，过期则删除
+func (db *DB) IsExpired(key string) bool {
+	rawExpireTime, ok := db.ttlMap.Get(key)
+	if !ok {
+		return false
+	}
+	expireTime, _ := rawExpireTime.(time.Time)
+	expired := time.Now().After(expireTime)
+	if expired {
+		db.Remove(key)
+		// an expired key is modified, let the transactions watching it abort
+		db.addVersion(key)
+	}
+	return expired
+}
+
+// GetExpireTime returns the expire time of key and whether the key has a ttl
+func (db *DB) GetExpireTime(key string) (time.Time, bool) {
+	rawExpireTime, ok := db.ttlMap.Get(key)
+	if !ok {
+		return time.Time{}, false
+	}
+	expireTime, _ := rawExpireTime.(time.Time)
+	return expireTime, true
 }
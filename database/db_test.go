@@ -0,0 +1,101 @@
+package database
+
+import (
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/resp/connection"
+	"go-redis/resp/reply"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// makeTestDatabase creates a database without persistence, commands are executed by a fake connection
+func makeTestDatabase() (*StandaloneDatabase, *connection.FakeConn) {
+	return newBasicDatabase(), &connection.FakeConn{}
+}
+
+// makeTestClient creates a connection of a client, it runs as the default user
+func makeTestClient(t *testing.T) *connection.Connection {
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		_ = server.Close()
+		_ = client.Close()
+	})
+	return connection.NewConn(server)
+}
+
+// execLine executes a command line whose arguments are separated by spaces
+func execLine(mdb *StandaloneDatabase, c resp.Connection, line string) resp.Reply {
+	return mdb.Exec(c, utils.ToCmdLine(strings.Fields(line)...))
+}
+
+// assertReply checks the RESP2 encoding of the reply
+func assertReply(t *testing.T, result resp.Reply, want string) {
+	t.Helper()
+	if got := string(result.ToBytes()); got != want {
+		t.Fatalf("expect %q, got %q", want, got)
+	}
+}
+
+// assertLines executes the commands in order and checks their replies
+func assertLines(t *testing.T, mdb *StandaloneDatabase, c resp.Connection, cases [][2]string) {
+	t.Helper()
+	for _, tc := range cases {
+		if got := string(execLine(mdb, c, tc[0]).ToBytes()); got != tc[1] {
+			t.Fatalf("%s: expect %q, got %q", tc[0], tc[1], got)
+		}
+	}
+}
+
+// TestExecCopiesWriteArgs checks the values stored don't share memory with the command line
+func TestExecCopiesWriteArgs(t *testing.T) {
+	mdb, c := makeTestDatabase()
+	buf := []byte("SETkv")
+	mdb.Exec(c, [][]byte{buf[0:3:3], buf[3:4:4], buf[4:5:5]})
+	copy(buf, "XXXXX")
+	assertReply(t, execLine(mdb, c, "GET k"), "$1\r\nv\r\n")
+}
+
+// TestConcurrentCheckAndSet runs MSETNX and RENAMENX on the same keys concurrently, only one of them succeeds
+func TestConcurrentCheckAndSet(t *testing.T) {
+	const n = 16
+	for round := 0; round < 20; round++ {
+		mdb, _ := makeTestDatabase()
+		for i := 0; i < n; i++ {
+			execLine(mdb, &connection.FakeConn{}, "SET src"+strconv.Itoa(i)+" "+strconv.Itoa(i))
+		}
+		var msetnx, renamenx int32
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				c := &connection.FakeConn{}
+				v := strconv.Itoa(i)
+				if execLine(mdb, c, "MSETNX a "+v+" b "+v).(*reply.IntReply).Code == 1 {
+					atomic.AddInt32(&msetnx, 1)
+				}
+				if execLine(mdb, c, "RENAMENX src"+v+" dst").(*reply.IntReply).Code == 1 {
+					atomic.AddInt32(&renamenx, 1)
+				}
+			}(i)
+		}
+		wg.Wait()
+		if msetnx != 1 || renamenx != 1 {
+			t.Fatalf("expect only one MSETNX and RENAMENX succeeded, got %d %d", msetnx, renamenx)
+		}
+		c := &connection.FakeConn{}
+		a := string(execLine(mdb, c, "GET a").ToBytes())
+		if b := string(execLine(mdb, c, "GET b").ToBytes()); a != b {
+			t.Fatalf("expect a and b set by the same MSETNX, got %q %q", a, b)
+		}
+		// the renamed key is gone, the others are kept
+		if size := mdb.dbSet[0].data.Len(); size != n+2 {
+			t.Fatalf("expect %d keys, got %d", n+2, size)
+		}
+	}
+}
@@ -0,0 +1,498 @@
+package database
+
+import (
+	"go-redis/config"
+	"go-redis/datastruct/hash"
+	"go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/lib/wildcard"
+	"go-redis/resp/reply"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func makeHash() *hash.Hash {
+	return hash.Make(config.Properties.HashMaxListpackEntries, config.Properties.HashMaxListpackValue)
+}
+
+func (db *DB) getAsHash(key string) (*hash.Hash, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	hash, ok := entity.Data.(*hash.Hash)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	return hash, nil
+}
+
+func (db *DB) getOrInitHash(key string) (hash *hash.Hash, inited bool, errReply reply.ErrorReply) {
+	hash, errReply = db.getAsHash(key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	inited = false
+	if hash == nil {
+		hash = makeHash()
+		db.PutEntity(key, &database.DataEntity{
+			Data: hash,
+		})
+		inited = true
+	}
+	return hash, inited, nil
+}
+
+// execHSet sets field in hash table
+// HSET key field value [field value ...]
+func execHSet(db *DB, args [][]byte) resp.Reply {
+	if len(args)%2 != 1 {
+		return reply.MakeArgNumErrReply("hset")
+	}
+	key := string(args[0])
+
+	hash, _, errReply := db.getOrInitHash(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	result := 0
+	for i := 1; i < len(args); i += 2 {
+		result += hash.Set(string(args[i]), args[i+1])
+	}
+	db.addAof(utils.ToCmdLine2("hset", args...))
+	return reply.MakeIntReply(int64(result))
+}
+
+// execHSetNX sets field in hash table only if field not exists
+// HSETNX key field value
+func execHSetNX(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	value := args[2]
+
+	hash, _, errReply := db.getOrInitHash(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	result := hash.SetIfAbsent(field, value)
+	if result > 0 {
+		db.addAof(utils.ToCmdLine2("hsetnx", args...))
+	}
+	return reply.MakeIntReply(int64(result))
+}
+
+// execHGet gets field value of hash table
+// HGET key field
+func execHGet(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	field := string(args[1])
+
+	hash, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return &reply.NullBulkReply{}
+	}
+
+	value, exists := hash.Get(field)
+	if !exists {
+		return &reply.NullBulkReply{}
+	}
+	return reply.MakeBulkReply(value)
+}
+
+// execHMGet gets multi fields in hash table
+// HMGET key field [field ...]
+func execHMGet(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	size := len(args) - 1
+
+	hash, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	result := make([][]byte, size)
+	if hash == nil {
+		return reply.MakeMultiBulkReply(result)
+	}
+	for i := 0; i < size; i++ {
+		value, _ := hash.Get(string(args[i+1]))
+		result[i] = value // nil if field not exists
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// execHExists checks if a hash field exists
+// HEXISTS key field
+func execHExists(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	field := string(args[1])
+
+	hash, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	_, exists := hash.Get(field)
+	if exists {
+		return reply.MakeIntReply(1)
+	}
+	return reply.MakeIntReply(0)
+}
+
+// execHDel deletes a hash field
+// HDEL key field [field ...]
+func execHDel(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	hash, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	deleted := 0
+	for _, field := range args[1:] {
+		deleted += hash.Remove(string(field))
+	}
+	if hash.Len() == 0 {
+		db.Remove(key)
+	}
+	if deleted > 0 {
+		db.addAof(utils.ToCmdLine2("hdel", args...))
+	}
+	return reply.MakeIntReply(int64(deleted))
+}
+
+// execHLen gets number of fields in hash table
+// HLEN key
+func execHLen(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	hash, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(int64(hash.Len()))
+}
+
+// execHStrLen gets the string length of a field value
+// HSTRLEN key field
+func execHStrLen(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	field := string(args[1])
+
+	hash, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	value, _ := hash.Get(field)
+	return reply.MakeIntReply(int64(len(value)))
+}
+
+// execHGetAll gets all key-value entries in hash table
+// HGETALL key
+func execHGetAll(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	hash, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return reply.MakeBulkMapReply(nil)
+	}
+
+	result := make([][]byte, 0, hash.Len()*2)
+	hash.ForEach(func(field string, value []byte) bool {
+		result = append(result, []byte(field), value)
+		return true
+	})
+	return reply.MakeBulkMapReply(result)
+}
+
+// execHKeys gets all field names in hash table
+// HKEYS key
+func execHKeys(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	hash, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return &reply.EmptyMultiBulkReply{}
+	}
+
+	fields := make([][]byte, 0, hash.Len())
+	hash.ForEach(func(field string, value []byte) bool {
+		fields = append(fields, []byte(field))
+		return true
+	})
+	return reply.MakeMultiBulkReply(fields)
+}
+
+// execHVals gets all field value in hash table
+// HVALS key
+func execHVals(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	hash, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return &reply.EmptyMultiBulkReply{}
+	}
+
+	values := make([][]byte, 0, hash.Len())
+	hash.ForEach(func(field string, value []byte) bool {
+		values = append(values, value)
+		return true
+	})
+	return reply.MakeMultiBulkReply(values)
+}
+
+// execHIncrBy increments the integer value of a hash field by the given number
+// HINCRBY key field increment
+func execHIncrBy(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	delta, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+
+	hash, _, errReply := db.getOrInitHash(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	value, exists := hash.Get(field)
+	if !exists {
+		hash.Set(field, []byte(strconv.FormatInt(delta, 10)))
+		db.addAof(utils.ToCmdLine2("hincrby", args...))
+		return reply.MakeIntReply(delta)
+	}
+	val, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR hash value is not an integer")
+	}
+	val += delta
+	hash.Set(field, []byte(strconv.FormatInt(val, 10)))
+	db.addAof(utils.ToCmdLine2("hincrby", args...))
+	return reply.MakeIntReply(val)
+}
+
+// execHIncrByFloat increments the float value of a hash field by the given number
+// HINCRBYFLOAT key field increment
+func execHIncrByFloat(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	delta, err := strconv.ParseFloat(string(args[2]), 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not a valid float")
+	}
+
+	hash, _, errReply := db.getOrInitHash(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	val := delta
+	value, exists := hash.Get(field)
+	if exists {
+		current, err := strconv.ParseFloat(string(value), 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR hash value is not a float")
+		}
+		val += current
+	}
+	result := []byte(strconv.FormatFloat(val, 'f', -1, 64))
+	hash.Set(field, result)
+	// write the result rather than the increment, so replay does not depend on float rounding
+	db.addAof(utils.ToCmdLine2("hset", args[0], args[1], result))
+	return reply.MakeBulkReply(result)
+}
+
+// execHRandField returns random fields of a hash
+// HRANDFIELD key [count [WITHVALUES]]
+func execHRandField(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	count := int64(1)
+	withCount := false
+	withValues := false
+	if len(args) > 1 {
+		var err error
+		count, err = strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		withCount = true
+	}
+	if len(args) > 2 {
+		if len(args) > 3 || strings.ToUpper(string(args[2])) != "WITHVALUES" {
+			return &reply.SyntaxErrReply{}
+		}
+		withValues = true
+	}
+
+	hash, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		if withCount {
+			return &reply.EmptyMultiBulkReply{}
+		}
+		return &reply.NullBulkReply{}
+	}
+
+	var fields []string
+	if count >= 0 {
+		fields = hash.RandomDistinctFields(int(count))
+	} else {
+		// negative count allows the same field multiple times
+		fields = hash.RandomFields(int(-count))
+	}
+	if !withCount {
+		return reply.MakeBulkReply([]byte(fields[0]))
+	}
+	result := make([][]byte, 0, len(fields)*2)
+	for _, field := range fields {
+		result = append(result, []byte(field))
+		if withValues {
+			value, _ := hash.Get(field)
+			result = append(result, value)
+		}
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// scanFields returns the fields after cursor in a stable order and the cursor of the next call
+// fields are ordered by their hash code and the cursor is the hash code to resume from,
+// so a field existing during the whole iteration is always returned no matter what else changes
+// 按字段的哈希值排序，游标即下一次开始的哈希值，保证整个迭代过程中一直存在的字段一定会被返回
+func scanFields(fields []string, cursor uint64, count int) ([]string, uint64) {
+	codes := make(map[string]uint64, len(fields))
+	for _, field := range fields {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(field))
+		// keep 0 as the cursor that starts or finishes an iteration
+		codes[field] = uint64(h.Sum32()) + 1
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return codes[fields[i]] < codes[fields[j]]
+	})
+	start := sort.Search(len(fields), func(i int) bool {
+		return codes[fields[i]] >= cursor
+	})
+	end := start + count
+	if end >= len(fields) {
+		return fields[start:], 0
+	}
+	return fields[start:end], codes[fields[end]]
+}
+
+// execHScan iterates fields of a hash
+// HSCAN key cursor [MATCH pattern] [COUNT count] [NOVALUES]
+func execHScan(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	cursor, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR invalid cursor")
+	}
+	count := 10
+	var pattern *wildcard.Pattern
+	noValues := false
+	for i := 2; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		switch {
+		case option == "MATCH" && i+1 < len(args):
+			pattern = wildcard.CompilePattern(string(args[i+1]))
+			i++
+		case option == "COUNT" && i+1 < len(args):
+			count, err = strconv.Atoi(string(args[i+1]))
+			if err != nil || count < 1 {
+				return &reply.SyntaxErrReply{}
+			}
+			i++
+		case option == "NOVALUES":
+			noValues = true
+		default:
+			return &reply.SyntaxErrReply{}
+		}
+	}
+
+	h, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if h == nil {
+		return reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeBulkReply([]byte("0")),
+			&reply.EmptyMultiBulkReply{},
+		})
+	}
+
+	var fields []string
+	nextCursor := uint64(0)
+	if h.Encoding() == hash.EncodingListpack {
+		// small hash is returned in one call, just like redis does
+		fields = h.Fields()
+	} else {
+		fields, nextCursor = scanFields(h.Fields(), cursor, count)
+	}
+	result := make([][]byte, 0, len(fields)*2)
+	for _, field := range fields {
+		if pattern != nil && !pattern.IsMatch(field) {
+			continue
+		}
+		result = append(result, []byte(field))
+		if !noValues {
+			value, _ := h.Get(field)
+			result = append(result, value)
+		}
+	}
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte(strconv.FormatUint(nextCursor, 10))),
+		reply.MakeMultiBulkReply(result),
+	})
+}
+
+func init() {
+	RegisterCommand("HSet", execHSet, nil, -4, flagWrite, 1, 1, 1)
+	RegisterCommand("HSetNX", execHSetNX, nil, 4, flagWrite, 1, 1, 1)
+	RegisterCommand("HGet", execHGet, nil, 3, flagReadOnly, 1, 1, 1)
+	RegisterCommand("HMGet", execHMGet, nil, -3, flagReadOnly, 1, 1, 1)
+	RegisterCommand("HExists", execHExists, nil, 3, flagReadOnly, 1, 1, 1)
+	RegisterCommand("HDel", execHDel, nil, -3, flagWrite, 1, 1, 1)
+	RegisterCommand("HLen", execHLen, nil, 2, flagReadOnly, 1, 1, 1)
+	RegisterCommand("HStrLen", execHStrLen, nil, 3, flagReadOnly, 1, 1, 1)
+	RegisterCommand("HGetAll", execHGetAll, nil, 2, flagReadOnly, 1, 1, 1)
+	RegisterCommand("HKeys", execHKeys, nil, 2, flagReadOnly, 1, 1, 1)
+	RegisterCommand("HVals", execHVals, nil, 2, flagReadOnly, 1, 1, 1)
+	RegisterCommand("HIncrBy", execHIncrBy, nil, 4, flagWrite, 1, 1, 1)
+	RegisterCommand("HIncrByFloat", execHIncrByFloat, nil, 4, flagWrite, 1, 1, 1)
+	RegisterCommand("HRandField", execHRandField, nil, -2, flagReadOnly, 1, 1, 1)
+	RegisterCommand("HScan", execHScan, nil, -3, flagReadOnly, 1, 1, 1)
+}
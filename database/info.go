@@ -0,0 +1,95 @@
+package database
+
+import (
+	"bytes"
+	"go-redis/config"
+	"go-redis/interface/resp"
+	"go-redis/resp/reply"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// infoSection generates the content of a section of INFO
+type infoSection struct {
+	name string
+	gen  func(mdb *StandaloneDatabase, buf *bytes.Buffer)
+}
+
+var infoSections = []infoSection{
+	{"persistence", persistenceInfo},
+}
+
+// execInfo implements INFO [section ...]
+func execInfo(mdb *StandaloneDatabase, args [][]byte) resp.Reply {
+	wanted := make(map[string]bool)
+	all := len(args) == 0
+	for _, arg := range args {
+		section := strings.ToLower(string(arg))
+		if section == "all" || section == "default" || section == "everything" {
+			all = true
+		}
+		wanted[section] = true
+	}
+	var buf bytes.Buffer
+	for _, section := range infoSections {
+		if !all && !wanted[section.name] {
+			continue
+		}
+		if buf.Len() > 0 {
+			buf.WriteString("\r\n")
+		}
+		buf.WriteString("# " + strings.ToUpper(section.name[:1]) + section.name[1:] + "\r\n")
+		section.gen(mdb, &buf)
+	}
+	return reply.MakeVerbatimStringReply("txt", buf.Bytes())
+}
+
+func writeInfoLine(buf *bytes.Buffer, field string, value string) {
+	buf.WriteString(field + ":" + value + "\r\n")
+}
+
+func boolToInfo(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+func persistenceInfo(mdb *StandaloneDatabase, buf *bytes.Buffer) {
+	if mdb.rdb != nil {
+		writeInfoLine(buf, "rdb_changes_since_last_save", strconv.FormatInt(atomic.LoadInt64(&mdb.rdb.dirty), 10))
+		mdb.rdb.mu.Lock()
+		inProgress, lastErr := mdb.rdb.bgSaveInProgress, mdb.rdb.lastBgSaveErr
+		mdb.rdb.mu.Unlock()
+		writeInfoLine(buf, "rdb_bgsave_in_progress", boolToInfo(inProgress))
+		writeInfoLine(buf, "rdb_last_save_time", strconv.FormatInt(atomic.LoadInt64(&mdb.rdb.lastSave), 10))
+		if lastErr != nil {
+			writeInfoLine(buf, "rdb_last_bgsave_status", "err")
+		} else {
+			writeInfoLine(buf, "rdb_last_bgsave_status", "ok")
+		}
+	}
+	writeInfoLine(buf, "aof_enabled", boolToInfo(config.Properties.AppendOnly))
+	if mdb.aofHandler == nil {
+		writeInfoLine(buf, "aof_rewrite_in_progress", "0")
+		return
+	}
+	status := mdb.aofHandler.Status()
+	writeInfoLine(buf, "aof_rewrite_in_progress", boolToInfo(status.RewriteInProgress))
+	writeInfoLine(buf, "aof_current_size", strconv.FormatInt(status.CurrentSize, 10))
+	writeInfoLine(buf, "aof_base_size", strconv.FormatInt(status.BaseSize, 10))
+	writeInfoLine(buf, "aof_fsync", status.Fsync)
+	var lastFsync int64
+	if !status.LastFsyncTime.IsZero() {
+		lastFsync = status.LastFsyncTime.Unix()
+	}
+	writeInfoLine(buf, "aof_last_fsync_time", strconv.FormatInt(lastFsync, 10))
+	if status.LastFsyncError != nil {
+		writeInfoLine(buf, "aof_last_fsync_status", "err")
+		writeInfoLine(buf, "aof_last_fsync_error", status.LastFsyncError.Error())
+	} else {
+		writeInfoLine(buf, "aof_last_fsync_status", "ok")
+	}
+	writeInfoLine(buf, "aof_fsync_errors", strconv.FormatInt(status.FsyncErrors, 10))
+}
@@ -1,10 +1,19 @@
 package database
 
 import (
+	"go-redis/aof"
+	"go-redis/datastruct/hash"
+	"go-redis/datastruct/list"
+	"go-redis/datastruct/set"
+	"go-redis/datastruct/sortedset"
 	"go-redis/interface/resp"
 	"go-redis/lib/utils"
 	"go-redis/lib/wildcard"
 	"go-redis/resp/reply"
+	"math"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // execDel removes a key from db
@@ -55,10 +64,57 @@ func execType(db *DB, args [][]byte) resp.Reply {
 	switch entity.Data.(type) {
 	case []byte:
 		return reply.MakeStatusReply("string")
+	case list.List:
+		return reply.MakeStatusReply("list")
+	case *hash.Hash:
+		return reply.MakeStatusReply("hash")
+	case *set.Set:
+		return reply.MakeStatusReply("set")
+	case *sortedset.SortedSet:
+		return reply.MakeStatusReply("zset")
 	}
 	return &reply.UnknownErrReply{}
 }
 
+// execObject inspects the internals of the value bound to a key
+// OBJECT ENCODING key
+func execObject(db *DB, args [][]byte) resp.Reply {
+	subCmd := strings.ToLower(string(args[0]))
+	if subCmd != "encoding" {
+		return reply.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try OBJECT HELP.")
+	}
+	if len(args) != 2 {
+		return reply.MakeArgNumErrReply("object|encoding")
+	}
+	key := string(args[1])
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return &reply.NullBulkReply{}
+	}
+	var encoding string
+	switch val := entity.Data.(type) {
+	case []byte:
+		if _, err := strconv.ParseInt(string(val), 10, 64); err == nil {
+			encoding = "int"
+		} else if len(val) <= 44 {
+			encoding = "embstr"
+		} else {
+			encoding = "raw"
+		}
+	case list.List:
+		encoding = "quicklist"
+	case *hash.Hash:
+		encoding = val.Encoding()
+	case *set.Set:
+		encoding = val.Encoding()
+	case *sortedset.SortedSet:
+		encoding = "skiplist"
+	default:
+		return &reply.UnknownErrReply{}
+	}
+	return reply.MakeBulkReply([]byte(encoding))
+}
+
 // execRename a key
 func execRename(db *DB, args [][]byte) resp.Reply {
 	if len(args) != 2 {
@@ -71,8 +127,12 @@ func execRename(db *DB, args [][]byte) resp.Reply {
 	if !ok {
 		return reply.MakeErrReply("no such key")
 	}
+	expireTime, hasTTL := db.GetExpireTime(src)
+	db.Removes(src, dest) // clean src and dest with their ttl
 	db.PutEntity(dest, entity)
-	db.Remove(src)
+	if hasTTL {
+		db.Expire(dest, expireTime)
+	}
 	db.addAof(utils.ToCmdLine2("rename", args...))
 	return &reply.OkReply{}
 }
@@ -92,8 +152,12 @@ func execRenameNx(db *DB, args [][]byte) resp.Reply {
 	if !ok {
 		return reply.MakeErrReply("no such key")
 	}
+	expireTime, hasTTL := db.GetExpireTime(src)
 	db.Removes(src, dest) // clean src and dest with their ttl
 	db.PutEntity(dest, entity)
+	if hasTTL {
+		db.Expire(dest, expireTime)
+	}
 	db.addAof(utils.ToCmdLine2("renamenx", args...))
 	return reply.MakeIntReply(1)
 }
@@ -103,8 +167,11 @@ func execRenameNx(db *DB, args [][]byte) resp.Reply {
 func execKeys(db *DB, args [][]byte) resp.Reply {
 	pattern := wildcard.CompilePattern(string(args[0]))
 	result := make([][]byte, 0)
+	now := time.Now()
 	db.data.ForEach(func(key string, val interface{}) bool {
-		if pattern.IsMatch(key) {
+		// the dict can not be modified during ForEach, so expired keys are skipped rather than removed
+		expireTime, hasTTL := db.GetExpireTime(key)
+		if pattern.IsMatch(key) && !(hasTTL && now.After(expireTime)) {
 			result = append(result, []byte(key))
 		}
 		return true
@@ -112,13 +179,162 @@ func execKeys(db *DB, args [][]byte) resp.Reply {
 	return reply.MakeMultiBulkReply(result)
 }
 
+// expireAt sets the absolute expire time of an existing key, a time in the past deletes the key at once
+// 设置 key 的绝对过期时间，若时间已过则直接删除 key
+func expireAt(db *DB, key string, expireTime time.Time) resp.Reply {
+	_, exists := db.GetEntity(key)
+	if !exists {
+		return reply.MakeIntReply(0)
+	}
+	if !expireTime.After(time.Now()) {
+		db.Remove(key)
+		db.addAof(utils.ToCmdLine("del", key))
+		return reply.MakeIntReply(1)
+	}
+	db.Expire(key, expireTime)
+	db.addAof(aof.MakeExpireCmd(key, expireTime))
+	return reply.MakeIntReply(1)
+}
+
+// toExpireTime converts a ttl (relative) or unix time (absolute) in the unit into expire time,
+// ok is false if the expire time is out of the range of unix nanoseconds
+// 将秒/毫秒级的 ttl 或 unix 时间戳转换为过期时间，溢出时 ok 为 false
+func toExpireTime(val int64, unit time.Duration, relative bool) (expireTime time.Time, ok bool) {
+	if val > math.MaxInt64/int64(unit) || val < math.MinInt64/int64(unit) {
+		return time.Time{}, false
+	}
+	nanos := val * int64(unit)
+	if relative {
+		now := time.Now().UnixNano()
+		if nanos > math.MaxInt64-now {
+			return time.Time{}, false
+		}
+		nanos += now
+	}
+	return time.Unix(0, nanos), true
+}
+
+// parseExpireArg parses the argument of EXPIRE, PEXPIRE, EXPIREAT and PEXPIREAT
+func parseExpireArg(arg []byte, unit time.Duration, relative bool, cmdName string) (time.Time, reply.ErrorReply) {
+	val, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return time.Time{}, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	expireTime, ok := toExpireTime(val, unit, relative)
+	if !ok {
+		return time.Time{}, reply.MakeErrReply("ERR invalid expire time in '" + cmdName + "' command")
+	}
+	return expireTime, nil
+}
+
+// execExpire sets a key's time to live in seconds
+// 设置 key 的过期时间，单位为秒
+func execExpire(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	expireTime, errReply := parseExpireArg(args[1], time.Second, true, "expire")
+	if errReply != nil {
+		return errReply
+	}
+	return expireAt(db, key, expireTime)
+}
+
+// execExpireAt sets a key's expiration in unix timestamp
+// 以秒级 unix 时间戳设置 key 的过期时间
+func execExpireAt(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	expireTime, errReply := parseExpireArg(args[1], time.Second, false, "expireat")
+	if errReply != nil {
+		return errReply
+	}
+	return expireAt(db, key, expireTime)
+}
+
+// execPExpire sets a key's time to live in milliseconds
+// 设置 key 的过期时间，单位为毫秒
+func execPExpire(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	expireTime, errReply := parseExpireArg(args[1], time.Millisecond, true, "pexpire")
+	if errReply != nil {
+		return errReply
+	}
+	return expireAt(db, key, expireTime)
+}
+
+// execPExpireAt sets a key's expiration in unix timestamp specified in milliseconds
+// 以毫秒级 unix 时间戳设置 key 的过期时间
+func execPExpireAt(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	expireTime, errReply := parseExpireArg(args[1], time.Millisecond, false, "pexpireat")
+	if errReply != nil {
+		return errReply
+	}
+	return expireAt(db, key, expireTime)
+}
+
+// execTTL returns a key's time to live in seconds
+// 返回 key 的剩余生存时间（秒），-2 表示 key 不存在，-1 表示 key 没有过期时间
+func execTTL(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	_, exists := db.GetEntity(key)
+	if !exists {
+		return reply.MakeIntReply(-2)
+	}
+	expireTime, hasTTL := db.GetExpireTime(key)
+	if !hasTTL {
+		return reply.MakeIntReply(-1)
+	}
+	ttl := expireTime.Sub(time.Now())
+	return reply.MakeIntReply(int64((ttl + 500*time.Millisecond) / time.Second))
+}
+
+// execPTTL returns a key's time to live in milliseconds
+// 返回 key 的剩余生存时间（毫秒）
+func execPTTL(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	_, exists := db.GetEntity(key)
+	if !exists {
+		return reply.MakeIntReply(-2)
+	}
+	expireTime, hasTTL := db.GetExpireTime(key)
+	if !hasTTL {
+		return reply.MakeIntReply(-1)
+	}
+	ttl := expireTime.Sub(time.Now())
+	return reply.MakeIntReply(int64(ttl / time.Millisecond))
+}
+
+// execPersist removes expiration from a key
+// 移除 key 的过期时间
+func execPersist(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	_, exists := db.GetEntity(key)
+	if !exists {
+		return reply.MakeIntReply(0)
+	}
+	_, hasTTL := db.GetExpireTime(key)
+	if !hasTTL {
+		return reply.MakeIntReply(0)
+	}
+	db.Persist(key)
+	db.addAof(utils.ToCmdLine2("persist", args...))
+	return reply.MakeIntReply(1)
+}
+
 // 为什么需要注册在这里? 因为在database.go中，我们需要注册所有的命令
 func init() {
-	RegisterCommand("Del", execDel, -2)
-	RegisterCommand("Exists", execExists, -2)
-	RegisterCommand("Keys", execKeys, 2)
-	RegisterCommand("FlushDB", execFlushDB, -1)
-	RegisterCommand("Type", execType, 2)
-	RegisterCommand("Rename", execRename, 3)
-	RegisterCommand("RenameNx", execRenameNx, 3)
+	RegisterCommand("Del", execDel, nil, -2, flagWrite, 1, -1, 1)
+	RegisterCommand("Exists", execExists, nil, -2, flagReadOnly, 1, -1, 1)
+	RegisterCommand("Keys", execKeys, nil, 2, flagReadOnly, 0, 0, 0)
+	RegisterCommand("FlushDB", execFlushDB, nil, -1, flagWrite, 0, 0, 0)
+	RegisterCommand("Type", execType, nil, 2, flagReadOnly, 1, 1, 1)
+	RegisterCommand("Object", execObject, nil, -2, flagReadOnly, 2, 2, 1)
+	RegisterCommand("Rename", execRename, nil, 3, flagWrite, 1, 2, 1)
+	RegisterCommand("RenameNx", execRenameNx, nil, 3, flagWrite, 1, 2, 1)
+	RegisterCommand("Expire", execExpire, nil, 3, flagWrite, 1, 1, 1)
+	RegisterCommand("ExpireAt", execExpireAt, nil, 3, flagWrite, 1, 1, 1)
+	RegisterCommand("PExpire", execPExpire, nil, 3, flagWrite, 1, 1, 1)
+	RegisterCommand("PExpireAt", execPExpireAt, nil, 3, flagWrite, 1, 1, 1)
+	RegisterCommand("TTL", execTTL, nil, 2, flagReadOnly, 1, 1, 1)
+	RegisterCommand("PTTL", execPTTL, nil, 2, flagReadOnly, 1, 1, 1)
+	RegisterCommand("Persist", execPersist, nil, 2, flagWrite, 1, 1, 1)
 }
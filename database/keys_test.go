@@ -0,0 +1,195 @@
+package database
+
+import (
+	"go-redis/resp/reply"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestActiveExpire checks the keys are removed by the time wheel without being read
+func TestActiveExpire(t *testing.T) {
+	mdb, c := makeTestDatabase()
+	db := mdb.dbSet[0]
+	for i := 0; i < 40; i++ {
+		key := "k" + strconv.Itoa(i)
+		execLine(mdb, c, "SET "+key+" v")
+		// sub-second and fractional ttls, which used to be rounded down to the tick before the deadline
+		ttl := []string{"PEXPIRE " + key + " 1500", "PEXPIRE " + key + " 300", "PEXPIRE " + key + " 1001", "EXPIRE " + key + " 1"}[i%4]
+		assertReply(t, execLine(mdb, c, ttl), ":1\r\n")
+	}
+	execLine(mdb, c, "SET long v")
+	execLine(mdb, c, "EXPIRE long 100")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for db.data.Len() > 1 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if n := db.data.Len(); n != 1 {
+		var left []string
+		db.data.ForEach(func(key string, val interface{}) bool {
+			left = append(left, key)
+			return true
+		})
+		t.Fatalf("expect only the long-lived key left, got %d keys %v", n, left)
+	}
+	if _, ok := db.data.Get("long"); !ok {
+		t.Fatal("expect the long-lived key kept")
+	}
+	if db.ttlMap.Len() != 1 {
+		t.Fatalf("expect 1 ttl left, got %d", db.ttlMap.Len())
+	}
+}
+
+// TestExpireExtended checks the expire task fires at the new deadline after the ttl is extended
+func TestExpireExtended(t *testing.T) {
+	mdb, c := makeTestDatabase()
+	db := mdb.dbSet[0]
+	execLine(mdb, c, "SET k v")
+	execLine(mdb, c, "PEXPIRE k 200")
+	execLine(mdb, c, "PEXPIRE k 1800")
+	time.Sleep(1200 * time.Millisecond)
+	if _, ok := db.data.Get("k"); !ok {
+		t.Fatal("expect the key kept before the extended deadline")
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for db.data.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if db.data.Len() != 0 {
+		t.Fatal("expect the key removed after the extended deadline")
+	}
+}
+
+func TestTTL(t *testing.T) {
+	mdb, c := makeTestDatabase()
+	future := strconv.FormatInt(time.Now().Add(100*time.Second).Unix(), 10)
+	futureMs := strconv.FormatInt(time.Now().Add(100*time.Second).UnixMilli(), 10)
+	past := strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10)
+	assertLines(t, mdb, c, [][2]string{
+		{"TTL k", ":-2\r\n"},
+		{"PTTL k", ":-2\r\n"},
+		{"EXPIRE k 100", ":0\r\n"},
+		{"PERSIST k", ":0\r\n"},
+		{"SET k v", "+OK\r\n"},
+		{"TTL k", ":-1\r\n"},
+		{"PTTL k", ":-1\r\n"},
+		{"PERSIST k", ":0\r\n"},
+		{"EXPIRE k 100", ":1\r\n"},
+		{"TTL k", ":100\r\n"},
+		{"PEXPIRE k 100600", ":1\r\n"},
+		{"TTL k", ":101\r\n"},
+		{"EXPIREAT k " + future, ":1\r\n"},
+		{"PEXPIREAT k " + futureMs, ":1\r\n"},
+		{"PERSIST k", ":1\r\n"},
+		{"TTL k", ":-1\r\n"},
+		{"EXPIRE k abc", "-ERR value is not an integer or out of range\r\n"},
+		{"EXPIRE k 9223372036854775807", "-ERR invalid expire time in 'expire' command\r\n"},
+		{"PEXPIRE k 9223372036854775807", "-ERR invalid expire time in 'pexpire' command\r\n"},
+		{"EXPIREAT k -9223372036854775808", "-ERR invalid expire time in 'expireat' command\r\n"},
+		{"PEXPIREAT k 9223372036854775807", "-ERR invalid expire time in 'pexpireat' command\r\n"},
+		{"TTL k", ":-1\r\n"},
+		// a time in the past deletes the key
+		{"EXPIREAT k " + past, ":1\r\n"},
+		{"EXISTS k", ":0\r\n"},
+		{"SET k v", "+OK\r\n"},
+		{"EXPIRE k -1", ":1\r\n"},
+		{"EXISTS k", ":0\r\n"},
+	})
+	execLine(mdb, c, "SET k v")
+	execLine(mdb, c, "PEXPIRE k 5000")
+	pttl := execLine(mdb, c, "PTTL k").(*reply.IntReply).Code
+	if pttl <= 4000 || pttl > 5000 {
+		t.Fatalf("expect pttl in (4000, 5000], got %d", pttl)
+	}
+}
+
+// TestLazyExpire checks an expired key is removed when it is read
+func TestLazyExpire(t *testing.T) {
+	mdb, c := makeTestDatabase()
+	execLine(mdb, c, "SET k v")
+	execLine(mdb, c, "PEXPIRE k 50")
+	time.Sleep(100 * time.Millisecond)
+	assertLines(t, mdb, c, [][2]string{
+		{"GET k", "$-1\r\n"},
+		{"TTL k", ":-2\r\n"},
+	})
+	if mdb.dbSet[0].ttlMap.Len() != 0 {
+		t.Fatal("expect the ttl removed with the key")
+	}
+}
+
+func TestTTLCarryOver(t *testing.T) {
+	mdb, c := makeTestDatabase()
+	assertLines(t, mdb, c, [][2]string{
+		// RENAME moves the ttl to the new key
+		{"SET a 1", "+OK\r\n"},
+		{"EXPIRE a 100", ":1\r\n"},
+		{"RENAME a b", "+OK\r\n"},
+		{"TTL a", ":-2\r\n"},
+		{"TTL b", ":100\r\n"},
+		// the ttl of the overwritten key is cleared
+		{"SET c 1", "+OK\r\n"},
+		{"RENAME c b", "+OK\r\n"},
+		{"TTL b", ":-1\r\n"},
+		// RENAMENX as well
+		{"SET d 1", "+OK\r\n"},
+		{"EXPIRE d 200", ":1\r\n"},
+		{"RENAMENX d b", ":0\r\n"},
+		{"RENAMENX d e", ":1\r\n"},
+		{"TTL e", ":200\r\n"},
+		// DEL removes the ttl, the key set again lives forever
+		{"DEL e", ":1\r\n"},
+		{"SET e 1", "+OK\r\n"},
+		{"TTL e", ":-1\r\n"},
+		// so does FLUSHDB
+		{"EXPIRE e 100", ":1\r\n"},
+		{"FLUSHDB", "+OK\r\n"},
+		{"SET e 1", "+OK\r\n"},
+		{"TTL e", ":-1\r\n"},
+	})
+	if n := mdb.dbSet[0].ttlMap.Len(); n != 0 {
+		t.Fatalf("expect no ttl left, got %d", n)
+	}
+}
+
+// TestExpireAof checks expirations are written to aof as absolute PEXPIREAT
+func TestExpireAof(t *testing.T) {
+	mdb, c := makeTestDatabase()
+	var lines []string
+	mdb.dbSet[0].addAof = func(line CmdLine) {
+		lines = append(lines, string(join(line)))
+	}
+	before := time.Now().Add(100 * time.Second).UnixMilli()
+	execLine(mdb, c, "SET k v")
+	execLine(mdb, c, "EXPIRE k 100")
+	after := time.Now().Add(100 * time.Second).UnixMilli()
+	execLine(mdb, c, "PERSIST k")
+	execLine(mdb, c, "EXPIRE k 0")
+	execLine(mdb, c, "EXPIRE missing 100")
+	if len(lines) != 4 {
+		t.Fatalf("expect 4 aof lines, got %q", lines)
+	}
+	fields := strings.Fields(lines[1])
+	if len(fields) != 3 || fields[0] != "PEXPIREAT" || fields[1] != "k" {
+		t.Fatalf("expect PEXPIREAT k <ms>, got %q", lines[1])
+	}
+	if ms, _ := strconv.ParseInt(fields[2], 10, 64); ms < before || ms > after {
+		t.Fatalf("expect expire time in [%d, %d], got %s", before, after, fields[2])
+	}
+	if lines[2] != "persist k" || lines[3] != "del k" {
+		t.Fatalf("expect persist and del, got %q", lines[2:])
+	}
+}
+
+func join(line CmdLine) []byte {
+	result := make([]byte, 0)
+	for i, arg := range line {
+		if i > 0 {
+			result = append(result, ' ')
+		}
+		result = append(result, arg...)
+	}
+	return result
+}
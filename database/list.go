@@ -0,0 +1,553 @@
+package database
+
+import (
+	"go-redis/datastruct/list"
+	"go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/resp/reply"
+	"strconv"
+	"strings"
+)
+
+func (db *DB) getAsList(key string) (list.List, reply.ErrorReply) {
+	entity, ok := db.GetEntity(key)
+	if !ok {
+		return nil, nil
+	}
+	list, ok := entity.Data.(list.List)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	return list, nil
+}
+
+func (db *DB) getOrInitList(key string) (l list.List, isNew bool, errReply reply.ErrorReply) {
+	l, errReply = db.getAsList(key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	isNew = false
+	if l == nil {
+		l = list.NewQuickList()
+		db.PutEntity(key, &database.DataEntity{
+			Data: l,
+		})
+		isNew = true
+	}
+	return l, isNew, nil
+}
+
+// normalizeRange converts redis style [start, stop] (stop inclusive, negative index counts from tail)
+// into a go style [start, stop) within [0, size], returns false if the range is empty
+// 将 redis 风格的闭区间索引（支持负数）转换为左闭右开区间
+func normalizeRange(start, stop int64, size int) (int, int, bool) {
+	length := int64(size)
+	if start < 0 {
+		start = length + start
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop < 0 {
+		stop = length + stop
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	if start >= length || start > stop {
+		return 0, 0, false
+	}
+	return int(start), int(stop) + 1, true
+}
+
+func listEquals(expected []byte) list.Expected {
+	return func(a interface{}) bool {
+		return utils.BytesEquals(a.([]byte), expected)
+	}
+}
+
+// execLIndex gets element of list at given list
+// LINDEX key index
+func execLIndex(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	index64, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	index := int(index64)
+
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return &reply.NullBulkReply{}
+	}
+
+	size := list.Len() // assert: size > 0
+	if index < -1*size {
+		return &reply.NullBulkReply{}
+	} else if index < 0 {
+		index = size + index
+	} else if index >= size {
+		return &reply.NullBulkReply{}
+	}
+
+	val, _ := list.Get(index).([]byte)
+	return reply.MakeBulkReply(val)
+}
+
+// execLLen gets length of list
+// LLEN key
+func execLLen(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	size := int64(list.Len())
+	return reply.MakeIntReply(size)
+}
+
+// popCount parses the optional count argument of LPOP/RPOP
+func popCount(args [][]byte) (int, bool, reply.ErrorReply) {
+	if len(args) < 2 {
+		return 1, false, nil
+	}
+	if len(args) > 2 {
+		return 0, false, &reply.SyntaxErrReply{}
+	}
+	count, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil || count < 0 {
+		return 0, false, reply.MakeErrReply("ERR value is out of range, must be positive")
+	}
+	return int(count), true, nil
+}
+
+// execLPop removes the first elements of list, and return them
+// LPOP key [count]
+func execLPop(db *DB, args [][]byte) resp.Reply {
+	return listPop(db, args, "lpop", func(list list.List) interface{} {
+		return list.Remove(0)
+	})
+}
+
+// execRPop removes the last elements of list, and return them
+// RPOP key [count]
+func execRPop(db *DB, args [][]byte) resp.Reply {
+	return listPop(db, args, "rpop", func(list list.List) interface{} {
+		return list.RemoveLast()
+	})
+}
+
+func listPop(db *DB, args [][]byte, cmdName string, pop func(list list.List) interface{}) resp.Reply {
+	key := string(args[0])
+	count, withCount, errReply := popCount(args)
+	if errReply != nil {
+		return errReply
+	}
+
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return &reply.NullBulkReply{}
+	}
+
+	if count > list.Len() {
+		count = list.Len()
+	}
+	popped := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		val, _ := pop(list).([]byte)
+		popped = append(popped, val)
+	}
+	if list.Len() == 0 {
+		db.Remove(key)
+	}
+	if count > 0 {
+		db.addAof(utils.ToCmdLine2(cmdName, args...))
+	}
+	if withCount {
+		return reply.MakeMultiBulkReply(popped)
+	}
+	return reply.MakeBulkReply(popped[0])
+}
+
+// execLPush inserts element at head of list
+// LPUSH key element [element ...]
+func execLPush(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	values := args[1:]
+
+	list, _, errReply := db.getOrInitList(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	for _, value := range values {
+		list.Insert(0, value)
+	}
+
+	db.addAof(utils.ToCmdLine2("lpush", args...))
+	return reply.MakeIntReply(int64(list.Len()))
+}
+
+// execRPush inserts element at last of list
+// RPUSH key element [element ...]
+func execRPush(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	values := args[1:]
+
+	list, _, errReply := db.getOrInitList(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	for _, value := range values {
+		list.Add(value)
+	}
+
+	db.addAof(utils.ToCmdLine2("rpush", args...))
+	return reply.MakeIntReply(int64(list.Len()))
+}
+
+// execLRange gets elements of list in given range
+// LRANGE key start stop
+func execLRange(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	start64, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	stop64, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return &reply.EmptyMultiBulkReply{}
+	}
+
+	start, stop, ok := normalizeRange(start64, stop64, list.Len())
+	if !ok {
+		return &reply.EmptyMultiBulkReply{}
+	}
+
+	slice := list.Range(start, stop)
+	result := make([][]byte, len(slice))
+	for i, raw := range slice {
+		bytes, _ := raw.([]byte)
+		result[i] = bytes
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// execLRem removes element of list
+// LREM key count element
+func execLRem(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	count64, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	count := int(count64)
+	value := args[2]
+
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	var removed int
+	if count == 0 {
+		removed = list.RemoveAllByVal(listEquals(value))
+	} else if count > 0 {
+		removed = list.RemoveByVal(listEquals(value), count)
+	} else {
+		removed = list.ReverseRemoveByVal(listEquals(value), -count)
+	}
+
+	if list.Len() == 0 {
+		db.Remove(key)
+	}
+	if removed > 0 {
+		db.addAof(utils.ToCmdLine2("lrem", args...))
+	}
+
+	return reply.MakeIntReply(int64(removed))
+}
+
+// execLSet puts element at given index of list
+// LSET key index element
+func execLSet(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	index64, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	index := int(index64)
+	value := args[2]
+
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return reply.MakeErrReply("ERR no such key")
+	}
+
+	size := list.Len() // assert: size > 0
+	if index < -1*size {
+		return reply.MakeErrReply("ERR index out of range")
+	} else if index < 0 {
+		index = size + index
+	} else if index >= size {
+		return reply.MakeErrReply("ERR index out of range")
+	}
+
+	list.Set(index, value)
+	db.addAof(utils.ToCmdLine2("lset", args...))
+	return &reply.OkReply{}
+}
+
+// execLTrim trims the list to the given range
+// LTRIM key start stop
+func execLTrim(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	start64, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	stop64, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return &reply.OkReply{}
+	}
+
+	start, stop, ok := normalizeRange(start64, stop64, list.Len())
+	if !ok {
+		db.Remove(key)
+	} else {
+		for list.Len() > stop {
+			list.RemoveLast()
+		}
+		for i := 0; i < start; i++ {
+			list.Remove(0)
+		}
+	}
+	db.addAof(utils.ToCmdLine2("ltrim", args...))
+	return &reply.OkReply{}
+}
+
+// execLInsert inserts element before or after the pivot
+// LINSERT key BEFORE|AFTER pivot element
+func execLInsert(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	where := strings.ToUpper(string(args[1]))
+	if where != "BEFORE" && where != "AFTER" {
+		return &reply.SyntaxErrReply{}
+	}
+	pivot := args[2]
+	value := args[3]
+
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	pivotIndex := -1
+	list.ForEach(func(i int, v interface{}) bool {
+		if utils.BytesEquals(v.([]byte), pivot) {
+			pivotIndex = i
+			return false
+		}
+		return true
+	})
+	if pivotIndex < 0 {
+		return reply.MakeIntReply(-1)
+	}
+	if where == "AFTER" {
+		pivotIndex++
+	}
+	list.Insert(pivotIndex, value)
+	db.addAof(utils.ToCmdLine2("linsert", args...))
+	return reply.MakeIntReply(int64(list.Len()))
+}
+
+// execLPos returns the index of matching elements inside a list
+// LPOS key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+func execLPos(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	element := args[1]
+	rank := int64(1)
+	count := int64(-1) // -1 means COUNT is not given
+	maxLen := int64(0)
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return &reply.SyntaxErrReply{}
+		}
+		option := strings.ToUpper(string(args[i]))
+		val, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		switch option {
+		case "RANK":
+			if val == 0 {
+				return reply.MakeErrReply("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")
+			}
+			rank = val
+		case "COUNT":
+			if val < 0 {
+				return reply.MakeErrReply("ERR COUNT can't be negative")
+			}
+			count = val
+		case "MAXLEN":
+			if val < 0 {
+				return reply.MakeErrReply("ERR MAXLEN can't be negative")
+			}
+			maxLen = val
+		default:
+			return &reply.SyntaxErrReply{}
+		}
+	}
+
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		if count >= 0 {
+			return &reply.EmptyMultiBulkReply{}
+		}
+		return &reply.NullBulkReply{}
+	}
+
+	// skip the first (|rank| - 1) matches, then collect
+	skip := rank - 1
+	if rank < 0 {
+		skip = -rank - 1
+	}
+	matches := make([]int64, 0)
+	scanned := int64(0)
+	consumer := func(i int, v interface{}) bool {
+		if maxLen > 0 && scanned >= maxLen {
+			return false
+		}
+		scanned++
+		if !utils.BytesEquals(v.([]byte), element) {
+			return true
+		}
+		if skip > 0 {
+			skip--
+			return true
+		}
+		matches = append(matches, int64(i))
+		if count < 0 {
+			return false // COUNT is not given, only the first match is needed
+		}
+		// COUNT 0 means returning all matches
+		return count == 0 || int64(len(matches)) < count
+	}
+	if rank > 0 {
+		list.ForEach(consumer)
+	} else {
+		list.ReverseForEach(consumer)
+	}
+
+	if count < 0 {
+		if len(matches) == 0 {
+			return &reply.NullBulkReply{}
+		}
+		return reply.MakeIntReply(matches[0])
+	}
+	result := make([]resp.Reply, len(matches))
+	for i, pos := range matches {
+		result[i] = reply.MakeIntReply(pos)
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+// execLMove atomically pops an element from source list and pushes it to destination list
+// LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+func execLMove(db *DB, args [][]byte) resp.Reply {
+	src := string(args[0])
+	dest := string(args[1])
+	from := strings.ToUpper(string(args[2]))
+	to := strings.ToUpper(string(args[3]))
+	if (from != "LEFT" && from != "RIGHT") || (to != "LEFT" && to != "RIGHT") {
+		return &reply.SyntaxErrReply{}
+	}
+
+	srcList, errReply := db.getAsList(src)
+	if errReply != nil {
+		return errReply
+	}
+	if srcList == nil {
+		return &reply.NullBulkReply{}
+	}
+	// check the type of destination before popping from source
+	if _, errReply = db.getAsList(dest); errReply != nil {
+		return errReply
+	}
+
+	var val []byte
+	if from == "LEFT" {
+		val, _ = srcList.Remove(0).([]byte)
+	} else {
+		val, _ = srcList.RemoveLast().([]byte)
+	}
+	if srcList.Len() == 0 {
+		db.Remove(src)
+	}
+
+	destList, _, _ := db.getOrInitList(dest)
+	if to == "LEFT" {
+		destList.Insert(0, val)
+	} else {
+		destList.Add(val)
+	}
+	db.addAof(utils.ToCmdLine2("lmove", args...))
+	return reply.MakeBulkReply(val)
+}
+
+func init() {
+	RegisterCommand("LPush", execLPush, nil, -3, flagWrite, 1, 1, 1)
+	RegisterCommand("RPush", execRPush, nil, -3, flagWrite, 1, 1, 1)
+	RegisterCommand("LPop", execLPop, nil, -2, flagWrite, 1, 1, 1)
+	RegisterCommand("RPop", execRPop, nil, -2, flagWrite, 1, 1, 1)
+	RegisterCommand("LRange", execLRange, nil, 4, flagReadOnly, 1, 1, 1)
+	RegisterCommand("LLen", execLLen, nil, 2, flagReadOnly, 1, 1, 1)
+	RegisterCommand("LIndex", execLIndex, nil, 3, flagReadOnly, 1, 1, 1)
+	RegisterCommand("LSet", execLSet, nil, 4, flagWrite, 1, 1, 1)
+	RegisterCommand("LRem", execLRem, nil, 4, flagWrite, 1, 1, 1)
+	RegisterCommand("LTrim", execLTrim, nil, 4, flagWrite, 1, 1, 1)
+	RegisterCommand("LInsert", execLInsert, nil, 5, flagWrite, 1, 1, 1)
+	RegisterCommand("LPos", execLPos, nil, -3, flagReadOnly, 1, 1, 1)
+	RegisterCommand("LMove", execLMove, nil, 5, flagWrite, 1, 2, 1)
+}
@@ -0,0 +1,356 @@
+package database
+
+import (
+	"bufio"
+	"errors"
+	"go-redis/aof"
+	"go-redis/config"
+	"go-redis/datastruct/hash"
+	"go-redis/datastruct/list"
+	"go-redis/datastruct/set"
+	"go-redis/datastruct/sortedset"
+	"go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/lib/logger"
+	"go-redis/rdb"
+	"go-redis/resp/reply"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errSaveInProgress is returned when a save is requested while another one is running
+var errSaveInProgress = errors.New("ERR Background save already in progress")
+
+// saveRule means saving rdb if there are at least `changes` changes within `seconds` seconds
+type saveRule struct {
+	seconds int64
+	changes int64
+}
+
+// rdbPersister holds the state of rdb persistence
+// RDB 持久化的状态：自上次保存以来的修改次数、上次保存时间以及后台保存状态
+type rdbPersister struct {
+	rules []saveRule
+	// dirty is the number of changes since last save
+	dirty int64
+	// lastSave is the unix time of last successful save
+	lastSave int64
+	// held while saving, only one save runs at a time
+	saving sync.Mutex
+	// stop the goroutine checking save rules
+	stopCron chan struct{}
+
+	mu               sync.Mutex // protects the fields below
+	bgSaveInProgress bool
+	lastBgSaveErr    error
+}
+
+func makeRDBPersister() *rdbPersister {
+	return &rdbPersister{
+		rules:    parseSaveRules(config.Properties.Save),
+		lastSave: time.Now().Unix(),
+	}
+}
+
+// parseSaveRules parses `save <seconds> <changes> [<seconds> <changes> ...]`
+func parseSaveRules(raw string) []saveRule {
+	fields := strings.Fields(strings.Trim(raw, "\""))
+	if len(fields)%2 != 0 {
+		logger.Warn("illegal save config: " + raw)
+		return nil
+	}
+	rules := make([]saveRule, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		seconds, err1 := strconv.ParseInt(fields[i], 10, 64)
+		changes, err2 := strconv.ParseInt(fields[i+1], 10, 64)
+		if err1 != nil || err2 != nil || seconds <= 0 || changes <= 0 {
+			logger.Warn("illegal save config: " + raw)
+			return nil
+		}
+		rules = append(rules, saveRule{seconds: seconds, changes: changes})
+	}
+	return rules
+}
+
+func (p *rdbPersister) addDirty(n int) {
+	atomic.AddInt64(&p.dirty, int64(n))
+}
+
+// startSaveCron checks save rules every second
+func (mdb *StandaloneDatabase) startSaveCron() {
+	p := mdb.rdb
+	if len(p.rules) == 0 {
+		return
+	}
+	p.stopCron = make(chan struct{})
+	ticker := time.NewTicker(time.Second)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if p.needSave() {
+					// ignore errSaveInProgress
+					_ = mdb.bgSave()
+				}
+			case <-p.stopCron:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func (p *rdbPersister) needSave() bool {
+	dirty := atomic.LoadInt64(&p.dirty)
+	elapsed := time.Now().Unix() - atomic.LoadInt64(&p.lastSave)
+	for _, rule := range p.rules {
+		if dirty >= rule.changes && elapsed >= rule.seconds {
+			return true
+		}
+	}
+	return false
+}
+
+// bgSave saves rdb in background
+func (mdb *StandaloneDatabase) bgSave() error {
+	p := mdb.rdb
+	if !p.saving.TryLock() {
+		return errSaveInProgress
+	}
+	p.mu.Lock()
+	p.bgSaveInProgress = true
+	p.mu.Unlock()
+	go func() {
+		defer p.saving.Unlock()
+		err := mdb.saveRDB()
+		if err != nil {
+			logger.Error("background saving failed: " + err.Error())
+		} else {
+			logger.Info("background saving finished")
+		}
+		p.mu.Lock()
+		p.bgSaveInProgress = false
+		p.lastBgSaveErr = err
+		p.mu.Unlock()
+	}()
+	return nil
+}
+
+// save saves rdb synchronously
+func (mdb *StandaloneDatabase) save() error {
+	p := mdb.rdb
+	if !p.saving.TryLock() {
+		return errSaveInProgress
+	}
+	defer p.saving.Unlock()
+	return mdb.saveRDB()
+}
+
+// saveRDB writes all data into a temp file and renames it to dbfilename, the caller holds rdb.saving
+// 逐个 key 加读锁写入，保证每个 key 自身是一致的，但不是整个数据库某一时刻的快照
+func (mdb *StandaloneDatabase) saveRDB() error {
+	dirty := atomic.LoadInt64(&mdb.rdb.dirty)
+	filename := config.Properties.RDBFilename
+	file, err := os.CreateTemp(filepath.Dir(filename), "temp-*.rdb")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name()) // no-op if it has been renamed
+	}()
+
+	// os.CreateTemp creates file with mode 0600
+	if err = file.Chmod(0644); err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	encoder := rdb.NewEncoder(writer)
+	if err = mdb.writeRDB(encoder); err != nil {
+		return err
+	}
+	if err = writer.Flush(); err != nil {
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		return err
+	}
+	if err = os.Rename(file.Name(), filename); err != nil {
+		return err
+	}
+	atomic.AddInt64(&mdb.rdb.dirty, -dirty)
+	atomic.StoreInt64(&mdb.rdb.lastSave, time.Now().Unix())
+	return nil
+}
+
+func (mdb *StandaloneDatabase) writeRDB(encoder *rdb.Encoder) error {
+	if err := encoder.WriteHeader(); err != nil {
+		return err
+	}
+	auxes := [][2]string{
+		{"redis-ver", "7.0.0"},
+		{"redis-bits", "64"},
+		{"ctime", strconv.FormatInt(time.Now().Unix(), 10)},
+	}
+	for _, aux := range auxes {
+		if err := encoder.WriteAux(aux[0], aux[1]); err != nil {
+			return err
+		}
+	}
+	for _, db := range mdb.dbSet {
+		if err := db.writeRDB(encoder); err != nil {
+			return err
+		}
+	}
+	return encoder.WriteEnd()
+}
+
+// writeRDB writes keys of the db, each key is read with its lock held
+func (db *DB) writeRDB(encoder *rdb.Encoder) error {
+	keys := db.data.Keys()
+	if len(keys) == 0 {
+		return nil
+	}
+	err := encoder.WriteDBHeader(uint(db.index), uint64(len(keys)), uint64(db.ttlMap.Len()))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, key := range keys {
+		err = db.writeKeyRDB(encoder, key, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DB) writeKeyRDB(encoder *rdb.Encoder, key string, now time.Time) error {
+	readKeys := []string{key}
+	db.RWLocks(nil, readKeys)
+	defer db.RWUnLocks(nil, readKeys)
+
+	raw, ok := db.data.Get(key)
+	if !ok {
+		return nil // removed after listing keys
+	}
+	var expiration *time.Time
+	if expireTime, hasTTL := db.GetExpireTime(key); hasTTL {
+		if !expireTime.After(now) {
+			return nil
+		}
+		expiration = &expireTime
+	}
+	entity, _ := raw.(*database.DataEntity)
+	return aof.EntityToRDB(encoder, key, entity, expiration)
+}
+
+// loadRDB loads dbfilename if it exists
+func (mdb *StandaloneDatabase) loadRDB() {
+	file, err := os.Open(config.Properties.RDBFilename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn(err)
+		}
+		return
+	}
+	defer file.Close()
+	err = mdb.LoadRDB(rdb.NewDecoder(bufio.NewReader(file)))
+	if err != nil {
+		logger.Error("load rdb failed: " + err.Error())
+	}
+}
+
+// LoadRDB loads the keys read by decoder into database, expired keys are ignored
+func (mdb *StandaloneDatabase) LoadRDB(decoder *rdb.Decoder) error {
+	now := time.Now()
+	return decoder.Parse(func(o rdb.Object) bool {
+		if o.GetDBIndex() >= len(mdb.dbSet) {
+			logger.Warn("db index of key " + o.GetKey() + " is out of range")
+			return true
+		}
+		expiration := o.GetExpiration()
+		if expiration != nil && !expiration.After(now) {
+			return true
+		}
+		entity := objectToEntity(o)
+		if entity == nil {
+			return true
+		}
+		db := mdb.dbSet[o.GetDBIndex()]
+		db.PutEntity(o.GetKey(), entity)
+		if expiration != nil {
+			db.Expire(o.GetKey(), *expiration)
+		}
+		return true
+	})
+}
+
+func objectToEntity(o rdb.Object) *database.DataEntity {
+	switch obj := o.(type) {
+	case *rdb.StringObject:
+		return &database.DataEntity{Data: obj.Value}
+	case *rdb.ListObject:
+		l := list.NewQuickList()
+		for _, v := range obj.Values {
+			l.Add(v)
+		}
+		return &database.DataEntity{Data: l}
+	case *rdb.HashObject:
+		h := hash.Make(config.Properties.HashMaxListpackEntries, config.Properties.HashMaxListpackValue)
+		for i, field := range obj.Fields {
+			h.Set(field, obj.Values[i])
+		}
+		return &database.DataEntity{Data: h}
+	case *rdb.SetObject:
+		members := make([]string, len(obj.Members))
+		for i, member := range obj.Members {
+			members[i] = string(member)
+		}
+		return &database.DataEntity{Data: set.Make(config.Properties.SetMaxIntsetEntries, members...)}
+	case *rdb.ZSetObject:
+		zset := sortedset.Make()
+		for _, entry := range obj.Entries {
+			zset.Add(entry.Member, entry.Score)
+		}
+		return &database.DataEntity{Data: zset}
+	}
+	return nil
+}
+
+/* ---- commands ---- */
+
+// execSave implements SAVE
+func execSave(mdb *StandaloneDatabase, args [][]byte) resp.Reply {
+	if len(args) != 0 {
+		return reply.MakeArgNumErrReply("save")
+	}
+	if err := mdb.save(); err != nil {
+		return reply.MakeErrReply(err.Error())
+	}
+	return reply.MakeOkReply()
+}
+
+// execBGSave implements BGSAVE
+func execBGSave(mdb *StandaloneDatabase, args [][]byte) resp.Reply {
+	if len(args) != 0 {
+		return reply.MakeArgNumErrReply("bgsave")
+	}
+	if err := mdb.bgSave(); err != nil {
+		return reply.MakeErrReply(err.Error())
+	}
+	return reply.MakeStatusReply("Background saving started")
+}
+
+// execLastSave implements LASTSAVE
+func execLastSave(mdb *StandaloneDatabase, args [][]byte) resp.Reply {
+	if len(args) != 0 {
+		return reply.MakeArgNumErrReply("lastsave")
+	}
+	return reply.MakeIntReply(atomic.LoadInt64(&mdb.rdb.lastSave))
+}
@@ -0,0 +1,407 @@
+package database
+
+import (
+	"go-redis/config"
+	"go-redis/datastruct/set"
+	"go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/resp/reply"
+	"strconv"
+)
+
+func makeSet(members ...string) *set.Set {
+	return set.Make(config.Properties.SetMaxIntsetEntries, members...)
+}
+
+func (db *DB) getAsSet(key string) (*set.Set, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	set, ok := entity.Data.(*set.Set)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	return set, nil
+}
+
+func (db *DB) getOrInitSet(key string) (set *set.Set, inited bool, errReply reply.ErrorReply) {
+	set, errReply = db.getAsSet(key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	inited = false
+	if set == nil {
+		set = makeSet()
+		db.PutEntity(key, &database.DataEntity{
+			Data: set,
+		})
+		inited = true
+	}
+	return set, inited, nil
+}
+
+func membersToReply(members []string) *reply.SetReply {
+	result := make([][]byte, len(members))
+	for i, member := range members {
+		result[i] = []byte(member)
+	}
+	return reply.MakeBulkSetReply(result)
+}
+
+// execSAdd adds members into set
+// SADD key member [member ...]
+func execSAdd(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	members := args[1:]
+
+	set, _, errReply := db.getOrInitSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	counter := 0
+	for _, member := range members {
+		counter += set.Add(string(member))
+	}
+	db.addAof(utils.ToCmdLine2("sadd", args...))
+	return reply.MakeIntReply(int64(counter))
+}
+
+// execSIsMember checks if the given value is member of set
+// SISMEMBER key member
+func execSIsMember(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	member := string(args[1])
+
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	if set.Has(member) {
+		return reply.MakeIntReply(1)
+	}
+	return reply.MakeIntReply(0)
+}
+
+// execSMIsMember checks if the given values are members of set
+// SMISMEMBER key member [member ...]
+func execSMIsMember(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	members := args[1:]
+
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	result := make([]resp.Reply, len(members))
+	for i, member := range members {
+		if set != nil && set.Has(string(member)) {
+			result[i] = reply.MakeIntReply(1)
+		} else {
+			result[i] = reply.MakeIntReply(0)
+		}
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+// execSRem removes members from set
+// SREM key member [member ...]
+func execSRem(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	members := args[1:]
+
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return reply.MakeIntReply(0)
+	}
+	counter := 0
+	for _, member := range members {
+		counter += set.Remove(string(member))
+	}
+	if set.Len() == 0 {
+		db.Remove(key)
+	}
+	if counter > 0 {
+		db.addAof(utils.ToCmdLine2("srem", args...))
+	}
+	return reply.MakeIntReply(int64(counter))
+}
+
+// execSPop removes and returns random members from set
+// SPOP key [count]
+func execSPop(db *DB, args [][]byte) resp.Reply {
+	if len(args) > 2 {
+		return &reply.SyntaxErrReply{}
+	}
+	key := string(args[0])
+	count := 1
+	withCount := len(args) == 2
+	if withCount {
+		count64, err := strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil || count64 < 0 {
+			return reply.MakeErrReply("ERR value is out of range, must be positive")
+		}
+		count = int(count64)
+	}
+
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		if withCount {
+			return &reply.EmptyMultiBulkReply{}
+		}
+		return &reply.NullBulkReply{}
+	}
+
+	members := set.RandomDistinctMembers(count)
+	for _, member := range members {
+		set.Remove(member)
+	}
+	if set.Len() == 0 {
+		db.Remove(key)
+	}
+	if len(members) > 0 {
+		// the popped members are random, so write down exactly which ones are removed
+		aofLine := make([]string, 0, len(members)+2)
+		aofLine = append(aofLine, "srem", key)
+		aofLine = append(aofLine, members...)
+		db.addAof(utils.ToCmdLine(aofLine...))
+	}
+	if !withCount {
+		return reply.MakeBulkReply([]byte(members[0]))
+	}
+	return membersToReply(members)
+}
+
+// execSCard gets the number of members in a set
+// SCARD key
+func execSCard(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(int64(set.Len()))
+}
+
+// execSMembers gets all members in a set
+// SMEMBERS key
+func execSMembers(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return membersToReply(nil)
+	}
+	return membersToReply(set.ToSlice())
+}
+
+// execSRandMember gets random members from set
+// SRANDMEMBER key [count]
+func execSRandMember(db *DB, args [][]byte) resp.Reply {
+	if len(args) > 2 {
+		return &reply.SyntaxErrReply{}
+	}
+	key := string(args[0])
+
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if len(args) == 1 {
+		if set == nil {
+			return &reply.NullBulkReply{}
+		}
+		members := set.RandomMembers(1)
+		return reply.MakeBulkReply([]byte(members[0]))
+	}
+
+	count64, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if set == nil {
+		return &reply.EmptyMultiBulkReply{}
+	}
+	count := int(count64)
+	if count >= 0 {
+		return membersToReply(set.RandomDistinctMembers(count))
+	}
+	// negative count allows the same member multiple times
+	return membersToReply(set.RandomMembers(-count))
+}
+
+// execSMove moves a member from one set to another
+// SMOVE source destination member
+func execSMove(db *DB, args [][]byte) resp.Reply {
+	src := string(args[0])
+	dest := string(args[1])
+	member := string(args[2])
+
+	srcSet, errReply := db.getAsSet(src)
+	if errReply != nil {
+		return errReply
+	}
+	destSet, errReply := db.getAsSet(dest)
+	if errReply != nil {
+		return errReply
+	}
+	if srcSet == nil || !srcSet.Has(member) {
+		return reply.MakeIntReply(0)
+	}
+	if src == dest {
+		// moving a member to the set itself changes nothing
+		return reply.MakeIntReply(1)
+	}
+
+	srcSet.Remove(member)
+	if srcSet.Len() == 0 {
+		db.Remove(src)
+	}
+	if destSet == nil {
+		destSet, _, _ = db.getOrInitSet(dest)
+	}
+	destSet.Add(member)
+	db.addAof(utils.ToCmdLine2("smove", args...))
+	return reply.MakeIntReply(1)
+}
+
+// setAlgebra computes the result of the given sets, a missing key is treated as an empty set
+func setAlgebra(db *DB, keys [][]byte, op func(a *set.Set, b *set.Set) *set.Set) (*set.Set, reply.ErrorReply) {
+	var result *set.Set
+	for i, arg := range keys {
+		set, errReply := db.getAsSet(string(arg))
+		if errReply != nil {
+			return nil, errReply
+		}
+		if set == nil {
+			set = makeSet()
+		}
+		if i == 0 {
+			result = set.Union(makeSet()) // copy
+			continue
+		}
+		result = op(result, set)
+	}
+	return result, nil
+}
+
+func intersect(a *set.Set, b *set.Set) *set.Set {
+	return a.Intersect(b)
+}
+
+func union(a *set.Set, b *set.Set) *set.Set {
+	return a.Union(b)
+}
+
+func diff(a *set.Set, b *set.Set) *set.Set {
+	return a.Diff(b)
+}
+
+// storeSet saves the result set into dest, an empty result removes dest
+func storeSet(db *DB, dest string, set *set.Set, cmdName string, args [][]byte) resp.Reply {
+	db.Remove(dest) // clean ttl too
+	if set.Len() > 0 {
+		db.PutEntity(dest, &database.DataEntity{
+			Data: set,
+		})
+	}
+	db.addAof(utils.ToCmdLine2(cmdName, args...))
+	return reply.MakeIntReply(int64(set.Len()))
+}
+
+// execSInter intersects multiple sets
+// SINTER key [key ...]
+func execSInter(db *DB, args [][]byte) resp.Reply {
+	result, errReply := setAlgebra(db, args, intersect)
+	if errReply != nil {
+		return errReply
+	}
+	return membersToReply(result.ToSlice())
+}
+
+// execSInterStore intersects multiple sets and store the result in a key
+// SINTERSTORE destination key [key ...]
+func execSInterStore(db *DB, args [][]byte) resp.Reply {
+	result, errReply := setAlgebra(db, args[1:], intersect)
+	if errReply != nil {
+		return errReply
+	}
+	return storeSet(db, string(args[0]), result, "sinterstore", args)
+}
+
+// execSUnion adds multiple sets
+// SUNION key [key ...]
+func execSUnion(db *DB, args [][]byte) resp.Reply {
+	result, errReply := setAlgebra(db, args, union)
+	if errReply != nil {
+		return errReply
+	}
+	return membersToReply(result.ToSlice())
+}
+
+// execSUnionStore adds multiple sets and store the result in a key
+// SUNIONSTORE destination key [key ...]
+func execSUnionStore(db *DB, args [][]byte) resp.Reply {
+	result, errReply := setAlgebra(db, args[1:], union)
+	if errReply != nil {
+		return errReply
+	}
+	return storeSet(db, string(args[0]), result, "sunionstore", args)
+}
+
+// execSDiff subtracts multiple sets
+// SDIFF key [key ...]
+func execSDiff(db *DB, args [][]byte) resp.Reply {
+	result, errReply := setAlgebra(db, args, diff)
+	if errReply != nil {
+		return errReply
+	}
+	return membersToReply(result.ToSlice())
+}
+
+// execSDiffStore subtracts multiple sets and store the result in a key
+// SDIFFSTORE destination key [key ...]
+func execSDiffStore(db *DB, args [][]byte) resp.Reply {
+	result, errReply := setAlgebra(db, args[1:], diff)
+	if errReply != nil {
+		return errReply
+	}
+	return storeSet(db, string(args[0]), result, "sdiffstore", args)
+}
+
+func init() {
+	RegisterCommand("SAdd", execSAdd, nil, -3, flagWrite, 1, 1, 1)
+	RegisterCommand("SIsMember", execSIsMember, nil, 3, flagReadOnly, 1, 1, 1)
+	RegisterCommand("SMIsMember", execSMIsMember, nil, -3, flagReadOnly, 1, 1, 1)
+	RegisterCommand("SRem", execSRem, nil, -3, flagWrite, 1, 1, 1)
+	RegisterCommand("SPop", execSPop, nil, -2, flagWrite, 1, 1, 1)
+	RegisterCommand("SCard", execSCard, nil, 2, flagReadOnly, 1, 1, 1)
+	RegisterCommand("SMembers", execSMembers, nil, 2, flagReadOnly, 1, 1, 1)
+	RegisterCommand("SRandMember", execSRandMember, nil, -2, flagReadOnly, 1, 1, 1)
+	RegisterCommand("SMove", execSMove, nil, 4, flagWrite, 1, 2, 1)
+	RegisterCommand("SInter", execSInter, nil, -2, flagReadOnly, 1, -1, 1)
+	RegisterCommand("SInterStore", execSInterStore, prepareSetStore, -3, flagWrite, 1, -1, 1)
+	RegisterCommand("SUnion", execSUnion, nil, -2, flagReadOnly, 1, -1, 1)
+	RegisterCommand("SUnionStore", execSUnionStore, prepareSetStore, -3, flagWrite, 1, -1, 1)
+	RegisterCommand("SDiff", execSDiff, nil, -2, flagReadOnly, 1, -1, 1)
+	RegisterCommand("SDiffStore", execSDiffStore, prepareSetStore, -3, flagWrite, 1, -1, 1)
+}
@@ -0,0 +1,816 @@
+package database
+
+import (
+	"go-redis/datastruct/set"
+	"go-redis/datastruct/sortedset"
+	"go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/resp/reply"
+	"math"
+	"strconv"
+	"strings"
+)
+
+func (db *DB) getAsSortedSet(key string) (*sortedset.SortedSet, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	sortedSet, ok := entity.Data.(*sortedset.SortedSet)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	return sortedSet, nil
+}
+
+func (db *DB) getOrInitSortedSet(key string) (sortedSet *sortedset.SortedSet, inited bool, errReply reply.ErrorReply) {
+	sortedSet, errReply = db.getAsSortedSet(key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	inited = false
+	if sortedSet == nil {
+		sortedSet = sortedset.Make()
+		db.PutEntity(key, &database.DataEntity{
+			Data: sortedSet,
+		})
+		inited = true
+	}
+	return sortedSet, inited, nil
+}
+
+// parseScore parses a score argument, inf, +inf and -inf are accepted
+func parseScore(raw []byte) (float64, reply.ErrorReply) {
+	score, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, reply.MakeErrReply("ERR value is not a valid float")
+	}
+	return score, nil
+}
+
+// formatScore formats a score the way redis does, infinity is written as inf or -inf
+func formatScore(score float64) []byte {
+	if math.IsInf(score, 1) {
+		return []byte("inf")
+	}
+	if math.IsInf(score, -1) {
+		return []byte("-inf")
+	}
+	return []byte(strconv.FormatFloat(score, 'f', -1, 64))
+}
+
+func elementsToReply(elements []*sortedset.Element, withScores bool) resp.Reply {
+	size := len(elements)
+	if withScores {
+		size *= 2
+	}
+	result := make([][]byte, 0, size)
+	for _, element := range elements {
+		result = append(result, []byte(element.Member))
+		if withScores {
+			result = append(result, formatScore(element.Score))
+		}
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// execZAdd adds members into sorted set
+// ZADD key [NX | XX] [GT | LT] [CH] [INCR] score member [score member ...]
+func execZAdd(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	var nx, xx, gt, lt, ch, incr bool
+	i := 1
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		if option == "NX" {
+			nx = true
+		} else if option == "XX" {
+			xx = true
+		} else if option == "GT" {
+			gt = true
+		} else if option == "LT" {
+			lt = true
+		} else if option == "CH" {
+			ch = true
+		} else if option == "INCR" {
+			incr = true
+		} else {
+			break
+		}
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return &reply.SyntaxErrReply{}
+	}
+	if nx && xx {
+		return reply.MakeErrReply("ERR XX and NX options at the same time are not compatible")
+	}
+	if (gt && lt) || (nx && (gt || lt)) {
+		return reply.MakeErrReply("ERR GT, LT, and/or NX options at the same time are not compatible")
+	}
+	if incr && len(pairs) != 2 {
+		return reply.MakeErrReply("ERR INCR option supports a single increment-element pair")
+	}
+
+	size := len(pairs) / 2
+	elements := make([]*sortedset.Element, size)
+	for j := 0; j < size; j++ {
+		score, errReply := parseScore(pairs[2*j])
+		if errReply != nil {
+			return errReply
+		}
+		elements[j] = &sortedset.Element{
+			Member: string(pairs[2*j+1]),
+			Score:  score,
+		}
+	}
+
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil && xx {
+		// XX never creates a new key
+		if incr {
+			return &reply.NullBulkReply{}
+		}
+		return reply.MakeIntReply(0)
+	}
+	if sortedSet == nil {
+		sortedSet, _, _ = db.getOrInitSortedSet(key)
+	}
+
+	added, changed := 0, 0
+	var incrResult []byte
+	for _, e := range elements {
+		old, exists := sortedSet.Get(e.Member)
+		if (exists && nx) || (!exists && xx) {
+			continue
+		}
+		score := e.Score
+		if incr && exists {
+			score += old.Score
+			if math.IsNaN(score) {
+				return reply.MakeErrReply("ERR resulting score is not a number (NaN)")
+			}
+		}
+		if exists {
+			if (gt && score <= old.Score) || (lt && score >= old.Score) {
+				continue
+			}
+			if score != old.Score {
+				sortedSet.Add(e.Member, score)
+				changed++
+			}
+		} else {
+			sortedSet.Add(e.Member, score)
+			added++
+		}
+		if incr {
+			incrResult = formatScore(score)
+		}
+	}
+
+	if sortedSet.Len() == 0 {
+		db.Remove(key)
+	}
+	if added+changed > 0 {
+		db.addAof(utils.ToCmdLine2("zadd", args...))
+	}
+	if incr {
+		if incrResult == nil {
+			return &reply.NullBulkReply{}
+		}
+		return reply.MakeBulkReply(incrResult)
+	}
+	if ch {
+		return reply.MakeIntReply(int64(added + changed))
+	}
+	return reply.MakeIntReply(int64(added))
+}
+
+// execZScore gets score of a member in sorted set
+// ZSCORE key member
+func execZScore(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	member := string(args[1])
+
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return &reply.NullBulkReply{}
+	}
+
+	element, exists := sortedSet.Get(member)
+	if !exists {
+		return &reply.NullBulkReply{}
+	}
+	return reply.MakeDoubleReply(element.Score)
+}
+
+// execZIncrBy increments the score of a member in sorted set
+// ZINCRBY key increment member
+func execZIncrBy(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	delta, errReply := parseScore(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	member := string(args[2])
+
+	sortedSet, _, errReply := db.getOrInitSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	score := delta
+	element, exists := sortedSet.Get(member)
+	if exists {
+		score += element.Score
+		if math.IsNaN(score) {
+			return reply.MakeErrReply("ERR resulting score is not a number (NaN)")
+		}
+	}
+	sortedSet.Add(member, score)
+	db.addAof(utils.ToCmdLine2("zincrby", args...))
+	return reply.MakeDoubleReply(score)
+}
+
+// execZCard gets number of members in sorted set
+// ZCARD key
+func execZCard(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(sortedSet.Len())
+}
+
+func zRank(db *DB, args [][]byte, desc bool) resp.Reply {
+	key := string(args[0])
+	member := string(args[1])
+	withScore := false
+	if len(args) == 3 {
+		if strings.ToUpper(string(args[2])) != "WITHSCORE" {
+			return &reply.SyntaxErrReply{}
+		}
+		withScore = true
+	} else if len(args) > 3 {
+		return &reply.SyntaxErrReply{}
+	}
+
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return &reply.NullBulkReply{}
+	}
+
+	rank := sortedSet.GetRank(member, desc)
+	if rank < 0 {
+		return &reply.NullBulkReply{}
+	}
+	if withScore {
+		element, _ := sortedSet.Get(member)
+		return reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeIntReply(rank),
+			reply.MakeBulkReply(formatScore(element.Score)),
+		})
+	}
+	return reply.MakeIntReply(rank)
+}
+
+// execZRank gets index of a member in sorted set, sorted by score ascending
+// ZRANK key member [WITHSCORE]
+func execZRank(db *DB, args [][]byte) resp.Reply {
+	return zRank(db, args, false)
+}
+
+// execZRevRank gets index of a member in sorted set, sorted by score descending
+// ZREVRANK key member [WITHSCORE]
+func execZRevRank(db *DB, args [][]byte) resp.Reply {
+	return zRank(db, args, true)
+}
+
+// zRangeSpec holds the options of ZRANGE and ZRANGESTORE
+type zRangeSpec struct {
+	byScore    bool
+	byLex      bool
+	rev        bool
+	withScores bool
+	hasLimit   bool
+	offset     int64
+	count      int64
+}
+
+func parseZRangeSpec(options [][]byte, allowWithScores bool) (*zRangeSpec, reply.ErrorReply) {
+	spec := &zRangeSpec{
+		count: -1,
+	}
+	for i := 0; i < len(options); i++ {
+		option := strings.ToUpper(string(options[i]))
+		switch {
+		case option == "BYSCORE":
+			spec.byScore = true
+		case option == "BYLEX":
+			spec.byLex = true
+		case option == "REV":
+			spec.rev = true
+		case option == "WITHSCORES" && allowWithScores:
+			spec.withScores = true
+		case option == "LIMIT" && i+2 < len(options):
+			offset, err := strconv.ParseInt(string(options[i+1]), 10, 64)
+			if err != nil {
+				return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			count, err := strconv.ParseInt(string(options[i+2]), 10, 64)
+			if err != nil {
+				return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			spec.hasLimit = true
+			spec.offset = offset
+			spec.count = count
+			i += 2
+		default:
+			return nil, &reply.SyntaxErrReply{}
+		}
+	}
+	if spec.byScore && spec.byLex {
+		return nil, &reply.SyntaxErrReply{}
+	}
+	if spec.hasLimit && !spec.byScore && !spec.byLex {
+		return nil, reply.MakeErrReply("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if spec.withScores && spec.byLex {
+		return nil, reply.MakeErrReply("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+	return spec, nil
+}
+
+// zRangeByRank returns elements ranking within redis style [start, stop]
+func zRangeByRank(sortedSet *sortedset.SortedSet, rawStart []byte, rawStop []byte, desc bool) ([]*sortedset.Element, reply.ErrorReply) {
+	start, err := strconv.ParseInt(string(rawStart), 10, 64)
+	if err != nil {
+		return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	stop, err := strconv.ParseInt(string(rawStop), 10, 64)
+	if err != nil {
+		return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if sortedSet == nil {
+		return nil, nil
+	}
+	from, to, ok := normalizeRange(start, stop, int(sortedSet.Len()))
+	if !ok {
+		return nil, nil
+	}
+	return sortedSet.RangeByRank(int64(from), int64(to), desc), nil
+}
+
+// parseBorders parses min and max of a score or lex range
+func parseBorders(rawMin []byte, rawMax []byte, byLex bool) (sortedset.Border, sortedset.Border, reply.ErrorReply) {
+	parse := sortedset.ParseScoreBorder
+	if byLex {
+		parse = sortedset.ParseLexBorder
+	}
+	min, err := parse(string(rawMin))
+	if err != nil {
+		return nil, nil, reply.MakeErrReply(err.Error())
+	}
+	max, err := parse(string(rawMax))
+	if err != nil {
+		return nil, nil, reply.MakeErrReply(err.Error())
+	}
+	return min, max, nil
+}
+
+// zRange returns elements selected by ZRANGE style arguments
+func zRange(sortedSet *sortedset.SortedSet, rawMin []byte, rawMax []byte, spec *zRangeSpec) ([]*sortedset.Element, reply.ErrorReply) {
+	if !spec.byScore && !spec.byLex {
+		return zRangeByRank(sortedSet, rawMin, rawMax, spec.rev)
+	}
+	if spec.rev {
+		// ZRANGE key max min BYSCORE REV
+		rawMin, rawMax = rawMax, rawMin
+	}
+	min, max, errReply := parseBorders(rawMin, rawMax, spec.byLex)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if sortedSet == nil {
+		return nil, nil
+	}
+	return sortedSet.Range(min, max, spec.offset, spec.count, spec.rev), nil
+}
+
+// execZRange gets members in range
+// ZRANGE key start stop [BYSCORE | BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func execZRange(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	spec, errReply := parseZRangeSpec(args[3:], true)
+	if errReply != nil {
+		return errReply
+	}
+
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	elements, errReply := zRange(sortedSet, args[1], args[2], spec)
+	if errReply != nil {
+		return errReply
+	}
+	if len(elements) == 0 {
+		return &reply.EmptyMultiBulkReply{}
+	}
+	return elementsToReply(elements, spec.withScores)
+}
+
+// execZRangeStore stores members in range into destination
+// ZRANGESTORE dst src min max [BYSCORE | BYLEX] [REV] [LIMIT offset count]
+func execZRangeStore(db *DB, args [][]byte) resp.Reply {
+	dest := string(args[0])
+	src := string(args[1])
+	spec, errReply := parseZRangeSpec(args[4:], false)
+	if errReply != nil {
+		return errReply
+	}
+
+	sortedSet, errReply := db.getAsSortedSet(src)
+	if errReply != nil {
+		return errReply
+	}
+	elements, errReply := zRange(sortedSet, args[2], args[3], spec)
+	if errReply != nil {
+		return errReply
+	}
+	result := sortedset.Make()
+	for _, element := range elements {
+		result.Add(element.Member, element.Score)
+	}
+	return storeSortedSet(db, dest, result, "zrangestore", args)
+}
+
+// storeSortedSet saves the result sorted set into dest, an empty result removes dest
+func storeSortedSet(db *DB, dest string, sortedSet *sortedset.SortedSet, cmdName string, args [][]byte) resp.Reply {
+	db.Remove(dest) // clean ttl too
+	if sortedSet.Len() > 0 {
+		db.PutEntity(dest, &database.DataEntity{
+			Data: sortedSet,
+		})
+	}
+	db.addAof(utils.ToCmdLine2(cmdName, args...))
+	return reply.MakeIntReply(sortedSet.Len())
+}
+
+// execZRem removes given members
+// ZREM key member [member ...]
+func execZRem(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	var deleted int64 = 0
+	for _, field := range args[1:] {
+		if sortedSet.Remove(string(field)) {
+			deleted++
+		}
+	}
+	if sortedSet.Len() == 0 {
+		db.Remove(key)
+	}
+	if deleted > 0 {
+		db.addAof(utils.ToCmdLine2("zrem", args...))
+	}
+	return reply.MakeIntReply(deleted)
+}
+
+func zRemRange(db *DB, args [][]byte, byLex bool, cmdName string) resp.Reply {
+	key := string(args[0])
+	min, max, errReply := parseBorders(args[1], args[2], byLex)
+	if errReply != nil {
+		return errReply
+	}
+
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	removed := sortedSet.RemoveRange(min, max)
+	if sortedSet.Len() == 0 {
+		db.Remove(key)
+	}
+	if removed > 0 {
+		db.addAof(utils.ToCmdLine2(cmdName, args...))
+	}
+	return reply.MakeIntReply(removed)
+}
+
+// execZRemRangeByScore removes members which score within given range
+// ZREMRANGEBYSCORE key min max
+func execZRemRangeByScore(db *DB, args [][]byte) resp.Reply {
+	return zRemRange(db, args, false, "zremrangebyscore")
+}
+
+// execZRemRangeByLex removes members which member within given lexicographical range
+// ZREMRANGEBYLEX key min max
+func execZRemRangeByLex(db *DB, args [][]byte) resp.Reply {
+	return zRemRange(db, args, true, "zremrangebylex")
+}
+
+// execZRemRangeByRank removes members within given indexes
+// ZREMRANGEBYRANK key start stop
+func execZRemRangeByRank(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	from, to, ok := normalizeRange(start, stop, int(sortedSet.Len()))
+	if !ok {
+		return reply.MakeIntReply(0)
+	}
+	removed := sortedSet.RemoveByRank(int64(from), int64(to))
+	if sortedSet.Len() == 0 {
+		db.Remove(key)
+	}
+	if removed > 0 {
+		db.addAof(utils.ToCmdLine2("zremrangebyrank", args...))
+	}
+	return reply.MakeIntReply(removed)
+}
+
+func zCount(db *DB, args [][]byte, byLex bool) resp.Reply {
+	key := string(args[0])
+	min, max, errReply := parseBorders(args[1], args[2], byLex)
+	if errReply != nil {
+		return errReply
+	}
+
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(sortedSet.RangeCount(min, max))
+}
+
+// execZCount gets number of members which score within given range
+// ZCOUNT key min max
+func execZCount(db *DB, args [][]byte) resp.Reply {
+	return zCount(db, args, false)
+}
+
+// execZLexCount gets number of members which member within given lexicographical range
+// ZLEXCOUNT key min max
+func execZLexCount(db *DB, args [][]byte) resp.Reply {
+	return zCount(db, args, true)
+}
+
+func zPop(db *DB, args [][]byte, max bool, cmdName string) resp.Reply {
+	if len(args) > 2 {
+		return &reply.SyntaxErrReply{}
+	}
+	key := string(args[0])
+	count := 1
+	if len(args) == 2 {
+		count64, err := strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil || count64 < 0 {
+			return reply.MakeErrReply("ERR value is out of range, must be positive")
+		}
+		count = int(count64)
+	}
+
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil || count == 0 {
+		return &reply.EmptyMultiBulkReply{}
+	}
+
+	var removed []*sortedset.Element
+	if max {
+		removed = sortedSet.PopMax(count)
+	} else {
+		removed = sortedSet.PopMin(count)
+	}
+	if sortedSet.Len() == 0 {
+		db.Remove(key)
+	}
+	if len(removed) > 0 {
+		db.addAof(utils.ToCmdLine2(cmdName, args...))
+	}
+	return elementsToReply(removed, true)
+}
+
+// execZPopMin removes and returns members with the lowest scores
+// ZPOPMIN key [count]
+func execZPopMin(db *DB, args [][]byte) resp.Reply {
+	return zPop(db, args, false, "zpopmin")
+}
+
+// execZPopMax removes and returns members with the highest scores
+// ZPOPMAX key [count]
+func execZPopMax(db *DB, args [][]byte) resp.Reply {
+	return zPop(db, args, true, "zpopmax")
+}
+
+const (
+	aggregateSum = iota
+	aggregateMin
+	aggregateMax
+)
+
+// getAsWeightedSet reads a sorted set or a set (every member scores 1) for ZUNIONSTORE and ZINTERSTORE
+func (db *DB) getAsWeightedSet(key string) (*sortedset.SortedSet, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return sortedset.Make(), nil
+	}
+	switch val := entity.Data.(type) {
+	case *sortedset.SortedSet:
+		return val, nil
+	case *set.Set:
+		sortedSet := sortedset.Make()
+		val.ForEach(func(member string) bool {
+			sortedSet.Add(member, 1)
+			return true
+		})
+		return sortedSet, nil
+	}
+	return nil, &reply.WrongTypeErrReply{}
+}
+
+func aggregate(a float64, b float64, policy int) float64 {
+	switch policy {
+	case aggregateMin:
+		return math.Min(a, b)
+	case aggregateMax:
+		return math.Max(a, b)
+	}
+	sum := a + b
+	if math.IsNaN(sum) {
+		return 0 // inf + -inf, same as redis
+	}
+	return sum
+}
+
+func zStore(db *DB, args [][]byte, inter bool, cmdName string) resp.Reply {
+	dest := string(args[0])
+	numKeys, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if numKeys < 1 {
+		return reply.MakeErrReply("ERR at least 1 input key is needed for '" + cmdName + "' command")
+	}
+	if int64(len(args)) < 2+numKeys {
+		return &reply.SyntaxErrReply{}
+	}
+	keys := args[2 : 2+numKeys]
+	weights := make([]float64, numKeys)
+	for i := range weights {
+		weights[i] = 1
+	}
+	policy := aggregateSum
+	options := args[2+numKeys:]
+	for i := 0; i < len(options); i++ {
+		option := strings.ToUpper(string(options[i]))
+		if option == "WEIGHTS" && i+int(numKeys) < len(options) {
+			for j := range weights {
+				weight, errReply := parseScore(options[i+1+j])
+				if errReply != nil {
+					return reply.MakeErrReply("ERR weight value is not a float")
+				}
+				weights[j] = weight
+			}
+			i += int(numKeys)
+		} else if option == "AGGREGATE" && i+1 < len(options) {
+			switch strings.ToUpper(string(options[i+1])) {
+			case "SUM":
+				policy = aggregateSum
+			case "MIN":
+				policy = aggregateMin
+			case "MAX":
+				policy = aggregateMax
+			default:
+				return &reply.SyntaxErrReply{}
+			}
+			i++
+		} else {
+			return &reply.SyntaxErrReply{}
+		}
+	}
+
+	sets := make([]*sortedset.SortedSet, numKeys)
+	for i, key := range keys {
+		sortedSet, errReply := db.getAsWeightedSet(string(key))
+		if errReply != nil {
+			return errReply
+		}
+		sets[i] = sortedSet
+	}
+
+	result := sortedset.Make()
+	for i, sortedSet := range sets {
+		weight := weights[i]
+		var fresh *sortedset.SortedSet
+		if inter {
+			fresh = sortedset.Make()
+		}
+		if sortedSet.Len() > 0 {
+			sortedSet.ForEachByRank(0, sortedSet.Len(), false, func(element *sortedset.Element) bool {
+				score := element.Score * weight
+				if math.IsNaN(score) {
+					score = 0 // 0 * inf
+				}
+				old, exists := result.Get(element.Member)
+				if inter {
+					if i == 0 {
+						fresh.Add(element.Member, score)
+					} else if exists {
+						fresh.Add(element.Member, aggregate(old.Score, score, policy))
+					}
+					return true
+				}
+				if exists {
+					score = aggregate(old.Score, score, policy)
+				}
+				result.Add(element.Member, score)
+				return true
+			})
+		}
+		if inter {
+			result = fresh
+		}
+	}
+	return storeSortedSet(db, dest, result, cmdName, args)
+}
+
+// execZUnionStore adds multiple sorted sets and store the result in a key
+// ZUNIONSTORE destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM | MIN | MAX]
+func execZUnionStore(db *DB, args [][]byte) resp.Reply {
+	return zStore(db, args, false, "zunionstore")
+}
+
+// execZInterStore intersects multiple sorted sets and store the result in a key
+// ZINTERSTORE destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM | MIN | MAX]
+func execZInterStore(db *DB, args [][]byte) resp.Reply {
+	return zStore(db, args, true, "zinterstore")
+}
+
+func init() {
+	RegisterCommand("ZAdd", execZAdd, nil, -4, flagWrite, 1, 1, 1)
+	RegisterCommand("ZScore", execZScore, nil, 3, flagReadOnly, 1, 1, 1)
+	RegisterCommand("ZIncrBy", execZIncrBy, nil, 4, flagWrite, 1, 1, 1)
+	RegisterCommand("ZCard", execZCard, nil, 2, flagReadOnly, 1, 1, 1)
+	RegisterCommand("ZRank", execZRank, nil, -3, flagReadOnly, 1, 1, 1)
+	RegisterCommand("ZRevRank", execZRevRank, nil, -3, flagReadOnly, 1, 1, 1)
+	RegisterCommand("ZRange", execZRange, nil, -4, flagReadOnly, 1, 1, 1)
+	RegisterCommand("ZRangeStore", execZRangeStore, prepareZRangeStore, -5, flagWrite, 1, 2, 1)
+	RegisterCommand("ZRem", execZRem, nil, -3, flagWrite, 1, 1, 1)
+	RegisterCommand("ZRemRangeByScore", execZRemRangeByScore, nil, 4, flagWrite, 1, 1, 1)
+	RegisterCommand("ZRemRangeByRank", execZRemRangeByRank, nil, 4, flagWrite, 1, 1, 1)
+	RegisterCommand("ZRemRangeByLex", execZRemRangeByLex, nil, 4, flagWrite, 1, 1, 1)
+	RegisterCommand("ZCount", execZCount, nil, 4, flagReadOnly, 1, 1, 1)
+	RegisterCommand("ZLexCount", execZLexCount, nil, 4, flagReadOnly, 1, 1, 1)
+	RegisterCommand("ZPopMin", execZPopMin, nil, -2, flagWrite, 1, 1, 1)
+	RegisterCommand("ZPopMax", execZPopMax, nil, -2, flagWrite, 1, 1, 1)
+	RegisterCommand("ZUnionStore", execZUnionStore, prepareZStore, -4, flagWrite, 1, 1, 1)
+	RegisterCommand("ZInterStore", execZInterStore, prepareZStore, -4, flagWrite, 1, 1, 1)
+}
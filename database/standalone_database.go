@@ -4,12 +4,15 @@ import (
 	"fmt"
 	"go-redis/aof"
 	"go-redis/config"
+	databaseface "go-redis/interface/database"
 	"go-redis/interface/resp"
 	"go-redis/lib/logger"
 	"go-redis/resp/reply"
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // StandaloneDatabase is a set of multiple database set
@@ -17,22 +20,22 @@ type StandaloneDatabase struct {
 	dbSet []*DB
 	// handle aof persistence
 	aofHandler *aof.AofHandler
+	// handle rdb persistence
+	rdb *rdbPersister
+	// Close may be called concurrently during shutdown, the later callers wait until the first one finished
+	closeOnce sync.Once
 }
 
 // NewStandaloneDatabase creates a redis database,
 func NewStandaloneDatabase() *StandaloneDatabase {
-	mdb := &StandaloneDatabase{}
-	if config.Properties.Databases == 0 {
-		config.Properties.Databases = 16
-	}
-	mdb.dbSet = make([]*DB, config.Properties.Databases)
-	for i := range mdb.dbSet {
-		singleDB := makeDB()
-		singleDB.index = i
-		mdb.dbSet[i] = singleDB
+	mdb := newBasicDatabase()
+	if err := initACL(); err != nil {
+		panic(err)
 	}
 	if config.Properties.AppendOnly {
-		aofHandler, err := aof.NewAOFHandler(mdb)
+		aofHandler, err := aof.NewAOFHandler(mdb, func() databaseface.DBEngine {
+			return MakeAuxiliaryDatabase()
+		})
 		if err != nil {
 			panic(err)
 		}
@@ -43,7 +46,58 @@ func NewStandaloneDatabase() *StandaloneDatabase {
 			singleDB.addAof = func(line CmdLine) {
 				mdb.aofHandler.AddAof(singleDB.index, line)
 			}
+			singleDB.addAofTx = func(lines []CmdLine) {
+				mdb.aofHandler.AddAofTx(singleDB.index, lines)
+			}
 		}
+	} else {
+		// rdb is loaded only if aof is disabled, aof is more complete
+		mdb.loadRDB()
+	}
+	mdb.rdb = makeRDBPersister()
+	for _, db := range mdb.dbSet {
+		db.onWrite = mdb.rdb.addDirty
+	}
+	mdb.startSaveCron()
+	return mdb
+}
+
+// MakeAuxiliaryDatabase creates a database only holding data, without persistence and active expiring,
+// eg. the temporary database for aof rewrite
+func MakeAuxiliaryDatabase() *StandaloneDatabase {
+	mdb := newBasicDatabase()
+	for _, db := range mdb.dbSet {
+		db.auxiliary = true
+	}
+	return mdb
+}
+
+// newBasicDatabase creates a database without persistence
+func newBasicDatabase() *StandaloneDatabase {
+	mdb := &StandaloneDatabase{}
+	if config.Properties.Databases == 0 {
+		config.Properties.Databases = 16
+	}
+	if config.Properties.HashMaxListpackEntries == 0 {
+		config.Properties.HashMaxListpackEntries = 128
+	}
+	if config.Properties.HashMaxListpackValue == 0 {
+		config.Properties.HashMaxListpackValue = 64
+	}
+	if config.Properties.SetMaxIntsetEntries == 0 {
+		config.Properties.SetMaxIntsetEntries = 512
+	}
+	if config.Properties.RDBFilename == "" {
+		config.Properties.RDBFilename = "dump.rdb"
+	}
+	if config.Properties.AppendFsync == "" {
+		config.Properties.AppendFsync = aof.FsyncEverySec
+	}
+	mdb.dbSet = make([]*DB, config.Properties.Databases)
+	for i := range mdb.dbSet {
+		singleDB := makeDB()
+		singleDB.index = i
+		mdb.dbSet[i] = singleDB
 	}
 	return mdb
 }
@@ -60,35 +114,121 @@ func (mdb *StandaloneDatabase) Exec(c resp.Connection, cmdLine [][]byte) (result
 	}()
 
 	cmdName := strings.ToLower(string(cmdLine[0]))
-	if cmdName == "select" {
-		if len(cmdLine) != 2 {
-			return reply.MakeArgNumErrReply("select")
-		}
-		return execSelect(c, mdb, cmdLine[1:])
+	if cmdName == "auth" {
+		return Auth(c, cmdLine[1:])
+	}
+	if !IsAuthenticated(c) {
+		return reply.MakeErrReply("NOAUTH Authentication required.")
+	}
+	if errReply := CheckPermission(c, cmdLine); errReply != nil {
+		return errReply
 	}
-	// normal commands
 	dbIndex := c.GetDBIndex()
 	if dbIndex >= len(mdb.dbSet) {
 		return reply.MakeErrReply("ERR DB index is out of range")
 	}
 	selectedDB := mdb.dbSet[dbIndex]
+	// transaction commands
+	switch cmdName {
+	case "multi":
+		return execMulti(c, cmdLine[1:])
+	case "exec":
+		return execExec(mdb, c, cmdLine[1:])
+	case "discard":
+		return execDiscard(c, cmdLine[1:])
+	case "watch":
+		return execWatch(selectedDB, c, cmdLine[1:])
+	case "unwatch":
+		return execUnWatch(c, cmdLine[1:])
+	}
+	if c.InMultiState() {
+		return enqueueCmd(c, cmdLine)
+	}
+	if result, ok := mdb.tryExecServerCmd(c, cmdName, cmdLine); ok {
+		return result
+	}
+	// normal commands
 	return selectedDB.Exec(c, cmdLine)
 }
 
+// tryExecServerCmd executes the commands handled by server rather than a single db, ok is false for other commands
+func (mdb *StandaloneDatabase) tryExecServerCmd(c resp.Connection, cmdName string, cmdLine [][]byte) (result resp.Reply, ok bool) {
+	args := cmdLine[1:]
+	switch cmdName {
+	case "select":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("select"), true
+		}
+		return execSelect(c, mdb, args), true
+	case "command":
+		return execCommand(args), true
+	case "info":
+		return execInfo(mdb, args), true
+	case "acl":
+		return execACL(c, args), true
+	case "bgrewriteaof":
+		return execBGRewriteAOF(mdb, args), true
+	case "save":
+		return execSave(mdb, args), true
+	case "bgsave":
+		return execBGSave(mdb, args), true
+	case "lastsave":
+		return execLastSave(mdb, args), true
+	}
+	return nil, false
+}
+
 // Close graceful shutdown database
 func (mdb *StandaloneDatabase) Close() {
+	mdb.closeOnce.Do(mdb.close)
+}
+
+func (mdb *StandaloneDatabase) close() {
+	if mdb.rdb != nil && len(mdb.rdb.rules) > 0 {
+		close(mdb.rdb.stopCron)
+		// wait for the running background save, then save the latest data
+		mdb.rdb.saving.Lock()
+		if err := mdb.saveRDB(); err != nil {
+			logger.Error("save rdb failed: " + err.Error())
+		}
+		mdb.rdb.saving.Unlock()
+	}
+	if mdb.aofHandler != nil {
+		mdb.aofHandler.Close()
+	}
+}
 
+// ForEach traverses all the keys in the given db
+func (mdb *StandaloneDatabase) ForEach(dbIndex int, cb func(key string, data *databaseface.DataEntity, expiration *time.Time) bool) {
+	if dbIndex < 0 || dbIndex >= len(mdb.dbSet) {
+		return
+	}
+	mdb.dbSet[dbIndex].ForEach(cb)
 }
 
 func (mdb *StandaloneDatabase) AfterClientClose(c resp.Connection) {
 }
 
+// execBGRewriteAOF rewrites the aof file in background
+func execBGRewriteAOF(mdb *StandaloneDatabase, args [][]byte) resp.Reply {
+	if len(args) != 0 {
+		return reply.MakeArgNumErrReply("bgrewriteaof")
+	}
+	if mdb.aofHandler == nil {
+		return reply.MakeErrReply("ERR append only file is not enabled")
+	}
+	if err := mdb.aofHandler.BGRewrite(); err != nil {
+		return reply.MakeErrReply(err.Error())
+	}
+	return reply.MakeStatusReply("Background append only file rewriting started")
+}
+
 func execSelect(c resp.Connection, mdb *StandaloneDatabase, args [][]byte) resp.Reply {
 	dbIndex, err := strconv.Atoi(string(args[0]))
 	if err != nil {
 		return reply.MakeErrReply("ERR invalid DB index")
 	}
-	if dbIndex >= len(mdb.dbSet) {
+	if dbIndex < 0 || dbIndex >= len(mdb.dbSet) {
 		return reply.MakeErrReply("ERR DB index is out of range")
 	}
 	c.SelectDB(dbIndex)
@@ -1,12 +1,14 @@
 package database
 
 import (
+	"go-redis/aof"
 	"go-redis/interface/database"
 	"go-redis/interface/resp"
 	"go-redis/lib/utils"
 	"go-redis/resp/reply"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func (db *DB) getAsString(key string) ([]byte, reply.ErrorReply) {
@@ -37,34 +39,97 @@ func execGet(db *DB, args [][]byte) resp.Reply {
 const (
 	upsertPolicy = iota // default
 	insertPolicy        // set nx
-	updatePolicy        // set ex
+	updatePolicy        // set xx
 )
 
+// parseExpireTime converts the argument of EX/PX/EXAT/PXAT into an absolute expire time
+// 将 EX/PX/EXAT/PXAT 选项的参数转换为绝对过期时间
+func parseExpireTime(option string, raw []byte, cmdName string) (time.Time, reply.ErrorReply) {
+	val, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return time.Time{}, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if val <= 0 {
+		return time.Time{}, reply.MakeErrReply("ERR invalid expire time in '" + cmdName + "' command")
+	}
+	var expireTime time.Time
+	var ok bool
+	switch option {
+	case "EX":
+		expireTime, ok = toExpireTime(val, time.Second, true)
+	case "PX":
+		expireTime, ok = toExpireTime(val, time.Millisecond, true)
+	case "EXAT":
+		expireTime, ok = toExpireTime(val, time.Second, false)
+	case "PXAT":
+		expireTime, ok = toExpireTime(val, time.Millisecond, false)
+	default:
+		return time.Time{}, &reply.SyntaxErrReply{}
+	}
+	if !ok {
+		return time.Time{}, reply.MakeErrReply("ERR invalid expire time in '" + cmdName + "' command")
+	}
+	return expireTime, nil
+}
+
 // execSet sets string value and time to live to the given key
+// SET key value [NX | XX] [GET] [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL]
 func execSet(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
 	value := args[1]
 	policy := upsertPolicy
+	var expireTime time.Time
+	hasTTL := false
+	keepTTL := false
+	returnOld := false
 	// parse options
 	if len(args) > 2 {
 		for i := 2; i < len(args); i++ {
 			arg := strings.ToUpper(string(args[i]))
-			if arg == "NX" { // insert
+			switch arg {
+			case "NX": // insert
 				if policy == updatePolicy {
 					return &reply.SyntaxErrReply{}
 				}
 				policy = insertPolicy
-			} else if arg == "XX" { // update policy
+			case "XX": // update policy
 				if policy == insertPolicy {
 					return &reply.SyntaxErrReply{}
 				}
 				policy = updatePolicy
-			} else {
+			case "GET":
+				returnOld = true
+			case "KEEPTTL":
+				if hasTTL {
+					return &reply.SyntaxErrReply{}
+				}
+				keepTTL = true
+			case "EX", "PX", "EXAT", "PXAT":
+				if hasTTL || keepTTL || i+1 >= len(args) {
+					return &reply.SyntaxErrReply{}
+				}
+				var errReply reply.ErrorReply
+				expireTime, errReply = parseExpireTime(arg, args[i+1], "set")
+				if errReply != nil {
+					return errReply
+				}
+				hasTTL = true
+				i++ // skip the expire time
+			default:
 				return &reply.SyntaxErrReply{}
 			}
 		}
 	}
 
+	var old []byte
+	if returnOld {
+		var errReply reply.ErrorReply
+		old, errReply = db.getAsString(key)
+		if errReply != nil {
+			return errReply
+		}
+	}
+
 	entity := &database.DataEntity{
 		Data: value,
 	}
@@ -74,18 +139,132 @@ func execSet(db *DB, args [][]byte) resp.Reply {
 	case upsertPolicy:
 		db.PutEntity(key, entity)
 		result = 1
-	case insertPolicy:
-		result = db.PutIfAbsent(key, entity)
-	case updatePolicy:
-		result = db.PutIfExists(key, entity)
+	case insertPolicy, updatePolicy:
+		// GetEntity removes the key if it has expired, so an expired key counts as absent
+		_, exists := db.GetEntity(key)
+		if exists == (policy == updatePolicy) {
+			db.PutEntity(key, entity)
+			result = 1
+		}
+	}
+	if result > 0 {
+		// the options have been applied, so a plain set (plus an absolute expire time) replays the same result
+		if hasTTL {
+			db.Expire(key, expireTime)
+			db.addAof(utils.ToCmdLine2("set", args[0], args[1]))
+			db.addAof(aof.MakeExpireCmd(key, expireTime))
+		} else if keepTTL {
+			db.addAof(utils.ToCmdLine2("set", args[0], args[1], []byte("KEEPTTL")))
+		} else {
+			// set overwrites the value, so the old ttl is discarded
+			db.Persist(key)
+			db.addAof(utils.ToCmdLine2("set", args[0], args[1]))
+		}
+	}
+	if returnOld {
+		if old == nil {
+			return &reply.NullBulkReply{}
+		}
+		return reply.MakeBulkReply(old)
 	}
-	db.addAof(utils.ToCmdLine2("set", args...))
 	if result > 0 {
 		return &reply.OkReply{}
 	}
 	return &reply.NullBulkReply{}
 }
 
+// execSetEX sets string and its ttl in seconds
+// SETEX key seconds value
+func execSetEX(db *DB, args [][]byte) resp.Reply {
+	return setWithTTL(db, "EX", args, "setex")
+}
+
+// execPSetEX sets string and its ttl in milliseconds
+// PSETEX key milliseconds value
+func execPSetEX(db *DB, args [][]byte) resp.Reply {
+	return setWithTTL(db, "PX", args, "psetex")
+}
+
+func setWithTTL(db *DB, option string, args [][]byte, cmdName string) resp.Reply {
+	key := string(args[0])
+	value := args[2]
+	expireTime, errReply := parseExpireTime(option, args[1], cmdName)
+	if errReply != nil {
+		return errReply
+	}
+	db.PutEntity(key, &database.DataEntity{Data: value})
+	db.Expire(key, expireTime)
+	db.addAof(utils.ToCmdLine2("set", args[0], value))
+	db.addAof(aof.MakeExpireCmd(key, expireTime))
+	return &reply.OkReply{}
+}
+
+// execGetEX returns string value and sets or removes its ttl
+// GETEX key [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST]
+func execGetEX(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	var expireTime time.Time
+	hasTTL := false
+	persist := false
+	for i := 1; i < len(args); i++ {
+		arg := strings.ToUpper(string(args[i]))
+		switch arg {
+		case "PERSIST":
+			if hasTTL {
+				return &reply.SyntaxErrReply{}
+			}
+			persist = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if hasTTL || persist || i+1 >= len(args) {
+				return &reply.SyntaxErrReply{}
+			}
+			var errReply reply.ErrorReply
+			expireTime, errReply = parseExpireTime(arg, args[i+1], "getex")
+			if errReply != nil {
+				return errReply
+			}
+			hasTTL = true
+			i++ // skip the expire time
+		default:
+			return &reply.SyntaxErrReply{}
+		}
+	}
+
+	bytes, err := db.getAsString(key)
+	if err != nil {
+		return err
+	}
+	if bytes == nil {
+		return &reply.NullBulkReply{}
+	}
+	if hasTTL {
+		db.Expire(key, expireTime)
+		db.addAof(aof.MakeExpireCmd(key, expireTime))
+	} else if persist {
+		if _, ok := db.GetExpireTime(key); ok {
+			db.Persist(key)
+			db.addAof(utils.ToCmdLine("persist", key))
+		}
+	}
+	return reply.MakeBulkReply(bytes)
+}
+
+// execGetDel returns string value and removes the key
+// GETDEL key
+func execGetDel(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	bytes, err := db.getAsString(key)
+	if err != nil {
+		return err
+	}
+	if bytes == nil {
+		return &reply.NullBulkReply{}
+	}
+	db.Remove(key)
+	db.addAof(utils.ToCmdLine2("del", args[0]))
+	return reply.MakeBulkReply(bytes)
+}
+
 // execSetNX sets string if not exists
 func execSetNX(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
@@ -93,9 +272,13 @@ func execSetNX(db *DB, args [][]byte) resp.Reply {
 	entity := &database.DataEntity{
 		Data: value,
 	}
-	result := db.PutIfAbsent(key, entity)
+	// GetEntity removes the key if it has expired, so an expired key counts as absent
+	if _, exists := db.GetEntity(key); exists {
+		return reply.MakeIntReply(0)
+	}
+	db.PutEntity(key, entity)
 	db.addAof(utils.ToCmdLine2("setnx", args...))
-	return reply.MakeIntReply(int64(result))
+	return reply.MakeIntReply(1)
 }
 
 // execMSet sets multi key-value in database
@@ -115,6 +298,7 @@ func execMSet(db *DB, args [][]byte) resp.Reply {
 	for i, key := range keys {
 		value := values[i]
 		db.PutEntity(key, &database.DataEntity{Data: value})
+		db.Persist(key)
 	}
 	db.addAof(utils.ToCmdLine2("mset", args...))
 	return &reply.OkReply{}
@@ -184,10 +368,11 @@ func execGetSet(db *DB, args [][]byte) resp.Reply {
 		return err
 	}
 	db.PutEntity(key, &database.DataEntity{Data: value})
+	db.Persist(key)
+	db.addAof(utils.ToCmdLine2("getset", args...))
 	if old == nil {
 		return new(reply.NullBulkReply)
 	}
-	db.addAof(utils.ToCmdLine2("getset", args...))
 	return reply.MakeBulkReply(old)
 }
 
@@ -416,19 +601,23 @@ func execGetRange(db *DB, args [][]byte) resp.Reply {
 }
 
 func init() {
-	RegisterCommand("Set", execSet, -3)
-	RegisterCommand("SetNx", execSetNX, 3)
-	RegisterCommand("MSet", execMSet, -3)
-	RegisterCommand("MGet", execMGet, -2)
-	RegisterCommand("MSetNX", execMSetNX, -3)
-	RegisterCommand("Get", execGet, 2)
-	RegisterCommand("GetSet", execGetSet, 3)
-	RegisterCommand("Incr", execIncr, 2)
-	RegisterCommand("IncrBy", execIncrBy, 3)
-	RegisterCommand("Decr", execDecr, 2)
-	RegisterCommand("DecrBy", execDecrBy, 3)
-	RegisterCommand("StrLen", execStrLen, 2)
-	RegisterCommand("Append", execAppend, 3)
-	RegisterCommand("SetRange", execSetRange, 4)
-	RegisterCommand("GetRange", execGetRange, 4)
+	RegisterCommand("Set", execSet, nil, -3, flagWrite, 1, 1, 1)
+	RegisterCommand("SetNx", execSetNX, nil, 3, flagWrite, 1, 1, 1)
+	RegisterCommand("SetEX", execSetEX, nil, 4, flagWrite, 1, 1, 1)
+	RegisterCommand("PSetEX", execPSetEX, nil, 4, flagWrite, 1, 1, 1)
+	RegisterCommand("MSet", execMSet, nil, -3, flagWrite, 1, -1, 2)
+	RegisterCommand("MGet", execMGet, nil, -2, flagReadOnly, 1, -1, 1)
+	RegisterCommand("MSetNX", execMSetNX, nil, -3, flagWrite, 1, -1, 2)
+	RegisterCommand("Get", execGet, nil, 2, flagReadOnly, 1, 1, 1)
+	RegisterCommand("GetSet", execGetSet, nil, 3, flagWrite, 1, 1, 1)
+	RegisterCommand("GetEX", execGetEX, nil, -2, flagWrite, 1, 1, 1)
+	RegisterCommand("GetDel", execGetDel, nil, 2, flagWrite, 1, 1, 1)
+	RegisterCommand("Incr", execIncr, nil, 2, flagWrite, 1, 1, 1)
+	RegisterCommand("IncrBy", execIncrBy, nil, 3, flagWrite, 1, 1, 1)
+	RegisterCommand("Decr", execDecr, nil, 2, flagWrite, 1, 1, 1)
+	RegisterCommand("DecrBy", execDecrBy, nil, 3, flagWrite, 1, 1, 1)
+	RegisterCommand("StrLen", execStrLen, nil, 2, flagReadOnly, 1, 1, 1)
+	RegisterCommand("Append", execAppend, nil, 3, flagWrite, 1, 1, 1)
+	RegisterCommand("SetRange", execSetRange, nil, 4, flagWrite, 1, 1, 1)
+	RegisterCommand("GetRange", execGetRange, nil, 4, flagReadOnly, 1, 1, 1)
 }
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"go-redis/interface/resp"
+	"go-redis/resp/reply"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// assertPTTL checks the ttl of key in milliseconds is in (want-1000, want]
+func assertPTTL(t *testing.T, mdb *StandaloneDatabase, c resp.Connection, key string, want int64) {
+	t.Helper()
+	got := execLine(mdb, c, "PTTL "+key).(*reply.IntReply).Code
+	if got > want || got <= want-1000 {
+		t.Fatalf("expect pttl of %s about %d, got %d", key, want, got)
+	}
+}
+
+func TestSetExpireOptions(t *testing.T) {
+	mdb, c := makeTestDatabase()
+	assertLines(t, mdb, c, [][2]string{{"SET k v EX 100", "+OK\r\n"}})
+	assertPTTL(t, mdb, c, "k", 100*1000)
+	assertLines(t, mdb, c, [][2]string{{"SET k v px 100500", "+OK\r\n"}})
+	assertPTTL(t, mdb, c, "k", 100500)
+
+	at := time.Now().Unix() + 100
+	assertLines(t, mdb, c, [][2]string{{"SET k v EXAT " + strconv.FormatInt(at, 10), "+OK\r\n"}})
+	assertPTTL(t, mdb, c, "k", at*1000-time.Now().UnixMilli())
+	atMs := time.Now().UnixMilli() + 200500
+	assertLines(t, mdb, c, [][2]string{{"SET k v PXAT " + strconv.FormatInt(atMs, 10), "+OK\r\n"}})
+	assertPTTL(t, mdb, c, "k", atMs-time.Now().UnixMilli())
+
+	// KEEPTTL keeps the ttl, while a plain SET discards it
+	assertLines(t, mdb, c, [][2]string{{"SET k v2 KEEPTTL", "+OK\r\n"}})
+	assertPTTL(t, mdb, c, "k", atMs-time.Now().UnixMilli())
+	assertLines(t, mdb, c, [][2]string{
+		{"GET k", "$2\r\nv2\r\n"},
+		{"SET k v3", "+OK\r\n"},
+		{"TTL k", ":-1\r\n"},
+		{"SET missing v KEEPTTL", "+OK\r\n"},
+		{"TTL missing", ":-1\r\n"},
+	})
+
+	// the expire time in the past removes the key
+	assertLines(t, mdb, c, [][2]string{
+		{"SET k v EXAT 1", "+OK\r\n"},
+		{"GET k", "$-1\r\n"},
+		{"SET k v PXAT 1", "+OK\r\n"},
+		{"EXISTS k", ":0\r\n"},
+	})
+}
+
+func TestSetGet(t *testing.T) {
+	mdb, c := makeTestDatabase()
+	assertLines(t, mdb, c, [][2]string{
+		{"SET k v1 GET", "$-1\r\n"},
+		{"SET k v2 GET", "$2\r\nv1\r\n"},
+		{"GET k", "$2\r\nv2\r\n"},
+		// the old value is returned whether the condition is met or not
+		{"SET k v3 NX GET", "$2\r\nv2\r\n"},
+		{"GET k", "$2\r\nv2\r\n"},
+		{"SET k v3 XX GET EX 100", "$2\r\nv2\r\n"},
+		{"GET k", "$2\r\nv3\r\n"},
+		{"TTL k", ":100\r\n"},
+		{"SET missing v XX GET", "$-1\r\n"},
+		{"EXISTS missing", ":0\r\n"},
+		// the value of other types is kept
+		{"RPUSH list a", ":1\r\n"},
+		{"SET list v GET", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{"TYPE list", "+list\r\n"},
+		{"SET k v NX", "$-1\r\n"},
+		{"SET new v NX", "+OK\r\n"},
+		{"SET k v4 XX", "+OK\r\n"},
+		{"GET k", "$2\r\nv4\r\n"},
+	})
+}
+
+// TestSetErrors covers the invalid options and the expire times out of range, the key is not modified by them
+func TestSetErrors(t *testing.T) {
+	const (
+		syntaxErr   = "-Err syntax error\r\n"
+		notInteger  = "-ERR value is not an integer or out of range\r\n"
+		invalidTime = "-ERR invalid expire time in 'set' command\r\n"
+	)
+	mdb, c := makeTestDatabase()
+	execLine(mdb, c, "SET k v")
+	tests := [][2]string{
+		{"SET k x EX 10 PX 10", syntaxErr},
+		{"SET k x EX 10 EX 10", syntaxErr},
+		{"SET k x KEEPTTL EX 10", syntaxErr},
+		{"SET k x PXAT 10 KEEPTTL", syntaxErr},
+		{"SET k x NX XX", syntaxErr},
+		{"SET k x EX", syntaxErr},
+		{"SET k x FOO", syntaxErr},
+		{"SET k x EX ten", notInteger},
+		{"SET k x PX 1.5", notInteger},
+		{"SET k x EX 99999999999999999999", notInteger},
+		{"SET k x EX 0", invalidTime},
+		{"SET k x PX -1", invalidTime},
+		{"SET k x EXAT 0", invalidTime},
+		// overflow of unix nanoseconds
+		{"SET k x EX 9223372036854775807", invalidTime},
+		{"SET k x EX 9223372036", invalidTime},
+		{"SET k x PX 9223372036854775", invalidTime},
+		{"SET k x EXAT 9223372037", invalidTime},
+		{"SET k x PXAT 9223372036855", invalidTime},
+		{"SET k x GET EX 0", invalidTime},
+	}
+	for _, tt := range tests {
+		if got := string(execLine(mdb, c, tt[0]).ToBytes()); got != tt[1] {
+			t.Errorf("%s: expect %q, got %q", tt[0], tt[1], got)
+		}
+	}
+	assertLines(t, mdb, c, [][2]string{
+		{"GET k", "$1\r\nv\r\n"},
+		{"TTL k", ":-1\r\n"},
+	})
+}
@@ -0,0 +1,283 @@
+package database
+
+import (
+	"errors"
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/resp/reply"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 事务相关命令：MULTI/EXEC/DISCARD/WATCH/UNWATCH
+// 与 redis 一致，事务中的命令不会回滚，EXEC 只保证命令连续执行、不被其他命令打断
+
+// isTxCommand tells whether the command is handled by transaction logic instead of cmdTable
+func isTxCommand(cmdName string) bool {
+	switch cmdName {
+	case "multi", "exec", "discard", "watch", "unwatch":
+		return true
+	}
+	return false
+}
+
+// execMulti starts a transaction
+func execMulti(c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) != 0 {
+		return reply.MakeArgNumErrReply("multi")
+	}
+	if c.InMultiState() {
+		return reply.MakeErrReply("ERR MULTI calls can not be nested")
+	}
+	c.SetMultiState(true)
+	return reply.MakeOkReply()
+}
+
+// execDiscard drops the queued commands and the watched keys
+func execDiscard(c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) != 0 {
+		return reply.MakeArgNumErrReply("discard")
+	}
+	if !c.InMultiState() {
+		return reply.MakeErrReply("ERR DISCARD without MULTI")
+	}
+	c.SetMultiState(false)
+	return reply.MakeOkReply()
+}
+
+// execWatch remembers the current version of the given keys
+func execWatch(db *DB, c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("watch")
+	}
+	if c.InMultiState() {
+		return reply.MakeErrReply("ERR WATCH inside MULTI is not allowed")
+	}
+	watching := c.GetWatching()
+	for _, bkey := range args {
+		key := string(bkey)
+		// remove the key if it has expired, so that its expiring doesn't abort the transaction later
+		db.IsExpired(key)
+		watching[key] = db.GetVersion(key)
+	}
+	return reply.MakeOkReply()
+}
+
+// execUnWatch forgets all watched keys
+func execUnWatch(c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) != 0 {
+		return reply.MakeArgNumErrReply("unwatch")
+	}
+	watching := c.GetWatching()
+	for key := range watching {
+		delete(watching, key)
+	}
+	return reply.MakeOkReply()
+}
+
+// enqueueCmd checks the command and puts it into the queue of current transaction
+// 命令不存在或参数个数错误时记录错误，EXEC 时整个事务被丢弃
+func enqueueCmd(c resp.Connection, cmdLine [][]byte) resp.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	if cmdName == "client" || cmdName == "hello" {
+		// they are executed by the connection handler which does not queue commands
+		errReply := reply.MakeErrReply("ERR " + strings.ToUpper(cmdName) + " is not allowed in MULTI")
+		c.AddTxError(errors.New(errReply.Error()))
+		return errReply
+	}
+	if _, ok := serverCmdFlags[cmdName]; ok {
+		// commands executed by server like SELECT and INFO check their arguments when executed
+		if cmdName == "select" && len(cmdLine) != 2 {
+			errReply := reply.MakeArgNumErrReply(cmdName)
+			c.AddTxError(errors.New(errReply.Error()))
+			return errReply
+		}
+		c.EnqueueCmd(cmdLine)
+		return reply.MakeQueuedReply()
+	}
+	cmd, ok := cmdTable[cmdName]
+	if !ok {
+		errReply := reply.MakeErrReply("ERR unknown command '" + cmdName + "'")
+		c.AddTxError(errors.New(errReply.Error()))
+		return errReply
+	}
+	if !validateArity(cmd.arity, cmdLine) {
+		errReply := reply.MakeArgNumErrReply(cmdName)
+		c.AddTxError(errors.New(errReply.Error()))
+		return errReply
+	}
+	c.EnqueueCmd(cmdLine)
+	return reply.MakeQueuedReply()
+}
+
+// execExec executes the queued commands of current transaction
+func execExec(mdb *StandaloneDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) != 0 {
+		return reply.MakeArgNumErrReply("exec")
+	}
+	if !c.InMultiState() {
+		return reply.MakeErrReply("ERR EXEC without MULTI")
+	}
+	defer c.SetMultiState(false)
+	if len(c.GetTxErrors()) > 0 {
+		return reply.MakeErrReply("EXECABORT Transaction discarded because of previous errors.")
+	}
+	return mdb.ExecMulti(c, c.GetWatching(), c.GetQueuedCmdLine())
+}
+
+// txKeys are the keys locked by a transaction in one db
+type txKeys struct {
+	writeKeys      []string
+	readKeys       []string
+	touchesAllKeys bool
+}
+
+// ExecMulti executes the queued commands atomically, aborts if any watched key has been modified.
+// SELECT in the queue switches the db of the commands after it, and keeps switched after EXEC like redis.
+func (mdb *StandaloneDatabase) ExecMulti(c resp.Connection, watching map[string]uint32, cmdLines [][][]byte) resp.Reply {
+	startIndex := c.GetDBIndex()
+	// lock all keys of the queued commands and the watched keys, so the transaction is not interleaved
+	keysOf := make(map[int]*txKeys)
+	getKeys := func(dbIndex int) *txKeys {
+		keys, ok := keysOf[dbIndex]
+		if !ok {
+			keys = &txKeys{}
+			keysOf[dbIndex] = keys
+		}
+		return keys
+	}
+	watchedKeys := getKeys(startIndex)
+	for key := range watching {
+		watchedKeys.readKeys = append(watchedKeys.readKeys, key)
+	}
+	dbIndex := startIndex
+	for _, cmdLine := range cmdLines {
+		cmdName := strings.ToLower(string(cmdLine[0]))
+		if cmdName == "select" {
+			if index, err := strconv.Atoi(string(cmdLine[1])); err == nil && index >= 0 && index < len(mdb.dbSet) {
+				dbIndex = index
+			}
+			continue
+		}
+		cmd, ok := cmdTable[cmdName]
+		if !ok {
+			// the other server commands don't access keys
+			continue
+		}
+		keys := getKeys(dbIndex)
+		write, read := cmd.getRelatedKeys(cmdLine[1:])
+		keys.writeKeys = append(keys.writeKeys, write...)
+		keys.readKeys = append(keys.readKeys, read...)
+		keys.touchesAllKeys = keys.touchesAllKeys || cmd.touchesAllKeys()
+	}
+	// dbs are locked in the order of index to avoid deadlock between transactions
+	indices := make([]int, 0, len(keysOf))
+	for index := range keysOf {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+	for _, index := range indices {
+		db, keys := mdb.dbSet[index], keysOf[index]
+		if keys.touchesAllKeys {
+			db.dbLock.Lock()
+		} else {
+			db.dbLock.RLock()
+		}
+		db.RWLocks(keys.writeKeys, keys.readKeys)
+	}
+	unlock := func() {
+		for i := len(indices) - 1; i >= 0; i-- {
+			db, keys := mdb.dbSet[indices[i]], keysOf[indices[i]]
+			db.RWUnLocks(keys.writeKeys, keys.readKeys)
+			if keys.touchesAllKeys {
+				db.dbLock.Unlock()
+			} else {
+				db.dbLock.RUnlock()
+			}
+		}
+	}
+
+	startDB := mdb.dbSet[startIndex]
+	for key, ver := range watching {
+		// a watched key expiring since WATCH is a modification as well
+		startDB.IsExpired(key)
+		if startDB.GetVersion(key) != ver {
+			unlock()
+			return reply.MakeNullMultiBulkReply()
+		}
+	}
+
+	// commands in a transaction write their aof lines into a buffer,
+	// then the whole transaction is written into aof wrapped in MULTI/EXEC.
+	// the commands of other dbs are preceded by SELECT inside the transaction
+	aofLines := make([]CmdLine, 0, len(cmdLines))
+	aofIndex := startIndex
+	txDBs := make(map[int]*DB)
+	getTxDB := func(index int) *DB {
+		txDB, ok := txDBs[index]
+		if !ok {
+			txDB = mdb.dbSet[index].makeTxDB(func(line CmdLine) {
+				if index != aofIndex {
+					aofLines = append(aofLines, utils.ToCmdLine("SELECT", strconv.Itoa(index)))
+					aofIndex = index
+				}
+				aofLines = append(aofLines, line)
+			})
+			txDBs[index] = txDB
+		}
+		return txDB
+	}
+	results := make([]resp.Reply, len(cmdLines))
+	var saves []int
+	for i, cmdLine := range cmdLines {
+		cmdName := strings.ToLower(string(cmdLine[0]))
+		cmd, ok := cmdTable[cmdName]
+		if !ok {
+			if cmdName == "save" {
+				// SAVE locks every key while reading it, run it after the keys of the transaction are unlocked
+				saves = append(saves, i)
+				continue
+			}
+			results[i], _ = mdb.tryExecServerCmd(c, cmdName, cmdLine)
+			continue
+		}
+		if cmd.flags&flagWrite != 0 {
+			cmdLine = utils.CopyCmdLine(cmdLine)
+		}
+		txDB := getTxDB(c.GetDBIndex())
+		write, _ := cmd.getRelatedKeys(cmdLine[1:])
+		result := cmd.executor(txDB, cmdLine[1:])
+		results[i] = result
+		txDB.addVersion(write...)
+		if len(write) > 0 && !reply.IsErrorReply(result) {
+			txDB.onWrite(len(write))
+		}
+	}
+	if len(aofLines) > 0 {
+		if aofIndex != startIndex {
+			aofLines = append(aofLines, utils.ToCmdLine("SELECT", strconv.Itoa(startIndex)))
+		}
+		startDB.addAofTx(aofLines)
+	}
+	unlock()
+	for _, i := range saves {
+		results[i] = execSave(mdb, cmdLines[i][1:])
+	}
+	return reply.MakeMultiRawReply(results)
+}
+
+// makeTxDB returns a view of db sharing its data, whose aof lines are collected by addAof
+func (db *DB) makeTxDB(addAof func(CmdLine)) *DB {
+	return &DB{
+		index:      db.index,
+		data:       db.data,
+		ttlMap:     db.ttlMap,
+		versionMap: db.versionMap,
+		locker:     db.locker,
+		dbLock:     db.dbLock,
+		auxiliary:  db.auxiliary,
+		onWrite:    db.onWrite,
+		addAof:     addAof,
+	}
+}
@@ -0,0 +1,128 @@
+package database
+
+import (
+	"go-redis/resp/connection"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMultiExec(t *testing.T) {
+	mdb, c := makeTestDatabase()
+	assertLines(t, mdb, c, [][2]string{
+		{"MULTI", "+OK\r\n"},
+		{"MULTI", "-ERR MULTI calls can not be nested\r\n"},
+		{"SET a 1", "+QUEUED\r\n"},
+		{"INCR a", "+QUEUED\r\n"},
+		// the error of a command doesn't stop the others
+		{"LPUSH a x", "+QUEUED\r\n"},
+		{"GET a", "+QUEUED\r\n"},
+		{"EXEC", "*4\r\n+OK\r\n:2\r\n-WRONGTYPE Operation against a key holding the wrong kind of value\r\n$1\r\n2\r\n"},
+		{"EXEC", "-ERR EXEC without MULTI\r\n"},
+		{"MULTI", "+OK\r\n"},
+		{"SET a 3", "+QUEUED\r\n"},
+		{"DISCARD", "+OK\r\n"},
+		{"GET a", "$1\r\n2\r\n"},
+		{"DISCARD", "-ERR DISCARD without MULTI\r\n"},
+	})
+}
+
+// TestExecAbort covers the transactions discarded by EXEC
+func TestExecAbort(t *testing.T) {
+	mdb, c := makeTestDatabase()
+	other := &connection.FakeConn{}
+	assertLines(t, mdb, c, [][2]string{
+		{"SET a 1", "+OK\r\n"},
+		{"WATCH a", "+OK\r\n"},
+		{"MULTI", "+OK\r\n"},
+		{"WATCH b", "-ERR WATCH inside MULTI is not allowed\r\n"},
+		{"SET a 2", "+QUEUED\r\n"},
+	})
+	// modified by another client
+	assertReply(t, execLine(mdb, other, "SET a 3"), "+OK\r\n")
+	assertLines(t, mdb, c, [][2]string{
+		{"EXEC", "*-1\r\n"},
+		{"GET a", "$1\r\n3\r\n"},
+		// EXEC forgets the watched keys
+		{"MULTI", "+OK\r\n"},
+		{"SET a 2", "+QUEUED\r\n"},
+		{"EXEC", "*1\r\n+OK\r\n"},
+	})
+
+	// expired since WATCH
+	assertLines(t, mdb, c, [][2]string{
+		{"PEXPIRE a 50", ":1\r\n"},
+		{"WATCH a", "+OK\r\n"},
+		{"MULTI", "+OK\r\n"},
+		{"SET b 1", "+QUEUED\r\n"},
+	})
+	time.Sleep(100 * time.Millisecond)
+	assertLines(t, mdb, c, [][2]string{
+		{"EXEC", "*-1\r\n"},
+		{"GET b", "$-1\r\n"},
+	})
+
+	// the watched key expired before WATCH doesn't abort the transaction
+	assertLines(t, mdb, c, [][2]string{
+		{"SET a 1", "+OK\r\n"},
+		{"PEXPIRE a 50", ":1\r\n"},
+	})
+	time.Sleep(100 * time.Millisecond)
+	assertLines(t, mdb, c, [][2]string{
+		{"WATCH a", "+OK\r\n"},
+		{"MULTI", "+OK\r\n"},
+		{"SET b 1", "+QUEUED\r\n"},
+		{"EXEC", "*1\r\n+OK\r\n"},
+	})
+
+	// errors when queued discard the whole transaction
+	assertLines(t, mdb, c, [][2]string{
+		{"MULTI", "+OK\r\n"},
+		{"SET b 2", "+QUEUED\r\n"},
+		{"NOSUCHCMD b", "-ERR unknown command 'nosuchcmd'\r\n"},
+		{"GET", "-ERR wrong number of arguments for 'get' command\r\n"},
+		{"SELECT", "-ERR wrong number of arguments for 'select' command\r\n"},
+		{"CLIENT ID", "-ERR CLIENT is not allowed in MULTI\r\n"},
+		{"EXEC", "-EXECABORT Transaction discarded because of previous errors.\r\n"},
+		{"GET b", "$1\r\n1\r\n"},
+		// the errors are cleared with the transaction
+		{"MULTI", "+OK\r\n"},
+		{"SET b 2", "+QUEUED\r\n"},
+		{"EXEC", "*1\r\n+OK\r\n"},
+	})
+}
+
+// TestMultiServerCommands runs the commands executed by server inside a transaction
+func TestMultiServerCommands(t *testing.T) {
+	mdb, c := makeTestDatabase()
+	var lines []string
+	mdb.dbSet[0].addAofTx = func(tx []CmdLine) {
+		for _, line := range tx {
+			lines = append(lines, string(join(line)))
+		}
+	}
+	assertLines(t, mdb, c, [][2]string{
+		{"MULTI", "+OK\r\n"},
+		{"SET a 0", "+QUEUED\r\n"},
+		{"SELECT 1", "+QUEUED\r\n"},
+		{"SET a 1", "+QUEUED\r\n"},
+		{"SELECT 16", "+QUEUED\r\n"},
+		{"INFO persistence", "+QUEUED\r\n"},
+	})
+	result := string(execLine(mdb, c, "EXEC").ToBytes())
+	if !strings.HasPrefix(result, "*5\r\n+OK\r\n+OK\r\n+OK\r\n-ERR DB index is out of range\r\n$") ||
+		!strings.Contains(result, "aof_enabled:") {
+		t.Fatalf("unexpected result %q", result)
+	}
+	// SELECT in the transaction keeps working after EXEC
+	assertLines(t, mdb, c, [][2]string{
+		{"GET a", "$1\r\n1\r\n"},
+		{"SELECT 0", "+OK\r\n"},
+		{"GET a", "$1\r\n0\r\n"},
+	})
+	// the transaction is written into aof of the db it started in, selecting it again at the end
+	want := []string{"set a 0", "SELECT 1", "set a 1", "SELECT 0"}
+	if strings.Join(lines, ",") != strings.Join(want, ",") {
+		t.Fatalf("expect aof %q, got %q", want, lines)
+	}
+}
@@ -0,0 +1,128 @@
+package dict
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestComputeCapacity(t *testing.T) {
+	tests := [][2]int{{0, 16}, {16, 16}, {17, 32}, {1000, 1024}, {1024, 1024}, {1025, 2048}}
+	for _, tt := range tests {
+		if got := computeCapacity(tt[0]); got != tt[1] {
+			t.Errorf("computeCapacity(%d): expect %d, got %d", tt[0], tt[1], got)
+		}
+	}
+}
+
+// TestShardDistribution checks the keys are spread over all the shards
+func TestShardDistribution(t *testing.T) {
+	d := MakeConcurrent(16)
+	const n = 16000
+	for i := 0; i < n; i++ {
+		d.Put("key:"+strconv.Itoa(i), i)
+	}
+	for i, s := range d.table {
+		// each shard gets about 1000 keys
+		if size := len(s.m); size < n/16/2 || size > n/16*2 {
+			t.Errorf("shard %d: expect about %d keys, got %d", i, n/16, size)
+		}
+	}
+}
+
+func TestConcurrentPutAndRemove(t *testing.T) {
+	d := MakeConcurrent(0)
+	if ret := d.Put("a", 1); ret != 1 {
+		t.Fatalf("expect 1 inserted, got %d", ret)
+	}
+	if ret := d.Put("a", 2); ret != 0 {
+		t.Fatalf("expect 0 inserted, got %d", ret)
+	}
+	if ret := d.PutIfAbsent("a", 3); ret != 0 {
+		t.Fatalf("expect absent put ignored, got %d", ret)
+	}
+	if ret := d.PutIfExists("b", 3); ret != 0 {
+		t.Fatalf("expect exists put ignored, got %d", ret)
+	}
+	if ret := d.PutIfExists("a", 4); ret != 1 {
+		t.Fatalf("expect exists put done, got %d", ret)
+	}
+	if val, ok := d.Get("a"); !ok || val != 4 {
+		t.Fatalf("expect 4, got %v %v", val, ok)
+	}
+	if d.Remove("a") != 1 || d.Remove("a") != 0 || d.Len() != 0 {
+		t.Fatalf("expect removed once, got len %d", d.Len())
+	}
+
+	// count stays right under concurrent writes
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := strconv.Itoa(i)
+				d.PutIfAbsent(key, g)
+				if i%2 == 0 {
+					d.Remove(key)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if d.Len() != len(d.Keys()) {
+		t.Fatalf("expect len %d equal to the number of keys %d", d.Len(), len(d.Keys()))
+	}
+	d.Clear()
+	if d.Len() != 0 || len(d.Keys()) != 0 {
+		t.Fatalf("expect empty after clear, got %d", d.Len())
+	}
+}
+
+func TestConcurrentRandomKeys(t *testing.T) {
+	d := MakeConcurrent(16)
+	for i := 0; i < 10; i++ {
+		d.Put(strconv.Itoa(i), i)
+	}
+	for _, limit := range []int{0, 3, 10, 20} {
+		want := limit
+		if want > 10 {
+			want = 10
+		}
+		keys := d.RandomKeys(limit)
+		if len(keys) != want {
+			t.Errorf("RandomKeys(%d): expect %d keys, got %d", limit, want, len(keys))
+		}
+		for _, key := range keys {
+			if _, ok := d.Get(key); !ok {
+				t.Errorf("RandomKeys(%d): unknown key %q", limit, key)
+			}
+		}
+
+		keys = d.RandomDistinctKeys(limit)
+		if len(keys) != want {
+			t.Errorf("RandomDistinctKeys(%d): expect %d keys, got %d", limit, want, len(keys))
+		}
+		seen := make(map[string]struct{})
+		for _, key := range keys {
+			if _, ok := d.Get(key); !ok {
+				t.Errorf("RandomDistinctKeys(%d): unknown key %q", limit, key)
+			}
+			if _, ok := seen[key]; ok {
+				t.Errorf("RandomDistinctKeys(%d): duplicated key %q", limit, key)
+			}
+			seen[key] = struct{}{}
+		}
+	}
+
+	// every key is picked sooner or later
+	seen := make(map[string]struct{})
+	for i := 0; i < 1000 && len(seen) < 10; i++ {
+		for _, key := range d.RandomKeys(1) {
+			seen[key] = struct{}{}
+		}
+	}
+	if len(seen) != 10 {
+		t.Errorf("expect all keys picked, got %d", len(seen))
+	}
+}
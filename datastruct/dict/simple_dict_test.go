@@ -0,0 +1,53 @@
+package dict
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// Keys used to return empty strings only, since the index was never increased
+func TestSimpleDictKeys(t *testing.T) {
+	d := MakeSimple()
+	for i := 0; i < 100; i++ {
+		d.Put(strconv.Itoa(i), i)
+	}
+	keys := d.Keys()
+	if len(keys) != 100 {
+		t.Fatalf("expect 100 keys, got %d", len(keys))
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, _ := strconv.Atoi(keys[i])
+		b, _ := strconv.Atoi(keys[j])
+		return a < b
+	})
+	for i, key := range keys {
+		if key != strconv.Itoa(i) {
+			t.Fatalf("expect key %d, got %q", i, key)
+		}
+	}
+}
+
+func TestSimpleDictRandomDistinctKeys(t *testing.T) {
+	d := MakeSimple()
+	for i := 0; i < 10; i++ {
+		d.Put(strconv.Itoa(i), i)
+	}
+	for _, limit := range []int{0, 3, 10, 20} {
+		keys := d.RandomDistinctKeys(limit)
+		want := limit
+		if want > 10 {
+			want = 10
+		}
+		seen := make(map[string]bool)
+		for _, key := range keys {
+			if _, ok := d.Get(key); !ok || seen[key] {
+				t.Fatalf("limit %d: unexpected key %q in %v", limit, key, keys)
+			}
+			seen[key] = true
+		}
+		if len(keys) != want {
+			t.Fatalf("limit %d: expect %d keys, got %v", limit, want, keys)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package hash
+
+import (
+	"go-redis/datastruct/dict"
+	"math/rand"
+)
+
+const (
+	// EncodingListpack means fields are stored in a compact slice
+	EncodingListpack = "listpack"
+	// EncodingHashtable means fields are stored in a dict.SimpleDict
+	EncodingHashtable = "hashtable"
+)
+
+// Consumer is used to traversal hash, if it returns false the traversal will be break
+type Consumer func(field string, value []byte) bool
+
+type entry struct {
+	field string
+	value []byte
+}
+
+// Hash is a field-value map
+// small hashes are stored as a compact slice which is scanned linearly,
+// once the hash grows past maxEntries fields or gets a value longer than maxValue bytes
+// it is converted to a dict.SimpleDict and never converted back
+// 小的哈希表使用紧凑的切片存储，超过阈值后转换为 dict.SimpleDict
+type Hash struct {
+	entries []entry
+	dict    *dict.SimpleDict
+
+	maxEntries int
+	maxValue   int
+}
+
+// Make creates an empty Hash with the given compact encoding thresholds
+func Make(maxEntries int, maxValue int) *Hash {
+	return &Hash{
+		entries:    make([]entry, 0),
+		maxEntries: maxEntries,
+		maxValue:   maxValue,
+	}
+}
+
+// Encoding returns the underlying encoding of the hash
+func (h *Hash) Encoding() string {
+	if h.dict != nil {
+		return EncodingHashtable
+	}
+	return EncodingListpack
+}
+
+func (h *Hash) find(field string) int {
+	for i := range h.entries {
+		if h.entries[i].field == field {
+			return i
+		}
+	}
+	return -1
+}
+
+// convert moves all entries into a dict.SimpleDict
+func (h *Hash) convert() {
+	d := dict.MakeSimple()
+	for _, e := range h.entries {
+		d.Put(e.field, e.value)
+	}
+	h.dict = d
+	h.entries = nil
+}
+
+// Get returns the value bound to field and whether the field exists
+func (h *Hash) Get(field string) ([]byte, bool) {
+	if h.dict != nil {
+		raw, ok := h.dict.Get(field)
+		if !ok {
+			return nil, false
+		}
+		return raw.([]byte), true
+	}
+	i := h.find(field)
+	if i < 0 {
+		return nil, false
+	}
+	return h.entries[i].value, true
+}
+
+// Set puts field-value into hash and returns the number of new inserted fields
+func (h *Hash) Set(field string, value []byte) (result int) {
+	if h.dict == nil {
+		if i := h.find(field); i >= 0 {
+			h.entries[i].value = value
+			if len(value) > h.maxValue {
+				h.convert()
+			}
+			return 0
+		}
+		if len(h.entries)+1 > h.maxEntries || len(field) > h.maxValue || len(value) > h.maxValue {
+			h.convert()
+		} else {
+			h.entries = append(h.entries, entry{field: field, value: value})
+			return 1
+		}
+	}
+	return h.dict.Put(field, value)
+}
+
+// SetIfAbsent puts field-value only if the field not exists and returns the number of inserted fields
+func (h *Hash) SetIfAbsent(field string, value []byte) (result int) {
+	if _, exists := h.Get(field); exists {
+		return 0
+	}
+	return h.Set(field, value)
+}
+
+// Remove removes the field and returns the number of deleted fields
+func (h *Hash) Remove(field string) (result int) {
+	if h.dict != nil {
+		return h.dict.Remove(field)
+	}
+	i := h.find(field)
+	if i < 0 {
+		return 0
+	}
+	last := len(h.entries) - 1
+	copy(h.entries[i:], h.entries[i+1:])
+	h.entries[last] = entry{} // help gc
+	h.entries = h.entries[:last]
+	return 1
+}
+
+// Len returns the number of fields
+func (h *Hash) Len() int {
+	if h.dict != nil {
+		return h.dict.Len()
+	}
+	return len(h.entries)
+}
+
+// ForEach traversal the hash
+func (h *Hash) ForEach(consumer Consumer) {
+	if h.dict != nil {
+		h.dict.ForEach(func(key string, val interface{}) bool {
+			return consumer(key, val.([]byte))
+		})
+		return
+	}
+	for _, e := range h.entries {
+		if !consumer(e.field, e.value) {
+			break
+		}
+	}
+}
+
+// Fields returns all fields in hash
+func (h *Hash) Fields() []string {
+	fields := make([]string, 0, h.Len())
+	h.ForEach(func(field string, value []byte) bool {
+		fields = append(fields, field)
+		return true
+	})
+	return fields
+}
+
+// RandomFields randomly returns fields of the given number, may contain duplicated field
+func (h *Hash) RandomFields(limit int) []string {
+	fields := h.Fields()
+	result := make([]string, 0, limit)
+	if len(fields) == 0 {
+		return result
+	}
+	for i := 0; i < limit; i++ {
+		result = append(result, fields[rand.Intn(len(fields))])
+	}
+	return result
+}
+
+// RandomDistinctFields randomly returns fields of the given number, won't contain duplicated field
+func (h *Hash) RandomDistinctFields(limit int) []string {
+	fields := h.Fields()
+	rand.Shuffle(len(fields), func(i, j int) {
+		fields[i], fields[j] = fields[j], fields[i]
+	})
+	if limit < len(fields) {
+		fields = fields[:limit]
+	}
+	return fields
+}
@@ -0,0 +1,153 @@
+package hash
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// checkHash compares the hash with the map holding the same fields
+func checkHash(t *testing.T, h *Hash, want map[string]string) {
+	t.Helper()
+	if h.Len() != len(want) {
+		t.Fatalf("expect len %d, got %d", len(want), h.Len())
+	}
+	for field, value := range want {
+		got, ok := h.Get(field)
+		if !ok || string(got) != value {
+			t.Fatalf("expect %s=%s, got %s %v", field, value, got, ok)
+		}
+	}
+	fields := h.Fields()
+	if len(fields) != len(want) {
+		t.Fatalf("expect %d fields, got %d", len(want), len(fields))
+	}
+	for _, field := range fields {
+		if _, ok := want[field]; !ok {
+			t.Fatalf("unexpected field %s", field)
+		}
+	}
+}
+
+func TestHashListpack(t *testing.T) {
+	h := Make(4, 8)
+	want := make(map[string]string)
+	for i := 0; i < 4; i++ {
+		field := "f" + strconv.Itoa(i)
+		if result := h.Set(field, []byte("v")); result != 1 {
+			t.Fatalf("expect 1 inserted, got %d", result)
+		}
+		want[field] = "v"
+	}
+	if result := h.Set("f0", []byte("new")); result != 0 {
+		t.Fatalf("expect 0 inserted for existing field, got %d", result)
+	}
+	want["f0"] = "new"
+	if result := h.SetIfAbsent("f1", []byte("x")); result != 0 {
+		t.Fatalf("expect SetIfAbsent to skip existing field, got %d", result)
+	}
+	if h.Encoding() != EncodingListpack {
+		t.Fatalf("expect listpack, got %s", h.Encoding())
+	}
+	checkHash(t, h, want)
+
+	if h.Remove("f2") != 1 || h.Remove("f2") != 0 {
+		t.Fatal("wrong Remove result")
+	}
+	delete(want, "f2")
+	checkHash(t, h, want)
+	if h.Encoding() != EncodingListpack {
+		t.Fatalf("expect listpack after remove, got %s", h.Encoding())
+	}
+}
+
+func TestHashConvert(t *testing.T) {
+	tests := []struct {
+		name   string
+		update func(h *Hash, want map[string]string)
+	}{
+		{"too many fields", func(h *Hash, want map[string]string) {
+			h.Set("f4", []byte("v"))
+			want["f4"] = "v"
+		}},
+		{"long new value", func(h *Hash, want map[string]string) {
+			h.Set("new", []byte("123456789"))
+			want["new"] = "123456789"
+		}},
+		{"long field", func(h *Hash, want map[string]string) {
+			h.Set("field-too-long", []byte("v"))
+			want["field-too-long"] = "v"
+		}},
+		{"long updated value", func(h *Hash, want map[string]string) {
+			h.Set("f0", []byte("123456789"))
+			want["f0"] = "123456789"
+		}},
+		{"SetIfAbsent", func(h *Hash, want map[string]string) {
+			h.SetIfAbsent("f4", []byte("v"))
+			want["f4"] = "v"
+		}},
+	}
+	for _, tt := range tests {
+		h := Make(4, 8)
+		want := make(map[string]string)
+		for i := 0; i < 4; i++ {
+			field := "f" + strconv.Itoa(i)
+			h.Set(field, []byte("v"))
+			want[field] = "v"
+		}
+		tt.update(h, want)
+		if h.Encoding() != EncodingHashtable {
+			t.Errorf("%s: expect hashtable, got %s", tt.name, h.Encoding())
+			continue
+		}
+		checkHash(t, h, want)
+		// never converted back
+		for field := range want {
+			h.Remove(field)
+		}
+		if h.Len() != 0 || h.Encoding() != EncodingHashtable {
+			t.Errorf("%s: expect empty hashtable, got %d %s", tt.name, h.Len(), h.Encoding())
+		}
+	}
+}
+
+func TestHashRandomFields(t *testing.T) {
+	for _, maxEntries := range []int{128, 2} {
+		h := Make(maxEntries, 64)
+		for _, field := range []string{"a", "b", "c"} {
+			h.Set(field, []byte(field))
+		}
+		distinct := h.RandomDistinctFields(5)
+		sort.Strings(distinct)
+		if strings.Join(distinct, ",") != "a,b,c" {
+			t.Errorf("%s: expect all fields, got %v", h.Encoding(), distinct)
+		}
+		if got := h.RandomDistinctFields(2); len(got) != 2 || got[0] == got[1] {
+			t.Errorf("%s: expect 2 distinct fields, got %v", h.Encoding(), got)
+		}
+		if got := h.RandomFields(10); len(got) != 10 {
+			t.Errorf("%s: expect 10 fields, got %v", h.Encoding(), got)
+		}
+	}
+	if got := Make(4, 4).RandomFields(3); len(got) != 0 {
+		t.Errorf("expect no field from empty hash, got %v", got)
+	}
+}
+
+func TestHashForEachBreak(t *testing.T) {
+	for _, maxEntries := range []int{128, 2} {
+		h := Make(maxEntries, 64)
+		for i := 0; i < 10; i++ {
+			h.Set(strconv.Itoa(i), nil)
+		}
+		visited := 0
+		h.ForEach(func(field string, value []byte) bool {
+			visited++
+			return visited < 3
+		})
+		if visited != 3 {
+			t.Errorf("%s: expect ForEach to stop after 3 fields, visited %d", h.Encoding(), visited)
+		}
+	}
+}
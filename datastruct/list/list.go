@@ -0,0 +1,28 @@
+package list
+
+// Expected check whether given item is equals to expected value
+// 用于判断元素是否符合预期
+type Expected func(a interface{}) bool
+
+// Consumer traverses list.
+// It receives index and value as params, returns true to continue traversal, while returns false to break
+// 用于遍历列表的函数，如果返回 false 则遍历会被中断
+type Consumer func(i int, v interface{}) bool
+
+// List is interface of a linear data structure
+type List interface {
+	Add(val interface{})
+	Get(index int) (val interface{})
+	Set(index int, val interface{})
+	Insert(index int, val interface{})
+	Remove(index int) (val interface{})
+	RemoveLast() (val interface{})
+	RemoveAllByVal(expected Expected) int
+	RemoveByVal(expected Expected, count int) int
+	ReverseRemoveByVal(expected Expected, count int) int
+	Len() int
+	ForEach(consumer Consumer)
+	ReverseForEach(consumer Consumer)
+	Contains(expected Expected) bool
+	Range(start int, stop int) []interface{}
+}
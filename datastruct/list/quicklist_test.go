@@ -0,0 +1,194 @@
+package list
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// checkList compares the list with the slice holding the same elements
+func checkList(t *testing.T, ql *QuickList, want []int) {
+	t.Helper()
+	if ql.Len() != len(want) {
+		t.Fatalf("expect len %d, got %d", len(want), ql.Len())
+	}
+	ql.ForEach(func(i int, v interface{}) bool {
+		if v.(int) != want[i] {
+			t.Fatalf("ForEach: expect %d at %d, got %d", want[i], i, v)
+		}
+		return true
+	})
+	next := len(want) - 1
+	ql.ReverseForEach(func(i int, v interface{}) bool {
+		if i != next || v.(int) != want[i] {
+			t.Fatalf("ReverseForEach: expect %d at %d, got %d at %d", want[next], next, v, i)
+		}
+		next--
+		return true
+	})
+	if next != -1 {
+		t.Fatalf("ReverseForEach stopped at %d", next)
+	}
+	// the pages are never empty or longer than pageSize
+	for n := ql.data.Front(); n != nil; n = n.Next() {
+		if size := len(n.Value.([]interface{})); size == 0 || size > pageSize {
+			t.Fatalf("wrong page size %d", size)
+		}
+	}
+}
+
+func equals(val int) Expected {
+	return func(a interface{}) bool {
+		return a.(int) == val
+	}
+}
+
+func TestQuickListAddGetSet(t *testing.T) {
+	ql := NewQuickList()
+	ql.Add(0)
+	// the page grows on demand
+	if size := cap(ql.data.Front().Value.([]interface{})); size >= pageSize {
+		t.Fatalf("expect a small page for a short list, got capacity %d", size)
+	}
+	ql.Remove(0)
+	var want []int
+	for i := 0; i < 3*pageSize+10; i++ {
+		ql.Add(i)
+		want = append(want, i)
+	}
+	checkList(t, ql, want)
+	for i := 0; i < len(want); i += 7 {
+		if ql.Get(i).(int) != i {
+			t.Fatalf("expect %d at %d, got %v", i, i, ql.Get(i))
+		}
+		ql.Set(i, -i)
+		want[i] = -i
+	}
+	checkList(t, ql, want)
+	if got := ql.Range(pageSize-2, pageSize+3); len(got) != 5 || got[0].(int) != want[pageSize-2] || got[4].(int) != want[pageSize+2] {
+		t.Fatalf("wrong range across pages: %v", got)
+	}
+	if !ql.Contains(equals(3*pageSize)) || ql.Contains(equals(10*pageSize)) {
+		t.Fatal("wrong Contains")
+	}
+}
+
+func TestQuickListInsertSplitsPage(t *testing.T) {
+	ql := NewQuickList()
+	var want []int
+	for i := 0; i < pageSize; i++ {
+		ql.Add(i)
+		want = append(want, i)
+	}
+	// the page is full, inserting into the first and the second half
+	for _, index := range []int{10, pageSize - 10, 0, pageSize / 2} {
+		ql.Insert(index, -index-1)
+		want = append(want[:index], append([]int{-index - 1}, want[index:]...)...)
+		checkList(t, ql, want)
+	}
+	ql.Insert(ql.Len(), 12345)
+	want = append(want, 12345)
+	checkList(t, ql, want)
+}
+
+func TestQuickListRemove(t *testing.T) {
+	ql := NewQuickList()
+	var want []int
+	for i := 0; i < 2*pageSize+3; i++ {
+		ql.Add(i % 5)
+		want = append(want, i%5)
+	}
+	// remove the last element of a page and the whole last page, negative index counts from the end
+	for _, index := range []int{pageSize - 1, -1, -1, -2, 0} {
+		if index < 0 {
+			index += len(want)
+		}
+		if got := ql.Remove(index).(int); got != want[index] {
+			t.Fatalf("expect removed %d, got %d", want[index], got)
+		}
+		want = append(want[:index], want[index+1:]...)
+		checkList(t, ql, want)
+	}
+	if got := ql.RemoveLast().(int); got != want[len(want)-1] {
+		t.Fatalf("expect removed %d, got %d", want[len(want)-1], got)
+	}
+	want = want[:len(want)-1]
+	checkList(t, ql, want)
+
+	removed := ql.RemoveByVal(equals(1), 3)
+	for i, n := 0, 0; i < len(want) && n < 3; {
+		if want[i] == 1 {
+			want = append(want[:i], want[i+1:]...)
+			n++
+		} else {
+			i++
+		}
+	}
+	if removed != 3 {
+		t.Fatalf("expect 3 removed, got %d", removed)
+	}
+	checkList(t, ql, want)
+
+	removed = ql.ReverseRemoveByVal(equals(2), 4)
+	for i, n := len(want)-1, 0; i >= 0 && n < 4; i-- {
+		if want[i] == 2 {
+			want = append(want[:i], want[i+1:]...)
+			n++
+		}
+	}
+	if removed != 4 {
+		t.Fatalf("expect 4 removed, got %d", removed)
+	}
+	checkList(t, ql, want)
+
+	count := 0
+	for _, v := range want {
+		if v == 3 {
+			count++
+		}
+	}
+	if removed := ql.RemoveAllByVal(equals(3)); removed != count {
+		t.Fatalf("expect %d removed, got %d", count, removed)
+	}
+	filtered := want[:0]
+	for _, v := range want {
+		if v != 3 {
+			filtered = append(filtered, v)
+		}
+	}
+	checkList(t, ql, filtered)
+}
+
+func TestQuickListRandomOps(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	ql := NewQuickList()
+	var want []int
+	for i := 0; i < 20000; i++ {
+		switch op := r.Intn(10); {
+		case op < 4 || len(want) == 0:
+			ql.Add(i)
+			want = append(want, i)
+		case op < 7:
+			index := r.Intn(len(want) + 1)
+			ql.Insert(index, i)
+			want = append(want[:index], append([]int{i}, want[index:]...)...)
+		case op < 9:
+			index := r.Intn(len(want))
+			if got := ql.Remove(index).(int); got != want[index] {
+				t.Fatalf("expect removed %d, got %d", want[index], got)
+			}
+			want = append(want[:index], want[index+1:]...)
+		default:
+			ql.RemoveLast()
+			want = want[:len(want)-1]
+		}
+	}
+	checkList(t, ql, want)
+	for len(want) > 0 {
+		ql.Remove(0)
+		want = want[1:]
+	}
+	checkList(t, ql, want)
+	if ql.RemoveLast() != nil || ql.RemoveByVal(equals(1), 0) != 0 {
+		t.Fatal("expect nothing to remove from empty list")
+	}
+}
@@ -0,0 +1,227 @@
+package set
+
+import (
+	"go-redis/datastruct/dict"
+	"math/rand"
+	"sort"
+	"strconv"
+)
+
+const (
+	// EncodingIntset means members are stored as a sorted slice of int64
+	EncodingIntset = "intset"
+	// EncodingHashtable means members are stored in a dict
+	EncodingHashtable = "hashtable"
+)
+
+// Consumer is used to traversal set, if it returns false the traversal will be break
+type Consumer func(member string) bool
+
+// Set is a set of strings
+// a set holding only integers is stored as a sorted []int64 to save memory,
+// it is upgraded to a dict.SimpleDict once a non-integer member arrives or it grows past maxIntsetEntries
+// 只包含整数的集合使用有序的 int64 切片存储，出现非整数成员或超过阈值后转换为哈希表
+type Set struct {
+	intset []int64
+	dict   dict.Dict
+
+	maxIntsetEntries int
+}
+
+// Make creates a new set with the given members
+func Make(maxIntsetEntries int, members ...string) *Set {
+	set := &Set{
+		intset:           make([]int64, 0),
+		maxIntsetEntries: maxIntsetEntries,
+	}
+	for _, member := range members {
+		set.Add(member)
+	}
+	return set
+}
+
+// toInt returns the integer form of member, only canonical integers like "12" (not "012" or "+12") are accepted
+func toInt(member string) (int64, bool) {
+	val, err := strconv.ParseInt(member, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	if strconv.FormatInt(val, 10) != member {
+		return 0, false
+	}
+	return val, true
+}
+
+// Encoding returns the underlying encoding of the set
+func (set *Set) Encoding() string {
+	if set.dict != nil {
+		return EncodingHashtable
+	}
+	return EncodingIntset
+}
+
+// search returns the position of val in intset and whether val exists
+func (set *Set) search(val int64) (int, bool) {
+	i := sort.Search(len(set.intset), func(i int) bool {
+		return set.intset[i] >= val
+	})
+	return i, i < len(set.intset) && set.intset[i] == val
+}
+
+// upgrade moves all members from intset into a dict
+func (set *Set) upgrade() {
+	d := dict.MakeSimple()
+	for _, val := range set.intset {
+		d.Put(strconv.FormatInt(val, 10), nil)
+	}
+	set.dict = d
+	set.intset = nil
+}
+
+// Add adds member into set and returns the number of new inserted members
+func (set *Set) Add(member string) int {
+	if set.dict == nil {
+		val, isInt := toInt(member)
+		if isInt {
+			i, exists := set.search(val)
+			if exists {
+				return 0
+			}
+			if len(set.intset)+1 <= set.maxIntsetEntries {
+				set.intset = append(set.intset, 0)
+				copy(set.intset[i+1:], set.intset[i:])
+				set.intset[i] = val
+				return 1
+			}
+		}
+		set.upgrade()
+	}
+	return set.dict.Put(member, nil)
+}
+
+// Remove removes member from set and returns the number of deleted members
+func (set *Set) Remove(member string) int {
+	if set.dict != nil {
+		return set.dict.Remove(member)
+	}
+	val, isInt := toInt(member)
+	if !isInt {
+		return 0
+	}
+	i, exists := set.search(val)
+	if !exists {
+		return 0
+	}
+	set.intset = append(set.intset[:i], set.intset[i+1:]...)
+	return 1
+}
+
+// Has returns true if the member exists in set
+func (set *Set) Has(member string) bool {
+	if set.dict != nil {
+		_, exists := set.dict.Get(member)
+		return exists
+	}
+	val, isInt := toInt(member)
+	if !isInt {
+		return false
+	}
+	_, exists := set.search(val)
+	return exists
+}
+
+// Len returns number of members in the set
+func (set *Set) Len() int {
+	if set.dict != nil {
+		return set.dict.Len()
+	}
+	return len(set.intset)
+}
+
+// ToSlice convert set to []string
+func (set *Set) ToSlice() []string {
+	slice := make([]string, 0, set.Len())
+	set.ForEach(func(member string) bool {
+		slice = append(slice, member)
+		return true
+	})
+	return slice
+}
+
+// ForEach visits each member in the set
+func (set *Set) ForEach(consumer Consumer) {
+	if set.dict != nil {
+		set.dict.ForEach(func(key string, val interface{}) bool {
+			return consumer(key)
+		})
+		return
+	}
+	for _, val := range set.intset {
+		if !consumer(strconv.FormatInt(val, 10)) {
+			break
+		}
+	}
+}
+
+// Intersect intersects two sets
+func (set *Set) Intersect(another *Set) *Set {
+	result := Make(set.maxIntsetEntries)
+	set.ForEach(func(member string) bool {
+		if another.Has(member) {
+			result.Add(member)
+		}
+		return true
+	})
+	return result
+}
+
+// Union adds two sets
+func (set *Set) Union(another *Set) *Set {
+	result := Make(set.maxIntsetEntries)
+	set.ForEach(func(member string) bool {
+		result.Add(member)
+		return true
+	})
+	another.ForEach(func(member string) bool {
+		result.Add(member)
+		return true
+	})
+	return result
+}
+
+// Diff subtracts two sets
+func (set *Set) Diff(another *Set) *Set {
+	result := Make(set.maxIntsetEntries)
+	set.ForEach(func(member string) bool {
+		if !another.Has(member) {
+			result.Add(member)
+		}
+		return true
+	})
+	return result
+}
+
+// RandomMembers randomly returns members of the given number, may contain duplicated member
+func (set *Set) RandomMembers(limit int) []string {
+	members := set.ToSlice()
+	result := make([]string, 0, limit)
+	if len(members) == 0 {
+		return result
+	}
+	for i := 0; i < limit; i++ {
+		result = append(result, members[rand.Intn(len(members))])
+	}
+	return result
+}
+
+// RandomDistinctMembers randomly returns members of the given number, won't contain duplicated member
+func (set *Set) RandomDistinctMembers(limit int) []string {
+	members := set.ToSlice()
+	rand.Shuffle(len(members), func(i, j int) {
+		members[i], members[j] = members[j], members[i]
+	})
+	if limit < len(members) {
+		members = members[:limit]
+	}
+	return members
+}
@@ -0,0 +1,130 @@
+package set
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+// sorted returns the members of set in order
+func sorted(set *Set) string {
+	members := set.ToSlice()
+	sort.Strings(members)
+	return strings.Join(members, ",")
+}
+
+func TestSetIntset(t *testing.T) {
+	set := Make(16, "5", "-3", "100", "0", "5")
+	if set.Encoding() != EncodingIntset {
+		t.Fatalf("expect intset, got %s", set.Encoding())
+	}
+	// intset members are visited in numeric order
+	if got := strings.Join(set.ToSlice(), ","); got != "-3,0,5,100" {
+		t.Fatalf("expect sorted members, got %s", got)
+	}
+	if set.Add("7") != 1 || set.Add("7") != 0 {
+		t.Fatal("wrong Add result")
+	}
+	if !set.Has("7") || set.Has("8") || set.Has("abc") || set.Has("07") {
+		t.Fatal("wrong Has result")
+	}
+	if set.Remove("abc") != 0 || set.Remove("8") != 0 || set.Remove("-3") != 1 {
+		t.Fatal("wrong Remove result")
+	}
+	if got := strings.Join(set.ToSlice(), ","); got != "0,5,7,100" {
+		t.Fatalf("expect 0,5,7,100, got %s", got)
+	}
+	if set.Encoding() != EncodingIntset {
+		t.Fatalf("expect intset, got %s", set.Encoding())
+	}
+}
+
+func TestSetUpgrade(t *testing.T) {
+	tests := []struct {
+		name   string
+		member string
+	}{
+		{"non integer", "abc"},
+		{"leading zero", "012"},
+		{"plus sign", "+12"},
+		{"out of int64", "9223372036854775808"},
+		{"too many entries", "4"},
+	}
+	for _, tt := range tests {
+		set := Make(4, "1", "2", "3", "-9223372036854775808")
+		if set.Encoding() != EncodingIntset {
+			t.Errorf("%s: expect intset before upgrade, got %s", tt.name, set.Encoding())
+			continue
+		}
+		if set.Add(tt.member) != 1 {
+			t.Errorf("%s: expect %s inserted", tt.name, tt.member)
+		}
+		if set.Encoding() != EncodingHashtable {
+			t.Errorf("%s: expect hashtable, got %s", tt.name, set.Encoding())
+			continue
+		}
+		if set.Len() != 5 || !set.Has(tt.member) || !set.Has("-9223372036854775808") {
+			t.Errorf("%s: wrong members after upgrade %s", tt.name, sorted(set))
+		}
+		// "012" is a different member from "12"
+		if tt.member == "012" && set.Has("12") {
+			t.Errorf("%s: 12 should not exist", tt.name)
+		}
+		if set.Remove("1") != 1 || set.Remove(tt.member) != 1 || set.Has("1") {
+			t.Errorf("%s: wrong Remove result", tt.name)
+		}
+	}
+	// an existing integer never upgrades a full intset
+	set := Make(2, "1", "2")
+	if set.Add("2") != 0 || set.Encoding() != EncodingIntset {
+		t.Fatalf("expect intset after adding existing member, got %s", set.Encoding())
+	}
+}
+
+func TestSetAlgebra(t *testing.T) {
+	for _, maxIntsetEntries := range []int{512, 0} {
+		a := Make(maxIntsetEntries, "1", "2", "3", "4")
+		b := Make(maxIntsetEntries, "3", "4", "5")
+		if got := sorted(a.Intersect(b)); got != "3,4" {
+			t.Errorf("%s: expect intersect 3,4, got %s", a.Encoding(), got)
+		}
+		if got := sorted(a.Union(b)); got != "1,2,3,4,5" {
+			t.Errorf("%s: expect union 1,2,3,4,5, got %s", a.Encoding(), got)
+		}
+		if got := sorted(a.Diff(b)); got != "1,2" {
+			t.Errorf("%s: expect diff 1,2, got %s", a.Encoding(), got)
+		}
+		c := Make(maxIntsetEntries, "x", "3")
+		if got := sorted(a.Intersect(c)); got != "3" {
+			t.Errorf("%s: expect intersect 3, got %s", a.Encoding(), got)
+		}
+		if got := sorted(c.Union(a)); got != "1,2,3,4,x" {
+			t.Errorf("%s: expect union 1,2,3,4,x, got %s", a.Encoding(), got)
+		}
+	}
+}
+
+func TestSetRandomMembers(t *testing.T) {
+	for _, set := range []*Set{Make(512, "1", "2", "3"), Make(512, "a", "b", "c")} {
+		distinct := set.RandomDistinctMembers(5)
+		sort.Strings(distinct)
+		if len(distinct) != 3 || strings.Join(distinct, ",") != sorted(set) {
+			t.Errorf("%s: expect all members, got %v", set.Encoding(), distinct)
+		}
+		if got := set.RandomDistinctMembers(2); len(got) != 2 || got[0] == got[1] {
+			t.Errorf("%s: expect 2 distinct members, got %v", set.Encoding(), got)
+		}
+		got := set.RandomMembers(10)
+		if len(got) != 10 {
+			t.Errorf("%s: expect 10 members, got %v", set.Encoding(), got)
+		}
+		for _, member := range got {
+			if !set.Has(member) {
+				t.Errorf("%s: unexpected member %s", set.Encoding(), member)
+			}
+		}
+	}
+	if got := Make(512).RandomMembers(3); len(got) != 0 {
+		t.Errorf("expect no member from empty set, got %v", got)
+	}
+}
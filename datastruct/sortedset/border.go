@@ -0,0 +1,189 @@
+package sortedset
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+/*
+ * ScoreBorder is a struct represents `min` `max` parameter of redis command `ZRANGEBYSCORE`
+ * can accept:
+ *   int or float value, such as 2.718, 2, -2.718, -2 ...
+ *   exclusive int or float value, such as (2.718, (2, (-2.718, (-2 ...
+ *   infinity: +inf, -inf， inf(same as +inf)
+ */
+
+const (
+	scoreNegativeInf int8 = -1
+	scorePositiveInf int8 = 1
+	lexNegativeInf   int8 = '-'
+	lexPositiveInf   int8 = '+'
+)
+
+// Border represents range of a command like ZRANGEBYSCORE or ZRANGEBYLEX
+// 表示范围查询的边界
+type Border interface {
+	// less returns true if element is not lower than min border
+	less(element *Element) bool
+	// greater returns true if element is not higher than max border
+	greater(element *Element) bool
+	// isIntersected returns true if no element can be in [min, max]
+	isIntersected(max Border) bool
+}
+
+// ScoreBorder represents range of a float value, including: <, <=, >, >=, +inf, -inf
+type ScoreBorder struct {
+	Inf     int8
+	Value   float64
+	Exclude bool
+}
+
+func (border *ScoreBorder) less(element *Element) bool {
+	if border.Inf == scoreNegativeInf {
+		return true
+	} else if border.Inf == scorePositiveInf {
+		return false
+	}
+	if border.Exclude {
+		return border.Value < element.Score
+	}
+	return border.Value <= element.Score
+}
+
+func (border *ScoreBorder) greater(element *Element) bool {
+	if border.Inf == scoreNegativeInf {
+		return false
+	} else if border.Inf == scorePositiveInf {
+		return true
+	}
+	if border.Exclude {
+		return border.Value > element.Score
+	}
+	return border.Value >= element.Score
+}
+
+func (border *ScoreBorder) isIntersected(max Border) bool {
+	maxBorder, ok := max.(*ScoreBorder)
+	if !ok {
+		return true
+	}
+	minValue := border.Value
+	maxValue := maxBorder.Value
+	if border.Inf == scorePositiveInf || maxBorder.Inf == scoreNegativeInf {
+		return true
+	}
+	if border.Inf == scoreNegativeInf || maxBorder.Inf == scorePositiveInf {
+		return false
+	}
+	return minValue > maxValue || (minValue == maxValue && (border.Exclude || maxBorder.Exclude))
+}
+
+var scorePositiveInfBorder = &ScoreBorder{
+	Inf: scorePositiveInf,
+}
+
+var scoreNegativeInfBorder = &ScoreBorder{
+	Inf: scoreNegativeInf,
+}
+
+// ParseScoreBorder creates ScoreBorder from redis arguments
+func ParseScoreBorder(s string) (Border, error) {
+	if s == "inf" || s == "+inf" {
+		return scorePositiveInfBorder, nil
+	}
+	if s == "-inf" {
+		return scoreNegativeInfBorder, nil
+	}
+	exclude := false
+	if len(s) > 0 && s[0] == '(' {
+		exclude = true
+		s = s[1:]
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(value) {
+		return nil, errors.New("ERR min or max is not a float")
+	}
+	if math.IsInf(value, 1) {
+		return scorePositiveInfBorder, nil
+	}
+	if math.IsInf(value, -1) {
+		return scoreNegativeInfBorder, nil
+	}
+	return &ScoreBorder{
+		Value:   value,
+		Exclude: exclude,
+	}, nil
+}
+
+/*
+ * LexBorder is a struct represents `min` `max` parameter of redis command `ZRANGEBYLEX`
+ * can accept:
+ *   inclusive value, such as [a
+ *   exclusive value, such as (a
+ *   infinity: -, +
+ */
+
+// LexBorder represents range of a member in lexicographical order
+// all members in the sorted set are expected to have the same score
+type LexBorder struct {
+	Inf     int8
+	Value   string
+	Exclude bool
+}
+
+func (border *LexBorder) less(element *Element) bool {
+	if border.Inf == lexNegativeInf {
+		return true
+	} else if border.Inf == lexPositiveInf {
+		return false
+	}
+	if border.Exclude {
+		return border.Value < element.Member
+	}
+	return border.Value <= element.Member
+}
+
+func (border *LexBorder) greater(element *Element) bool {
+	if border.Inf == lexNegativeInf {
+		return false
+	} else if border.Inf == lexPositiveInf {
+		return true
+	}
+	if border.Exclude {
+		return border.Value > element.Member
+	}
+	return border.Value >= element.Member
+}
+
+func (border *LexBorder) isIntersected(max Border) bool {
+	maxBorder, ok := max.(*LexBorder)
+	if !ok {
+		return true
+	}
+	if border.Inf == lexPositiveInf || maxBorder.Inf == lexNegativeInf {
+		return true
+	}
+	if border.Inf == lexNegativeInf || maxBorder.Inf == lexPositiveInf {
+		return false
+	}
+	return border.Value > maxBorder.Value ||
+		(border.Value == maxBorder.Value && (border.Exclude || maxBorder.Exclude))
+}
+
+// ParseLexBorder creates LexBorder from redis arguments
+func ParseLexBorder(s string) (Border, error) {
+	if s == "+" {
+		return &LexBorder{Inf: lexPositiveInf}, nil
+	}
+	if s == "-" {
+		return &LexBorder{Inf: lexNegativeInf}, nil
+	}
+	if len(s) == 0 || (s[0] != '(' && s[0] != '[') {
+		return nil, errors.New("ERR min or max not valid string range item")
+	}
+	return &LexBorder{
+		Value:   s[1:],
+		Exclude: s[0] == '(',
+	}, nil
+}
@@ -0,0 +1,341 @@
+package sortedset
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// checkSkiplist checks the order, backward pointers and spans of the skiplist
+func checkSkiplist(t *testing.T, sortedSet *SortedSet) {
+	t.Helper()
+	sl := sortedSet.skiplist
+	rank := make(map[*node]int64)
+	var prev *node
+	var i int64
+	for n := sl.header.level[0].forward; n != nil; n = n.level[0].forward {
+		i++
+		rank[n] = i
+		if n.backward != prev {
+			t.Fatalf("wrong backward of %s", n.Member)
+		}
+		if prev != nil && !prev.lessThan(n.Score, n.Member) {
+			t.Fatalf("%s(%v) is ordered after %s(%v)", prev.Member, prev.Score, n.Member, n.Score)
+		}
+		if element, ok := sortedSet.dict[n.Member]; !ok || element.Score != n.Score {
+			t.Fatalf("member %s(%v) is not in dict", n.Member, n.Score)
+		}
+		prev = n
+	}
+	if sl.tail != prev || sl.length != i || int64(len(sortedSet.dict)) != i {
+		t.Fatalf("expect length %d, got skiplist %d dict %d", i, sl.length, len(sortedSet.dict))
+	}
+	for level := int16(0); level < sl.level; level++ {
+		for n := sl.header; n.level[level].forward != nil; n = n.level[level].forward {
+			if n.level[level].span != rank[n.level[level].forward]-rank[n] {
+				t.Fatalf("wrong span at level %d after %q", level, n.Member)
+			}
+		}
+	}
+}
+
+// members joins the members of elements
+func members(elements []*Element) string {
+	result := make([]string, len(elements))
+	for i, element := range elements {
+		result[i] = element.Member
+	}
+	return strings.Join(result, ",")
+}
+
+func TestParseScoreBorder(t *testing.T) {
+	element := func(score float64) *Element {
+		return &Element{Score: score}
+	}
+	tests := []struct {
+		s string
+		// scores within and out of the border, used as min and as max
+		minIn, minOut []float64
+		maxIn, maxOut []float64
+		wantErr       bool
+	}{
+		{s: "1.5", minIn: []float64{1.5, 2}, minOut: []float64{1}, maxIn: []float64{1.5, 1}, maxOut: []float64{2}},
+		{s: "(1.5", minIn: []float64{2}, minOut: []float64{1.5}, maxIn: []float64{1}, maxOut: []float64{1.5}},
+		{s: "-inf", minIn: []float64{-1e308}, maxOut: []float64{-1e308}},
+		{s: "+inf", minOut: []float64{1e308}, maxIn: []float64{1e308}},
+		{s: "inf", minOut: []float64{1e308}, maxIn: []float64{1e308}},
+		{s: "(+inf", minOut: []float64{1e308}, maxIn: []float64{1e308}},
+		{s: "abc", wantErr: true},
+		{s: "(", wantErr: true},
+		{s: "nan", wantErr: true},
+		{s: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		border, err := ParseScoreBorder(tt.s)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expect error", tt.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.s, err)
+			continue
+		}
+		for _, score := range tt.minIn {
+			if !border.less(element(score)) {
+				t.Errorf("%q: expect %v within min border", tt.s, score)
+			}
+		}
+		for _, score := range tt.minOut {
+			if border.less(element(score)) {
+				t.Errorf("%q: expect %v out of min border", tt.s, score)
+			}
+		}
+		for _, score := range tt.maxIn {
+			if !border.greater(element(score)) {
+				t.Errorf("%q: expect %v within max border", tt.s, score)
+			}
+		}
+		for _, score := range tt.maxOut {
+			if border.greater(element(score)) {
+				t.Errorf("%q: expect %v out of max border", tt.s, score)
+			}
+		}
+	}
+}
+
+func TestBorderIsIntersected(t *testing.T) {
+	tests := []struct {
+		min, max string
+		lex      bool
+		empty    bool
+	}{
+		{min: "1", max: "2"},
+		{min: "1", max: "1"},
+		{min: "(1", max: "1", empty: true},
+		{min: "1", max: "(1", empty: true},
+		{min: "2", max: "1", empty: true},
+		{min: "-inf", max: "+inf"},
+		{min: "+inf", max: "+inf", empty: true},
+		{min: "-inf", max: "-inf", empty: true},
+		{min: "[a", max: "[b", lex: true},
+		{min: "[a", max: "[a", lex: true},
+		{min: "(a", max: "[a", lex: true, empty: true},
+		{min: "[b", max: "[a", lex: true, empty: true},
+		{min: "-", max: "+", lex: true},
+		{min: "+", max: "[a", lex: true, empty: true},
+		{min: "[a", max: "-", lex: true, empty: true},
+	}
+	for _, tt := range tests {
+		parse := ParseScoreBorder
+		if tt.lex {
+			parse = ParseLexBorder
+		}
+		min, err1 := parse(tt.min)
+		max, err2 := parse(tt.max)
+		if err1 != nil || err2 != nil {
+			t.Errorf("%s %s: %v %v", tt.min, tt.max, err1, err2)
+			continue
+		}
+		if min.isIntersected(max) != tt.empty {
+			t.Errorf("%s %s: expect empty %v", tt.min, tt.max, tt.empty)
+		}
+	}
+	for _, s := range []string{"", "a", "{a"} {
+		if _, err := ParseLexBorder(s); err == nil {
+			t.Errorf("%q: expect error", s)
+		}
+	}
+}
+
+func TestSortedSetRank(t *testing.T) {
+	sortedSet := Make()
+	for i := 0; i < 100; i++ {
+		// members with the same score are ordered by member
+		sortedSet.Add("m"+strconv.Itoa(99-i), float64(i/10))
+	}
+	checkSkiplist(t, sortedSet)
+	all := sortedSet.RangeByRank(0, 100, false)
+	for rank, element := range all {
+		if got := sortedSet.GetRank(element.Member, false); got != int64(rank) {
+			t.Fatalf("expect rank %d of %s, got %d", rank, element.Member, got)
+		}
+		if got := sortedSet.GetRank(element.Member, true); got != int64(99-rank) {
+			t.Fatalf("expect reverse rank %d of %s, got %d", 99-rank, element.Member, got)
+		}
+	}
+	if got := members(all[:3]); got != "m90,m91,m92" {
+		t.Fatalf("expect m90,m91,m92 first, got %s", got)
+	}
+	if got := members(sortedSet.RangeByRank(1, 3, true)); got != "m8,m7" {
+		t.Fatalf("expect m8,m7, got %s", got)
+	}
+	if sortedSet.GetRank("nope", false) != -1 {
+		t.Fatal("expect -1 for missing member")
+	}
+
+	// updating the score moves the member
+	if sortedSet.Add("m0", -1) {
+		t.Fatal("expect existing member updated")
+	}
+	if element, _ := sortedSet.Get("m0"); element.Score != -1 || sortedSet.GetRank("m0", false) != 0 {
+		t.Fatal("expect m0 ranked first after update")
+	}
+	checkSkiplist(t, sortedSet)
+}
+
+func TestSortedSetRange(t *testing.T) {
+	sortedSet := Make()
+	for i := 0; i < 10; i++ {
+		sortedSet.Add(string(rune('a'+i)), float64(i))
+	}
+	score := func(min, max string) (Border, Border) {
+		minBorder, _ := ParseScoreBorder(min)
+		maxBorder, _ := ParseScoreBorder(max)
+		return minBorder, maxBorder
+	}
+	tests := []struct {
+		min, max      string
+		offset, limit int64
+		desc          bool
+		want          string
+	}{
+		{"2", "4", 0, -1, false, "c,d,e"},
+		{"(2", "(4", 0, -1, false, "d"},
+		{"2", "4", 0, -1, true, "e,d,c"},
+		{"-inf", "+inf", 3, 2, false, "d,e"},
+		{"-inf", "+inf", 3, 2, true, "g,f"},
+		{"-inf", "(1", 0, -1, false, "a"},
+		{"8.5", "+inf", 0, -1, false, "j"},
+		{"(9", "+inf", 0, -1, false, ""},
+		{"3", "2", 0, -1, false, ""},
+		{"2", "4", 5, -1, false, ""},
+		{"2", "4", 0, 0, false, ""},
+		{"2", "4", -1, -1, false, ""},
+	}
+	for _, tt := range tests {
+		min, max := score(tt.min, tt.max)
+		got := members(sortedSet.Range(min, max, tt.offset, tt.limit, tt.desc))
+		if got != tt.want {
+			t.Errorf("%s %s offset %d limit %d desc %v: expect %q, got %q", tt.min, tt.max, tt.offset, tt.limit, tt.desc, tt.want, got)
+		}
+		if tt.offset == 0 && tt.limit < 0 {
+			count := int64(0)
+			if got != "" {
+				count = int64(strings.Count(got, ",") + 1)
+			}
+			if n := sortedSet.RangeCount(min, max); n != count {
+				t.Errorf("%s %s: expect count %d, got %d", tt.min, tt.max, count, n)
+			}
+		}
+	}
+
+	// lex ranges when all scores are the same
+	lexSet := Make()
+	for _, member := range []string{"a", "b", "c", "d", "e"} {
+		lexSet.Add(member, 0)
+	}
+	lex := func(min, max string) string {
+		minBorder, _ := ParseLexBorder(min)
+		maxBorder, _ := ParseLexBorder(max)
+		return members(lexSet.Range(minBorder, maxBorder, 0, -1, false))
+	}
+	if got := lex("[b", "(d"); got != "b,c" {
+		t.Errorf("expect b,c, got %s", got)
+	}
+	if got := lex("-", "[b"); got != "a,b" {
+		t.Errorf("expect a,b, got %s", got)
+	}
+	if got := lex("(d", "+"); got != "e" {
+		t.Errorf("expect e, got %s", got)
+	}
+}
+
+func TestSortedSetRemove(t *testing.T) {
+	sortedSet := Make()
+	for i := 0; i < 20; i++ {
+		sortedSet.Add("m"+strconv.Itoa(i), float64(i))
+	}
+	min, _ := ParseScoreBorder("(4")
+	max, _ := ParseScoreBorder("7")
+	if n := sortedSet.RemoveRange(min, max); n != 3 {
+		t.Fatalf("expect 3 removed, got %d", n)
+	}
+	checkSkiplist(t, sortedSet)
+	// removes rank [2, 5), which are m2, m3, m4
+	if n := sortedSet.RemoveByRank(2, 5); n != 3 {
+		t.Fatalf("expect 3 removed, got %d", n)
+	}
+	checkSkiplist(t, sortedSet)
+	if got := members(sortedSet.PopMin(2)); got != "m0,m1" {
+		t.Fatalf("expect m0,m1 popped, got %s", got)
+	}
+	if got := members(sortedSet.PopMax(2)); got != "m19,m18" {
+		t.Fatalf("expect m19,m18 popped, got %s", got)
+	}
+	checkSkiplist(t, sortedSet)
+	if got := members(sortedSet.RangeByRank(0, sortedSet.Len(), false)); got != "m8,m9,m10,m11,m12,m13,m14,m15,m16,m17" {
+		t.Fatalf("wrong members left: %s", got)
+	}
+	if got := members(sortedSet.PopMax(100)); got != "m17,m16,m15,m14,m13,m12,m11,m10,m9,m8" {
+		t.Fatalf("expect all popped, got %s", got)
+	}
+	if sortedSet.PopMin(1) != nil || sortedSet.Len() != 0 {
+		t.Fatal("expect empty set")
+	}
+	checkSkiplist(t, sortedSet)
+}
+
+func TestSortedSetRandomOps(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	sortedSet := Make()
+	want := make(map[string]float64)
+	for i := 0; i < 20000; i++ {
+		member := "m" + strconv.Itoa(r.Intn(500))
+		switch op := r.Intn(10); {
+		case op < 6:
+			score := float64(r.Intn(100))
+			_, exists := want[member]
+			if sortedSet.Add(member, score) == exists {
+				t.Fatalf("wrong Add result of %s", member)
+			}
+			want[member] = score
+		case op < 9:
+			_, exists := want[member]
+			if sortedSet.Remove(member) != exists {
+				t.Fatalf("wrong Remove result of %s", member)
+			}
+			delete(want, member)
+		default:
+			score := float64(r.Intn(100))
+			min := &ScoreBorder{Value: score}
+			max := &ScoreBorder{Value: score + 5, Exclude: true}
+			removed := sortedSet.RemoveRange(min, max)
+			var n int64
+			for member, s := range want {
+				if s >= score && s < score+5 {
+					delete(want, member)
+					n++
+				}
+			}
+			if removed != n {
+				t.Fatalf("expect %d removed in [%v, %v), got %d", n, score, score+5, removed)
+			}
+		}
+	}
+	checkSkiplist(t, sortedSet)
+	expected := make([]string, 0, len(want))
+	for member := range want {
+		expected = append(expected, member)
+	}
+	sort.Slice(expected, func(i, j int) bool {
+		a, b := expected[i], expected[j]
+		return want[a] < want[b] || (want[a] == want[b] && a < b)
+	})
+	if got := members(sortedSet.RangeByRank(0, sortedSet.Len(), false)); got != strings.Join(expected, ",") {
+		t.Fatalf("expect %s, got %s", strings.Join(expected, ","), got)
+	}
+}
@@ -2,4 +2,4 @@ module go-redis
 
 go 1.20
 
-require github.com/jolestar/go-commons-pool/v2 v2.1.2 // indirect
+require github.com/jolestar/go-commons-pool/v2 v2.1.2
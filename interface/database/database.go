@@ -1,6 +1,10 @@
 package database
 
-import "go-redis/interface/resp"
+import (
+	"go-redis/interface/resp"
+	"go-redis/rdb"
+	"time"
+)
 
 // CmdLine is alias for [][]byte, represents a command line
 type CmdLine = [][]byte
@@ -12,6 +16,15 @@ type Database interface {
 	Close()
 }
 
+// DBEngine is the storage engine exposing its data, used by aof rewrite to read a temporary database
+type DBEngine interface {
+	Database
+	// ForEach traverses keys of the given db with their data and expiration, expiration is nil if the key has no ttl
+	ForEach(dbIndex int, cb func(key string, data *DataEntity, expiration *time.Time) bool)
+	// LoadRDB loads the keys read by decoder, used by aof with rdb preamble
+	LoadRDB(decoder *rdb.Decoder) error
+}
+
 // DataEntity stores data bound to a key, including a string, list, hash, set and so on
 // 存储数据的结构体
 type DataEntity struct {
@@ -5,4 +5,21 @@ type Connection interface {
 	Write([]byte) error
 	GetDBIndex() int // used for multi database
 	SelectDB(int)
+
+	// used for `Auth` command
+	SetAuthenticated(bool)
+	IsAuthenticated() bool
+	// used for ACL, the user which the client runs commands as
+	SetUser(string)
+	GetUser() string
+
+	// used for `Multi` command
+	InMultiState() bool
+	SetMultiState(bool)
+	GetQueuedCmdLine() [][][]byte
+	EnqueueCmd([][]byte)
+	ClearQueuedCmds()
+	GetWatching() map[string]uint32
+	AddTxError(err error)
+	GetTxErrors() []error
 }
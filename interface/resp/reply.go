@@ -5,3 +5,16 @@ package resp
 type Reply interface {
 	ToBytes() []byte
 }
+
+// Resp3Reply is implemented by the replies encoded differently in RESP3, eg. map is encoded as array in RESP2
+type Resp3Reply interface {
+	Reply
+	ToBytes3() []byte
+}
+
+// AppendReply is implemented by the replies which can be marshaled into a buffer without allocating
+type AppendReply interface {
+	Reply
+	// AppendTo appends the reply in the given protocol version, 2 or 3, to buf and returns the extended buffer
+	AppendTo(buf []byte, protocol int) []byte
+}
@@ -0,0 +1,119 @@
+package lock
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collidingKeys returns n distinct keys which are spread to the same lock
+func collidingKeys(locks *Locks, n int) []string {
+	var keys []string
+	target := locks.spread(fnv32("0"))
+	for i := 0; len(keys) < n; i++ {
+		key := strconv.Itoa(i)
+		if locks.spread(fnv32(key)) == target {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func TestToLockIndices(t *testing.T) {
+	locks := Make(16)
+	keys := []string{"a", "b", "c", "d", "e", "f", "a", "b"}
+	keys = append(keys, collidingKeys(locks, 3)...)
+	for _, reverse := range []bool{false, true} {
+		indices := locks.toLockIndices(keys, reverse)
+		seen := make(map[uint32]struct{})
+		for i, index := range indices {
+			if _, ok := seen[index]; ok {
+				t.Fatalf("reverse %v: duplicated index %d in %v", reverse, index, indices)
+			}
+			seen[index] = struct{}{}
+			if i > 0 && (indices[i-1] < index) == reverse {
+				t.Fatalf("reverse %v: indices not sorted %v", reverse, indices)
+			}
+		}
+		for _, key := range keys {
+			if _, ok := seen[locks.spread(fnv32(key))]; !ok {
+				t.Fatalf("reverse %v: index of %s missing", reverse, key)
+			}
+		}
+	}
+}
+
+// TestRWLocksOverlapping locks the same key or keys sharing a lock for reading and writing, it must not deadlock
+func TestRWLocksOverlapping(t *testing.T) {
+	locks := Make(16)
+	colliding := collidingKeys(locks, 2)
+	tests := []struct {
+		name      string
+		writeKeys []string
+		readKeys  []string
+	}{
+		{"duplicated write keys", []string{"a", "a"}, nil},
+		{"duplicated read keys", nil, []string{"a", "a"}},
+		{"same key read and written", []string{"a"}, []string{"a", "b"}},
+		{"keys sharing lock read and written", colliding[:1], colliding[1:]},
+	}
+	for _, tt := range tests {
+		done := make(chan struct{})
+		go func() {
+			locks.RWLocks(tt.writeKeys, tt.readKeys)
+			locks.RWUnLocks(tt.writeKeys, tt.readKeys)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("%s: deadlock", tt.name)
+		}
+	}
+
+	// a lock shared by a write key and a read key is locked for writing
+	locks.RWLocks(colliding[:1], colliding[1:])
+	locked := make(chan struct{})
+	go func() {
+		locks.RLock(colliding[1])
+		locks.RUnLock(colliding[1])
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("expect the shared lock held for writing")
+	case <-time.After(50 * time.Millisecond):
+	}
+	locks.RWUnLocks(colliding[:1], colliding[1:])
+	<-locked
+}
+
+// TestRWLocksConcurrent locks keys in different orders from many goroutines, the sorted order prevents deadlock
+func TestRWLocksConcurrent(t *testing.T) {
+	locks := Make(16)
+	keys := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	counter := 0
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				// write keys[g] and read the others in the reversed order
+				writeKeys := []string{keys[g], "counter"}
+				readKeys := make([]string, 0, len(keys))
+				for j := len(keys) - 1; j >= 0; j-- {
+					readKeys = append(readKeys, keys[(g+j)%len(keys)])
+				}
+				locks.RWLocks(writeKeys, readKeys)
+				counter++
+				locks.RWUnLocks(writeKeys, readKeys)
+			}
+		}(g)
+	}
+	wg.Wait()
+	if counter != 8000 {
+		t.Fatalf("expect 8000, got %d", counter)
+	}
+}
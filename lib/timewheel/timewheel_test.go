@@ -0,0 +1,59 @@
+package timewheel
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestNeverEarly checks the jobs never run before their delay, including the delays longer than a round of the wheel
+func TestNeverEarly(t *testing.T) {
+	tw := New(10*time.Millisecond, 10)
+	tw.Start()
+	defer tw.Stop()
+
+	delays := []time.Duration{0, time.Millisecond, 15 * time.Millisecond, 25 * time.Millisecond,
+		99 * time.Millisecond, 100 * time.Millisecond, 101 * time.Millisecond, 255 * time.Millisecond}
+	var wg sync.WaitGroup
+	for i, delay := range delays {
+		wg.Add(1)
+		delay := delay
+		start := time.Now()
+		tw.AddJob(delay, strconv.Itoa(i), func() {
+			defer wg.Done()
+			if elapsed := time.Since(start); elapsed < delay {
+				t.Errorf("delay %s: job runs after %s", delay, elapsed)
+			} else if elapsed > delay+200*time.Millisecond {
+				t.Errorf("delay %s: job runs too late after %s", delay, elapsed)
+			}
+		})
+	}
+	wg.Wait()
+}
+
+func TestRemoveAndReplace(t *testing.T) {
+	tw := New(10*time.Millisecond, 10)
+	tw.Start()
+	defer tw.Stop()
+
+	ran := make(chan string, 3)
+	tw.AddJob(20*time.Millisecond, "removed", func() { ran <- "removed" })
+	tw.RemoveJob("removed")
+	tw.AddJob(20*time.Millisecond, "replaced", func() { ran <- "old" })
+	tw.AddJob(30*time.Millisecond, "replaced", func() { ran <- "new" })
+
+	select {
+	case got := <-ran:
+		if got != "new" {
+			t.Fatalf("expect new job, got %s", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("job not run")
+	}
+	select {
+	case got := <-ran:
+		t.Fatalf("unexpected job %s", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
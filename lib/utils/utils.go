@@ -19,6 +19,17 @@ func ToCmdLine2(commandName string, args ...[]byte) [][]byte {
 	return result
 }
 
+// CopyCmdLine copies each argument of the command line into its own memory
+func CopyCmdLine(cmdLine [][]byte) [][]byte {
+	result := make([][]byte, len(cmdLine))
+	for i, arg := range cmdLine {
+		if arg != nil {
+			result[i] = append(make([]byte, 0, len(arg)), arg...)
+		}
+	}
+	return result
+}
+
 // BytesEquals check whether the given bytes is equal
 func BytesEquals(a []byte, b []byte) bool {
 	if (a == nil && b != nil) || (a != nil && b == nil) {
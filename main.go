@@ -11,11 +11,6 @@ import (
 
 const configFile string = "redis.conf"
 
-var defaultProperties = &config.ServerProperties{
-	Bind: "0.0.0.0",
-	Port: 6379,
-}
-
 func fileExists(filename string) bool {
 	info, err := os.Stat(filename)
 	return err == nil && !info.IsDir()
@@ -29,10 +24,9 @@ func main() {
 		TimeFormat: "2006-01-02",
 	})
 
+	// config.Properties holds the default config if the config file doesn't exist
 	if fileExists(configFile) {
 		config.SetupConfig(configFile)
-	} else {
-		config.Properties = defaultProperties
 	}
 
 	err := tcp.ListenAndServeWithSignal(
@@ -40,6 +34,7 @@ func main() {
 			Address: fmt.Sprintf("%s:%d",
 				config.Properties.Bind,
 				config.Properties.Port),
+			MaxConnect: uint32(config.Properties.MaxClients),
 		},
 		handler.MakeHandler())
 	if err != nil {
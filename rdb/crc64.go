@@ -0,0 +1,12 @@
+package rdb
+
+import "hash/crc64"
+
+// redis uses crc-64-jones: reflected polynomial 0xad93d23594c935a9, initial value 0 and no final xor
+var crcTable = crc64.MakeTable(0x95ac9329ac4bc9b5)
+
+// crc64Update updates the checksum with p
+// crc64.Update inverts the value before and after computing, invert them back to match redis
+func crc64Update(crc uint64, p []byte) uint64 {
+	return ^crc64.Update(^crc, crcTable, p)
+}
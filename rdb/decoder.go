@@ -0,0 +1,495 @@
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// lengths in a corrupted file may be huge, the decoder allocates at most maxPrealloc bytes or entries
+// before reading the data, so that it fails with unexpected EOF instead of allocating huge memory
+const maxPrealloc = 1024 * 1024
+
+// Decoder reads rdb file
+type Decoder struct {
+	reader  *bufio.Reader
+	crc     uint64
+	version int
+	buf     []byte
+	// offset is the number of bytes consumed
+	offset int64
+}
+
+// NewDecoder creates a decoder reading from reader
+func NewDecoder(reader io.Reader) *Decoder {
+	return &Decoder{
+		reader: bufio.NewReader(reader),
+		buf:    make([]byte, 8),
+	}
+}
+
+func (dec *Decoder) readFull(p []byte) error {
+	_, err := io.ReadFull(dec.reader, p)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	dec.offset += int64(len(p))
+	dec.crc = crc64Update(dec.crc, p)
+	return nil
+}
+
+// Offset returns the number of bytes consumed by Parse, it is the size of the rdb after Parse succeeded
+func (dec *Decoder) Offset() int64 {
+	return dec.offset
+}
+
+// readBytes reads a string of the given length, the buffer doubles as the data arrives
+func (dec *Decoder) readBytes(length uint64) ([]byte, error) {
+	if length <= maxPrealloc {
+		buf := make([]byte, length)
+		if err := dec.readFull(buf); err != nil {
+			return nil, err
+		}
+		return buf, nil
+	}
+	buf := make([]byte, 0, maxPrealloc)
+	for uint64(len(buf)) < length {
+		if len(buf) == cap(buf) {
+			newCap := 2 * uint64(cap(buf))
+			if newCap > length {
+				newCap = length
+			}
+			grown := make([]byte, len(buf), newCap)
+			copy(grown, buf)
+			buf = grown
+		}
+		if err := dec.readFull(buf[len(buf):cap(buf)]); err != nil {
+			return nil, err
+		}
+		buf = buf[:cap(buf)]
+	}
+	return buf, nil
+}
+
+func (dec *Decoder) readByte() (byte, error) {
+	err := dec.readFull(dec.buf[:1])
+	return dec.buf[0], err
+}
+
+// Parse reads the whole rdb file and calls cb for each key-value pair, stops if cb returns false
+func (dec *Decoder) Parse(cb func(o Object) bool) error {
+	header := make([]byte, 9)
+	if err := dec.readFull(header); err != nil {
+		return err
+	}
+	if string(header[:5]) != Magic {
+		return errors.New("file is not a rdb file")
+	}
+	version, err := strconv.Atoi(string(header[5:]))
+	if err != nil {
+		return errors.New("illegal rdb version " + string(header[5:]))
+	}
+	dec.version = version
+
+	dbIndex := 0
+	var expiration *time.Time
+	for {
+		opCode, err := dec.readByte()
+		if err != nil {
+			return err
+		}
+		switch opCode {
+		case opCodeEOF:
+			return dec.verifyChecksum()
+		case opCodeSelectDB:
+			index, _, err := dec.readLength()
+			if err != nil {
+				return err
+			}
+			dbIndex = int(index)
+		case opCodeResizeDB:
+			if _, _, err = dec.readLength(); err != nil {
+				return err
+			}
+			if _, _, err = dec.readLength(); err != nil {
+				return err
+			}
+		case opCodeAux:
+			if _, err = dec.readString(); err != nil {
+				return err
+			}
+			if _, err = dec.readString(); err != nil {
+				return err
+			}
+		case opCodeExpireTimeMs:
+			if err = dec.readFull(dec.buf[:8]); err != nil {
+				return err
+			}
+			ms := int64(binary.LittleEndian.Uint64(dec.buf[:8]))
+			t := time.Unix(0, ms*int64(time.Millisecond))
+			expiration = &t
+		case opCodeExpireTime:
+			if err = dec.readFull(dec.buf[:4]); err != nil {
+				return err
+			}
+			t := time.Unix(int64(binary.LittleEndian.Uint32(dec.buf[:4])), 0)
+			expiration = &t
+		case opCodeFreq:
+			if _, err = dec.readByte(); err != nil {
+				return err
+			}
+		case opCodeIdle:
+			if _, _, err = dec.readLength(); err != nil {
+				return err
+			}
+		case opCodeFunction2:
+			// functions are not supported, skip the library code
+			if _, err = dec.readString(); err != nil {
+				return err
+			}
+		case opCodeFunction, opCodeModuleAux:
+			return fmt.Errorf("unsupported rdb op code %d", opCode)
+		default:
+			key, err := dec.readString()
+			if err != nil {
+				return err
+			}
+			base := &BaseObject{
+				DB:         dbIndex,
+				Key:        string(key),
+				Expiration: expiration,
+			}
+			expiration = nil
+			obj, err := dec.readObject(opCode, base)
+			if err != nil {
+				return fmt.Errorf("read key %s failed: %w", key, err)
+			}
+			if !cb(obj) {
+				return nil
+			}
+		}
+	}
+}
+
+func (dec *Decoder) verifyChecksum() error {
+	if dec.version < 5 {
+		return nil
+	}
+	expected := dec.crc
+	if _, err := io.ReadFull(dec.reader, dec.buf[:8]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	dec.offset += 8
+	checksum := binary.LittleEndian.Uint64(dec.buf[:8])
+	// checksum 0 means redis was configured not to compute it
+	if checksum != 0 && checksum != expected {
+		return errors.New("rdb checksum mismatch")
+	}
+	return nil
+}
+
+func (dec *Decoder) readObject(valueType byte, base *BaseObject) (Object, error) {
+	switch valueType {
+	case typeString:
+		value, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		return &StringObject{BaseObject: base, Value: value}, nil
+	case typeList, typeSet:
+		values, err := dec.readStringSlice()
+		if err != nil {
+			return nil, err
+		}
+		if valueType == typeList {
+			return &ListObject{BaseObject: base, Values: values}, nil
+		}
+		return &SetObject{BaseObject: base, Members: values}, nil
+	case typeZSet, typeZSet2:
+		return dec.readZSet(valueType, base)
+	case typeHash:
+		size, _, err := dec.readLength()
+		if err != nil {
+			return nil, err
+		}
+		obj := &HashObject{BaseObject: base}
+		for i := uint64(0); i < size; i++ {
+			field, err := dec.readString()
+			if err != nil {
+				return nil, err
+			}
+			value, err := dec.readString()
+			if err != nil {
+				return nil, err
+			}
+			obj.Fields = append(obj.Fields, string(field))
+			obj.Values = append(obj.Values, value)
+		}
+		return obj, nil
+	case typeSetIntSet:
+		raw, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		members, err := parseIntSet(raw)
+		if err != nil {
+			return nil, err
+		}
+		return &SetObject{BaseObject: base, Members: members}, nil
+	case typeListZipList, typeHashZipList, typeZSetZipList,
+		typeHashListPack, typeZSetListPack, typeSetListPack:
+		raw, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		var entries [][]byte
+		if valueType == typeListZipList || valueType == typeHashZipList || valueType == typeZSetZipList {
+			entries, err = parseZipList(raw)
+		} else {
+			entries, err = parseListPack(raw)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return makeObjectFromEntries(valueType, base, entries)
+	case typeListQuickList, typeListQuickList2:
+		return dec.readQuickList(valueType, base)
+	}
+	return nil, fmt.Errorf("unsupported rdb value type %d", valueType)
+}
+
+// makeObjectFromEntries builds object from the entries of ziplist or listpack
+func makeObjectFromEntries(valueType byte, base *BaseObject, entries [][]byte) (Object, error) {
+	switch valueType {
+	case typeListZipList:
+		return &ListObject{BaseObject: base, Values: entries}, nil
+	case typeSetListPack:
+		return &SetObject{BaseObject: base, Members: entries}, nil
+	case typeHashZipList, typeHashListPack:
+		if len(entries)%2 != 0 {
+			return nil, errors.New("odd number of entries in hash")
+		}
+		obj := &HashObject{BaseObject: base}
+		for i := 0; i < len(entries); i += 2 {
+			obj.Fields = append(obj.Fields, string(entries[i]))
+			obj.Values = append(obj.Values, entries[i+1])
+		}
+		return obj, nil
+	case typeZSetZipList, typeZSetListPack:
+		if len(entries)%2 != 0 {
+			return nil, errors.New("odd number of entries in sorted set")
+		}
+		obj := &ZSetObject{BaseObject: base}
+		for i := 0; i < len(entries); i += 2 {
+			score, err := strconv.ParseFloat(string(entries[i+1]), 64)
+			if err != nil {
+				return nil, err
+			}
+			obj.Entries = append(obj.Entries, &ZSetEntry{Member: string(entries[i]), Score: score})
+		}
+		return obj, nil
+	}
+	return nil, fmt.Errorf("unsupported rdb value type %d", valueType)
+}
+
+func (dec *Decoder) readQuickList(valueType byte, base *BaseObject) (Object, error) {
+	size, _, err := dec.readLength()
+	if err != nil {
+		return nil, err
+	}
+	obj := &ListObject{BaseObject: base}
+	for i := uint64(0); i < size; i++ {
+		container := uint64(2) // packed
+		if valueType == typeListQuickList2 {
+			container, _, err = dec.readLength()
+			if err != nil {
+				return nil, err
+			}
+		}
+		raw, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		if container == 1 {
+			// plain node holds a single large element
+			obj.Values = append(obj.Values, raw)
+			continue
+		}
+		var entries [][]byte
+		if valueType == typeListQuickList {
+			entries, err = parseZipList(raw)
+		} else {
+			entries, err = parseListPack(raw)
+		}
+		if err != nil {
+			return nil, err
+		}
+		obj.Values = append(obj.Values, entries...)
+	}
+	return obj, nil
+}
+
+func (dec *Decoder) readZSet(valueType byte, base *BaseObject) (Object, error) {
+	size, _, err := dec.readLength()
+	if err != nil {
+		return nil, err
+	}
+	obj := &ZSetObject{BaseObject: base}
+	for i := uint64(0); i < size; i++ {
+		member, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		var score float64
+		if valueType == typeZSet2 {
+			if err = dec.readFull(dec.buf[:8]); err != nil {
+				return nil, err
+			}
+			score = math.Float64frombits(binary.LittleEndian.Uint64(dec.buf[:8]))
+		} else {
+			score, err = dec.readStringDouble()
+			if err != nil {
+				return nil, err
+			}
+		}
+		obj.Entries = append(obj.Entries, &ZSetEntry{Member: string(member), Score: score})
+	}
+	return obj, nil
+}
+
+// readStringDouble reads score of zset in rdb version < 8
+func (dec *Decoder) readStringDouble() (float64, error) {
+	length, err := dec.readByte()
+	if err != nil {
+		return 0, err
+	}
+	switch length {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+	buf := make([]byte, length)
+	if err = dec.readFull(buf); err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(string(buf), 64)
+}
+
+func (dec *Decoder) readStringSlice() ([][]byte, error) {
+	size, _, err := dec.readLength()
+	if err != nil {
+		return nil, err
+	}
+	capacity := size
+	if capacity > maxPrealloc {
+		capacity = maxPrealloc
+	}
+	values := make([][]byte, 0, capacity)
+	for i := uint64(0); i < size; i++ {
+		value, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// readLength reads length encoding, special is true if the value is the type of an encoded string
+func (dec *Decoder) readLength() (length uint64, special bool, err error) {
+	first, err := dec.readByte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch first >> 6 {
+	case 0:
+		return uint64(first & 0x3f), false, nil
+	case 1:
+		next, err := dec.readByte()
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(first&0x3f)<<8 | uint64(next), false, nil
+	case 2:
+		if first == 0x80 {
+			if err = dec.readFull(dec.buf[:4]); err != nil {
+				return 0, false, err
+			}
+			return uint64(binary.BigEndian.Uint32(dec.buf[:4])), false, nil
+		}
+		if first == 0x81 {
+			if err = dec.readFull(dec.buf[:8]); err != nil {
+				return 0, false, err
+			}
+			return binary.BigEndian.Uint64(dec.buf[:8]), false, nil
+		}
+		return 0, false, fmt.Errorf("illegal length encoding %x", first)
+	}
+	return uint64(first & 0x3f), true, nil
+}
+
+// string encodings
+const (
+	encodeInt8  = 0
+	encodeInt16 = 1
+	encodeInt32 = 2
+	encodeLZF   = 3
+)
+
+// readString reads string, which may be encoded as integer or compressed by lzf
+func (dec *Decoder) readString() ([]byte, error) {
+	length, special, err := dec.readLength()
+	if err != nil {
+		return nil, err
+	}
+	if !special {
+		return dec.readBytes(length)
+	}
+	switch length {
+	case encodeInt8:
+		b, err := dec.readByte()
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strconv.Itoa(int(int8(b)))), nil
+	case encodeInt16:
+		if err = dec.readFull(dec.buf[:2]); err != nil {
+			return nil, err
+		}
+		return []byte(strconv.Itoa(int(int16(binary.LittleEndian.Uint16(dec.buf[:2]))))), nil
+	case encodeInt32:
+		if err = dec.readFull(dec.buf[:4]); err != nil {
+			return nil, err
+		}
+		return []byte(strconv.Itoa(int(int32(binary.LittleEndian.Uint32(dec.buf[:4]))))), nil
+	case encodeLZF:
+		inLen, _, err := dec.readLength()
+		if err != nil {
+			return nil, err
+		}
+		outLen, _, err := dec.readLength()
+		if err != nil {
+			return nil, err
+		}
+		in, err := dec.readBytes(inLen)
+		if err != nil {
+			return nil, err
+		}
+		return lzfDecompress(in, outLen)
+	}
+	return nil, fmt.Errorf("unknown string encoding %d", length)
+}
@@ -0,0 +1,206 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Encoder writes rdb file
+// 写入顺序：WriteHeader -> WriteAux -> (WriteDBHeader -> Write*Object ...) -> WriteEnd
+type Encoder struct {
+	writer io.Writer
+	crc    uint64
+	buf    []byte
+}
+
+// NewEncoder creates an encoder writing to writer
+func NewEncoder(writer io.Writer) *Encoder {
+	return &Encoder{
+		writer: writer,
+		buf:    make([]byte, 9),
+	}
+}
+
+func (enc *Encoder) write(p []byte) error {
+	_, err := enc.writer.Write(p)
+	if err != nil {
+		return err
+	}
+	enc.crc = crc64Update(enc.crc, p)
+	return nil
+}
+
+// WriteHeader writes magic and version
+func (enc *Encoder) WriteHeader() error {
+	return enc.write([]byte(Magic + "000" + strconv.Itoa(Version)))
+}
+
+// WriteAux writes an auxiliary field, eg. redis-ver
+func (enc *Encoder) WriteAux(key string, value string) error {
+	if err := enc.write([]byte{opCodeAux}); err != nil {
+		return err
+	}
+	if err := enc.writeString(key); err != nil {
+		return err
+	}
+	return enc.writeString(value)
+}
+
+// WriteDBHeader selects db and writes the size hint of it
+func (enc *Encoder) WriteDBHeader(dbIndex uint, keyCount uint64, ttlCount uint64) error {
+	if err := enc.write([]byte{opCodeSelectDB}); err != nil {
+		return err
+	}
+	if err := enc.writeLength(uint64(dbIndex)); err != nil {
+		return err
+	}
+	if err := enc.write([]byte{opCodeResizeDB}); err != nil {
+		return err
+	}
+	if err := enc.writeLength(keyCount); err != nil {
+		return err
+	}
+	return enc.writeLength(ttlCount)
+}
+
+// WriteEnd writes EOF and checksum
+func (enc *Encoder) WriteEnd() error {
+	if err := enc.write([]byte{opCodeEOF}); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint64(enc.buf, enc.crc)
+	_, err := enc.writer.Write(enc.buf[:8])
+	return err
+}
+
+// writeObjectHeader writes expiration, value type and key
+func (enc *Encoder) writeObjectHeader(key string, valueType byte, expiration *time.Time) error {
+	if expiration != nil {
+		enc.buf[0] = opCodeExpireTimeMs
+		binary.LittleEndian.PutUint64(enc.buf[1:], uint64(expiration.UnixNano()/int64(time.Millisecond)))
+		if err := enc.write(enc.buf[:9]); err != nil {
+			return err
+		}
+	}
+	if err := enc.write([]byte{valueType}); err != nil {
+		return err
+	}
+	return enc.writeString(key)
+}
+
+// WriteStringObject writes a string value
+func (enc *Encoder) WriteStringObject(key string, value []byte, expiration *time.Time) error {
+	if err := enc.writeObjectHeader(key, typeString, expiration); err != nil {
+		return err
+	}
+	return enc.writeBytes(value)
+}
+
+// WriteListObject writes elements of a list
+func (enc *Encoder) WriteListObject(key string, values [][]byte, expiration *time.Time) error {
+	if err := enc.writeObjectHeader(key, typeList, expiration); err != nil {
+		return err
+	}
+	return enc.writeBytesSlice(values)
+}
+
+// WriteSetObject writes members of a set
+func (enc *Encoder) WriteSetObject(key string, members [][]byte, expiration *time.Time) error {
+	if err := enc.writeObjectHeader(key, typeSet, expiration); err != nil {
+		return err
+	}
+	return enc.writeBytesSlice(members)
+}
+
+// WriteHashObject writes fields of a hash, fields and values must have the same length
+func (enc *Encoder) WriteHashObject(key string, fields []string, values [][]byte, expiration *time.Time) error {
+	if len(fields) != len(values) {
+		return errors.New("fields and values of hash must have the same length")
+	}
+	if err := enc.writeObjectHeader(key, typeHash, expiration); err != nil {
+		return err
+	}
+	if err := enc.writeLength(uint64(len(fields))); err != nil {
+		return err
+	}
+	for i, field := range fields {
+		if err := enc.writeString(field); err != nil {
+			return err
+		}
+		if err := enc.writeBytes(values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteZSetObject writes members of a sorted set
+func (enc *Encoder) WriteZSetObject(key string, entries []*ZSetEntry, expiration *time.Time) error {
+	if err := enc.writeObjectHeader(key, typeZSet2, expiration); err != nil {
+		return err
+	}
+	if err := enc.writeLength(uint64(len(entries))); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := enc.writeString(entry.Member); err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint64(enc.buf, math.Float64bits(entry.Score))
+		if err := enc.write(enc.buf[:8]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (enc *Encoder) writeBytesSlice(values [][]byte) error {
+	if err := enc.writeLength(uint64(len(values))); err != nil {
+		return err
+	}
+	for _, value := range values {
+		if err := enc.writeBytes(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeLength writes length encoding
+func (enc *Encoder) writeLength(length uint64) error {
+	var n int
+	switch {
+	case length < 1<<6:
+		enc.buf[0] = byte(length)
+		n = 1
+	case length < 1<<14:
+		enc.buf[0] = byte(length>>8) | 0x40
+		enc.buf[1] = byte(length)
+		n = 2
+	case length <= math.MaxUint32:
+		enc.buf[0] = 0x80
+		binary.BigEndian.PutUint32(enc.buf[1:], uint32(length))
+		n = 5
+	default:
+		enc.buf[0] = 0x81
+		binary.BigEndian.PutUint64(enc.buf[1:], length)
+		n = 9
+	}
+	return enc.write(enc.buf[:n])
+}
+
+func (enc *Encoder) writeString(s string) error {
+	return enc.writeBytes([]byte(s))
+}
+
+// writeBytes writes length prefixed string
+func (enc *Encoder) writeBytes(b []byte) error {
+	if err := enc.writeLength(uint64(len(b))); err != nil {
+		return err
+	}
+	return enc.write(b)
+}
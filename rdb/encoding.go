@@ -0,0 +1,237 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+// decoders of the compact encodings used by redis: intset, ziplist and listpack
+
+var errCorruptEncoding = errors.New("corrupt compact encoding")
+
+// parseIntSet parses intset: encoding(4 bytes) length(4 bytes) contents, little endian
+func parseIntSet(buf []byte) ([][]byte, error) {
+	if len(buf) < 8 {
+		return nil, errCorruptEncoding
+	}
+	width := int(binary.LittleEndian.Uint32(buf[0:4]))
+	size := int(binary.LittleEndian.Uint32(buf[4:8]))
+	if (width != 2 && width != 4 && width != 8) || len(buf) < 8+width*size {
+		return nil, errCorruptEncoding
+	}
+	members := make([][]byte, 0, size)
+	for i := 0; i < size; i++ {
+		p := buf[8+i*width:]
+		var v int64
+		switch width {
+		case 2:
+			v = int64(int16(binary.LittleEndian.Uint16(p)))
+		case 4:
+			v = int64(int32(binary.LittleEndian.Uint32(p)))
+		case 8:
+			v = int64(binary.LittleEndian.Uint64(p))
+		}
+		members = append(members, []byte(strconv.FormatInt(v, 10)))
+	}
+	return members, nil
+}
+
+// parseZipList parses ziplist: zlbytes(4) zltail(4) zllen(2) entries... end(0xff)
+func parseZipList(buf []byte) ([][]byte, error) {
+	if len(buf) < 11 {
+		return nil, errCorruptEncoding
+	}
+	entries := make([][]byte, 0, binary.LittleEndian.Uint16(buf[8:10]))
+	pos := 10
+	for {
+		if pos >= len(buf) {
+			return nil, errCorruptEncoding
+		}
+		if buf[pos] == 0xff {
+			return entries, nil
+		}
+		// skip prevlen
+		if buf[pos] == 0xfe {
+			pos += 5
+		} else {
+			pos++
+		}
+		if pos >= len(buf) {
+			return nil, errCorruptEncoding
+		}
+		entry, n, err := parseZipListEntry(buf[pos:])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+		pos += n
+	}
+}
+
+// parseZipListEntry parses encoding and content of an entry, returns the entry and bytes consumed
+func parseZipListEntry(buf []byte) ([]byte, int, error) {
+	header := buf[0]
+	var length, headerLen int
+	switch header >> 6 {
+	case 0:
+		length, headerLen = int(header&0x3f), 1
+	case 1:
+		if len(buf) < 2 {
+			return nil, 0, errCorruptEncoding
+		}
+		length, headerLen = int(header&0x3f)<<8|int(buf[1]), 2
+	case 2:
+		if len(buf) < 5 {
+			return nil, 0, errCorruptEncoding
+		}
+		length, headerLen = int(binary.BigEndian.Uint32(buf[1:5])), 5
+	default:
+		return parseZipListInt(buf)
+	}
+	if len(buf) < headerLen+length {
+		return nil, 0, errCorruptEncoding
+	}
+	return buf[headerLen : headerLen+length], headerLen + length, nil
+}
+
+func parseZipListInt(buf []byte) ([]byte, int, error) {
+	header := buf[0]
+	var v int64
+	var size int
+	switch {
+	case header == 0xc0:
+		size = 2
+	case header == 0xd0:
+		size = 4
+	case header == 0xe0:
+		size = 8
+	case header == 0xf0:
+		size = 3
+	case header == 0xfe:
+		size = 1
+	case header >= 0xf1 && header <= 0xfd:
+		// immediate value 0 to 12
+		return []byte(strconv.Itoa(int(header&0x0f) - 1)), 1, nil
+	default:
+		return nil, 0, errCorruptEncoding
+	}
+	if len(buf) < 1+size {
+		return nil, 0, errCorruptEncoding
+	}
+	p := buf[1:]
+	switch size {
+	case 1:
+		v = int64(int8(p[0]))
+	case 2:
+		v = int64(int16(binary.LittleEndian.Uint16(p)))
+	case 3:
+		v = int64(int32(uint32(p[0])<<8|uint32(p[1])<<16|uint32(p[2])<<24) >> 8)
+	case 4:
+		v = int64(int32(binary.LittleEndian.Uint32(p)))
+	case 8:
+		v = int64(binary.LittleEndian.Uint64(p))
+	}
+	return []byte(strconv.FormatInt(v, 10)), 1 + size, nil
+}
+
+// parseListPack parses listpack: total bytes(4) num elements(2) entries... end(0xff)
+// each entry is encoding, content and backlen
+func parseListPack(buf []byte) ([][]byte, error) {
+	if len(buf) < 7 {
+		return nil, errCorruptEncoding
+	}
+	entries := make([][]byte, 0, binary.LittleEndian.Uint16(buf[4:6]))
+	pos := 6
+	for {
+		if pos >= len(buf) {
+			return nil, errCorruptEncoding
+		}
+		if buf[pos] == 0xff {
+			return entries, nil
+		}
+		entry, n, err := parseListPackEntry(buf[pos:])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+		pos += n + listPackBackLen(n)
+	}
+}
+
+// parseListPackEntry returns entry and the length of encoding and content
+func parseListPackEntry(buf []byte) ([]byte, int, error) {
+	header := buf[0]
+	need := func(n int) error {
+		if len(buf) < n {
+			return errCorruptEncoding
+		}
+		return nil
+	}
+	switch {
+	case header>>7 == 0: // 7 bit unsigned int
+		return []byte(strconv.Itoa(int(header))), 1, nil
+	case header>>6 == 2: // 6 bit string length
+		length := int(header & 0x3f)
+		if err := need(1 + length); err != nil {
+			return nil, 0, err
+		}
+		return buf[1 : 1+length], 1 + length, nil
+	case header>>5 == 6: // 13 bit signed int
+		if err := need(2); err != nil {
+			return nil, 0, err
+		}
+		v := int(header&0x1f)<<8 | int(buf[1])
+		if v >= 1<<12 {
+			v -= 1 << 13
+		}
+		return []byte(strconv.Itoa(v)), 2, nil
+	case header>>4 == 14: // 12 bit string length
+		if err := need(2); err != nil {
+			return nil, 0, err
+		}
+		length := int(header&0x0f)<<8 | int(buf[1])
+		if err := need(2 + length); err != nil {
+			return nil, 0, err
+		}
+		return buf[2 : 2+length], 2 + length, nil
+	case header == 0xf0: // 32 bit string length
+		if err := need(5); err != nil {
+			return nil, 0, err
+		}
+		length := int(binary.LittleEndian.Uint32(buf[1:5]))
+		if err := need(5 + length); err != nil {
+			return nil, 0, err
+		}
+		return buf[5 : 5+length], 5 + length, nil
+	case header >= 0xf1 && header <= 0xf4:
+		size := map[byte]int{0xf1: 2, 0xf2: 3, 0xf3: 4, 0xf4: 8}[header]
+		if err := need(1 + size); err != nil {
+			return nil, 0, err
+		}
+		var u uint64
+		for i := size - 1; i >= 0; i-- {
+			u = u<<8 | uint64(buf[1+i])
+		}
+		// sign extend
+		shift := uint(64 - size*8)
+		v := int64(u<<shift) >> shift
+		return []byte(strconv.FormatInt(v, 10)), 1 + size, nil
+	}
+	return nil, 0, errCorruptEncoding
+}
+
+// listPackBackLen returns the size of backlen field for an entry of the given length
+func listPackBackLen(entryLen int) int {
+	switch {
+	case entryLen <= 127:
+		return 1
+	case entryLen < 16383:
+		return 2
+	case entryLen < 2097151:
+		return 3
+	case entryLen < 268435455:
+		return 4
+	}
+	return 5
+}
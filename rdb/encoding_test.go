@@ -0,0 +1,434 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// zipList builds a ziplist of raw entries, each of which is encoding and content
+func zipList(entries ...[]byte) []byte {
+	buf := make([]byte, 10)
+	prevLen := 0
+	for _, entry := range entries {
+		if prevLen < 254 {
+			buf = append(buf, byte(prevLen))
+		} else {
+			buf = append(buf, 0xfe, 0, 0, 0, 0)
+			binary.LittleEndian.PutUint32(buf[len(buf)-4:], uint32(prevLen))
+		}
+		start := len(buf)
+		buf = append(buf, entry...)
+		prevLen = len(buf) - start + 1
+		if prevLen > 254 {
+			prevLen += 4
+		}
+	}
+	buf = append(buf, 0xff)
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(buf)))
+	binary.LittleEndian.PutUint16(buf[8:10], uint16(len(entries)))
+	return buf
+}
+
+// zipStr encodes s as a ziplist entry
+func zipStr(s string) []byte {
+	switch {
+	case len(s) < 1<<6:
+		return append([]byte{byte(len(s))}, s...)
+	case len(s) < 1<<14:
+		return append([]byte{byte(len(s)>>8) | 0x40, byte(len(s))}, s...)
+	}
+	header := []byte{0x80, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(header[1:], uint32(len(s)))
+	return append(header, s...)
+}
+
+// listPack builds a listpack of raw entries, each of which is encoding and content
+func listPack(entries ...[]byte) []byte {
+	buf := make([]byte, 6)
+	for _, entry := range entries {
+		buf = append(buf, entry...)
+		// backlen is stored big endian in 7 bit groups, the high bit marks all but the first byte
+		n := len(entry)
+		var backLen []byte
+		for {
+			backLen = append([]byte{byte(n & 127)}, backLen...)
+			n >>= 7
+			if n == 0 {
+				break
+			}
+		}
+		for i := 1; i < len(backLen); i++ {
+			backLen[i] |= 128
+		}
+		buf = append(buf, backLen...)
+	}
+	buf = append(buf, 0xff)
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(buf)))
+	binary.LittleEndian.PutUint16(buf[4:6], uint16(len(entries)))
+	return buf
+}
+
+// lpStr encodes s as a listpack entry
+func lpStr(s string) []byte {
+	switch {
+	case len(s) < 1<<6:
+		return append([]byte{0x80 | byte(len(s))}, s...)
+	case len(s) < 1<<12:
+		return append([]byte{0xe0 | byte(len(s)>>8), byte(len(s))}, s...)
+	}
+	header := []byte{0xf0, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(header[1:], uint32(len(s)))
+	return append(header, s...)
+}
+
+func intSet(width int, values ...int64) []byte {
+	buf := make([]byte, 8+width*len(values))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(width))
+	binary.LittleEndian.PutUint32(buf[4:8], uint32(len(values)))
+	for i, v := range values {
+		p := buf[8+i*width:]
+		switch width {
+		case 2:
+			binary.LittleEndian.PutUint16(p, uint16(v))
+		case 4:
+			binary.LittleEndian.PutUint32(p, uint32(v))
+		case 8:
+			binary.LittleEndian.PutUint64(p, uint64(v))
+		}
+	}
+	return buf
+}
+
+func joinEntries(entries [][]byte) string {
+	result := make([]string, len(entries))
+	for i, entry := range entries {
+		result[i] = string(entry)
+	}
+	return strings.Join(result, ",")
+}
+
+var long300 = strings.Repeat("y", 300)
+var long20000 = strings.Repeat("z", 20000)
+
+func TestParseZipList(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry []byte
+		want  string
+	}{
+		{"6 bit string", zipStr("abc"), "abc"},
+		{"empty string", zipStr(""), ""},
+		{"14 bit string", zipStr(long300), long300},
+		{"32 bit string", zipStr(long20000), long20000},
+		{"int8", []byte{0xfe, 0x80}, "-128"},
+		{"int16", []byte{0xc0, 0x00, 0x80}, "-32768"},
+		{"int24", []byte{0xf0, 0xfe, 0xff, 0xff}, "-2"},
+		{"int24 positive", []byte{0xf0, 0xff, 0xff, 0x7f}, "8388607"},
+		{"int32", []byte{0xd0, 0x00, 0x00, 0x00, 0x80}, "-2147483648"},
+		{"int64", []byte{0xe0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}, "9223372036854775807"},
+		{"immediate 0", []byte{0xf1}, "0"},
+		{"immediate 12", []byte{0xfd}, "12"},
+	}
+	for _, tt := range tests {
+		// the entry after a long one has a 5 bytes prevlen
+		entries, err := parseZipList(zipList(zipStr("a"), tt.entry, zipStr(long300), tt.entry, zipStr("b")))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		want := strings.Join([]string{"a", tt.want, long300, tt.want, "b"}, ",")
+		if got := joinEntries(entries); got != want {
+			t.Errorf("%s: expect %.40q, got %.40q", tt.name, want, got)
+		}
+	}
+	if entries, err := parseZipList(zipList()); err != nil || len(entries) != 0 {
+		t.Errorf("expect empty ziplist, got %q %v", entries, err)
+	}
+}
+
+func TestParseListPack(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry []byte
+		want  string
+	}{
+		{"7 bit uint", []byte{0x7f}, "127"},
+		{"6 bit string", lpStr("abc"), "abc"},
+		{"empty string", lpStr(""), ""},
+		{"12 bit string", lpStr(long300), long300},
+		{"32 bit string", lpStr(long20000), long20000},
+		{"13 bit int", []byte{0xdf, 0xff}, "-1"},
+		{"13 bit int positive", []byte{0xcf, 0xff}, "4095"},
+		{"int16", []byte{0xf1, 0x00, 0x80}, "-32768"},
+		{"int24", []byte{0xf2, 0xfe, 0xff, 0xff}, "-2"},
+		{"int32", []byte{0xf3, 0xff, 0xff, 0xff, 0x7f}, "2147483647"},
+		{"int64", []byte{0xf4, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x80}, "-9223372036854775808"},
+	}
+	for _, tt := range tests {
+		entries, err := parseListPack(listPack(lpStr("a"), tt.entry, lpStr(long300), tt.entry, lpStr("b")))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		want := strings.Join([]string{"a", tt.want, long300, tt.want, "b"}, ",")
+		if got := joinEntries(entries); got != want {
+			t.Errorf("%s: expect %.40q, got %.40q", tt.name, want, got)
+		}
+	}
+}
+
+func TestParseIntSet(t *testing.T) {
+	tests := []struct {
+		width  int
+		values []int64
+		want   string
+	}{
+		{2, []int64{-32768, 0, 32767}, "-32768,0,32767"},
+		{4, []int64{-2147483648, 1, 2147483647}, "-2147483648,1,2147483647"},
+		{8, []int64{-9223372036854775808, 9223372036854775807}, "-9223372036854775808,9223372036854775807"},
+		{2, nil, ""},
+	}
+	for _, tt := range tests {
+		members, err := parseIntSet(intSet(tt.width, tt.values...))
+		if err != nil || joinEntries(members) != tt.want {
+			t.Errorf("width %d: expect %s, got %q %v", tt.width, tt.want, members, err)
+		}
+	}
+}
+
+func TestCorruptedEncoding(t *testing.T) {
+	zl := zipList(zipStr("abc"), []byte{0xd0, 1, 0, 0, 0}, zipStr(long300))
+	lp := listPack(lpStr("abc"), []byte{0xf3, 1, 0, 0, 0}, lpStr(long300))
+	is := intSet(4, 1, 2, 3)
+	// every truncation of the encodings must be detected
+	for i := 0; i < len(zl); i++ {
+		if _, err := parseZipList(zl[:i]); err != errCorruptEncoding {
+			t.Fatalf("ziplist truncated at %d: expect corrupt encoding, got %v", i, err)
+		}
+	}
+	for i := 0; i < len(lp); i++ {
+		if _, err := parseListPack(lp[:i]); err != errCorruptEncoding {
+			t.Fatalf("listpack truncated at %d: expect corrupt encoding, got %v", i, err)
+		}
+	}
+	for i := 0; i < len(is); i++ {
+		if _, err := parseIntSet(is[:i]); err != errCorruptEncoding {
+			t.Fatalf("intset truncated at %d: expect corrupt encoding, got %v", i, err)
+		}
+	}
+	invalid := map[string]func() error{
+		"ziplist int encoding": func() error {
+			_, err := parseZipList(zipList([]byte{0xc1, 0, 0}))
+			return err
+		},
+		"listpack encoding": func() error {
+			_, err := parseListPack(listPack([]byte{0xf5, 0}))
+			return err
+		},
+		"intset width": func() error {
+			_, err := parseIntSet(intSet(3))
+			return err
+		},
+	}
+	for name, parse := range invalid {
+		if err := parse(); err != errCorruptEncoding {
+			t.Errorf("%s: expect corrupt encoding, got %v", name, err)
+		}
+	}
+}
+
+func TestLZFDecompress(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want string
+	}{
+		{"literal", []byte{0x02, 'a', 'b', 'c'}, "abc"},
+		// 'a' followed by a reference to the previous byte with length 9, the copy overlaps the output
+		{"overlapping reference", []byte{0x00, 'a', 0xe0, 0x00, 0x00}, strings.Repeat("a", 10)},
+		// "abc" followed by a reference 3 bytes back with length 9
+		{"short reference", []byte{0x02, 'a', 'b', 'c', 0xe0, 0x00, 0x02}, strings.Repeat("abc", 4)},
+		// length 3 fits in the control byte: (3-2)<<5
+		{"reference without extra length", []byte{0x01, 'a', 'b', 0x20, 0x01, 0x00, 'c'}, "ababac"},
+		{"long reference", []byte{0x00, 'x', 0xe0, 0xff, 0x00}, strings.Repeat("x", 1+7+255+2)},
+	}
+	for _, tt := range tests {
+		out, err := lzfDecompress(tt.in, uint64(len(tt.want)))
+		if err != nil || string(out) != tt.want {
+			t.Errorf("%s: expect %q, got %q %v", tt.name, tt.want, out, err)
+		}
+	}
+
+	corrupted := []struct {
+		name   string
+		in     []byte
+		outLen uint64
+	}{
+		{"output longer than expected", []byte{0x02, 'a', 'b', 'c'}, 2},
+		{"output shorter than expected", []byte{0x02, 'a', 'b', 'c'}, 4},
+		{"truncated literal", []byte{0x05, 'a', 'b'}, 6},
+		{"reference before start", []byte{0x00, 'a', 0x20, 0x01}, 4},
+		{"truncated reference", []byte{0x00, 'a', 0xe0}, 10},
+		{"huge output length", []byte{0x00, 'a'}, 1 << 62},
+	}
+	for _, tt := range corrupted {
+		if _, err := lzfDecompress(tt.in, tt.outLen); err != errCorruptLZF {
+			t.Errorf("%s: expect corrupt lzf, got %v", tt.name, err)
+		}
+	}
+}
+
+// writeRaw writes an object of the given type with raw value into rdb file
+func writeRaw(t *testing.T, valueType byte, key string, write func(enc *Encoder) error) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	err := enc.WriteHeader()
+	if err == nil {
+		err = enc.writeObjectHeader(key, valueType, nil)
+	}
+	if err == nil {
+		err = write(enc)
+	}
+	if err == nil {
+		err = enc.WriteEnd()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func writeRawString(raw []byte) func(enc *Encoder) error {
+	return func(enc *Encoder) error {
+		return enc.writeBytes(raw)
+	}
+}
+
+// TestDecodeEncodings reads the value types written by redis, which are never written by Encoder
+func TestDecodeEncodings(t *testing.T) {
+	tests := []struct {
+		name      string
+		valueType byte
+		write     func(enc *Encoder) error
+		wantType  string
+		// want is the entries joined by ',', hashes and sorted sets are written as field,value pairs
+		want string
+	}{
+		{"int8 string", typeString, func(enc *Encoder) error {
+			return enc.write([]byte{0xc0, 0x80})
+		}, StringType, "-128"},
+		{"int16 string", typeString, func(enc *Encoder) error {
+			return enc.write([]byte{0xc1, 0x39, 0x30})
+		}, StringType, "12345"},
+		{"int32 string", typeString, func(enc *Encoder) error {
+			return enc.write([]byte{0xc2, 0xff, 0xff, 0xff, 0xff})
+		}, StringType, "-1"},
+		{"lzf string", typeString, func(enc *Encoder) error {
+			return enc.write([]byte{0xc3, 0x07, 0x0c, 0x02, 'a', 'b', 'c', 0xe0, 0x00, 0x02})
+		}, StringType, "abcabcabcabc"},
+		{"intset", typeSetIntSet, writeRawString(intSet(2, -1, 5)), SetType, "-1,5"},
+		{"set listpack", typeSetListPack, writeRawString(listPack(lpStr("a"), []byte{0x05})), SetType, "a,5"},
+		{"list ziplist", typeListZipList, writeRawString(zipList(zipStr("a"), []byte{0xf2})), ListType, "a,1"},
+		{"hash ziplist", typeHashZipList, writeRawString(zipList(zipStr("f"), zipStr("v"), zipStr("n"), []byte{0xf3})), HashType, "f,v,n,2"},
+		{"hash listpack", typeHashListPack, writeRawString(listPack(lpStr("f"), lpStr("v"))), HashType, "f,v"},
+		{"zset ziplist", typeZSetZipList, writeRawString(zipList(zipStr("a"), []byte{0xf2}, zipStr("b"), zipStr("1.5"))), ZSetType, "a,1,b,1.5"},
+		{"zset listpack", typeZSetListPack, writeRawString(listPack(lpStr("a"), lpStr("-inf"))), ZSetType, "a,-Inf"},
+		{"zset with string scores", typeZSet, func(enc *Encoder) error {
+			return enc.write([]byte{0x03, 0x01, 'a', 0x03, '2', '.', '5', 0x01, 'b', 0xfe, 0x01, 'c', 0xff})
+		}, ZSetType, "a,2.5,b,+Inf,c,-Inf"},
+		{"quicklist", typeListQuickList, func(enc *Encoder) error {
+			if err := enc.writeLength(2); err != nil {
+				return err
+			}
+			if err := enc.writeBytes(zipList(zipStr("a"), zipStr("b"))); err != nil {
+				return err
+			}
+			return enc.writeBytes(zipList([]byte{0xfe, 0x07}))
+		}, ListType, "a,b,7"},
+		{"quicklist2", typeListQuickList2, func(enc *Encoder) error {
+			if err := enc.writeLength(2); err != nil {
+				return err
+			}
+			// a packed node and a plain node
+			if err := enc.writeLength(2); err != nil {
+				return err
+			}
+			if err := enc.writeBytes(listPack(lpStr("a"), []byte{0x01})); err != nil {
+				return err
+			}
+			if err := enc.writeLength(1); err != nil {
+				return err
+			}
+			return enc.writeString(long20000)
+		}, ListType, "a,1," + long20000},
+	}
+	for _, tt := range tests {
+		objects, err := parseAll(writeRaw(t, tt.valueType, "key", tt.write))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(objects) != 1 || objects[0].GetType() != tt.wantType {
+			t.Errorf("%s: expect a %s, got %v", tt.name, tt.wantType, objects)
+			continue
+		}
+		var got []string
+		switch obj := objects[0].(type) {
+		case *StringObject:
+			got = []string{string(obj.Value)}
+		case *ListObject:
+			got = strings.Split(joinEntries(obj.Values), ",")
+		case *SetObject:
+			got = strings.Split(joinEntries(obj.Members), ",")
+		case *HashObject:
+			for i, field := range obj.Fields {
+				got = append(got, field, string(obj.Values[i]))
+			}
+		case *ZSetObject:
+			for _, entry := range obj.Entries {
+				got = append(got, entry.Member, strconv.FormatFloat(entry.Score, 'g', -1, 64))
+			}
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("%s: expect %.60q, got %.60q", tt.name, tt.want, strings.Join(got, ","))
+		}
+	}
+}
+
+func TestDecodeCorruptedLength(t *testing.T) {
+	huge := []byte{0x81, 0x0f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	tests := []struct {
+		name      string
+		valueType byte
+		data      []byte
+	}{
+		{"huge string", typeString, huge},
+		{"huge list", typeList, huge},
+		{"huge hash", typeHash, huge},
+		{"huge zset", typeZSet2, huge},
+		{"huge quicklist", typeListQuickList2, huge},
+		{"huge lzf input", typeString, append([]byte{0xc3}, huge...)},
+		{"huge lzf output", typeString, append(append([]byte{0xc3, 0x02}, huge...), 0x00, 'a')},
+	}
+	for _, tt := range tests {
+		data := writeRaw(t, tt.valueType, "key", func(enc *Encoder) error {
+			return enc.write(tt.data)
+		})
+		// remove EOF and checksum
+		_, err := parseAll(data[:len(data)-9])
+		if !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, errCorruptLZF) {
+			t.Errorf("%s: expect unexpected EOF, got %v", tt.name, err)
+		}
+	}
+	// the decoded ziplist and listpack entries must be even for hashes
+	data := writeRaw(t, typeHashListPack, "key", writeRawString(listPack(lpStr("f"))))
+	if _, err := parseAll(data); err == nil {
+		t.Error("expect error for hash with odd number of entries")
+	}
+}
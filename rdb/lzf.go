@@ -0,0 +1,57 @@
+package rdb
+
+import "errors"
+
+var errCorruptLZF = errors.New("corrupt lzf compressed data")
+
+// lzfDecompress decompresses data compressed by redis, outLen is the length of the original data.
+// The output grows as it is decompressed, a corrupted outLen cannot make it allocate huge memory
+func lzfDecompress(in []byte, outLen uint64) ([]byte, error) {
+	capacity := outLen
+	if capacity > maxPrealloc {
+		capacity = maxPrealloc
+	}
+	out := make([]byte, 0, capacity)
+	var i int
+	for i < len(in) {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 32 {
+			// literal run of ctrl+1 bytes
+			ctrl++
+			if uint64(len(out)+ctrl) > outLen || i+ctrl > len(in) {
+				return nil, errCorruptLZF
+			}
+			out = append(out, in[i:i+ctrl]...)
+			i += ctrl
+			continue
+		}
+		// back reference
+		length := ctrl >> 5
+		ref := len(out) - ((ctrl & 0x1f) << 8) - 1
+		if length == 7 {
+			if i >= len(in) {
+				return nil, errCorruptLZF
+			}
+			length += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, errCorruptLZF
+		}
+		ref -= int(in[i])
+		i++
+		length += 2
+		if ref < 0 || uint64(len(out)+length) > outLen {
+			return nil, errCorruptLZF
+		}
+		// the reference may overlap the output, copy byte by byte
+		for j := 0; j < length; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if uint64(len(out)) != outLen {
+		return nil, errCorruptLZF
+	}
+	return out, nil
+}
@@ -0,0 +1,147 @@
+// Package rdb reads and writes redis compatible RDB files
+package rdb
+
+import "time"
+
+// Version is the rdb version written by Encoder
+const Version = 9
+
+// Magic is the header of every rdb file
+const Magic = "REDIS"
+
+// value types
+const (
+	typeString         = 0
+	typeList           = 1
+	typeSet            = 2
+	typeZSet           = 3
+	typeHash           = 4
+	typeZSet2          = 5
+	typeHashZipMap     = 9
+	typeListZipList    = 10
+	typeSetIntSet      = 11
+	typeZSetZipList    = 12
+	typeHashZipList    = 13
+	typeListQuickList  = 14
+	typeHashListPack   = 16
+	typeZSetListPack   = 17
+	typeListQuickList2 = 18
+	typeSetListPack    = 20
+)
+
+// op codes
+const (
+	opCodeFunction2    = 245
+	opCodeFunction     = 246
+	opCodeModuleAux    = 247
+	opCodeIdle         = 248
+	opCodeFreq         = 249
+	opCodeAux          = 250
+	opCodeResizeDB     = 251
+	opCodeExpireTimeMs = 252
+	opCodeExpireTime   = 253
+	opCodeSelectDB     = 254
+	opCodeEOF          = 255
+)
+
+// types of Object
+const (
+	StringType = "string"
+	ListType   = "list"
+	HashType   = "hash"
+	SetType    = "set"
+	ZSetType   = "zset"
+)
+
+// Object is a key-value pair read from rdb file
+type Object interface {
+	GetType() string
+	GetKey() string
+	GetDBIndex() int
+	// GetExpiration returns nil if the key has no expiration
+	GetExpiration() *time.Time
+}
+
+// BaseObject holds the common fields of objects
+type BaseObject struct {
+	DB         int
+	Key        string
+	Expiration *time.Time
+}
+
+// GetKey returns the key of object
+func (o *BaseObject) GetKey() string {
+	return o.Key
+}
+
+// GetDBIndex returns the db the key belongs to
+func (o *BaseObject) GetDBIndex() int {
+	return o.DB
+}
+
+// GetExpiration returns the expiration of key, nil if the key has no expiration
+func (o *BaseObject) GetExpiration() *time.Time {
+	return o.Expiration
+}
+
+// StringObject stores a string value
+type StringObject struct {
+	*BaseObject
+	Value []byte
+}
+
+// GetType returns StringType
+func (o *StringObject) GetType() string {
+	return StringType
+}
+
+// ListObject stores the elements of a list
+type ListObject struct {
+	*BaseObject
+	Values [][]byte
+}
+
+// GetType returns ListType
+func (o *ListObject) GetType() string {
+	return ListType
+}
+
+// HashObject stores the fields of a hash, Fields and Values have the same length
+type HashObject struct {
+	*BaseObject
+	Fields []string
+	Values [][]byte
+}
+
+// GetType returns HashType
+func (o *HashObject) GetType() string {
+	return HashType
+}
+
+// SetObject stores the members of a set
+type SetObject struct {
+	*BaseObject
+	Members [][]byte
+}
+
+// GetType returns SetType
+func (o *SetObject) GetType() string {
+	return SetType
+}
+
+// ZSetEntry is a member of sorted set
+type ZSetEntry struct {
+	Member string
+	Score  float64
+}
+
+// ZSetObject stores the members of a sorted set
+type ZSetObject struct {
+	*BaseObject
+	Entries []*ZSetEntry
+}
+
+// GetType returns ZSetType
+func (o *ZSetObject) GetType() string {
+	return ZSetType
+}
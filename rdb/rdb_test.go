@@ -0,0 +1,188 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseAll decodes data and returns all objects
+func parseAll(data []byte) ([]Object, error) {
+	var objects []Object
+	err := NewDecoder(bytes.NewReader(data)).Parse(func(o Object) bool {
+		objects = append(objects, o)
+		return true
+	})
+	return objects, err
+}
+
+func TestCRC64(t *testing.T) {
+	// the check value of crc-64-jones in redis/src/crc64.c
+	if got := crc64Update(0, []byte("123456789")); got != 0xe9c6d914c4b8d9ca {
+		t.Fatalf("expect 0xe9c6d914c4b8d9ca, got %#x", got)
+	}
+	// checksum can be computed piece by piece
+	if got := crc64Update(crc64Update(0, []byte("1234")), []byte("56789")); got != 0xe9c6d914c4b8d9ca {
+		t.Fatalf("expect 0xe9c6d914c4b8d9ca, got %#x", got)
+	}
+}
+
+// writeSample writes every object type into an rdb file, returns the file and the objects written
+func writeSample(t *testing.T) ([]byte, []Object) {
+	t.Helper()
+	// rdb stores expiration in milliseconds
+	expiration := time.UnixMilli(time.Now().Add(time.Hour).UnixMilli())
+	long := []byte(strings.Repeat("x", 20000))
+	objects := []Object{
+		&StringObject{BaseObject: &BaseObject{Key: "str", Expiration: &expiration}, Value: []byte("hello")},
+		&StringObject{BaseObject: &BaseObject{Key: "empty"}, Value: []byte{}},
+		&StringObject{BaseObject: &BaseObject{Key: "long"}, Value: long},
+		&ListObject{BaseObject: &BaseObject{Key: "list"}, Values: [][]byte{[]byte("a"), {}, long, []byte("123")}},
+		&SetObject{BaseObject: &BaseObject{Key: "set", Expiration: &expiration}, Members: [][]byte{[]byte("1"), []byte("b")}},
+		&HashObject{BaseObject: &BaseObject{Key: "hash"}, Fields: []string{"f1", "f2"}, Values: [][]byte{[]byte("v1"), {}}},
+		&ZSetObject{BaseObject: &BaseObject{DB: 3, Key: "zset"}, Entries: []*ZSetEntry{
+			{Member: "a", Score: -1.5},
+			{Member: "b", Score: math.Inf(1)},
+			{Member: "c", Score: math.Inf(-1)},
+			{Member: "d", Score: 1e300},
+		}},
+		&StringObject{BaseObject: &BaseObject{DB: 3, Key: "db3", Expiration: &expiration}, Value: []byte("v")},
+	}
+
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	check := func(err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(enc.WriteHeader())
+	check(enc.WriteAux("redis-ver", "7.0.0"))
+	db := -1
+	for _, o := range objects {
+		if o.GetDBIndex() != db {
+			db = o.GetDBIndex()
+			check(enc.WriteDBHeader(uint(db), 10, 1))
+		}
+		switch obj := o.(type) {
+		case *StringObject:
+			check(enc.WriteStringObject(obj.Key, obj.Value, obj.Expiration))
+		case *ListObject:
+			check(enc.WriteListObject(obj.Key, obj.Values, obj.Expiration))
+		case *SetObject:
+			check(enc.WriteSetObject(obj.Key, obj.Members, obj.Expiration))
+		case *HashObject:
+			check(enc.WriteHashObject(obj.Key, obj.Fields, obj.Values, obj.Expiration))
+		case *ZSetObject:
+			check(enc.WriteZSetObject(obj.Key, obj.Entries, obj.Expiration))
+		}
+	}
+	check(enc.WriteEnd())
+	return buf.Bytes(), objects
+}
+
+func TestRoundTrip(t *testing.T) {
+	data, want := writeSample(t)
+	if !bytes.HasPrefix(data, []byte("REDIS0009")) {
+		t.Fatalf("wrong header %q", data[:9])
+	}
+	decoder := NewDecoder(bytes.NewReader(data))
+	var got []Object
+	err := decoder.Parse(func(o Object) bool {
+		got = append(got, o)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoder.Offset() != int64(len(data)) {
+		t.Errorf("expect offset %d, got %d", len(data), decoder.Offset())
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expect %d objects, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i].GetType() != want[i].GetType() {
+			t.Errorf("%s: expect type %s, got %s", want[i].GetKey(), want[i].GetType(), got[i].GetType())
+			continue
+		}
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("%s: expect %+v, got %+v", want[i].GetKey(), want[i], got[i])
+		}
+	}
+}
+
+func TestParseStop(t *testing.T) {
+	data, _ := writeSample(t)
+	count := 0
+	err := NewDecoder(bytes.NewReader(data)).Parse(func(o Object) bool {
+		count++
+		return count < 2
+	})
+	if err != nil || count != 2 {
+		t.Fatalf("expect to stop after 2 objects, got %d %v", count, err)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	data, _ := writeSample(t)
+
+	// flips a byte of the value "hello"
+	corrupted := append([]byte{}, data...)
+	corrupted[bytes.Index(corrupted, []byte("hello"))] = 'j'
+	if _, err := parseAll(corrupted); err == nil || err.Error() != "rdb checksum mismatch" {
+		t.Errorf("expect checksum mismatch, got %v", err)
+	}
+
+	// checksum 0 means it was not computed
+	noChecksum := append([]byte{}, corrupted...)
+	binary.LittleEndian.PutUint64(noChecksum[len(noChecksum)-8:], 0)
+	if _, err := parseAll(noChecksum); err != nil {
+		t.Errorf("expect checksum 0 to be skipped, got %v", err)
+	}
+
+	// versions before 5 have no checksum
+	old := append([]byte("REDIS0004"), data[9:len(data)-8]...)
+	if objects, err := parseAll(old); err != nil || len(objects) != 8 {
+		t.Errorf("expect version 4 without checksum loaded, got %d objects %v", len(objects), err)
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	data, _ := writeSample(t)
+	for i := 0; i < len(data); i++ {
+		_, err := parseAll(data[:i])
+		if err == nil {
+			t.Fatalf("expect error for file truncated at %d", i)
+		}
+		if i >= 9 && !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("truncated at %d: expect unexpected EOF, got %v", i, err)
+		}
+	}
+}
+
+func TestCorruptedHeader(t *testing.T) {
+	tests := []struct {
+		data    string
+		wantErr string
+	}{
+		{"REDIX0009\xff", "file is not a rdb file"},
+		{"REDIS00x9\xff", "illegal rdb version 00x9"},
+		{"REDIS0009\xf6", "unsupported rdb op code 246"},
+		{"REDIS0009\x07\x01k", "read key k failed: unsupported rdb value type 7"},
+		{"REDIS0009\x00\x01k\xc4", "read key k failed: unknown string encoding 4"},
+		{"REDIS0009\x00\x01k\xbf", "read key k failed: illegal length encoding bf"},
+	}
+	for _, tt := range tests {
+		_, err := parseAll([]byte(tt.data))
+		if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("%q: expect error %q, got %v", tt.data, tt.wantErr, err)
+		}
+	}
+}
@@ -1,9 +1,11 @@
 package client
 
 import (
+	"errors"
 	"go-redis/interface/resp"
 	"go-redis/lib/logger"
 	"go-redis/lib/sync/wait"
+	"go-redis/lib/utils"
 	"go-redis/resp/parser"
 	"go-redis/resp/reply"
 	"net"
@@ -19,6 +21,8 @@ type Client struct {
 	waitingReqs chan *request // waiting response
 	ticker      *time.Ticker
 	addr        string
+	// password is sent by AUTH after reconnecting, it is empty if the server requires no password
+	password string
 
 	working *sync.WaitGroup // its counter presents unfinished requests(pending and waiting)
 }
@@ -66,6 +70,16 @@ func (client *Client) Start() {
 	go client.heartbeat()
 }
 
+// Auth authenticates the connection, the client authenticates again with the password after reconnecting
+func (client *Client) Auth(password string) error {
+	client.password = password
+	result := client.Send(utils.ToCmdLine("AUTH", password))
+	if errReply, ok := result.(reply.ErrorReply); ok {
+		return errors.New(errReply.Error())
+	}
+	return nil
+}
+
 // Close stops asynchronous goroutines and close connection
 func (client *Client) Close() {
 	client.ticker.Stop()
@@ -100,6 +114,24 @@ func (client *Client) handleConnectionError(err error) error {
 	go func() {
 		_ = client.handleRead()
 	}()
+	return client.reAuth()
+}
+
+// reAuth sends AUTH on the new connection before other requests, its reply is ignored
+func (client *Client) reAuth() error {
+	if client.password == "" {
+		return nil
+	}
+	req := &request{
+		args:    utils.ToCmdLine("AUTH", client.password),
+		waiting: &wait.Wait{},
+	}
+	req.waiting.Add(1)
+	_, err := client.conn.Write(reply.MakeMultiBulkReply(req.args).ToBytes())
+	if err != nil {
+		return err
+	}
+	client.waitingReqs <- req
 	return nil
 }
 
@@ -190,13 +222,18 @@ func (client *Client) finishRequest(reply resp.Reply) {
 }
 
 func (client *Client) handleRead() error {
-	ch := parser.ParseStream(client.conn)
-	for payload := range ch {
-		if payload.Err != nil {
-			client.finishRequest(reply.MakeErrReply(payload.Err.Error()))
-			continue
+	reader := parser.NewReader(client.conn)
+	defer reader.Release()
+	for {
+		result, err := reader.ReadReply()
+		if err != nil {
+			client.finishRequest(reply.MakeErrReply(err.Error()))
+			if _, ok := err.(*reply.ProtocolErrReply); ok {
+				continue
+			}
+			// the connection is broken
+			return nil
 		}
-		client.finishRequest(payload.Data)
+		client.finishRequest(result)
 	}
-	return nil
 }
@@ -2,26 +2,71 @@ package connection
 
 import (
 	"bytes"
+	"fmt"
+	"go-redis/interface/resp"
 	"go-redis/lib/sync/wait"
+	"go-redis/resp/reply"
 	"net"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// nextID is the id of the next connection, ids are never reused
+var nextID uint64
+
+// the output buffer larger than maxRetainedOutBuf is released after it is sent
+const maxRetainedOutBuf = 64 * 1024
+
 // Connection represents a connection with a redis-cli
 type Connection struct {
 	conn net.Conn
+	id   uint64
+	// created time of the connection, shown by CLIENT LIST
+	createdAt time.Time
 	// waiting until reply finished
 	waitingReply wait.Wait
 	// lock while handler sending response
 	mu sync.Mutex
+	// replies waiting to be sent by Flush, guarded by mu
+	outBuf []byte
+	// bytes of the replies buffered or being sent, it keeps growing if the client reads slowly
+	outputBytes int64
+	// stateMu protects the states below which are read by CLIENT LIST from other connections
+	stateMu sync.Mutex
+	// name set by CLIENT SETNAME
+	name string
+	// protocol version of replies, 2 or 3, negotiated by HELLO
+	protocol int
+	// last command and the total size of its arguments
+	lastCmd string
+	argvMem int
 	// selected db
 	selectedDB int
+	// whether the client has passed AUTH
+	authenticated bool
+	// unix nano time of the last command received, used to close idle clients
+	lastInteraction int64
+	// ACL user of the client, empty user has all permissions and is only used inside server
+	user string
+
+	// queued commands for `multi`
+	multiState bool
+	queue      [][][]byte
+	// key -> version of the key when it is watched
+	watching map[string]uint32
+	txErrors []error
 }
 
 func NewConn(conn net.Conn) *Connection {
 	return &Connection{
-		conn: conn,
+		conn:            conn,
+		id:              atomic.AddUint64(&nextID, 1),
+		createdAt:       time.Now(),
+		user:            "default",
+		protocol:        2,
+		lastInteraction: time.Now().UnixNano(),
 	}
 }
 
@@ -37,32 +82,243 @@ func (c *Connection) Close() error {
 	return nil
 }
 
-// Write sends response to client over tcp connection
+// Write sends response to client over tcp connection, the buffered replies are sent before it
 func (c *Connection) Write(b []byte) error {
 	if len(b) == 0 {
 		return nil
 	}
 	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.outBuf) > 0 {
+		// send them in one syscall
+		c.outBuf = append(c.outBuf, b...)
+		atomic.AddInt64(&c.outputBytes, int64(len(b)))
+		return c.flush()
+	}
 	c.waitingReply.Add(1)
+	atomic.AddInt64(&c.outputBytes, int64(len(b)))
 	defer func() {
+		atomic.AddInt64(&c.outputBytes, -int64(len(b)))
 		c.waitingReply.Done()
-		c.mu.Unlock()
 	}()
 
 	_, err := c.conn.Write(b)
 	return err
 }
 
+// WriteReply appends the reply to the output buffer in the protocol version of the client,
+// it is sent by the next Flush or Write, so that the replies of a pipeline are sent together
+func (c *Connection) WriteReply(r resp.Reply) {
+	protocol := c.GetProtocol()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	size := len(c.outBuf)
+	c.outBuf = reply.AppendTo(c.outBuf, r, protocol)
+	atomic.AddInt64(&c.outputBytes, int64(len(c.outBuf)-size))
+}
+
+// Buffered returns the number of bytes of the replies waiting to be sent
+func (c *Connection) Buffered() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.outBuf)
+}
+
+// Flush sends the buffered replies
+func (c *Connection) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flush()
+}
+
+// flush sends the buffered replies, mu must be held
+func (c *Connection) flush() error {
+	if len(c.outBuf) == 0 {
+		return nil
+	}
+	c.waitingReply.Add(1)
+	defer c.waitingReply.Done()
+	_, err := c.conn.Write(c.outBuf)
+	atomic.AddInt64(&c.outputBytes, -int64(len(c.outBuf)))
+	if cap(c.outBuf) > maxRetainedOutBuf {
+		// don't hold the memory of a huge reply while the client is idle
+		c.outBuf = nil
+	} else {
+		c.outBuf = c.outBuf[:0]
+	}
+	return err
+}
+
+// Touch records that the client sent a command just now
+func (c *Connection) Touch() {
+	atomic.StoreInt64(&c.lastInteraction, time.Now().UnixNano())
+}
+
+// IdleTime returns how long the client has sent nothing
+func (c *Connection) IdleTime() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&c.lastInteraction)))
+}
+
+// GetID returns the unique id of the connection
+func (c *Connection) GetID() uint64 {
+	return c.id
+}
+
+// SetName sets the name of the connection, empty name removes it
+func (c *Connection) SetName(name string) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	c.name = name
+}
+
+// GetName returns the name set by CLIENT SETNAME
+func (c *Connection) GetName() string {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return c.name
+}
+
+// RecordCmd records the command being executed
+func (c *Connection) RecordCmd(cmdLine [][]byte) {
+	size := 0
+	for _, arg := range cmdLine {
+		size += len(arg)
+	}
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	c.lastCmd = strings.ToLower(string(cmdLine[0]))
+	c.argvMem = size
+}
+
+// Info describes the connection in the format of CLIENT LIST
+func (c *Connection) Info() string {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	flags := "N"
+	multi := -1
+	if c.multiState {
+		flags = "x"
+		multi = len(c.queue)
+	}
+	return fmt.Sprintf("id=%d addr=%s laddr=%s name=%s age=%d idle=%d flags=%s db=%d multi=%d argv-mem=%d omem=%d cmd=%s user=%s resp=%d",
+		c.id, c.conn.RemoteAddr(), c.conn.LocalAddr(), c.name,
+		int64(time.Since(c.createdAt).Seconds()), int64(c.IdleTime().Seconds()),
+		flags, c.selectedDB, multi, c.argvMem, atomic.LoadInt64(&c.outputBytes), c.lastCmd, c.user, c.protocol)
+}
+
+// SetProtocol sets the protocol version of replies
+func (c *Connection) SetProtocol(protocol int) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	c.protocol = protocol
+}
+
+// GetProtocol returns the protocol version of replies, 2 or 3
+func (c *Connection) GetProtocol() int {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return c.protocol
+}
+
+// LocalAddr returns the local network address
+func (c *Connection) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
 // GetDBIndex returns selected db
 func (c *Connection) GetDBIndex() int {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
 	return c.selectedDB
 }
 
 // SelectDB selects a database
 func (c *Connection) SelectDB(dbNum int) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
 	c.selectedDB = dbNum
 }
 
+// SetAuthenticated records whether the client has passed AUTH
+func (c *Connection) SetAuthenticated(authenticated bool) {
+	c.authenticated = authenticated
+}
+
+// IsAuthenticated tells whether the client has passed AUTH
+func (c *Connection) IsAuthenticated() bool {
+	return c.authenticated
+}
+
+// SetUser sets the ACL user of the client
+func (c *Connection) SetUser(user string) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	c.user = user
+}
+
+// GetUser returns the ACL user of the client
+func (c *Connection) GetUser() string {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return c.user
+}
+
+// InMultiState tells is connection in an uncommitted transaction
+func (c *Connection) InMultiState() bool {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return c.multiState
+}
+
+// SetMultiState sets transaction flag
+func (c *Connection) SetMultiState(state bool) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	if !state { // reset data when cancel multi
+		c.watching = nil
+		c.queue = nil
+		c.txErrors = nil
+	}
+	c.multiState = state
+}
+
+// GetQueuedCmdLine returns queued commands of current transaction
+func (c *Connection) GetQueuedCmdLine() [][][]byte {
+	return c.queue
+}
+
+// EnqueueCmd enqueues command of current transaction
+func (c *Connection) EnqueueCmd(cmdLine [][]byte) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	c.queue = append(c.queue, cmdLine)
+}
+
+// ClearQueuedCmds clears queued commands of current transaction
+func (c *Connection) ClearQueuedCmds() {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	c.queue = nil
+}
+
+// GetWatching returns watching keys and their version code when started watching
+func (c *Connection) GetWatching() map[string]uint32 {
+	if c.watching == nil {
+		c.watching = make(map[string]uint32)
+	}
+	return c.watching
+}
+
+// AddTxError stores syntax error within transaction
+func (c *Connection) AddTxError(err error) {
+	c.txErrors = append(c.txErrors, err)
+}
+
+// GetTxErrors returns syntax error within transaction
+func (c *Connection) GetTxErrors() []error {
+	return c.txErrors
+}
+
 // FakeConn implements redis.Connection for test
 type FakeConn struct {
 	Connection
@@ -75,6 +331,12 @@ func (c *FakeConn) Write(b []byte) error {
 	return nil
 }
 
+// IsAuthenticated returns true, fake connection is used inside server, eg. loading aof.
+// Its user is empty, so it is not limited by ACL either
+func (c *FakeConn) IsAuthenticated() bool {
+	return true
+}
+
 // Clean resets the buffer
 func (c *FakeConn) Clean() {
 	c.buf.Reset()
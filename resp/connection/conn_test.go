@@ -0,0 +1,105 @@
+package connection
+
+import (
+	"go-redis/resp/reply"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// recordConn records every write of the connection, it stands for the socket of a client
+type recordConn struct {
+	net.Conn
+	writes []string
+}
+
+func (c *recordConn) Write(b []byte) (int, error) {
+	c.writes = append(c.writes, string(b))
+	return len(b), nil
+}
+
+// assertOutput checks the bytes buffered by WriteReply and the bytes counted as output
+func assertOutput(t *testing.T, c *Connection, buffered int, output int64) {
+	t.Helper()
+	if got := c.Buffered(); got != buffered {
+		t.Fatalf("expect %d bytes buffered, got %d", buffered, got)
+	}
+	if got := atomic.LoadInt64(&c.outputBytes); got != output {
+		t.Fatalf("expect %d output bytes, got %d", output, got)
+	}
+}
+
+// TestWriteReplyBatching checks the replies written by WriteReply are sent together by Flush or Write
+func TestWriteReplyBatching(t *testing.T) {
+	conn := &recordConn{}
+	c := NewConn(conn)
+	c.WriteReply(reply.MakeOkReply())
+	c.WriteReply(reply.MakeIntReply(1))
+	c.WriteReply(reply.MakeBulkReply(nil))
+	const batch = "+OK\r\n:1\r\n$-1\r\n"
+	if len(conn.writes) != 0 {
+		t.Fatalf("expect nothing sent before Flush, got %q", conn.writes)
+	}
+	assertOutput(t, c, len(batch), int64(len(batch)))
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.writes) != 1 || conn.writes[0] != batch {
+		t.Fatalf("expect replies sent in one write %q, got %q", batch, conn.writes)
+	}
+	assertOutput(t, c, 0, 0)
+	// nothing to send
+	if err := c.Flush(); err != nil || len(conn.writes) != 1 {
+		t.Fatalf("expect no write by empty Flush, got %q %v", conn.writes, err)
+	}
+
+	// Write sends the buffered replies first in the same write
+	c.WriteReply(reply.MakeStatusReply("QUEUED"))
+	if err := c.Write([]byte("-ERR x\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.writes) != 2 || conn.writes[1] != "+QUEUED\r\n-ERR x\r\n" {
+		t.Fatalf("expect buffered replies sent before Write, got %q", conn.writes)
+	}
+	assertOutput(t, c, 0, 0)
+	if err := c.Write([]byte("+PONG\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.writes) != 3 || conn.writes[2] != "+PONG\r\n" {
+		t.Fatalf("expect Write sent directly, got %q", conn.writes)
+	}
+	assertOutput(t, c, 0, 0)
+}
+
+// TestWriteReplyProtocol checks replies are encoded in the protocol version of the client
+func TestWriteReplyProtocol(t *testing.T) {
+	conn := &recordConn{}
+	c := NewConn(conn)
+	r := reply.MakeBulkMapReply([][]byte{[]byte("k"), nil})
+	c.WriteReply(r)
+	c.SetProtocol(3)
+	c.WriteReply(r)
+	_ = c.Flush()
+	want := "*2\r\n$1\r\nk\r\n$-1\r\n" + "%1\r\n$1\r\nk\r\n_\r\n"
+	if len(conn.writes) != 1 || conn.writes[0] != want {
+		t.Fatalf("expect %q, got %q", want, conn.writes)
+	}
+}
+
+// TestOutBufReleased checks the buffer of a huge reply is not retained after it is sent
+func TestOutBufReleased(t *testing.T) {
+	conn := &recordConn{}
+	c := NewConn(conn)
+	c.WriteReply(reply.MakeOkReply())
+	_ = c.Flush()
+	if cap(c.outBuf) == 0 {
+		t.Fatal("expect small buffer retained")
+	}
+	c.WriteReply(reply.MakeBulkReply([]byte(strings.Repeat("a", maxRetainedOutBuf))))
+	_ = c.Flush()
+	if c.outBuf != nil {
+		t.Fatalf("expect huge buffer released, got capacity %d", cap(c.outBuf))
+	}
+	assertOutput(t, c, 0, 0)
+}
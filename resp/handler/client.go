@@ -0,0 +1,337 @@
+package handler
+
+import (
+	"go-redis/database"
+	"go-redis/interface/resp"
+	"go-redis/resp/connection"
+	"go-redis/resp/reply"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// modes of CLIENT PAUSE
+const (
+	pauseOff = iota
+	// pauseWrite holds the commands which may modify data
+	pauseWrite
+	// pauseAll holds all commands
+	pauseAll
+)
+
+// clientPause holds commands until the deadline of CLIENT PAUSE or CLIENT UNPAUSE
+type clientPause struct {
+	mu       sync.Mutex
+	mode     int
+	deadline time.Time
+	// unpaused is closed by CLIENT UNPAUSE to wake up the waiting clients
+	unpaused chan struct{}
+}
+
+func makeClientPause() *clientPause {
+	return &clientPause{unpaused: make(chan struct{})}
+}
+
+// pause starts pausing, the longer deadline and the stricter mode win if clients are already paused
+func (p *clientPause) pause(mode int, deadline time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.mode != pauseOff && time.Now().Before(p.deadline) {
+		if deadline.Before(p.deadline) {
+			deadline = p.deadline
+		}
+		if mode < p.mode {
+			mode = p.mode
+		}
+	}
+	p.mode = mode
+	p.deadline = deadline
+}
+
+func (p *clientPause) unpause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.mode = pauseOff
+	close(p.unpaused)
+	p.unpaused = make(chan struct{})
+}
+
+// isPaused tells whether the command would be held by wait now
+func (p *clientPause) isPaused(isWrite bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.blocks(isWrite)
+}
+
+// blocks tells whether the command is held, mu must be held
+func (p *clientPause) blocks(isWrite bool) bool {
+	return p.mode != pauseOff && (p.mode == pauseAll || isWrite) && time.Now().Before(p.deadline)
+}
+
+// wait blocks until the command is not paused, or stop is closed
+func (p *clientPause) wait(isWrite bool, stop <-chan struct{}) {
+	for {
+		p.mu.Lock()
+		if !p.blocks(isWrite) {
+			p.mu.Unlock()
+			return
+		}
+		unpaused := p.unpaused
+		timer := time.NewTimer(time.Until(p.deadline))
+		p.mu.Unlock()
+		select {
+		case <-unpaused:
+		case <-timer.C:
+		case <-stop:
+			timer.Stop()
+			return
+		}
+		timer.Stop()
+	}
+}
+
+// isWriteCommand tells whether the command may modify data, EXEC is a write command if any queued command is.
+// Commands queued in a transaction are not executed, so they are never paused
+func isWriteCommand(client *connection.Connection, cmdName string) bool {
+	if cmdName == "exec" {
+		for _, cmdLine := range client.GetQueuedCmdLine() {
+			if database.IsWriteCommand(string(cmdLine[0])) {
+				return true
+			}
+		}
+		return false
+	}
+	return !client.InMultiState() && database.IsWriteCommand(cmdName)
+}
+
+var errInvalidClientName = reply.MakeErrReply("ERR Client names cannot contain spaces, newlines or special characters.")
+
+// isValidClientName tells whether the name can be shown in CLIENT LIST which is separated by spaces
+func isValidClientName(name string) bool {
+	for _, c := range name {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// clients returns active connections sorted by id
+func (h *RespHandler) clients() []*connection.Connection {
+	var clients []*connection.Connection
+	h.activeConn.Range(func(key interface{}, val interface{}) bool {
+		clients = append(clients, key.(*connection.Connection))
+		return true
+	})
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].GetID() < clients[j].GetID()
+	})
+	return clients
+}
+
+// handleClientCmd checks authentication and permission before executing CLIENT command
+func (h *RespHandler) handleClientCmd(client *connection.Connection, cmdLine [][]byte) (resp.Reply, bool) {
+	if !database.IsAuthenticated(client) {
+		return reply.MakeErrReply("NOAUTH Authentication required."), false
+	}
+	if errReply := database.CheckPermission(client, cmdLine); errReply != nil {
+		return errReply, false
+	}
+	return h.execClient(client, cmdLine[1:])
+}
+
+// execClient implements CLIENT ID/SETNAME/GETNAME/INFO/LIST/KILL/PAUSE/UNPAUSE.
+// closeSelf is true if the client kills itself, it should be closed after the reply is sent
+func (h *RespHandler) execClient(client *connection.Connection, args [][]byte) (result resp.Reply, closeSelf bool) {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("client"), false
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	args = args[1:]
+	argNumErr := reply.MakeArgNumErrReply("client|" + subCmd)
+	switch subCmd {
+	case "id":
+		if len(args) != 0 {
+			return argNumErr, false
+		}
+		return reply.MakeIntReply(int64(client.GetID())), false
+	case "setname":
+		if len(args) != 1 {
+			return argNumErr, false
+		}
+		name := string(args[0])
+		if !isValidClientName(name) {
+			return errInvalidClientName, false
+		}
+		client.SetName(name)
+		return reply.MakeOkReply(), false
+	case "getname":
+		if len(args) != 0 {
+			return argNumErr, false
+		}
+		name := client.GetName()
+		if name == "" {
+			return reply.MakeNullBulkReply(), false
+		}
+		return reply.MakeBulkReply([]byte(name)), false
+	case "info":
+		if len(args) != 0 {
+			return argNumErr, false
+		}
+		return reply.MakeVerbatimStringReply("txt", []byte(client.Info()+"\n")), false
+	case "list":
+		return h.execClientList(args), false
+	case "kill":
+		if len(args) == 0 {
+			return argNumErr, false
+		}
+		return h.execClientKill(client, args)
+	case "pause":
+		if len(args) != 1 && len(args) != 2 {
+			return argNumErr, false
+		}
+		return h.execClientPause(args), false
+	case "unpause":
+		if len(args) != 0 {
+			return argNumErr, false
+		}
+		h.pause.unpause()
+		return reply.MakeOkReply(), false
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try CLIENT HELP."), false
+}
+
+// execClientList implements CLIENT LIST [TYPE normal|master|replica|pubsub] [ID client-id ...]
+func (h *RespHandler) execClientList(args [][]byte) resp.Reply {
+	var ids map[uint64]bool
+	onlyNormal := false
+	for i := 0; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		switch {
+		case option == "type" && i+1 < len(args):
+			clientType := strings.ToLower(string(args[i+1]))
+			switch clientType {
+			case "normal":
+			case "master", "replica", "slave", "pubsub":
+				// there are no replicas or subscribers, all clients are normal clients
+				onlyNormal = true
+			default:
+				return reply.MakeErrReply("ERR Unknown client type '" + clientType + "'")
+			}
+			i++
+		case option == "id" && i+1 < len(args):
+			ids = make(map[uint64]bool)
+			for i++; i < len(args); i++ {
+				id, err := strconv.ParseUint(string(args[i]), 10, 64)
+				if err != nil || id == 0 {
+					return reply.MakeErrReply("ERR Invalid client ID")
+				}
+				ids[id] = true
+			}
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	var buf strings.Builder
+	if !onlyNormal {
+		for _, c := range h.clients() {
+			if ids == nil || ids[c.GetID()] {
+				buf.WriteString(c.Info())
+				buf.WriteByte('\n')
+			}
+		}
+	}
+	return reply.MakeVerbatimStringReply("txt", []byte(buf.String()))
+}
+
+// execClientKill implements CLIENT KILL addr:port and CLIENT KILL <filter> <value> [<filter> <value> ...],
+// the filters are ID, ADDR, LADDR, USER and SKIPME
+func (h *RespHandler) execClientKill(client *connection.Connection, args [][]byte) (resp.Reply, bool) {
+	oldStyle := len(args) == 1
+	var id uint64
+	var addr, laddr, user string
+	skipMe := !oldStyle
+	if oldStyle {
+		addr = string(args[0])
+	} else {
+		if len(args)%2 != 0 {
+			return reply.MakeSyntaxErrReply(), false
+		}
+		for i := 0; i < len(args); i += 2 {
+			value := string(args[i+1])
+			switch strings.ToLower(string(args[i])) {
+			case "id":
+				var err error
+				id, err = strconv.ParseUint(value, 10, 64)
+				if err != nil || id == 0 {
+					return reply.MakeErrReply("ERR client-id should be greater than 0"), false
+				}
+			case "addr":
+				addr = value
+			case "laddr":
+				laddr = value
+			case "user":
+				user = value
+			case "skipme":
+				switch strings.ToLower(value) {
+				case "yes":
+					skipMe = true
+				case "no":
+					skipMe = false
+				default:
+					return reply.MakeSyntaxErrReply(), false
+				}
+			default:
+				return reply.MakeSyntaxErrReply(), false
+			}
+		}
+	}
+
+	killed := 0
+	closeSelf := false
+	for _, c := range h.clients() {
+		if (id != 0 && c.GetID() != id) ||
+			(addr != "" && c.RemoteAddr().String() != addr) ||
+			(laddr != "" && c.LocalAddr().String() != laddr) ||
+			(user != "" && c.GetUser() != user) ||
+			(skipMe && c == client) {
+			continue
+		}
+		if c == client {
+			closeSelf = true
+		} else {
+			// Handle of the killed client finds the connection closed and cleans it up
+			_ = c.Close()
+		}
+		killed++
+	}
+	if oldStyle {
+		if killed == 0 {
+			return reply.MakeErrReply("ERR No such client"), false
+		}
+		return reply.MakeOkReply(), closeSelf
+	}
+	return reply.MakeIntReply(int64(killed)), closeSelf
+}
+
+// execClientPause implements CLIENT PAUSE timeout [WRITE|ALL], timeout is in milliseconds
+func (h *RespHandler) execClientPause(args [][]byte) resp.Reply {
+	timeout, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil || timeout < 0 {
+		return reply.MakeErrReply("ERR timeout is not an integer or out of range")
+	}
+	mode := pauseAll
+	if len(args) == 2 {
+		switch strings.ToLower(string(args[1])) {
+		case "write":
+			mode = pauseWrite
+		case "all":
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	h.pause.pause(mode, time.Now().Add(time.Duration(timeout)*time.Millisecond))
+	return reply.MakeOkReply()
+}
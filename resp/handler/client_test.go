@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"go-redis/config"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clientID returns the id of the client by CLIENT ID
+func clientID(t *testing.T, c *testClient) string {
+	t.Helper()
+	got := c.do(t, "CLIENT", "ID")
+	if !strings.HasPrefix(got, ":") {
+		t.Fatalf("expect id, got %q", got)
+	}
+	return strings.TrimSuffix(got[1:], "\r\n")
+}
+
+// assertDo sends the command and checks its reply
+func assertDo(t *testing.T, c *testClient, want string, args ...string) {
+	t.Helper()
+	if got := c.do(t, args...); got != want {
+		t.Fatalf("%s: expect %q, got %q", strings.Join(args, " "), want, got)
+	}
+}
+
+func TestClientName(t *testing.T) {
+	_, addr := serve(t, &config.ServerProperties{})
+	a := dial(t, addr)
+	b := dial(t, addr)
+	assertDo(t, a, "$-1\r\n", "CLIENT", "GETNAME")
+	assertDo(t, a, "-ERR Client names cannot contain spaces, newlines or special characters.\r\n", "CLIENT", "SETNAME", "a b")
+	assertDo(t, a, "+OK\r\n", "CLIENT", "SETNAME", "alice")
+	assertDo(t, a, "$5\r\nalice\r\n", "CLIENT", "GETNAME")
+	assertDo(t, b, "$-1\r\n", "CLIENT", "GETNAME")
+	assertDo(t, a, "-ERR wrong number of arguments for 'client|getname' command\r\n", "CLIENT", "GETNAME", "x")
+	assertDo(t, a, "-ERR unknown subcommand 'foo'. Try CLIENT HELP.\r\n", "CLIENT", "FOO")
+
+	idA, idB := clientID(t, a), clientID(t, b)
+	if idA == idB {
+		t.Fatalf("expect different ids, got %s", idA)
+	}
+	info := a.do(t, "CLIENT", "INFO")
+	for _, field := range []string{"id=" + idA + " ", "addr=" + a.conn.LocalAddr().String() + " ", "name=alice ", "cmd=client "} {
+		if !strings.Contains(info, field) {
+			t.Errorf("expect %q in CLIENT INFO, got %q", field, info)
+		}
+	}
+}
+
+func TestClientList(t *testing.T) {
+	_, addr := serve(t, &config.ServerProperties{})
+	a := dial(t, addr)
+	b := dial(t, addr)
+	idA, idB := clientID(t, a), clientID(t, b)
+	assertDo(t, b, "+OK\r\n", "MULTI")
+	assertDo(t, b, "+QUEUED\r\n", "SET", "k", "v")
+
+	list := a.do(t, "CLIENT", "LIST")
+	lines := strings.Split(strings.TrimSuffix(list[strings.Index(list, "\r\n")+2:], "\n\r\n"), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "id="+idA+" ") || !strings.HasPrefix(lines[1], "id="+idB+" ") {
+		t.Fatalf("expect clients sorted by id, got %q", list)
+	}
+	if !strings.Contains(lines[1], " flags=x ") || !strings.Contains(lines[1], " multi=1 ") {
+		t.Errorf("expect the client in transaction, got %q", lines[1])
+	}
+	list = a.do(t, "CLIENT", "LIST", "ID", idB, "12345")
+	if !strings.Contains(list, "id="+idB+" ") || strings.Contains(list, "id="+idA+" ") {
+		t.Errorf("expect only client %s, got %q", idB, list)
+	}
+	assertDo(t, a, "$0\r\n\r\n", "CLIENT", "LIST", "TYPE", "pubsub")
+	assertDo(t, a, "-ERR Unknown client type 'foo'\r\n", "CLIENT", "LIST", "TYPE", "foo")
+	assertDo(t, a, "-ERR Invalid client ID\r\n", "CLIENT", "LIST", "ID", "x")
+}
+
+func TestClientKill(t *testing.T) {
+	_, addr := serve(t, &config.ServerProperties{})
+	admin := dial(t, addr)
+	idAdmin := clientID(t, admin)
+
+	// old style with address
+	b := dial(t, addr)
+	assertDo(t, b, "+PONG\r\n", "PING")
+	assertDo(t, admin, "+OK\r\n", "CLIENT", "KILL", b.conn.LocalAddr().String())
+	b.waitClosed(t, time.Second)
+	assertDo(t, admin, "-ERR No such client\r\n", "CLIENT", "KILL", b.conn.LocalAddr().String())
+
+	// filters
+	c := dial(t, addr)
+	d := dial(t, addr)
+	idC := clientID(t, c)
+	assertDo(t, admin, ":1\r\n", "CLIENT", "KILL", "ID", idC)
+	c.waitClosed(t, time.Second)
+	assertDo(t, admin, ":0\r\n", "CLIENT", "KILL", "ID", idC)
+	assertDo(t, admin, ":1\r\n", "CLIENT", "KILL", "ADDR", d.conn.LocalAddr().String())
+	d.waitClosed(t, time.Second)
+	assertDo(t, admin, "-ERR client-id should be greater than 0\r\n", "CLIENT", "KILL", "ID", "0")
+	assertDo(t, admin, "-Err syntax error\r\n", "CLIENT", "KILL", "ID", idC, "ADDR")
+
+	// the client itself is skipped unless SKIPME no, and it is closed after the reply
+	assertDo(t, admin, ":0\r\n", "CLIENT", "KILL", "ID", idAdmin)
+	assertDo(t, admin, ":1\r\n", "CLIENT", "KILL", "ID", idAdmin, "SKIPME", "no")
+	admin.waitClosed(t, time.Second)
+}
+
+func TestClientPause(t *testing.T) {
+	_, addr := serve(t, &config.ServerProperties{})
+	admin := dial(t, addr)
+	reader := dial(t, addr)
+	writer := dial(t, addr)
+	assertDo(t, admin, "-ERR timeout is not an integer or out of range\r\n", "CLIENT", "PAUSE", "x")
+	assertDo(t, admin, "-Err syntax error\r\n", "CLIENT", "PAUSE", "100", "foo")
+
+	// PAUSE WRITE holds the writes while the reads go on
+	assertDo(t, admin, "+OK\r\n", "CLIENT", "PAUSE", "10000", "WRITE")
+	writer.send(t, "SET", "k", "v")
+	time.Sleep(100 * time.Millisecond)
+	assertDo(t, reader, "$-1\r\n", "GET", "k")
+	assertDo(t, reader, ":0\r\n", "EXISTS", "k")
+	assertDo(t, admin, "+OK\r\n", "CLIENT", "UNPAUSE")
+	if got := writer.read(t); got != "+OK\r\n" {
+		t.Fatalf("expect the write served after UNPAUSE, got %q", got)
+	}
+	assertDo(t, reader, "$1\r\nv\r\n", "GET", "k")
+
+	// PAUSE ALL holds the reads as well until the timeout
+	const timeout = 300 * time.Millisecond
+	assertDo(t, admin, "+OK\r\n", "CLIENT", "PAUSE", strconv.Itoa(int(timeout.Milliseconds())), "ALL")
+	start := time.Now()
+	assertDo(t, reader, "$1\r\nv\r\n", "GET", "k")
+	if elapsed := time.Since(start); elapsed < timeout-50*time.Millisecond {
+		t.Fatalf("expect the read held by pause, served after %s", elapsed)
+	}
+}
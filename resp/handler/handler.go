@@ -6,26 +6,56 @@ import (
 	"go-redis/config"
 	"go-redis/database"
 	databaseface "go-redis/interface/database"
+	"go-redis/interface/resp"
 	"go-redis/lib/logger"
 	"go-redis/lib/sync/atomic"
 	"go-redis/resp/connection"
 	"go-redis/resp/parser"
 	"go-redis/resp/reply"
-	"io"
 	"net"
 	"strings"
 	"sync"
+	"time"
 )
 
 var (
-	unknownErrReplyBytes = []byte("-ERR unknown\r\n")
+	unknownErrReply = reply.MakeErrReply("ERR unknown")
 )
 
+// states of the connections in activeConn
+const (
+	connActive = iota
+	// connPaused is held by CLIENT PAUSE, it is not idle while waiting
+	connPaused
+	// connClosingIdle is being closed by closeIdleClientsCron
+	connClosingIdle
+)
+
+// maxReplyBatch is the size at which buffered replies are sent without waiting for the rest of the pipeline
+const maxReplyBatch = 64 * 1024
+
+// flushBeforeRead sends the buffered replies of the client before waiting for more data from the connection,
+// it is called by the parser only when the commands received have been used up
+type flushBeforeRead struct {
+	net.Conn
+	client *connection.Connection
+}
+
+func (r *flushBeforeRead) Read(p []byte) (int, error) {
+	if err := r.client.Flush(); err != nil {
+		return 0, err
+	}
+	return r.Conn.Read(p)
+}
+
 // RespHandler implements tcp.Handler and serves as a redis handler
 type RespHandler struct {
-	activeConn sync.Map              // 用于存储当前活跃的客户端连接的同步哈希表
+	activeConn sync.Map              // 用于存储当前活跃的客户端连接的同步哈希表，value 为连接的状态
 	db         databaseface.Database // 处理Redis命令的数据库接口
 	closing    atomic.Boolean        // 记录服务器是否正在关闭，如果正在关闭，将拒绝新客户端和新请求
+	done       chan struct{}         // 关闭时 close，用于停止定时任务和唤醒被 CLIENT PAUSE 阻塞的客户端
+	doneOnce   sync.Once             // Close 可能被并发调用多次
+	pause      *clientPause          // CLIENT PAUSE 的状态
 }
 
 // MakeHandler creates a RespHandler instance
@@ -41,8 +71,41 @@ func MakeHandler() *RespHandler {
 	} else {
 		db = database.NewStandaloneDatabase()
 	}
-	return &RespHandler{
-		db: db,
+	h := &RespHandler{
+		db:    db,
+		done:  make(chan struct{}),
+		pause: makeClientPause(),
+	}
+	if config.Properties.Timeout > 0 {
+		go h.closeIdleClientsCron(time.Duration(config.Properties.Timeout) * time.Second)
+	}
+	return h
+}
+
+// closeIdleClientsCron closes the clients which have sent nothing for longer than timeout
+// 定时关闭超过 timeout 没有发送命令的客户端
+func (h *RespHandler) closeIdleClientsCron(timeout time.Duration) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+		}
+		h.activeConn.Range(func(key interface{}, val interface{}) bool {
+			client := key.(*connection.Connection)
+			// the clients held by CLIENT PAUSE are not idle, and the client being closed is skipped
+			if client.IdleTime() > timeout && h.activeConn.CompareAndSwap(client, connActive, connClosingIdle) {
+				logger.Info("closing idle client: " + client.RemoteAddr().String())
+				// Close waits for the reply being sent, don't let a slow client hold up the others.
+				// Handle finds the connection closed and cleans it up
+				go func() {
+					_ = client.Close()
+				}()
+			}
+			return true
+		})
 	}
 }
 
@@ -57,49 +120,68 @@ func (h *RespHandler) Handle(ctx context.Context, conn net.Conn) {
 	if h.closing.Get() {
 		// closing handler refuse new connection
 		_ = conn.Close()
+		return
 	}
 
 	client := connection.NewConn(conn)
-	h.activeConn.Store(client, 1)
-	ch := parser.ParseStream(conn)
-	for payload := range ch {
-		if payload.Err != nil {
-			// 先判断是否发送 EOF 或者 ErrUnexpectedEOF 信号，或者是否是网络连接关闭的错误，如果是，则关闭客户端连接
-			if payload.Err == io.EOF ||
-				payload.Err == io.ErrUnexpectedEOF ||
-				strings.Contains(payload.Err.Error(), "use of closed network connection") {
-				h.closeClient(client)
+	h.activeConn.Store(client, connActive)
+	// replies are buffered until the commands received are used up, so a pipeline is replied in one write
+	reader := parser.NewReader(&flushBeforeRead{Conn: conn, client: client})
+	defer reader.Release()
+	reader.SetLimits(parser.Limits{
+		MaxBulkLen:       config.Properties.ProtoMaxBulkLen,
+		MaxMultiBulkLen:  config.Properties.ProtoMaxMultiBulkLen,
+		QueryBufferLimit: config.Properties.ClientQueryBufferLimit,
+	})
+	for {
+		args, err := reader.ReadCommand()
+		if err != nil {
+			if errReply, ok := err.(*reply.ProtocolErrReply); ok {
+				// 协议解析错误，返回错误信息后关闭连接，因为无法确定下一条命令从哪里开始
+				_ = client.Write(errReply.ToBytes())
+				logger.Info("protocol error from " + client.RemoteAddr().String() + ": " + errReply.Msg)
+			} else {
+				// EOF、连接被关闭等 IO 错误，关闭客户端连接
 				logger.Info("connection closed: " + client.RemoteAddr().String())
-				return
 			}
-			// 协议解析错误，返回错误信息
-			errReply := reply.MakeErrReply(payload.Err.Error())
-			err := client.Write(errReply.ToBytes())
-			if err != nil {
-				h.closeClient(client)
-				logger.Info("connection closed: " + client.RemoteAddr().String())
-				return
+			h.closeClient(client)
+			return
+		}
+		client.Touch()
+		client.RecordCmd(args)
+		cmdName := strings.ToLower(string(args[0]))
+		var result resp.Reply
+		closeSelf := false
+		if cmdName == "client" && !client.InMultiState() {
+			// CLIENT commands need all the connections, so they are executed by handler rather than db
+			result, closeSelf = h.handleClientCmd(client, args)
+		} else if cmdName == "hello" && !client.InMultiState() {
+			result = execHello(client, args[1:])
+		} else {
+			isWrite := isWriteCommand(client, cmdName)
+			if h.pause.isPaused(isWrite) {
+				// don't hold the replies of the previous commands while waiting
+				_ = client.Flush()
+				h.activeConn.CompareAndSwap(client, connActive, connPaused)
+				h.pause.wait(isWrite, h.done)
+				h.activeConn.CompareAndSwap(client, connPaused, connActive)
+				// the idle time counts from the end of the pause
+				client.Touch()
 			}
-			continue
+			result = h.db.Exec(client, args)
 		}
-		// 如果 payload.Data 为空，则说明没有接收到任何数据，直接跳过
-		if payload.Data == nil {
-			logger.Error("empty payload")
-			continue
+		if result == nil {
+			result = unknownErrReply
 		}
-		// 尝试转换为 MultiBulkReply 类型，如果转换失败，则跳过这次解析
-		// 为什么要转换为 MultiBulkReply 类型呢？因为 Redis 的命令都是以 MultiBulkReply 类型的数组来表示的
-		// 比如：*2\r\n$3\r\nSET\r\n$3\r\nkey\r\n
-		r, ok := payload.Data.(*reply.MultiBulkReply)
-		if !ok {
-			logger.Error("require multi bulk reply")
-			continue
+		client.WriteReply(result)
+		if client.Buffered() >= maxReplyBatch {
+			_ = client.Flush()
 		}
-		result := h.db.Exec(client, r.Args)
-		if result != nil {
-			_ = client.Write(result.ToBytes())
-		} else {
-			_ = client.Write(unknownErrReplyBytes)
+		if closeSelf {
+			_ = client.Flush()
+			h.closeClient(client)
+			logger.Info("connection killed: " + client.RemoteAddr().String())
+			return
 		}
 	}
 }
@@ -108,6 +190,9 @@ func (h *RespHandler) Handle(ctx context.Context, conn net.Conn) {
 func (h *RespHandler) Close() error {
 	logger.Info("handler shutting down...")
 	h.closing.Set(true)
+	h.doneOnce.Do(func() {
+		close(h.done)
+	})
 	// TODO: concurrent wait
 	h.activeConn.Range(func(key interface{}, val interface{}) bool {
 		client := key.(*connection.Connection)
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"context"
+	"go-redis/config"
+	"go-redis/resp/parser"
+	"go-redis/resp/reply"
+	"go-redis/tcp"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serve starts a handler with a standalone database without persistence on a loopback address
+func serve(t *testing.T, properties *config.ServerProperties) (*RespHandler, string) {
+	t.Helper()
+	properties.RDBFilename = filepath.Join(t.TempDir(), "dump.rdb")
+	config.Properties = properties
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := MakeHandler()
+	closeChan := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		tcp.ListenAndServe(listener, h, &tcp.Config{}, closeChan)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		close(closeChan)
+		<-done
+	})
+	return h, listener.Addr().String()
+}
+
+// testClient sends commands and reads replies in RESP2 encoding
+type testClient struct {
+	conn   net.Conn
+	reader *parser.Reader
+}
+
+func dial(t *testing.T, addr string) *testClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return &testClient{conn: conn, reader: parser.NewReader(conn)}
+}
+
+func (c *testClient) send(t *testing.T, args ...string) {
+	t.Helper()
+	cmdLine := make([][]byte, len(args))
+	for i, arg := range args {
+		cmdLine[i] = []byte(arg)
+	}
+	if _, err := c.conn.Write(reply.MakeMultiBulkReply(cmdLine).ToBytes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// read returns the next reply, it fails if nothing is received in 5 seconds
+func (c *testClient) read(t *testing.T) string {
+	t.Helper()
+	_ = c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	result, err := c.reader.ReadReply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(result.ToBytes())
+}
+
+// do sends the command and returns its reply
+func (c *testClient) do(t *testing.T, args ...string) string {
+	t.Helper()
+	c.send(t, args...)
+	return c.read(t)
+}
+
+// waitClosed checks the server closes the connection within the timeout
+func (c *testClient) waitClosed(t *testing.T, timeout time.Duration) {
+	t.Helper()
+	_ = c.conn.SetReadDeadline(time.Now().Add(timeout))
+	if _, err := c.reader.ReadReply(); err != io.EOF {
+		t.Fatalf("expect connection closed, got %v", err)
+	}
+}
+
+// TestCloseIdleClients checks the idle clients are closed, while the clients held by CLIENT PAUSE are not
+func TestCloseIdleClients(t *testing.T) {
+	_, addr := serve(t, &config.ServerProperties{Timeout: 1})
+	idle := dial(t, addr)
+	if got := idle.do(t, "PING"); got != "+PONG\r\n" {
+		t.Fatalf("expect PONG, got %q", got)
+	}
+	admin := dial(t, addr)
+	if got := admin.do(t, "CLIENT", "PAUSE", "3500", "WRITE"); got != "+OK\r\n" {
+		t.Fatalf("expect OK, got %q", got)
+	}
+	paused := dial(t, addr)
+	start := time.Now()
+	paused.send(t, "SET", "k", "v")
+
+	idle.waitClosed(t, 3*time.Second)
+	if got := paused.read(t); got != "+OK\r\n" {
+		t.Fatalf("expect the paused client served after pause, got %q", got)
+	}
+	if elapsed := time.Since(start); elapsed < 3*time.Second {
+		t.Fatalf("expect the write held by pause, served after %s", elapsed)
+	}
+	// the idle time counts from the end of the pause
+	if got := paused.do(t, "GET", "k"); got != "$1\r\nv\r\n" {
+		t.Fatalf("expect v, got %q", got)
+	}
+	paused.waitClosed(t, 3*time.Second)
+}
+
+// countingConn counts the writes of the handler to the connection
+type countingConn struct {
+	net.Conn
+	writes int32
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	atomic.AddInt32(&c.writes, 1)
+	return c.Conn.Write(b)
+}
+
+// waitOmem waits until CLIENT LIST shows the output buffer of the only client is the given size
+func waitOmem(t *testing.T, h *RespHandler, omem int) {
+	t.Helper()
+	field := " omem=" + strconv.Itoa(omem) + " "
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		clients := h.clients()
+		if len(clients) == 1 && strings.Contains(clients[0].Info(), field) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expect%s, got %v", field, clients)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestPipelineCoalesced checks the replies of a pipeline are sent in one write, and omem counts them until sent
+func TestPipelineCoalesced(t *testing.T) {
+	h, _ := serve(t, &config.ServerProperties{})
+	serverSide, clientSide := net.Pipe()
+	conn := &countingConn{Conn: serverSide}
+	done := make(chan struct{})
+	go func() {
+		h.Handle(context.Background(), conn)
+		close(done)
+	}()
+	defer func() {
+		_ = clientSide.Close()
+		<-done
+	}()
+
+	const n = 50
+	var pipeline, want strings.Builder
+	for i := 1; i <= n; i++ {
+		pipeline.Write(reply.MakeMultiBulkReply([][]byte{[]byte("INCR"), []byte("n")}).ToBytes())
+		want.WriteString(":" + strconv.Itoa(i) + "\r\n")
+	}
+	// the pipeline fits in the read buffer of the handler, so it is received by one read
+	if _, err := clientSide.Write([]byte(pipeline.String())); err != nil {
+		t.Fatal(err)
+	}
+	// the write is blocked until the client reads, the replies are counted as output meanwhile
+	waitOmem(t, h, want.Len())
+	got := make([]byte, want.Len())
+	if _, err := io.ReadFull(clientSide, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want.String() {
+		t.Fatalf("expect %q, got %q", want.String(), got)
+	}
+	waitOmem(t, h, 0)
+	if writes := atomic.LoadInt32(&conn.writes); writes != 1 {
+		t.Fatalf("expect replies sent in one write, got %d writes", writes)
+	}
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"go-redis/config"
+	"go-redis/database"
+	"go-redis/interface/resp"
+	"go-redis/resp/connection"
+	"go-redis/resp/reply"
+	"strconv"
+	"strings"
+)
+
+// serverVersion is reported by HELLO, clients use it to decide the features they can use
+const serverVersion = "7.0.0"
+
+// execHello implements HELLO [protover [AUTH username password] [SETNAME clientname]],
+// it switches the protocol of replies between RESP2 and RESP3
+// 协商连接使用的协议版本，同时可以完成认证和设置客户端名称
+func execHello(client *connection.Connection, args [][]byte) resp.Reply {
+	protocol := client.GetProtocol()
+	if len(args) > 0 {
+		ver, err := strconv.ParseInt(string(args[0]), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR Protocol version is not an integer or out of range")
+		}
+		if ver != 2 && ver != 3 {
+			return reply.MakeErrReply("NOPROTO unsupported protocol version")
+		}
+		protocol = int(ver)
+	}
+	var authArgs [][]byte
+	var name []byte
+	for i := 1; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		switch {
+		case option == "auth" && i+2 < len(args):
+			authArgs = args[i+1 : i+3]
+			i += 2
+		case option == "setname" && i+1 < len(args):
+			name = args[i+1]
+			i++
+		default:
+			return reply.MakeErrReply("ERR Syntax error in HELLO option '" + string(args[i]) + "'")
+		}
+	}
+	if authArgs != nil {
+		if result := database.Auth(client, authArgs); reply.IsErrorReply(result) {
+			return result
+		}
+	} else if !database.IsAuthenticated(client) {
+		return reply.MakeErrReply("NOAUTH HELLO must be called with the client already authenticated, " +
+			"otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client " +
+			"and select the RESP protocol version at the same time")
+	}
+	if name != nil {
+		if !isValidClientName(string(name)) {
+			return errInvalidClientName
+		}
+		client.SetName(string(name))
+	}
+	client.SetProtocol(protocol)
+
+	mode := "standalone"
+	if config.Properties.Self != "" && len(config.Properties.Peers) > 0 {
+		mode = "cluster"
+	}
+	return reply.MakeMapReply([]resp.Reply{
+		reply.MakeBulkReply([]byte("server")), reply.MakeBulkReply([]byte("redis")),
+		reply.MakeBulkReply([]byte("version")), reply.MakeBulkReply([]byte(serverVersion)),
+		reply.MakeBulkReply([]byte("proto")), reply.MakeIntReply(int64(protocol)),
+		reply.MakeBulkReply([]byte("id")), reply.MakeIntReply(int64(client.GetID())),
+		reply.MakeBulkReply([]byte("mode")), reply.MakeBulkReply([]byte(mode)),
+		reply.MakeBulkReply([]byte("role")), reply.MakeBulkReply([]byte("master")),
+		reply.MakeBulkReply([]byte("modules")), &reply.EmptyMultiBulkReply{},
+	})
+}
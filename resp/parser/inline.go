@@ -0,0 +1,173 @@
+package parser
+
+import (
+	"bufio"
+	"go-redis/interface/resp"
+	"go-redis/resp/reply"
+	"strconv"
+)
+
+// maxInlineSize is the max length of an inline command
+const maxInlineSize = 64 * 1024
+
+var (
+	errUnbalancedQuotes = &reply.ProtocolErrReply{Msg: "unbalanced quotes in request"}
+	errTooBigInline     = &reply.ProtocolErrReply{Msg: "too big inline request"}
+)
+
+// readCommand reads a command sent by client, a command starting with '*' is multi bulk,
+// otherwise it is an inline command like `SET key "hello world"`, which is typed over telnet
+// 读取客户端发送的命令，以 '*' 开头的是 multi bulk 格式，其它的是 telnet 等工具输入的内联命令
+func readCommand(bufReader *bufio.Reader) (resp.Reply, bool, error) {
+	for {
+		first, err := bufReader.Peek(1)
+		if err != nil {
+			return nil, true, err
+		}
+		if first[0] == '*' {
+			return readReply(bufReader)
+		}
+		args, ioErr, err := readInline(bufReader)
+		if err != nil {
+			return nil, ioErr, err
+		}
+		if len(args) == 0 {
+			// empty lines are ignored
+			continue
+		}
+		return reply.MakeMultiBulkReply(args), false, nil
+	}
+}
+
+// readInline reads a line of inline command and splits it into arguments, the line is at most maxInlineSize bytes
+func readInline(bufReader *bufio.Reader) ([][]byte, bool, error) {
+	line, err := bufReader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		// the line is longer than the read buffer
+		line = append([]byte(nil), line...)
+		for err == bufio.ErrBufferFull && len(line) <= maxInlineSize {
+			var more []byte
+			more, err = bufReader.ReadSlice('\n')
+			line = append(line, more...)
+		}
+	}
+	if err == bufio.ErrBufferFull || len(line) > maxInlineSize {
+		return nil, false, errTooBigInline
+	}
+	if err != nil {
+		return nil, true, err
+	}
+	// the line may end with LF only, eg. sent by nc
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	args, err := splitArgs(line)
+	if err != nil {
+		return nil, false, err
+	}
+	return args, false, nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// splitArgs splits a line into arguments the same way as redis-cli:
+// arguments are separated by spaces, and may be quoted by double quotes with escapes like \n, \t and \xff,
+// or by single quotes in which only \' is escaped. A closing quote must be followed by a space or the end of line
+func splitArgs(line []byte) ([][]byte, error) {
+	var args [][]byte
+	i := 0
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i == len(line) {
+			return args, nil
+		}
+		var arg []byte
+		inDoubleQuotes := false
+		inSingleQuotes := false
+		done := false
+		for !done {
+			if inDoubleQuotes {
+				if i == len(line) {
+					return nil, errUnbalancedQuotes
+				}
+				c := line[i]
+				if c == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHexDigit(line[i+2]) && isHexDigit(line[i+3]) {
+					b, _ := strconv.ParseUint(string(line[i+2:i+4]), 16, 8)
+					arg = append(arg, byte(b))
+					i += 3
+				} else if c == '\\' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						arg = append(arg, '\n')
+					case 'r':
+						arg = append(arg, '\r')
+					case 't':
+						arg = append(arg, '\t')
+					case 'b':
+						arg = append(arg, '\b')
+					case 'a':
+						arg = append(arg, '\a')
+					default:
+						arg = append(arg, line[i])
+					}
+				} else if c == '"' {
+					// closing quote must be followed by a space or nothing at all
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, errUnbalancedQuotes
+					}
+					done = true
+				} else {
+					arg = append(arg, c)
+				}
+			} else if inSingleQuotes {
+				if i == len(line) {
+					return nil, errUnbalancedQuotes
+				}
+				c := line[i]
+				if c == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					arg = append(arg, '\'')
+				} else if c == '\'' {
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, errUnbalancedQuotes
+					}
+					done = true
+				} else {
+					arg = append(arg, c)
+				}
+			} else {
+				if i == len(line) {
+					break
+				}
+				switch c := line[i]; {
+				case isSpace(c):
+					done = true
+				case c == '"':
+					inDoubleQuotes = true
+				case c == '\'':
+					inSingleQuotes = true
+				default:
+					arg = append(arg, c)
+				}
+			}
+			if i < len(line) {
+				i++
+			}
+		}
+		if arg == nil {
+			// "" is an empty argument rather than no argument
+			arg = []byte{}
+		}
+		args = append(args, arg)
+	}
+}
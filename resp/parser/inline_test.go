@@ -0,0 +1,63 @@
+package parser
+
+import (
+	"testing"
+)
+
+// the cases of sdssplitargs in redis
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+		// wantErr means the quotes are unbalanced
+		wantErr bool
+	}{
+		{line: "", want: nil},
+		{line: "   \t ", want: nil},
+		{line: "SET key value", want: []string{"SET", "key", "value"}},
+		{line: "  SET \t key   value  ", want: []string{"SET", "key", "value"}},
+		{line: `SET key "hello world"`, want: []string{"SET", "key", "hello world"}},
+		{line: `SET key 'hello world'`, want: []string{"SET", "key", "hello world"}},
+		{line: `SET key ""`, want: []string{"SET", "key", ""}},
+		{line: `SET key ''`, want: []string{"SET", "key", ""}},
+		{line: `"a\nb\rc\td\be\af\\g\"h"`, want: []string{"a\nb\rc\td\be\af\\g\"h"}},
+		{line: `"\x41\x6a\xff"`, want: []string{"Aj\xff"}},
+		// an invalid hex escape is kept as x followed by the characters
+		{line: `"\x4g"`, want: []string{"x4g"}},
+		{line: `"\q"`, want: []string{"q"}},
+		{line: `'it\'s'`, want: []string{"it's"}},
+		// only \' is escaped in single quotes
+		{line: `'a\nb'`, want: []string{`a\nb`}},
+		// a quote inside a word starts quoting as well
+		{line: `a"b c"`, want: []string{"ab c"}},
+		{line: `"a b"c`, wantErr: true},
+		{line: `'a b'c`, wantErr: true},
+		{line: `"unterminated`, wantErr: true},
+		{line: `'unterminated`, wantErr: true},
+		{line: `"ends with escape\`, wantErr: true},
+		{line: `"a" 'b' c`, want: []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		args, err := splitArgs([]byte(tt.line))
+		if tt.wantErr {
+			if err != errUnbalancedQuotes {
+				t.Errorf("%q: expect unbalanced quotes, got %q %v", tt.line, args, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.line, err)
+			continue
+		}
+		if len(args) != len(tt.want) {
+			t.Errorf("%q: expect %q, got %q", tt.line, tt.want, args)
+			continue
+		}
+		for i, arg := range args {
+			if string(arg) != tt.want[i] {
+				t.Errorf("%q: expect %q, got %q", tt.line, tt.want, args)
+				break
+			}
+		}
+	}
+}
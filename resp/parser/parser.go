@@ -2,14 +2,14 @@ package parser
 
 import (
 	"bufio"
-	"errors"
 	"go-redis/interface/resp"
 	"go-redis/lib/logger"
 	"go-redis/resp/reply"
 	"io"
+	"math"
+	"math/big"
 	"runtime/debug"
 	"strconv"
-	"strings"
 )
 
 // Payload stores redis.Reply or error
@@ -18,27 +18,25 @@ type Payload struct {
 	Err  error
 }
 
-// ParseStream reads data from io.Reader and send payloads through channel
+// ParseStream reads replies from io.Reader and send payloads through channel
 // 从io.Reader中读取数据，并通过通道发送负载
 func ParseStream(reader io.Reader) <-chan *Payload {
 	ch := make(chan *Payload)
-	go parse0(reader, ch)
+	go parse0(reader, ch, readReply)
 	return ch
 }
 
-type readState struct {
-	readingMultiLine  bool     // 是否在读取多行
-	expectedArgsCount int      // 期望的参数个数
-	msgType           byte     // 消息类型
-	args              [][]byte // 已经解析的参数
-	bulkLen           int64    // 字节长度
+// ParseCommandStream reads commands sent by clients, including inline commands, and send payloads through channel
+func ParseCommandStream(reader io.Reader) <-chan *Payload {
+	ch := make(chan *Payload)
+	go parse0(reader, ch, readCommand)
+	return ch
 }
 
-func (s *readState) finished() bool {
-	return s.expectedArgsCount > 0 && len(s.args) == s.expectedArgsCount
-}
+// readFunc reads a payload, ioErr tells whether err is an io error
+type readFunc func(bufReader *bufio.Reader) (result resp.Reply, ioErr bool, err error)
 
-func parse0(reader io.Reader, ch chan<- *Payload) {
+func parse0(reader io.Reader, ch chan<- *Payload, read readFunc) {
 	// 延迟函数会在函数执行完毕后执行
 	// 该延迟函数首先检查是否有发生了panic，如果有，就将调用logger.Error函数并将堆栈信息输出到日志中。
 	defer func() {
@@ -47,206 +45,257 @@ func parse0(reader io.Reader, ch chan<- *Payload) {
 		}
 	}()
 	bufReader := bufio.NewReader(reader)
-	var state readState
-	var err error
-	var msg []byte
 	for {
-		// read line
-		var ioErr bool
-		msg, ioErr, err = readLine(bufReader, &state)
+		result, ioErr, err := read(bufReader)
 		if err != nil {
+			ch <- &Payload{
+				Err: err,
+			}
 			if ioErr { // 先判断是不是 IO error，如果是，就关闭 channel 并返回
-				ch <- &Payload{
-					Err: err,
-				}
 				close(ch)
 				return
 			}
-			/// 不是 IO error，是协议错误，就将错误信息发送到 channel 中
-			ch <- &Payload{
-				Err: err,
-			}
+			// 不是 IO error，是协议错误，发送错误信息后继续读取下一行
 			continue
 		}
-
-		// 判断不是在读取多行
-		if !state.readingMultiLine {
-			// 判断是不是以 * 开头，如果是，就是多行
-			if msg[0] == '*' {
-				err := parseMultiBulkHeader(msg, &state)
-				if err != nil {
-					ch <- &Payload{
-						Err: errors.New("protocol error: " + string(msg)),
-					}
-					state = readState{}
-					continue
-				}
-				// 检查多行回复消息中预期的参数数量，如果为 0，则发送一个空的回复消息给 Redis 客户端
-				if state.expectedArgsCount == 0 {
-					ch <- &Payload{
-						Data: &reply.EmptyMultiBulkReply{},
-					}
-					state = readState{}
-					continue
-				}
-			} else if msg[0] == '$' { // 判断是不是以 $ 开头，如果是，就是单行
-				err := parseBulkHeader(msg, &state)
-				if err != nil {
-					ch <- &Payload{
-						Err: errors.New("protocol error: " + string(msg)),
-					}
-					state = readState{}
-					continue
-				}
-				// 字节长度为 -1，表示空的 bulk reply
-				if state.bulkLen == -1 {
-					ch <- &Payload{
-						Data: &reply.NullBulkReply{},
-					}
-					state = readState{}
-					continue
-				}
-			} else {
-				result, err := parseSingleLineReply(msg)
-				ch <- &Payload{
-					Data: result,
-					Err:  err,
-				}
-				state = readState{}
-				continue
-			}
-		} else {
-			// 如果是在读取多行，就调用 readBody 函数来解析多行消息
-			err = readBody(msg, &state)
-			if err != nil {
-				ch <- &Payload{
-					Err: errors.New("protocol error: " + string(msg)),
-				}
-				state = readState{}
-				continue
-			}
-			if state.finished() {
-				var result resp.Reply
-				if state.msgType == '*' {
-					result = reply.MakeMultiBulkReply(state.args)
-				} else if state.msgType == '$' {
-					result = reply.MakeBulkReply(state.args[0])
-				}
-				ch <- &Payload{
-					Data: result,
-					Err:  err,
-				}
-				state = readState{}
-			}
+		ch <- &Payload{
+			Data: result,
 		}
 	}
 }
 
-func readLine(bufReader *bufio.Reader, state *readState) ([]byte, bool, error) {
-	var msg []byte
-	var err error
-	if state.bulkLen == 0 { // read normal line
-		msg, err = bufReader.ReadBytes('\n')
-		if err != nil {
-			return nil, true, err
-		}
-		if len(msg) == 0 || msg[len(msg)-2] != '\r' {
-			return nil, false, errors.New("protocol error: " + string(msg))
-		}
-	} else { // read bulk line (binary safe)
-		msg = make([]byte, state.bulkLen+2) // 创建一个切片
-		_, err = io.ReadFull(bufReader, msg)
-		if err != nil {
-			return nil, true, err
-		}
-		if len(msg) == 0 ||
-			msg[len(msg)-2] != '\r' ||
-			msg[len(msg)-1] != '\n' {
-			// 检查读取的行是否以"\r\n"结尾，如果不是，就返回错误
-			return nil, false, errors.New("protocol error: " + string(msg))
-		}
-		state.bulkLen = 0
+func protocolError(line []byte) error {
+	return &reply.ProtocolErrReply{Msg: "unexpected line " + strconv.Quote(string(line))}
+}
+
+// readLine reads a line and returns it without CRLF, ioErr tells whether err is an io error.
+// The line is a slice of the read buffer if it fits in, so it is only valid until the next read
+func readLine(bufReader *bufio.Reader) (line []byte, ioErr bool, err error) {
+	msg, err := bufReader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		// the line is longer than the read buffer
+		msg = append([]byte(nil), msg...)
+		var rest []byte
+		rest, err = bufReader.ReadBytes('\n')
+		msg = append(msg, rest...)
 	}
-	return msg, false, nil
+	if err != nil {
+		return nil, true, err
+	}
+	if len(msg) < 2 || msg[len(msg)-2] != '\r' {
+		return nil, false, protocolError(msg)
+	}
+	return msg[:len(msg)-2], false, nil
 }
 
-// 用于解析多条消息的 header
-func parseMultiBulkHeader(msg []byte, state *readState) error {
-	var err error
-	var expectedLine uint64
-	expectedLine, err = strconv.ParseUint(string(msg[1:len(msg)-2]), 10, 32) // 从msg中解析出期望的参数个数
+// readBlob reads a binary safe string of the given size followed by CRLF
+func readBlob(bufReader *bufio.Reader, size int64) ([]byte, bool, error) {
+	msg := make([]byte, size+2)
+	_, err := io.ReadFull(bufReader, msg)
 	if err != nil {
-		return errors.New("protocol error: " + string(msg))
-	}
-	if expectedLine == 0 {
-		state.expectedArgsCount = 0
-		return nil
-	} else if expectedLine > 0 {
-		// first line of multi bulk reply
-		state.msgType = msg[0]
-		state.readingMultiLine = true
-		state.expectedArgsCount = int(expectedLine)
-		state.args = make([][]byte, 0, expectedLine)
-		return nil
-	} else {
-		return errors.New("protocol error: " + string(msg))
+		return nil, true, err
+	}
+	if msg[size] != '\r' || msg[size+1] != '\n' {
+		// 检查读取的行是否以"\r\n"结尾，如果不是，就返回错误
+		return nil, false, protocolError(msg)
+	}
+	return msg[:size], false, nil
+}
+
+// readBlobOf reads the string of a header line like `$5`, it returns nil for `$-1`
+func readBlobOf(bufReader *bufio.Reader, line []byte) ([]byte, bool, error) {
+	size, ok := parseLength(line[1:])
+	if !ok || size < -1 || (size == -1 && line[0] != '$') {
+		return nil, false, protocolError(line)
+	}
+	if size == -1 {
+		return nil, false, nil
+	}
+	return readBlob(bufReader, int64(size))
+}
+
+// readElements reads n replies of an aggregate type
+func readElements(bufReader *bufio.Reader, n int) ([]resp.Reply, bool, error) {
+	capacity := n
+	if capacity > maxPreallocArgs {
+		capacity = maxPreallocArgs
+	}
+	elements := make([]resp.Reply, 0, capacity)
+	for i := 0; i < n; i++ {
+		element, ioErr, err := readReply(bufReader)
+		if err != nil {
+			return nil, ioErr, err
+		}
+		elements = append(elements, element)
 	}
+	return elements, false, nil
 }
 
-func parseBulkHeader(msg []byte, state *readState) error {
-	var err error
-	state.bulkLen, err = strconv.ParseInt(string(msg[1:len(msg)-2]), 10, 64)
+// readReply reads a complete reply of RESP2 or RESP3, aggregate types are read recursively.
+// An array of strings is returned as MultiBulkReply, which is the form of commands sent by clients
+// 读取一个完整的 RESP2/RESP3 消息，嵌套的聚合类型递归读取
+func readReply(bufReader *bufio.Reader) (resp.Reply, bool, error) {
+	line, ioErr, err := readLine(bufReader)
 	if err != nil {
-		return errors.New("protocol error: " + string(msg))
-	}
-	if state.bulkLen == -1 { // null bulk
-		return nil
-	} else if state.bulkLen > 0 {
-		state.msgType = msg[0]
-		state.readingMultiLine = true
-		state.expectedArgsCount = 1
-		state.args = make([][]byte, 0, 1)
-		return nil
-	} else {
-		return errors.New("protocol error: " + string(msg))
+		return nil, ioErr, err
 	}
+	return readReplyOf(bufReader, line)
 }
 
-// 实现了解析 Redis 协议中的单行回复的功能
-func parseSingleLineReply(msg []byte) (resp.Reply, error) {
-	str := strings.TrimSuffix(string(msg), "\r\n")
-	var result resp.Reply
-	switch msg[0] {
+// readReplyOf reads the rest of the reply whose first line has been read
+func readReplyOf(bufReader *bufio.Reader, line []byte) (resp.Reply, bool, error) {
+	if len(line) == 0 {
+		return nil, false, protocolError(line)
+	}
+	// line is invalid after the next read
+	prefix := line[0]
+	switch prefix {
+	case '$', '!', '=': // bulk string, RESP3 blob error and verbatim string
+		blob, ioErr, err := readBlobOf(bufReader, line)
+		if err != nil {
+			return nil, ioErr, err
+		}
+		if blob == nil {
+			// 字节长度为 -1，表示空的 bulk reply
+			return reply.MakeNullBulkReply(), false, nil
+		}
+		switch prefix {
+		case '!':
+			return reply.MakeErrReply(string(blob)), false, nil
+		case '=':
+			if len(blob) < 4 || blob[3] != ':' {
+				return nil, false, protocolError(blob)
+			}
+			return reply.MakeVerbatimStringReply(string(blob[:3]), blob[4:]), false, nil
+		}
+		return reply.MakeBulkReply(blob), false, nil
+	case '*', '%', '~', '>', '|': // array, RESP3 map, set, push and attribute
+		n, ok := parseLength(line[1:])
+		if !ok || n < -1 || (n == -1 && prefix != '*') {
+			return nil, false, protocolError(line)
+		}
+		if n == -1 {
+			return reply.MakeNullMultiBulkReply(), false, nil
+		}
+		if prefix == '*' {
+			if n == 0 {
+				return &reply.EmptyMultiBulkReply{}, false, nil
+			}
+			return readArray(bufReader, n)
+		}
+		count := n
+		if prefix == '%' || prefix == '|' {
+			count *= 2
+		}
+		elements, ioErr, err := readElements(bufReader, count)
+		if err != nil {
+			return nil, ioErr, err
+		}
+		switch prefix {
+		case '%':
+			return reply.MakeMapReply(elements), false, nil
+		case '~':
+			return reply.MakeSetReply(elements), false, nil
+		case '>':
+			return reply.MakePushReply(elements), false, nil
+		}
+		// attributes are followed by the reply they are attached to
+		attached, ioErr, err := readReply(bufReader)
+		if err != nil {
+			return nil, ioErr, err
+		}
+		return reply.MakeAttributeReply(elements, attached), false, nil
+	}
+	// the other types are a single line
+	body := string(line[1:])
+	switch prefix {
 	case '+': // status reply
-		result = reply.MakeStatusReply(str[1:])
+		return reply.MakeStatusReply(body), false, nil
 	case '-': // err reply
-		result = reply.MakeErrReply(str[1:])
+		return reply.MakeErrReply(body), false, nil
 	case ':': // int reply
-		val, err := strconv.ParseInt(str[1:], 10, 64)
+		val, err := strconv.ParseInt(body, 10, 64)
+		if err != nil {
+			return nil, false, protocolError(line)
+		}
+		return reply.MakeIntReply(val), false, nil
+	case '_': // RESP3 null
+		if body != "" {
+			return nil, false, protocolError(line)
+		}
+		return reply.MakeNullReply(), false, nil
+	case '#': // RESP3 boolean
+		if body != "t" && body != "f" {
+			return nil, false, protocolError(line)
+		}
+		return reply.MakeBoolReply(body == "t"), false, nil
+	case ',': // RESP3 double
+		val, err := parseDouble(body)
 		if err != nil {
-			return nil, errors.New("protocol error: " + string(msg))
+			return nil, false, protocolError(line)
 		}
-		result = reply.MakeIntReply(val)
+		return reply.MakeDoubleReply(val), false, nil
+	case '(': // RESP3 big number
+		if _, ok := new(big.Int).SetString(body, 10); !ok {
+			return nil, false, protocolError(line)
+		}
+		return reply.MakeBigNumberReply(body), false, nil
 	}
-	return result, nil
+	return nil, false, protocolError(line)
 }
 
-// read the non-first lines of multi bulk reply or bulk reply
-func readBody(msg []byte, state *readState) error {
-	line := msg[0 : len(msg)-2]
-	var err error
-	if line[0] == '$' {
-		// bulk reply
-		state.bulkLen, err = strconv.ParseInt(string(line[1:]), 10, 64)
+// readArray reads the n elements of an array. An array of strings, which is the form of commands,
+// is returned as MultiBulkReply without wrapping the strings in replies, otherwise MultiRawReply
+func readArray(bufReader *bufio.Reader, n int) (resp.Reply, bool, error) {
+	capacity := n
+	if capacity > maxPreallocArgs {
+		capacity = maxPreallocArgs
+	}
+	args := make([][]byte, 0, capacity)
+	for len(args) < n {
+		line, ioErr, err := readLine(bufReader)
+		if err != nil {
+			return nil, ioErr, err
+		}
+		if len(line) > 0 && line[0] == '$' {
+			arg, ioErr, err := readBlobOf(bufReader, line)
+			if err != nil {
+				return nil, ioErr, err
+			}
+			args = append(args, arg)
+			continue
+		}
+		// not an array of strings, the strings read are wrapped in replies
+		elements := make([]resp.Reply, len(args), capacity)
+		for i, arg := range args {
+			if arg == nil {
+				elements[i] = reply.MakeNullBulkReply()
+			} else {
+				elements[i] = reply.MakeBulkReply(arg)
+			}
+		}
+		element, ioErr, err := readReplyOf(bufReader, line)
 		if err != nil {
-			return errors.New("protocol error: " + string(msg))
+			return nil, ioErr, err
 		}
-		if state.bulkLen <= 0 { // null bulk in multi bulks
-			state.args = append(state.args, []byte{})
-			state.bulkLen = 0
+		rest, ioErr, err := readElements(bufReader, n-len(elements)-1)
+		if err != nil {
+			return nil, ioErr, err
 		}
-	} else {
-		state.args = append(state.args, line)
+		elements = append(append(elements, element), rest...)
+		return reply.MakeMultiRawReply(elements), false, nil
+	}
+	return reply.MakeMultiBulkReply(args), false, nil
+}
+
+func parseDouble(s string) (float64, error) {
+	switch s {
+	case "inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	case "nan":
+		return math.NaN(), nil
 	}
-	return nil
+	return strconv.ParseFloat(s, 64)
 }
@@ -0,0 +1,305 @@
+package parser
+
+import (
+	"bytes"
+	"go-redis/interface/resp"
+	"go-redis/resp/reply"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// readAllCommands reads commands until an error occurs
+func readAllCommands(reader *Reader) ([]string, error) {
+	var cmds []string
+	for {
+		args, err := reader.ReadCommand()
+		if err != nil {
+			return cmds, err
+		}
+		parts := make([]string, len(args))
+		for i, arg := range args {
+			parts[i] = string(arg)
+		}
+		cmds = append(cmds, strings.Join(parts, "|"))
+	}
+}
+
+func TestReaderReadCommand(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		// commands with arguments joined by '|'
+		want []string
+		// wantErr is the message of the protocol error, empty means the input ends with EOF
+		wantErr string
+	}{
+		{
+			name:  "multi bulk",
+			input: "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n",
+			want:  []string{"SET|key|value", "GET|key"},
+		},
+		{
+			name:  "empty and binary bulk",
+			input: "*3\r\n$3\r\nSET\r\n$0\r\n\r\n$4\r\na\r\nb\r\n",
+			want:  []string{"SET||a\r\nb"},
+		},
+		{
+			name:  "empty multi bulk is skipped",
+			input: "*0\r\n*-1\r\n*1\r\n$4\r\nPING\r\n",
+			want:  []string{"PING"},
+		},
+		{
+			name:  "inline",
+			input: "PING\r\nSET key \"hello world\"\n\r\n\nGET key\r\n",
+			want:  []string{"PING", "SET|key|hello world", "GET|key"},
+		},
+		{
+			name:  "inline mixed with multi bulk",
+			input: "PING\r\n*1\r\n$4\r\nPING\r\nECHO a\r\n",
+			want:  []string{"PING", "PING", "ECHO|a"},
+		},
+		{
+			name:    "invalid multi bulk length",
+			input:   "*1\r\n$4\r\nPING\r\n*x\r\n",
+			want:    []string{"PING"},
+			wantErr: "invalid multibulk length",
+		},
+		{
+			name:    "invalid bulk length",
+			input:   "*1\r\n$-2\r\n",
+			wantErr: "invalid bulk length",
+		},
+		{
+			name:    "expect bulk",
+			input:   "*1\r\n:1\r\n",
+			wantErr: `expected '$', got ":1"`,
+		},
+		{
+			name:    "bulk without CRLF",
+			input:   "*1\r\n$4\r\nPINGxx",
+			wantErr: "bulk string is not terminated by CRLF",
+		},
+		{
+			name:    "header without CR",
+			input:   "*1\n$4\r\nPING\r\n",
+			wantErr: `unexpected line "*1\n"`,
+		},
+		{
+			name:    "unbalanced quotes",
+			input:   "SET key \"value\r\n",
+			wantErr: "unbalanced quotes in request",
+		},
+		{
+			name:    "too big inline",
+			input:   "SET key " + strings.Repeat("a", maxInlineSize) + "\r\n",
+			wantErr: "too big inline request",
+		},
+		{
+			name:    "too big header",
+			input:   "*" + strings.Repeat("1", readerBufSize) + "\r\n",
+			wantErr: "too big mbulk count string",
+		},
+		{
+			name:  "incomplete command",
+			input: "*2\r\n$3\r\nGET\r\n$3\r\nke",
+		},
+	}
+	for _, tt := range tests {
+		// a one byte reader splits every token across reads
+		for _, split := range []bool{false, true} {
+			var rd io.Reader = strings.NewReader(tt.input)
+			if split {
+				rd = iotest.OneByteReader(rd)
+			}
+			reader := NewReader(rd)
+			cmds, err := readAllCommands(reader)
+			reader.Release()
+			if strings.Join(cmds, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("%s (split %v): expect commands %q, got %q", tt.name, split, tt.want, cmds)
+			}
+			if tt.wantErr == "" {
+				if err != io.EOF && err != io.ErrUnexpectedEOF {
+					t.Errorf("%s (split %v): expect EOF, got %v", tt.name, split, err)
+				}
+				continue
+			}
+			protocolErr, ok := err.(*reply.ProtocolErrReply)
+			if !ok {
+				t.Errorf("%s (split %v): expect protocol error, got %v", tt.name, split, err)
+				continue
+			}
+			if protocolErr.Msg != tt.wantErr {
+				t.Errorf("%s (split %v): expect error %q, got %q", tt.name, split, tt.wantErr, protocolErr.Msg)
+			}
+		}
+	}
+}
+
+func TestReaderReadLargeBulk(t *testing.T) {
+	// larger than the read buffer, and larger than the size preallocated before receiving
+	for _, size := range []int{readerBufSize + 1, maxPreallocBulk + 3, 3*maxPreallocBulk + 5} {
+		value := make([]byte, size)
+		for i := range value {
+			value[i] = byte(i)
+		}
+		cmd := reply.MakeMultiBulkReply([][]byte{[]byte("SET"), []byte("key"), value}).ToBytes()
+		cmd = append(cmd, "PING\r\n"...)
+		reader := NewReader(iotest.HalfReader(bytes.NewReader(cmd)))
+		args, err := reader.ReadCommand()
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if len(args) != 3 || !bytes.Equal(args[2], value) {
+			t.Fatalf("size %d: wrong value", size)
+		}
+		args, err = reader.ReadCommand()
+		if err != nil || len(args) != 1 || string(args[0]) != "PING" {
+			t.Fatalf("size %d: expect PING after the large bulk, got %q %v", size, args, err)
+		}
+		reader.Release()
+	}
+}
+
+func TestReaderLimits(t *testing.T) {
+	limits := Limits{
+		MaxBulkLen:       10,
+		MaxMultiBulkLen:  3,
+		QueryBufferLimit: 15,
+	}
+	tests := []struct {
+		input   string
+		wantErr string
+	}{
+		{"*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$10\r\n0123456789\r\n", ""},
+		{"*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$11\r\n", "invalid bulk length"},
+		{"*4\r\n", "invalid multibulk length"},
+		{"*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$10\r\n", "client query buffer limit reached"},
+		{"*2\r\n$3\r\nGET\r\n$9999999999\r\n", "invalid bulk length"},
+	}
+	for _, tt := range tests {
+		reader := NewReader(strings.NewReader(tt.input))
+		reader.SetLimits(limits)
+		_, err := reader.ReadCommand()
+		reader.Release()
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%q: expect no error, got %v", tt.input, err)
+			}
+			continue
+		}
+		if protocolErr, ok := err.(*reply.ProtocolErrReply); !ok || protocolErr.Msg != tt.wantErr {
+			t.Errorf("%q: expect error %q, got %v", tt.input, tt.wantErr, err)
+		}
+	}
+}
+
+func TestReaderReadReply(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply resp.Reply
+	}{
+		{"status", reply.MakeStatusReply("OK")},
+		{"error", reply.MakeErrReply("ERR something wrong")},
+		{"int", reply.MakeIntReply(-42)},
+		{"bulk", reply.MakeBulkReply([]byte("hello\r\nworld"))},
+		{"empty bulk", reply.MakeBulkReply([]byte{})},
+		{"null bulk", reply.MakeNullBulkReply()},
+		{"null array", reply.MakeNullMultiBulkReply()},
+		{"empty array", &reply.EmptyMultiBulkReply{}},
+		{"array of strings", reply.MakeMultiBulkReply([][]byte{[]byte("a"), nil, []byte("")})},
+		{"mixed array", reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeBulkReply([]byte("a")),
+			reply.MakeIntReply(1),
+			reply.MakeMultiBulkReply([][]byte{[]byte("b")}),
+			reply.MakeNullBulkReply(),
+		})},
+		{"null", reply.MakeNullReply()},
+		{"map", reply.MakeBulkMapReply([][]byte{[]byte("k1"), []byte("v1"), []byte("k2"), []byte("v2")})},
+		{"set", reply.MakeBulkSetReply([][]byte{[]byte("a"), []byte("b")})},
+		{"push", reply.MakePushReply([]resp.Reply{reply.MakeBulkReply([]byte("message")), reply.MakeIntReply(1)})},
+		{"attribute", reply.MakeAttributeReply(
+			[]resp.Reply{reply.MakeBulkReply([]byte("ttl")), reply.MakeIntReply(100)},
+			reply.MakeBulkReply([]byte("value")))},
+		{"double", reply.MakeDoubleReply(1.5)},
+		{"inf", reply.MakeDoubleReply(-1 / zero())},
+		{"bool", reply.MakeBoolReply(true)},
+		{"big number", reply.MakeBigNumberReply("3492890328409238509324850943850943825024385")},
+		{"verbatim string", reply.MakeVerbatimStringReply("txt", []byte("some text"))},
+	}
+	for _, tt := range tests {
+		for _, protocol := range []int{2, 3} {
+			data := reply.ToBytes(tt.reply, protocol)
+			// a trailing reply checks that nothing more or less is consumed
+			data = append(data, "+END\r\n"...)
+			reader := NewReader(iotest.OneByteReader(bytes.NewReader(data)))
+			result, err := reader.ReadReply()
+			if err != nil {
+				t.Errorf("%s (RESP%d): %v", tt.name, protocol, err)
+				reader.Release()
+				continue
+			}
+			if got := reply.ToBytes(result, protocol); !bytes.Equal(got, reply.ToBytes(tt.reply, protocol)) {
+				t.Errorf("%s (RESP%d): expect %q, got %q", tt.name, protocol, reply.ToBytes(tt.reply, protocol), got)
+			}
+			end, err := reader.ReadReply()
+			if err != nil || string(end.ToBytes()) != "+END\r\n" {
+				t.Errorf("%s (RESP%d): expect +END after the reply, got %v", tt.name, protocol, err)
+			}
+			reader.Release()
+		}
+	}
+}
+
+func zero() float64 {
+	return 0
+}
+
+func TestReaderReadReplyErrors(t *testing.T) {
+	tests := []string{
+		"\r\n",
+		"?what\r\n",
+		":abc\r\n",
+		"$-2\r\n",
+		"!-1\r\n",
+		"$3\r\nabcde\r\n",
+		"%-1\r\n",
+		"#x\r\n",
+		",1.2.3\r\n",
+		"(12a\r\n",
+		"=5\r\nabcde\r\n",
+		"_x\r\n",
+	}
+	for _, input := range tests {
+		reader := NewReader(strings.NewReader(input))
+		_, err := reader.ReadReply()
+		reader.Release()
+		if _, ok := err.(*reply.ProtocolErrReply); !ok {
+			t.Errorf("%q: expect protocol error, got %v", input, err)
+		}
+	}
+}
+
+// TestParseStream checks the channel based parsers give the same results as Reader
+func TestParseStream(t *testing.T) {
+	input := "*2\r\n$3\r\nGET\r\n$1\r\na\r\nPING\r\n*x\r\n*1\r\n$4\r\nPING\r\n"
+	var got []string
+	for payload := range ParseCommandStream(strings.NewReader(input)) {
+		if payload.Err != nil {
+			got = append(got, "err:"+payload.Err.Error())
+			continue
+		}
+		got = append(got, string(payload.Data.ToBytes()))
+	}
+	want := []string{
+		"*2\r\n$3\r\nGET\r\n$1\r\na\r\n",
+		"*1\r\n$4\r\nPING\r\n",
+		`err:ERR Protocol error: unexpected line "*x"`,
+		"*1\r\n$4\r\nPING\r\n",
+		"err:EOF",
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("expect %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,250 @@
+package parser
+
+import (
+	"bufio"
+	"go-redis/interface/resp"
+	"go-redis/resp/reply"
+	"io"
+	"strconv"
+	"sync"
+)
+
+const (
+	// readerBufSize is the size of the read buffer of a connection
+	readerBufSize = 16 * 1024
+	// arenaBlockSize is the size of the blocks which bulk strings are sliced out of
+	arenaBlockSize = 64 * 1024
+	// bulk strings larger than maxArenaBulk are allocated separately, so that they don't waste the blocks
+	maxArenaBulk = arenaBlockSize / 8
+	// bulk strings larger than maxPreallocBulk grow while being received, so that a client announcing
+	// a huge length cannot make the server allocate the memory before sending the data
+	maxPreallocBulk = 1024 * 1024
+	// the argument slice of a command is allocated for at most maxPreallocArgs arguments in advance
+	maxPreallocArgs = 1024
+)
+
+// bufReaderPool holds the read buffers of closed connections
+var bufReaderPool = sync.Pool{
+	New: func() interface{} {
+		return bufio.NewReaderSize(nil, readerBufSize)
+	},
+}
+
+// Limits protects the server from the commands which make it allocate too much memory, 0 means no limit
+type Limits struct {
+	// MaxBulkLen is the max length of a bulk string
+	MaxBulkLen int
+	// MaxMultiBulkLen is the max number of arguments of a command
+	MaxMultiBulkLen int
+	// QueryBufferLimit is the max total length of the arguments of a command
+	QueryBufferLimit int
+}
+
+// Reader parses commands and replies synchronously, without the goroutine and channel of ParseStream.
+// Lines are parsed in the read buffer without copying, and the bulk strings of commands are sliced out of
+// a shared arena block, so reading a command allocates the argument slice only most of the time.
+// The arena blocks are never reused after the strings are handed out, so the arguments stay valid however
+// long they are kept. A small argument kept for long would hold the whole block, so database copies
+// the arguments of write commands before storing them as values
+// 同步解析命令和回复：行数据直接在读缓冲区中解析，参数从共享的内存块中切分，避免逐个分配；
+// 数据库在保存写命令的参数前会复制它们，避免一个小的值占住整个内存块
+type Reader struct {
+	reader *bufio.Reader
+	// arena is the unused part of the current block
+	arena  []byte
+	limits Limits
+}
+
+// NewReader creates a Reader reading from rd, Release should be called after using it
+func NewReader(rd io.Reader) *Reader {
+	bufReader := bufReaderPool.Get().(*bufio.Reader)
+	bufReader.Reset(rd)
+	return &Reader{
+		reader: bufReader,
+	}
+}
+
+// Release puts the read buffer back to pool, the Reader cannot be used after it
+func (r *Reader) Release() {
+	r.reader.Reset(nil)
+	bufReaderPool.Put(r.reader)
+	r.reader = nil
+	r.arena = nil
+}
+
+// SetLimits sets the limits of the commands read by ReadCommand
+func (r *Reader) SetLimits(limits Limits) {
+	r.limits = limits
+}
+
+// Buffered returns the number of bytes which have been received but not parsed
+func (r *Reader) Buffered() int {
+	return r.reader.Buffered()
+}
+
+// alloc returns n bytes sliced out of the arena
+func (r *Reader) alloc(n int) []byte {
+	if n > maxArenaBulk {
+		return make([]byte, n)
+	}
+	if len(r.arena) < n {
+		r.arena = make([]byte, arenaBlockSize)
+	}
+	// limit the capacity, so that appending to the string doesn't overwrite the next one
+	b := r.arena[:n:n]
+	r.arena = r.arena[n:]
+	return b
+}
+
+// parseLength parses the length in header line like `*3` or `$5` without allocation
+func parseLength(b []byte) (int, bool) {
+	if len(b) == 0 || len(b) > 10 {
+		return 0, false
+	}
+	negative := b[0] == '-'
+	if negative {
+		b = b[1:]
+		if len(b) == 0 {
+			return 0, false
+		}
+	}
+	n := 0
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+	if negative {
+		return -n, true
+	}
+	return n, true
+}
+
+// ReadCommand reads a command sent by client, either in multi bulk or inline.
+// Empty commands are skipped. It returns *reply.ProtocolErrReply if the data breaks the protocol or the limits,
+// other errors are io errors
+func (r *Reader) ReadCommand() ([][]byte, error) {
+	for {
+		first, err := r.reader.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		var args [][]byte
+		if first[0] == '*' {
+			args, err = r.readMultiBulk()
+		} else {
+			args, _, err = readInline(r.reader)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(args) > 0 {
+			return args, nil
+		}
+	}
+}
+
+// readHeader reads a header line like `*3` or `$5` in the read buffer, a line longer than the buffer must be garbage
+func (r *Reader) readHeader(tooBigMsg string) ([]byte, error) {
+	line, err := r.reader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, &reply.ProtocolErrReply{Msg: tooBigMsg}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, protocolError(line)
+	}
+	return line[:len(line)-2], nil
+}
+
+// readMultiBulk reads a command like `*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n`
+func (r *Reader) readMultiBulk() ([][]byte, error) {
+	line, err := r.readHeader("too big mbulk count string")
+	if err != nil {
+		return nil, err
+	}
+	n, ok := parseLength(line[1:])
+	if !ok || (r.limits.MaxMultiBulkLen > 0 && n > r.limits.MaxMultiBulkLen) {
+		return nil, &reply.ProtocolErrReply{Msg: "invalid multibulk length"}
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+	capacity := n
+	if capacity > maxPreallocArgs {
+		capacity = maxPreallocArgs
+	}
+	args := make([][]byte, 0, capacity)
+	total := 0
+	for len(args) < n {
+		line, err = r.readHeader("too big bulk count string")
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, &reply.ProtocolErrReply{Msg: "expected '$', got " + strconv.Quote(string(line))}
+		}
+		size, ok := parseLength(line[1:])
+		if !ok || size < 0 || (r.limits.MaxBulkLen > 0 && size > r.limits.MaxBulkLen) {
+			return nil, &reply.ProtocolErrReply{Msg: "invalid bulk length"}
+		}
+		total += size
+		if r.limits.QueryBufferLimit > 0 && total > r.limits.QueryBufferLimit {
+			return nil, &reply.ProtocolErrReply{Msg: "client query buffer limit reached"}
+		}
+		arg, err := r.readBulk(size)
+		if err != nil {
+			return nil, err
+		}
+		crlf, err := r.reader.Peek(2)
+		if err != nil {
+			return nil, err
+		}
+		if crlf[0] != '\r' || crlf[1] != '\n' {
+			return nil, &reply.ProtocolErrReply{Msg: "bulk string is not terminated by CRLF"}
+		}
+		_, _ = r.reader.Discard(2)
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// readBulk reads a bulk string of the given size without CRLF
+func (r *Reader) readBulk(size int) ([]byte, error) {
+	if size <= maxPreallocBulk {
+		arg := r.alloc(size)
+		if _, err := io.ReadFull(r.reader, arg); err != nil {
+			return nil, err
+		}
+		return arg, nil
+	}
+	// the buffer doubles as the data arrives
+	arg := make([]byte, 0, maxPreallocBulk)
+	for len(arg) < size {
+		if len(arg) == cap(arg) {
+			newCap := 2 * cap(arg)
+			if newCap > size {
+				newCap = size
+			}
+			grown := make([]byte, len(arg), newCap)
+			copy(grown, arg)
+			arg = grown
+		}
+		n, err := r.reader.Read(arg[len(arg):cap(arg)])
+		arg = arg[:len(arg)+n]
+		if err != nil {
+			return nil, err
+		}
+	}
+	return arg, nil
+}
+
+// ReadReply reads a reply of RESP2 or RESP3.
+// It returns *reply.ProtocolErrReply if the data breaks the protocol, other errors are io errors
+func (r *Reader) ReadReply() (resp.Reply, error) {
+	result, _, err := readReply(r.reader)
+	return result, err
+}
@@ -0,0 +1,144 @@
+package parser
+
+import (
+	"bytes"
+	"go-redis/resp/reply"
+	"strconv"
+	"testing"
+)
+
+// makePipeline returns n SET commands sent in a pipeline
+func makePipeline(n int) []byte {
+	var buf bytes.Buffer
+	value := bytes.Repeat([]byte("v"), 64)
+	for i := 0; i < n; i++ {
+		cmd := reply.MakeMultiBulkReply([][]byte{[]byte("SET"), []byte("key:" + strconv.Itoa(i)), value})
+		buf.Write(cmd.ToBytes())
+	}
+	return buf.Bytes()
+}
+
+const pipelineSize = 1000
+
+func BenchmarkParseCommandStream(b *testing.B) {
+	data := makePipeline(pipelineSize)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		count := 0
+		for payload := range ParseCommandStream(bytes.NewReader(data)) {
+			if payload.Err == nil {
+				count++
+			}
+		}
+		if count != pipelineSize {
+			b.Fatalf("expect %d commands, got %d", pipelineSize, count)
+		}
+	}
+}
+
+func BenchmarkReaderReadCommand(b *testing.B) {
+	data := makePipeline(pipelineSize)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		reader := NewReader(bytes.NewReader(data))
+		count := 0
+		for {
+			if _, err := reader.ReadCommand(); err != nil {
+				break
+			}
+			count++
+		}
+		reader.Release()
+		if count != pipelineSize {
+			b.Fatalf("expect %d commands, got %d", pipelineSize, count)
+		}
+	}
+}
+
+// makeReplies returns the replies of n HGETALL with 4 fields
+func makeReplies(n int) []byte {
+	var buf bytes.Buffer
+	fields := [][]byte{[]byte("f1"), []byte("v1"), []byte("f2"), []byte("v2"), []byte("f3"), []byte("v3"), []byte("f4"), []byte("v4")}
+	for i := 0; i < n; i++ {
+		buf.Write(reply.MakeMultiBulkReply(fields).ToBytes())
+	}
+	return buf.Bytes()
+}
+
+func BenchmarkParseStream(b *testing.B) {
+	data := makeReplies(pipelineSize)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		count := 0
+		for payload := range ParseStream(bytes.NewReader(data)) {
+			if payload.Err == nil {
+				count++
+			}
+		}
+		if count != pipelineSize {
+			b.Fatalf("expect %d replies, got %d", pipelineSize, count)
+		}
+	}
+}
+
+func BenchmarkReaderReadReply(b *testing.B) {
+	data := makeReplies(pipelineSize)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		reader := NewReader(bytes.NewReader(data))
+		count := 0
+		for {
+			if _, err := reader.ReadReply(); err != nil {
+				break
+			}
+			count++
+		}
+		reader.Release()
+		if count != pipelineSize {
+			b.Fatalf("expect %d replies, got %d", pipelineSize, count)
+		}
+	}
+}
+
+// TestReaderArena checks the arguments sliced out of the arena don't overlap
+func TestReaderArena(t *testing.T) {
+	big := bytes.Repeat([]byte("b"), maxArenaBulk+1)
+	data := append(makePipeline(2), reply.MakeMultiBulkReply([][]byte{[]byte("SET"), []byte("big"), big}).ToBytes()...)
+	reader := NewReader(bytes.NewReader(data))
+	defer reader.Release()
+
+	first, err := reader.ReadCommand()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := reader.ReadCommand()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, arg := range first {
+		if len(arg) != cap(arg) {
+			t.Fatalf("expect capacity limited to %d, got %d", len(arg), cap(arg))
+		}
+	}
+	// appending to an argument allocates new memory instead of overwriting the next one
+	_ = append(first[2], 'x')
+	if string(second[0]) != "SET" || string(second[1]) != "key:1" {
+		t.Fatalf("expect the second command unchanged, got %q", second)
+	}
+
+	third, err := reader.ReadCommand()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(third[2], big) {
+		t.Fatal("expect the big argument read")
+	}
+}
@@ -1,14 +1,11 @@
 package reply
 
 import (
-	"bytes"
 	"go-redis/interface/resp"
 	"strconv"
 )
 
 var (
-	nullBulkReplyBytes = []byte("$-1")
-
 	// CRLF is the line separator of redis serialization protocol
 	CRLF = "\r\n"
 )
@@ -27,12 +24,14 @@ func MakeBulkReply(arg []byte) *BulkReply {
 	}
 }
 
-// ToBytes marshal redis.Reply
+// ToBytes marshal redis.Reply, nil Arg is encoded as null bulk string and empty Arg as empty string
 func (r *BulkReply) ToBytes() []byte {
-	if len(r.Arg) == 0 {
-		return nullBulkReplyBytes
-	}
-	return []byte("$" + strconv.Itoa(len(r.Arg)) + CRLF + string(r.Arg) + CRLF)
+	return r.AppendTo(nil, 2)
+}
+
+// AppendTo appends the bulk string to buf
+func (r *BulkReply) AppendTo(buf []byte, protocol int) []byte {
+	return appendBulk(buf, r.Arg, protocol)
 }
 
 /* ---- Multi Bulk Reply ---- */
@@ -51,17 +50,41 @@ func MakeMultiBulkReply(args [][]byte) *MultiBulkReply {
 
 // ToBytes marshal redis.Reply
 func (r *MultiBulkReply) ToBytes() []byte {
-	argLen := len(r.Args)
-	var buf bytes.Buffer
-	buf.WriteString("*" + strconv.Itoa(argLen) + CRLF)
+	return r.AppendTo(nil, 2)
+}
+
+// AppendTo appends the array of bulk strings to buf
+func (r *MultiBulkReply) AppendTo(buf []byte, protocol int) []byte {
+	buf = appendHeader(buf, '*', len(r.Args))
 	for _, arg := range r.Args {
-		if arg == nil {
-			buf.WriteString("$-1" + CRLF)
-		} else {
-			buf.WriteString("$" + strconv.Itoa(len(arg)) + CRLF + string(arg) + CRLF)
-		}
+		buf = appendBulk(buf, arg, protocol)
+	}
+	return buf
+}
+
+/* ---- Multi Raw Reply ---- */
+
+// MultiRawReply stores a list of replies of any type, for example LPOS with COUNT
+// 存储由任意类型的 reply 组成的数组
+type MultiRawReply struct {
+	Replies []resp.Reply
+}
+
+// MakeMultiRawReply creates MultiRawReply
+func MakeMultiRawReply(replies []resp.Reply) *MultiRawReply {
+	return &MultiRawReply{
+		Replies: replies,
 	}
-	return buf.Bytes()
+}
+
+// ToBytes marshal redis.Reply
+func (r *MultiRawReply) ToBytes() []byte {
+	return r.AppendTo(nil, 2)
+}
+
+// AppendTo appends the array to buf, the elements are marshaled in the same protocol version
+func (r *MultiRawReply) AppendTo(buf []byte, protocol int) []byte {
+	return appendAggregate(buf, '*', len(r.Replies), r.Replies, protocol)
 }
 
 /* ---- Status Reply ---- */
@@ -83,6 +106,13 @@ func (r *StatusReply) ToBytes() []byte {
 	return []byte("+" + r.Status + CRLF)
 }
 
+// AppendTo appends the status to buf
+func (r *StatusReply) AppendTo(buf []byte, protocol int) []byte {
+	buf = append(buf, '+')
+	buf = append(buf, r.Status...)
+	return append(buf, CRLF...)
+}
+
 /* ---- Int Reply ---- */
 
 // IntReply stores an int64 number
@@ -102,6 +132,13 @@ func (r *IntReply) ToBytes() []byte {
 	return []byte(":" + strconv.FormatInt(r.Code, 10) + CRLF)
 }
 
+// AppendTo appends the integer to buf
+func (r *IntReply) AppendTo(buf []byte, protocol int) []byte {
+	buf = append(buf, ':')
+	buf = strconv.AppendInt(buf, r.Code, 10)
+	return append(buf, CRLF...)
+}
+
 /* ---- Error Reply ---- */
 
 // ErrorReply is an error and redis.Reply
@@ -120,6 +157,13 @@ func (r *StandardErrReply) ToBytes() []byte {
 	return []byte("-" + r.Status + CRLF)
 }
 
+// AppendTo appends the error to buf
+func (r *StandardErrReply) AppendTo(buf []byte, protocol int) []byte {
+	buf = append(buf, '-')
+	buf = append(buf, r.Status...)
+	return append(buf, CRLF...)
+}
+
 func (r *StandardErrReply) Error() string {
 	return r.Status
 }
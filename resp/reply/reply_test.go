@@ -0,0 +1,74 @@
+package reply
+
+import (
+	"go-redis/interface/resp"
+	"testing"
+)
+
+// TestBulkEncoding checks nil is encoded as null bulk string, while empty string is a bulk string of length 0
+func TestBulkEncoding(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply resp.Reply
+		want  string
+	}{
+		{"nil bulk", MakeBulkReply(nil), "$-1\r\n"},
+		{"empty bulk", MakeBulkReply([]byte{}), "$0\r\n\r\n"},
+		{"bulk", MakeBulkReply([]byte("a")), "$1\r\na\r\n"},
+		{"binary safe bulk", MakeBulkReply([]byte("a\r\nb")), "$4\r\na\r\nb\r\n"},
+		{"null bulk", MakeNullBulkReply(), "$-1\r\n"},
+		{"multi bulk with nil and empty", MakeMultiBulkReply([][]byte{[]byte("a"), nil, {}}), "*3\r\n$1\r\na\r\n$-1\r\n$0\r\n\r\n"},
+		{"empty multi bulk", MakeMultiBulkReply([][]byte{}), "*0\r\n"},
+	}
+	for _, tt := range tests {
+		if got := string(tt.reply.ToBytes()); got != tt.want {
+			t.Errorf("%s: expect %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+// TestAppendTo checks AppendTo keeps the content of buf and encodes the same bytes as ToBytes
+func TestAppendTo(t *testing.T) {
+	replies := []resp.Reply{
+		MakeBulkReply([]byte("a")),
+		MakeBulkReply(nil),
+		MakeMultiBulkReply([][]byte{[]byte("a"), nil, {}}),
+		MakeMultiRawReply([]resp.Reply{MakeIntReply(1), MakeBulkSetReply([][]byte{[]byte("m")}), MakeNullReply()}),
+		MakeStatusReply("OK"),
+		MakeIntReply(42),
+		MakeErrReply("ERR bad"),
+		MakeBulkMapReply([][]byte{[]byte("k"), []byte("v")}),
+		MakeBulkSetReply([][]byte{[]byte("a"), nil}),
+		// the replies not implementing resp.AppendReply fall back to ToBytes
+		MakeDoubleReply(1.5),
+		MakeBoolReply(true),
+		MakeOkReply(),
+		MakeNullMultiBulkReply(),
+	}
+	for _, protocol := range []int{2, 3} {
+		var want []byte
+		buf := []byte("prefix")
+		want = append(want, buf...)
+		for _, r := range replies {
+			before := len(buf)
+			buf = AppendTo(buf, r, protocol)
+			encoded := ToBytes(r, protocol)
+			if got := string(buf[before:]); got != string(encoded) {
+				t.Errorf("RESP%d %T: expect %q, got %q", protocol, r, encoded, got)
+			}
+			want = append(want, encoded...)
+		}
+		if string(buf) != string(want) {
+			t.Errorf("RESP%d: expect %q, got %q", protocol, want, buf)
+		}
+	}
+
+	// appending into a buffer with enough capacity doesn't allocate
+	buf := make([]byte, 0, 1024)
+	r := MakeMultiBulkReply([][]byte{[]byte("a"), []byte("b")})
+	if allocs := testing.AllocsPerRun(100, func() {
+		buf = AppendTo(buf[:0], r, 3)
+	}); allocs != 0 {
+		t.Errorf("expect no allocation, got %v", allocs)
+	}
+}
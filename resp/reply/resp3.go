@@ -0,0 +1,371 @@
+package reply
+
+import (
+	"go-redis/interface/resp"
+	"math"
+	"strconv"
+)
+
+// replies of RESP3, they are encoded as the closest RESP2 type by ToBytes,
+// so that clients which never send HELLO 3 get the same output as before
+// RESP3 协议的回复类型，ToBytes 输出与之对应的 RESP2 格式，ToBytes3 输出 RESP3 格式
+
+var nullBytes = []byte("_\r\n")
+
+// ToBytes marshals the reply in the given protocol version, 2 or 3
+func ToBytes(r resp.Reply, protocol int) []byte {
+	if protocol == 3 {
+		if r3, ok := r.(resp.Resp3Reply); ok {
+			return r3.ToBytes3()
+		}
+	}
+	return r.ToBytes()
+}
+
+// AppendTo appends the reply in the given protocol version to buf.
+// The replies implementing resp.AppendReply are marshaled in place, the others fall back to ToBytes
+// 将回复序列化到 buf 末尾，实现了 resp.AppendReply 的类型无需分配中间结果
+func AppendTo(buf []byte, r resp.Reply, protocol int) []byte {
+	if ar, ok := r.(resp.AppendReply); ok {
+		return ar.AppendTo(buf, protocol)
+	}
+	return append(buf, ToBytes(r, protocol)...)
+}
+
+// appendHeader appends a line like `*3\r\n` or `$5\r\n`
+func appendHeader(buf []byte, prefix byte, size int) []byte {
+	buf = append(buf, prefix)
+	buf = strconv.AppendInt(buf, int64(size), 10)
+	return append(buf, CRLF...)
+}
+
+// appendBulk appends a bulk string, nil is marshaled as null of the protocol version
+func appendBulk(buf []byte, arg []byte, protocol int) []byte {
+	if arg == nil {
+		if protocol == 3 {
+			return append(buf, nullBytes...)
+		}
+		return append(buf, nullBulkBytes...)
+	}
+	buf = appendHeader(buf, '$', len(arg))
+	buf = append(buf, arg...)
+	return append(buf, CRLF...)
+}
+
+// appendAggregate appends an aggregate type whose elements are encoded in the same protocol version
+func appendAggregate(buf []byte, prefix byte, size int, elements []resp.Reply, protocol int) []byte {
+	buf = appendHeader(buf, prefix, size)
+	for _, element := range elements {
+		buf = AppendTo(buf, element, protocol)
+	}
+	return buf
+}
+
+// aggregateToBytes marshals an aggregate type whose elements are encoded in the same protocol version
+func aggregateToBytes(prefix byte, size int, elements []resp.Reply, protocol int) []byte {
+	return appendAggregate(nil, prefix, size, elements, protocol)
+}
+
+// bulkReplies converts strings to bulk replies, nil is converted to null
+func bulkReplies(args [][]byte) []resp.Reply {
+	replies := make([]resp.Reply, len(args))
+	for i, arg := range args {
+		replies[i] = MakeBulkReply(arg)
+	}
+	return replies
+}
+
+/* ---- RESP3 encoding of RESP2 types ---- */
+
+// ToBytes3 marshals null bulk string as RESP3 null
+func (r *BulkReply) ToBytes3() []byte {
+	if r.Arg == nil {
+		return nullBytes
+	}
+	return r.ToBytes()
+}
+
+// ToBytes3 marshals the nil elements as RESP3 null
+func (r *MultiBulkReply) ToBytes3() []byte {
+	return r.AppendTo(nil, 3)
+}
+
+// ToBytes3 marshals the elements in RESP3
+func (r *MultiRawReply) ToBytes3() []byte {
+	return r.AppendTo(nil, 3)
+}
+
+// ToBytes3 marshals RESP3 null
+func (r *NullBulkReply) ToBytes3() []byte {
+	return nullBytes
+}
+
+// ToBytes3 marshals RESP3 null
+func (r *NullMultiBulkReply) ToBytes3() []byte {
+	return nullBytes
+}
+
+/* ---- Null Reply ---- */
+
+// NullReply is the null of RESP3, it is encoded as null bulk string in RESP2
+type NullReply struct{}
+
+// MakeNullReply creates NullReply
+func MakeNullReply() *NullReply {
+	return &NullReply{}
+}
+
+// ToBytes marshals null bulk string
+func (r *NullReply) ToBytes() []byte {
+	return nullBulkBytes
+}
+
+// ToBytes3 marshals RESP3 null
+func (r *NullReply) ToBytes3() []byte {
+	return nullBytes
+}
+
+/* ---- Map Reply ---- */
+
+// MapReply stores key-value pairs, it is encoded as a flat array in RESP2
+type MapReply struct {
+	// Entries are keys and values in turn: k1 v1 k2 v2 ...
+	Entries []resp.Reply
+}
+
+// MakeMapReply creates MapReply from keys and values in turn
+func MakeMapReply(entries []resp.Reply) *MapReply {
+	return &MapReply{
+		Entries: entries,
+	}
+}
+
+// MakeBulkMapReply creates MapReply from string keys and values in turn, eg. the reply of HGETALL
+func MakeBulkMapReply(args [][]byte) *MapReply {
+	return MakeMapReply(bulkReplies(args))
+}
+
+// ToBytes marshals a flat array
+func (r *MapReply) ToBytes() []byte {
+	return aggregateToBytes('*', len(r.Entries), r.Entries, 2)
+}
+
+// ToBytes3 marshals RESP3 map
+func (r *MapReply) ToBytes3() []byte {
+	return aggregateToBytes('%', len(r.Entries)/2, r.Entries, 3)
+}
+
+// AppendTo appends the map to buf
+func (r *MapReply) AppendTo(buf []byte, protocol int) []byte {
+	if protocol == 3 {
+		return appendAggregate(buf, '%', len(r.Entries)/2, r.Entries, 3)
+	}
+	return appendAggregate(buf, '*', len(r.Entries), r.Entries, 2)
+}
+
+/* ---- Set Reply ---- */
+
+// SetReply stores unordered unique elements, it is encoded as array in RESP2
+type SetReply struct {
+	Members []resp.Reply
+}
+
+// MakeSetReply creates SetReply
+func MakeSetReply(members []resp.Reply) *SetReply {
+	return &SetReply{
+		Members: members,
+	}
+}
+
+// MakeBulkSetReply creates SetReply of strings, eg. the reply of SMEMBERS
+func MakeBulkSetReply(args [][]byte) *SetReply {
+	return MakeSetReply(bulkReplies(args))
+}
+
+// ToBytes marshals array
+func (r *SetReply) ToBytes() []byte {
+	return aggregateToBytes('*', len(r.Members), r.Members, 2)
+}
+
+// ToBytes3 marshals RESP3 set
+func (r *SetReply) ToBytes3() []byte {
+	return aggregateToBytes('~', len(r.Members), r.Members, 3)
+}
+
+// AppendTo appends the set to buf
+func (r *SetReply) AppendTo(buf []byte, protocol int) []byte {
+	if protocol == 3 {
+		return appendAggregate(buf, '~', len(r.Members), r.Members, 3)
+	}
+	return appendAggregate(buf, '*', len(r.Members), r.Members, 2)
+}
+
+/* ---- Push Reply ---- */
+
+// PushReply is the out of band data sent to client, eg. messages of pub/sub, it is encoded as array in RESP2
+type PushReply struct {
+	Elements []resp.Reply
+}
+
+// MakePushReply creates PushReply
+func MakePushReply(elements []resp.Reply) *PushReply {
+	return &PushReply{
+		Elements: elements,
+	}
+}
+
+// ToBytes marshals array
+func (r *PushReply) ToBytes() []byte {
+	return aggregateToBytes('*', len(r.Elements), r.Elements, 2)
+}
+
+// ToBytes3 marshals RESP3 push
+func (r *PushReply) ToBytes3() []byte {
+	return aggregateToBytes('>', len(r.Elements), r.Elements, 3)
+}
+
+/* ---- Attribute Reply ---- */
+
+// AttributeReply attaches auxiliary key-value pairs to a reply, the attributes are dropped in RESP2
+type AttributeReply struct {
+	// Attributes are keys and values in turn
+	Attributes []resp.Reply
+	Reply      resp.Reply
+}
+
+// MakeAttributeReply creates AttributeReply
+func MakeAttributeReply(attributes []resp.Reply, reply resp.Reply) *AttributeReply {
+	return &AttributeReply{
+		Attributes: attributes,
+		Reply:      reply,
+	}
+}
+
+// ToBytes marshals the reply without attributes
+func (r *AttributeReply) ToBytes() []byte {
+	return r.Reply.ToBytes()
+}
+
+// ToBytes3 marshals RESP3 attributes followed by the reply
+func (r *AttributeReply) ToBytes3() []byte {
+	attributes := aggregateToBytes('|', len(r.Attributes)/2, r.Attributes, 3)
+	return append(attributes, ToBytes(r.Reply, 3)...)
+}
+
+/* ---- Double Reply ---- */
+
+// DoubleReply stores a float number, it is encoded as bulk string in RESP2
+type DoubleReply struct {
+	Value float64
+}
+
+// MakeDoubleReply creates DoubleReply
+func MakeDoubleReply(value float64) *DoubleReply {
+	return &DoubleReply{
+		Value: value,
+	}
+}
+
+func (r *DoubleReply) format() string {
+	switch {
+	case math.IsInf(r.Value, 1):
+		return "inf"
+	case math.IsInf(r.Value, -1):
+		return "-inf"
+	case math.IsNaN(r.Value):
+		return "nan"
+	}
+	return strconv.FormatFloat(r.Value, 'f', -1, 64)
+}
+
+// ToBytes marshals bulk string
+func (r *DoubleReply) ToBytes() []byte {
+	return MakeBulkReply([]byte(r.format())).ToBytes()
+}
+
+// ToBytes3 marshals RESP3 double
+func (r *DoubleReply) ToBytes3() []byte {
+	return []byte("," + r.format() + CRLF)
+}
+
+/* ---- Bool Reply ---- */
+
+// BoolReply stores a boolean, it is encoded as integer 1 or 0 in RESP2
+type BoolReply struct {
+	Value bool
+}
+
+// MakeBoolReply creates BoolReply
+func MakeBoolReply(value bool) *BoolReply {
+	return &BoolReply{
+		Value: value,
+	}
+}
+
+// ToBytes marshals integer
+func (r *BoolReply) ToBytes() []byte {
+	if r.Value {
+		return []byte(":1" + CRLF)
+	}
+	return []byte(":0" + CRLF)
+}
+
+// ToBytes3 marshals RESP3 boolean
+func (r *BoolReply) ToBytes3() []byte {
+	if r.Value {
+		return []byte("#t" + CRLF)
+	}
+	return []byte("#f" + CRLF)
+}
+
+/* ---- Big Number Reply ---- */
+
+// BigNumberReply stores an integer out of the range of int64 in decimal, it is encoded as bulk string in RESP2
+type BigNumberReply struct {
+	Value string
+}
+
+// MakeBigNumberReply creates BigNumberReply
+func MakeBigNumberReply(value string) *BigNumberReply {
+	return &BigNumberReply{
+		Value: value,
+	}
+}
+
+// ToBytes marshals bulk string
+func (r *BigNumberReply) ToBytes() []byte {
+	return MakeBulkReply([]byte(r.Value)).ToBytes()
+}
+
+// ToBytes3 marshals RESP3 big number
+func (r *BigNumberReply) ToBytes3() []byte {
+	return []byte("(" + r.Value + CRLF)
+}
+
+/* ---- Verbatim String Reply ---- */
+
+// VerbatimStringReply stores a string with its format, eg. txt or mkd, it is encoded as bulk string in RESP2
+type VerbatimStringReply struct {
+	// Format is exactly 3 bytes
+	Format string
+	Value  []byte
+}
+
+// MakeVerbatimStringReply creates VerbatimStringReply
+func MakeVerbatimStringReply(format string, value []byte) *VerbatimStringReply {
+	return &VerbatimStringReply{
+		Format: format,
+		Value:  value,
+	}
+}
+
+// ToBytes marshals bulk string
+func (r *VerbatimStringReply) ToBytes() []byte {
+	return MakeBulkReply(r.Value).ToBytes()
+}
+
+// ToBytes3 marshals RESP3 verbatim string
+func (r *VerbatimStringReply) ToBytes3() []byte {
+	size := len(r.Format) + 1 + len(r.Value)
+	return []byte("=" + strconv.Itoa(size) + CRLF + r.Format + ":" + string(r.Value) + CRLF)
+}
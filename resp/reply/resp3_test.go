@@ -0,0 +1,78 @@
+package reply
+
+import (
+	"go-redis/interface/resp"
+	"math"
+	"testing"
+)
+
+// TestResp3Encoding checks the encoding of replies in RESP3, and the RESP2 fallback of the same replies
+func TestResp3Encoding(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply resp.Reply
+		want2 string
+		want3 string
+	}{
+		{"null", MakeNullReply(), "$-1\r\n", "_\r\n"},
+		{"null bulk", MakeNullBulkReply(), "$-1\r\n", "_\r\n"},
+		{"nil bulk", MakeBulkReply(nil), "$-1\r\n", "_\r\n"},
+		{"empty bulk", MakeBulkReply([]byte{}), "$0\r\n\r\n", "$0\r\n\r\n"},
+		{"null multi bulk", MakeNullMultiBulkReply(), "*-1\r\n", "_\r\n"},
+		{"multi bulk with nil", MakeMultiBulkReply([][]byte{[]byte("a"), nil}), "*2\r\n$1\r\na\r\n$-1\r\n", "*2\r\n$1\r\na\r\n_\r\n"},
+		{
+			name:  "map",
+			reply: MakeBulkMapReply([][]byte{[]byte("k1"), []byte("v1"), []byte("k2"), nil}),
+			want2: "*4\r\n$2\r\nk1\r\n$2\r\nv1\r\n$2\r\nk2\r\n$-1\r\n",
+			want3: "%2\r\n$2\r\nk1\r\n$2\r\nv1\r\n$2\r\nk2\r\n_\r\n",
+		},
+		{"empty map", MakeMapReply(nil), "*0\r\n", "%0\r\n"},
+		{
+			name:  "map of mixed types",
+			reply: MakeMapReply([]resp.Reply{MakeBulkReply([]byte("n")), MakeIntReply(1), MakeBulkReply([]byte("ok")), MakeBoolReply(true)}),
+			want2: "*4\r\n$1\r\nn\r\n:1\r\n$2\r\nok\r\n:1\r\n",
+			want3: "%2\r\n$1\r\nn\r\n:1\r\n$2\r\nok\r\n#t\r\n",
+		},
+		{"set", MakeBulkSetReply([][]byte{[]byte("a"), []byte("b")}), "*2\r\n$1\r\na\r\n$1\r\nb\r\n", "~2\r\n$1\r\na\r\n$1\r\nb\r\n"},
+		{"empty set", MakeSetReply(nil), "*0\r\n", "~0\r\n"},
+		{
+			name:  "nested aggregates",
+			reply: MakeMultiRawReply([]resp.Reply{MakeBulkSetReply([][]byte{[]byte("a")}), MakeNullReply(), MakeDoubleReply(0.5)}),
+			want2: "*3\r\n*1\r\n$1\r\na\r\n$-1\r\n$3\r\n0.5\r\n",
+			want3: "*3\r\n~1\r\n$1\r\na\r\n_\r\n,0.5\r\n",
+		},
+		{"double", MakeDoubleReply(3.25), "$4\r\n3.25\r\n", ",3.25\r\n"},
+		{"integral double", MakeDoubleReply(10), "$2\r\n10\r\n", ",10\r\n"},
+		{"negative double", MakeDoubleReply(-0.125), "$6\r\n-0.125\r\n", ",-0.125\r\n"},
+		{"inf", MakeDoubleReply(math.Inf(1)), "$3\r\ninf\r\n", ",inf\r\n"},
+		{"-inf", MakeDoubleReply(math.Inf(-1)), "$4\r\n-inf\r\n", ",-inf\r\n"},
+		{"nan", MakeDoubleReply(math.NaN()), "$3\r\nnan\r\n", ",nan\r\n"},
+		{"true", MakeBoolReply(true), ":1\r\n", "#t\r\n"},
+		{"false", MakeBoolReply(false), ":0\r\n", "#f\r\n"},
+		{"big number", MakeBigNumberReply("3492890328409238509324850943850943825024385"), "$43\r\n3492890328409238509324850943850943825024385\r\n", "(3492890328409238509324850943850943825024385\r\n"},
+		{"verbatim", MakeVerbatimStringReply("txt", []byte("a\r\nb")), "$4\r\na\r\nb\r\n", "=8\r\ntxt:a\r\nb\r\n"},
+		{"empty verbatim", MakeVerbatimStringReply("mkd", []byte{}), "$0\r\n\r\n", "=4\r\nmkd:\r\n"},
+		{"push", MakePushReply([]resp.Reply{MakeBulkReply([]byte("message")), MakeIntReply(1)}), "*2\r\n$7\r\nmessage\r\n:1\r\n", ">2\r\n$7\r\nmessage\r\n:1\r\n"},
+		{
+			name:  "attribute",
+			reply: MakeAttributeReply([]resp.Reply{MakeBulkReply([]byte("ttl")), MakeIntReply(10)}, MakeBulkReply([]byte("v"))),
+			want2: "$1\r\nv\r\n",
+			want3: "|1\r\n$3\r\nttl\r\n:10\r\n$1\r\nv\r\n",
+		},
+		// the RESP2 types are encoded the same way in RESP3
+		{"status", MakeStatusReply("OK"), "+OK\r\n", "+OK\r\n"},
+		{"int", MakeIntReply(-1), ":-1\r\n", ":-1\r\n"},
+		{"error", MakeErrReply("ERR bad"), "-ERR bad\r\n", "-ERR bad\r\n"},
+	}
+	for _, tt := range tests {
+		if got := string(tt.reply.ToBytes()); got != tt.want2 {
+			t.Errorf("%s: expect RESP2 %q, got %q", tt.name, tt.want2, got)
+		}
+		if got := string(ToBytes(tt.reply, 2)); got != tt.want2 {
+			t.Errorf("%s: expect RESP2 %q, got %q", tt.name, tt.want2, got)
+		}
+		if got := string(ToBytes(tt.reply, 3)); got != tt.want3 {
+			t.Errorf("%s: expect RESP3 %q, got %q", tt.name, tt.want3, got)
+		}
+	}
+}
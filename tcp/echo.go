@@ -44,6 +44,7 @@ func (h *EchoHandler) Handle(ctx context.Context, conn net.Conn) {
 	if h.closing.Get() {
 		// closing handler refuse new connection
 		_ = conn.Close()
+		return
 	}
 
 	client := &EchoClient{
@@ -60,7 +61,7 @@ func (h *EchoHandler) Handle(ctx context.Context, conn net.Conn) {
 			if err == io.EOF {
 				logger.Info("client closed connection")
 			} else {
-				logger.Warn("read from client failed: %s", err)
+				logger.Warn("read from client failed: " + err.Error())
 			}
 			break
 		}
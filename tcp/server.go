@@ -13,21 +13,24 @@ import (
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
-	"time"
 )
 
 // Config stores tcp handler properties
 type Config struct {
-	Address    string        `yaml:"address"`
-	MaxConnect uint32        `yaml:"max-connect"`
-	Timeout    time.Duration `yaml:"timeout"`
+	Address string `yaml:"address"`
+	// connections beyond MaxConnect are rejected, 0 means no limit
+	MaxConnect uint32 `yaml:"max-connect"`
 }
 
+// maxClientsErrBytes is sent to the connection rejected by MaxConnect
+var maxClientsErrBytes = []byte("-ERR max number of clients reached\r\n")
+
 // ListenAndServeWithSignal binds port and handle requests, blocking until receive stop signal
 func ListenAndServeWithSignal(cfg *Config, handler tcp.Handler) error {
 	closeChan := make(chan struct{})
-	sigCh := make(chan os.Signal)
+	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT)
 	go func() {
 		sig := <-sigCh
@@ -41,12 +44,12 @@ func ListenAndServeWithSignal(cfg *Config, handler tcp.Handler) error {
 		return err
 	}
 	logger.Info(fmt.Sprintf("bind: %s, start listening...", cfg.Address))
-	ListenAndServe(listener, handler, closeChan)
+	ListenAndServe(listener, handler, cfg, closeChan)
 	return nil
 }
 
 // ListenAndServe binds port and handle requests, blocking until close
-func ListenAndServe(listener net.Listener, handler tcp.Handler, closeChan <-chan struct{}) {
+func ListenAndServe(listener net.Listener, handler tcp.Handler, cfg *Config, closeChan <-chan struct{}) {
 	// listen signal
 	go func() {
 		<-closeChan
@@ -63,16 +66,26 @@ func ListenAndServe(listener net.Listener, handler tcp.Handler, closeChan <-chan
 	}()
 	ctx := context.Background()
 	var waitDone sync.WaitGroup
+	// number of connections being handled
+	var clientCount int32
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
 			break
 		}
+		if cfg.MaxConnect > 0 && atomic.LoadInt32(&clientCount) >= int32(cfg.MaxConnect) {
+			logger.Warn("max number of clients reached, reject " + conn.RemoteAddr().String())
+			_, _ = conn.Write(maxClientsErrBytes)
+			_ = conn.Close()
+			continue
+		}
 		// handle
 		logger.Info("accept link")
+		atomic.AddInt32(&clientCount, 1)
 		waitDone.Add(1)
 		go func() {
 			defer func() {
+				atomic.AddInt32(&clientCount, -1)
 				waitDone.Done()
 			}()
 			handler.Handle(ctx, conn)
@@ -0,0 +1,82 @@
+package tcp
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// dialEcho connects to the echo server and checks the connection is served
+func dialEcho(t *testing.T, addr string) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	_ = conn.SetDeadline(time.Now().Add(3 * time.Second))
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || line != "ping\n" {
+		t.Fatalf("expect echo, got %q %v", line, err)
+	}
+	return conn
+}
+
+func TestMaxConnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeChan := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		ListenAndServe(listener, MakeHandler(), &Config{MaxConnect: 2}, closeChan)
+		close(done)
+	}()
+	defer func() {
+		close(closeChan)
+		<-done
+	}()
+	addr := listener.Addr().String()
+
+	first := dialEcho(t, addr)
+	dialEcho(t, addr)
+	rejected, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = rejected.SetDeadline(time.Now().Add(3 * time.Second))
+	data, err := io.ReadAll(rejected)
+	_ = rejected.Close()
+	if err != nil || string(data) != "-ERR max number of clients reached\r\n" {
+		t.Fatalf("expect max clients error and closed, got %q %v", data, err)
+	}
+
+	// the slot is released after a client leaves
+	_ = first.Close()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.SetDeadline(time.Now().Add(time.Second))
+		_, _ = conn.Write([]byte("ping\n"))
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		_ = conn.Close()
+		if line == "ping\n" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expect the new client served after one left, got %q", line)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}